@@ -193,6 +193,7 @@ func NewFs(name, root string) (fs.Fs, error) {
 	f.features = (&fs.Features{
 		CaseInsensitive:         true,
 		ReadMimeType:            true,
+		ListMimeType:            true,
 		CanHaveEmptyDirectories: true,
 	}).Fill(f)
 
@@ -216,8 +216,10 @@ func NewFs(name, root string) (fs.Fs, error) {
 	}
 	f.features = (&fs.Features{
 		ReadMimeType:  true,
+		ListMimeType:  true,
 		WriteMimeType: true,
 		BucketBased:   true,
+		SeekOpen:      true,
 	}).Fill(f)
 	if f.root != "" {
 		f.root += "/"
@@ -257,6 +257,7 @@ func NewFs(name, root string) (fs.Fs, error) {
 	}
 	f.features = (&fs.Features{
 		ReadMimeType:  true,
+		ListMimeType:  true,
 		WriteMimeType: true,
 		BucketBased:   true,
 	}).Fill(f)
@@ -0,0 +1,94 @@
+package about
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/ncw/rclone/cmd"
+	"github.com/ncw/rclone/fs"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var (
+	jsonOutput bool
+)
+
+func init() {
+	cmd.Root.AddCommand(commandDefintion)
+	commandDefintion.Flags().BoolVarP(&jsonOutput, "json", "", false, "Format output as JSON")
+}
+
+var commandDefintion = &cobra.Command{
+	Use:   "about remote:",
+	Short: `Get quota information from the remote.`,
+	Long: `
+Get quota information from the remote, like bytes used/free/quota and
+bytes used in the trash.  Not supported by all remotes.
+
+This will print to stdout something like this:
+
+    Total:   17G
+    Used:    7.444G
+    Free:    1.315G
+    Trashed: 100M
+    Other:   8.241G
+    Objects: 1234
+
+Where the fields are:
+
+  * Total: total size available.
+  * Used: total size used
+  * Free: total amount this user could upload.
+  * Trashed: total amount in the trash
+  * Other: total amount in other storage (eg Gmail, Google Photos)
+  * Objects: total number of objects in the storage
+
+Not all backends print all fields.  Information is not included if it
+is not provided by a backend.  Where the value is unlimited it is
+omitted.
+
+Use the --json flag for output which is easy to parse in scripts.
+This prints the values in bytes, eg
+
+    {
+    	"total": 18253611008,
+    	"used": 7993453766,
+    	"free": 1411001220
+    }
+`,
+	Run: func(command *cobra.Command, args []string) {
+		cmd.CheckArgs(1, 1, command, args)
+		f := cmd.NewFsSrc(args)
+		cmd.Run(false, false, command, func() error {
+			doAbout := f.Features().About
+			if doAbout == nil {
+				return errors.Errorf("%v doesn't support about", f)
+			}
+			u, err := doAbout()
+			if err != nil {
+				return errors.Wrap(err, "About call failed")
+			}
+			if jsonOutput {
+				out := json.NewEncoder(os.Stdout)
+				out.SetIndent("", "\t")
+				return out.Encode(u)
+			}
+			printValue := func(what string, value *int64) {
+				if value != nil {
+					fmt.Printf("%-9s%v\n", what+":", fs.SizeSuffix(*value))
+				}
+			}
+			printValue("Total", u.Total)
+			printValue("Used", u.Used)
+			printValue("Free", u.Free)
+			printValue("Trashed", u.Trashed)
+			printValue("Other", u.Other)
+			if u.Objects != nil {
+				fmt.Printf("%-9s%d\n", "Objects:", *u.Objects)
+			}
+			return nil
+		})
+	},
+}
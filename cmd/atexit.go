@@ -6,6 +6,7 @@ import (
 	"os"
 	"os/signal"
 	"sync"
+	"sync/atomic"
 
 	"github.com/ncw/rclone/fs"
 )
@@ -14,6 +15,7 @@ var (
 	atExitFns          []func()
 	atExitOnce         sync.Once
 	atExitRegisterOnce sync.Once
+	handlingInterrupts int32 // non zero while handleInterrupts is active
 )
 
 // AtExit registers a function to be added on exit
@@ -25,7 +27,13 @@ func AtExit(fn func()) {
 		go func() {
 			ch := make(chan os.Signal, 1)
 			signal.Notify(ch, os.Interrupt) // syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT
-			sig := <-ch
+			var sig os.Signal
+			for sig = range ch {
+				// Leave the signal to handleInterrupts if active
+				if atomic.LoadInt32(&handlingInterrupts) == 0 {
+					break
+				}
+			}
 			fs.Infof(nil, "Signal received: %s", sig)
 			runAtExitFunctions()
 			fs.Infof(nil, "Exiting...")
@@ -43,3 +51,45 @@ func runAtExitFunctions() {
 		}
 	})
 }
+
+// handleInterrupts stops the command gracefully on SIGINT.
+//
+// The first interrupt asks any syncs to stop starting new transfers
+// and wait for the ones in progress to finish.  A second interrupt,
+// or the first if nothing which can stop gracefully is running, runs
+// the AtExit functions and exits immediately.
+//
+// It returns a function which should be called to stop handling the
+// interrupts.
+func handleInterrupts() func() {
+	atomic.StoreInt32(&handlingInterrupts, 1)
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, os.Interrupt)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-ch:
+			case <-done:
+				return
+			}
+			if !fs.StopRequested() && fs.Stoppable() {
+				fs.Logf(nil, "Interrupt received - waiting for transfers in progress to finish - press Ctrl-C again to abort")
+				fs.RequestStop()
+				continue
+			}
+			if fs.StopRequested() {
+				fs.Logf(nil, "Interrupt received again - aborting")
+			} else {
+				fs.Logf(nil, "Interrupt received - aborting")
+			}
+			runAtExitFunctions()
+			os.Exit(exitCodeInterrupted)
+		}
+	}()
+	return func() {
+		signal.Stop(ch)
+		close(done)
+		atomic.StoreInt32(&handlingInterrupts, 0)
+	}
+}
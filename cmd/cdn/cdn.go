@@ -0,0 +1,54 @@
+package cdn
+
+import (
+	"time"
+
+	"github.com/ncw/rclone/cmd"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var (
+	disable bool
+	ttl     time.Duration
+)
+
+func init() {
+	cmd.Root.AddCommand(commandDefintion)
+	commandDefintion.Flags().BoolVarP(&disable, "disable", "", false, "Disable CDN access instead of enabling it")
+	commandDefintion.Flags().DurationVarP(&ttl, "ttl", "", 0, "How long the CDN caches objects for (default 72h)")
+}
+
+// cdnSetter is implemented by remotes which can enable CDN access
+type cdnSetter interface {
+	SetCDN(enabled bool, ttl time.Duration) error
+}
+
+var commandDefintion = &cobra.Command{
+	Use:   "cdn remote:container",
+	Short: `Enable or disable CDN access to a container.`,
+	Long: `
+This enables CDN access to the container so objects in it can be read
+by anyone through the CDN.  Use --ttl to set how long the CDN caches
+objects for, and run it again to change it.  Use --disable to turn CDN
+access off again.
+
+    rclone cdn --ttl 24h remote:container
+
+Once the container is CDN enabled "rclone link" gives the CDN links to
+the objects in it.
+
+This is only supported by swift on Rackspace Cloud Files.
+`,
+	Run: func(command *cobra.Command, args []string) {
+		cmd.CheckArgs(1, 1, command, args)
+		f := cmd.NewFsSrc(args)
+		cmd.Run(false, false, command, func() error {
+			do, ok := f.(cdnSetter)
+			if !ok {
+				return errors.Errorf("%v doesn't support CDN", f)
+			}
+			return do.SetCDN(!disable, ttl)
+		})
+	},
+}
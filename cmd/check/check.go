@@ -1,19 +1,96 @@
 package check
 
 import (
+	"io"
+	"os"
+
 	"github.com/ncw/rclone/cmd"
 	"github.com/ncw/rclone/fs"
+	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 )
 
 // Globals
 var (
-	download = false
+	download     = false
+	oneway       = false
+	missingOnSrc = ""
+	missingOnDst = ""
+	match        = ""
+	differ       = ""
+	errorFile    = ""
 )
 
 func init() {
 	cmd.Root.AddCommand(commandDefintion)
 	commandDefintion.Flags().BoolVarP(&download, "download", "", download, "Check by downloading rather than with hash.")
+	commandDefintion.Flags().BoolVarP(&oneway, "one-way", "", oneway, "Check one way only, source files must exist on destination")
+	commandDefintion.Flags().StringVarP(&missingOnSrc, "missing-on-src", "", missingOnSrc, "Report all files missing from the source to this file")
+	commandDefintion.Flags().StringVarP(&missingOnDst, "missing-on-dst", "", missingOnDst, "Report all files missing from the destination to this file")
+	commandDefintion.Flags().StringVarP(&match, "match", "", match, "Report all matching files to this file")
+	commandDefintion.Flags().StringVarP(&differ, "differ", "", differ, "Report all non-matching files to this file")
+	commandDefintion.Flags().StringVarP(&errorFile, "error", "", errorFile, "Report all files which couldn't be checked because of errors to this file")
+}
+
+// outputFiles holds the files opened for the reports
+type outputFiles struct {
+	files []*os.File
+}
+
+// open opens the file name for writing a report, or stdout if name is
+// "-", and sets *w to it.  Nothing is done if name is empty.
+//
+// The file is created even if nothing is written to it.
+func (o *outputFiles) open(name string, w *io.Writer) error {
+	switch name {
+	case "":
+		return nil
+	case "-":
+		*w = os.Stdout
+		return nil
+	}
+	out, err := os.Create(name)
+	if err != nil {
+		return errors.Wrap(err, "failed to open report file")
+	}
+	o.files = append(o.files, out)
+	*w = out
+	return nil
+}
+
+// close closes all the files opened returning the first error
+func (o *outputFiles) close() (err error) {
+	for _, out := range o.files {
+		closeErr := out.Close()
+		if err == nil && closeErr != nil {
+			err = errors.Wrap(closeErr, "failed to close report file")
+		}
+	}
+	return err
+}
+
+// checkOpt makes the fs.CheckOpt from the flags opening the report
+// files in o
+func checkOpt(o *outputFiles) (*fs.CheckOpt, error) {
+	opt := &fs.CheckOpt{
+		OneWay: oneway,
+	}
+	for _, report := range []struct {
+		name string
+		w    *io.Writer
+	}{
+		{missingOnSrc, &opt.MissingOnSrc},
+		{missingOnDst, &opt.MissingOnDst},
+		{match, &opt.Match},
+		{differ, &opt.Differ},
+		{errorFile, &opt.Error},
+	} {
+		err := o.open(report.name, report.w)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return opt, nil
 }
 
 var commandDefintion = &cobra.Command{
@@ -30,16 +107,51 @@ the hashes as well.  Use this for a quick check.
 If you supply the --download flag, it will download the data from
 both remotes and check them against each other on the fly.  This can
 be useful for remotes that don't support hashes or if you really want
-to check all the data.
+to check all the data.  The files are compared as they are read, so
+rclone stops reading a file as soon as a difference is found.  Up to
+--checkers files are compared at once, the data read is shown in the
+stats and --bwlimit applies to it.
+
+Files which differ and files which couldn't be checked because of an
+error are reported separately.
+
+If you supply the --one-way flag, it will only check that files in
+the source match the files in the destination, not the other way
+around.  Files which are only in the destination are ignored and
+don't affect the exit code.  This is useful for checking a backup
+which keeps older files.
+
+The paths of the files checked can be written to files, one per line,
+so they can be used with --files-from to copy just the files which
+need repairing.  Use "-" to write them to stdout.  The files are
+always created, even if they end up empty.
+
+  * --missing-on-src FILE - files in the destination but not in the source
+  * --missing-on-dst FILE - files in the source but not in the destination
+  * --match FILE - files which are identical in the source and destination
+  * --differ FILE - files which are in both but differ
+  * --error FILE - files which couldn't be checked because of an error
+
+The counts of the files in each category are logged at the end.
 `,
 	Run: func(command *cobra.Command, args []string) {
 		cmd.CheckArgs(2, 2, command, args)
 		fsrc, fdst := cmd.NewFsSrcDst(args)
 		cmd.Run(false, false, command, func() error {
-			if download {
-				return fs.CheckDownload(fdst, fsrc)
+			var o outputFiles
+			opt, err := checkOpt(&o)
+			if err == nil {
+				if download {
+					err = fs.CheckDownload(fdst, fsrc, opt)
+				} else {
+					err = fs.Check(fdst, fsrc, opt)
+				}
+			}
+			closeErr := o.close()
+			if err == nil {
+				err = closeErr
 			}
-			return fs.Check(fdst, fsrc)
+			return err
 		})
 	},
 }
@@ -16,10 +16,23 @@ import (
 	"runtime/pprof"
 	"time"
 
+	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
 
 	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/fs/rc"
+)
+
+// Exit codes which aren't just 1 for failure
+const (
+	// exitCodeTransferExceeded is returned when the sync stopped
+	// early as the --max-transfer limit was reached
+	exitCodeTransferExceeded = 8
+	// exitCodeInterrupted is returned when the command was stopped
+	// early by an interrupt (Ctrl-C) or a remote control stop
+	// request.  This is the conventional code for SIGINT.
+	exitCodeInterrupted = 130
 )
 
 // Globals
@@ -31,6 +44,9 @@ var (
 	dataRateUnit  = fs.StringP("stats-unit", "", "bytes", "Show data rate in stats as either 'bits' or 'bytes'/s")
 	version       bool
 	retries       = fs.IntP("retries", "", 3, "Retry operations this many times if they fail")
+	retriesSleep  = fs.DurationP("retries-sleep", "", 0, "Interval between retrying operations if they fail, e.g 500ms, 60s, 5m. (0 to disable)")
+	retriesMax    = fs.DurationP("retries-sleep-max", "", 0, "If set double --retries-sleep after each retry up to this.")
+	progress      = fs.BoolP("progress", "P", false, "Show progress during transfer.")
 )
 
 // Root is the main rclone command
@@ -127,6 +143,13 @@ func newFsFile(remote string) (fs.Fs, string) {
 	return nil, ""
 }
 
+// NewFsFile creates an Fs from a name but may point to a file.
+//
+// It returns a string with the file name if points to a file
+func NewFsFile(remote string) (fs.Fs, string) {
+	return newFsFile(remote)
+}
+
 // newFsSrc creates a src Fs from a name
 //
 // It returns a string with the file name if limiting to one file
@@ -234,12 +257,16 @@ func ShowStats() bool {
 func Run(Retry bool, showStats bool, cmd *cobra.Command, f func() error) {
 	var err error
 	var stopStats chan struct{}
+	var stopProgress func()
 	if !showStats && ShowStats() {
 		showStats = true
 	}
-	if showStats {
+	if *progress {
+		stopProgress = startProgress()
+	} else if showStats {
 		stopStats = StartStats()
 	}
+	stopInterrupts := handleInterrupts()
 	for try := 1; try <= *retries; try++ {
 		err = f()
 		if !Retry || (err == nil && !fs.Stats.Errored()) {
@@ -263,15 +290,36 @@ func Run(Retry bool, showStats bool, cmd *cobra.Command, f func() error) {
 		}
 		if try < *retries {
 			fs.Stats.ResetErrors()
+			if !retrySleep(try) {
+				break
+			}
 		}
 	}
-	if showStats {
+	stopInterrupts()
+	if stopProgress != nil {
+		stopProgress()
+	} else if showStats {
 		close(stopStats)
 	}
 	if err != nil {
+		exitCode := 0
+		switch errors.Cause(err) {
+		case fs.ErrorMaxTransferLimitReached:
+			exitCode = exitCodeTransferExceeded
+		case fs.ErrorStopRequested:
+			exitCode = exitCodeInterrupted
+		}
+		if exitCode != 0 {
+			// Always show the final stats as the run was cut short
+			if !*progress {
+				fs.Stats.Log()
+			}
+			log.Printf("Failed to %s: %v", cmd.Name(), err)
+			os.Exit(exitCode)
+		}
 		log.Fatalf("Failed to %s: %v", cmd.Name(), err)
 	}
-	if showStats && (fs.Stats.Errored() || *statsInterval > 0) {
+	if showStats && !*progress && (fs.Stats.Errored() || *statsInterval > 0) {
 		fs.Stats.Log()
 	}
 	fs.Debugf(nil, "Go routines at exit %d\n", runtime.NumGoroutine())
@@ -280,6 +328,37 @@ func Run(Retry bool, showStats bool, cmd *cobra.Command, f func() error) {
 	}
 }
 
+// retrySleep sleeps for --retries-sleep before the retry after
+// attempt try, doubling it for each attempt up to --retries-sleep-max
+// if set.
+//
+// It returns false if a stop was requested while sleeping, eg by
+// handleInterrupts on SIGINT, so no more retries should be done.
+func retrySleep(try int) bool {
+	sleep := *retriesSleep
+	if sleep <= 0 {
+		return true
+	}
+	if *retriesMax > 0 {
+		for i := 1; i < try && sleep < *retriesMax; i++ {
+			sleep *= 2
+		}
+		if sleep > *retriesMax {
+			sleep = *retriesMax
+		}
+	}
+	fs.Errorf(nil, "Waiting %v before attempt %d/%d as --retries-sleep is set", sleep, try+1, *retries)
+	timer := time.NewTimer(sleep)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-fs.StopRequestedChan():
+		fs.Errorf(nil, "Interrupted while waiting to retry - not attempting retries")
+		return false
+	}
+}
+
 // CheckArgs checks there are enough arguments and prints a message if not
 func CheckArgs(MinArgs, MaxArgs int, cmd *cobra.Command, args []string) {
 	if len(args) < MinArgs {
@@ -366,6 +445,15 @@ func initConfig() {
 		})
 	}
 
+	// Start the remote control server if configured
+	stopRC, err := rc.Start()
+	if err != nil {
+		log.Fatalf("Failed to start remote control: %v", err)
+	}
+	if stopRC != nil {
+		AtExit(stopRC)
+	}
+
 	if m, _ := regexp.MatchString("^(bits|bytes)$", *dataRateUnit); m == false {
 		fs.Errorf(nil, "Invalid unit passed to --stats-unit. Defaulting to bytes.")
 		fs.Config.DataRateUnit = "bytes"
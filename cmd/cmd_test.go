@@ -0,0 +1,45 @@
+package cmd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetrySleep(t *testing.T) {
+	oldRetriesSleep, oldRetriesMax := *retriesSleep, *retriesMax
+	defer func() {
+		*retriesSleep, *retriesMax = oldRetriesSleep, oldRetriesMax
+	}()
+	*retriesMax = 0
+
+	// No sleep
+	*retriesSleep = 0
+	assert.True(t, retrySleep(1))
+
+	// Sleeps then carries on
+	*retriesSleep = 10 * time.Millisecond
+	start := time.Now()
+	assert.True(t, retrySleep(1))
+	assert.True(t, time.Since(start) >= *retriesSleep)
+
+	// Stops sleeping when a stop is requested, eg by the first
+	// interrupt
+	*retriesSleep = time.Hour
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		fs.RequestStop()
+	}()
+	defer fs.CancelStop()
+	assert.False(t, retrySleep(1))
+
+	// Doesn't sleep if a stop has already been requested
+	assert.False(t, retrySleep(1))
+
+	// Sleeps again once the stop is cancelled
+	fs.CancelStop()
+	*retriesSleep = 10 * time.Millisecond
+	assert.True(t, retrySleep(1))
+}
@@ -8,8 +8,14 @@ import (
 	"github.com/spf13/cobra"
 )
 
+// Globals
+var (
+	oneway = false
+)
+
 func init() {
 	cmd.Root.AddCommand(commandDefintion)
+	commandDefintion.Flags().BoolVarP(&oneway, "one-way", "", oneway, "Check one way only, source files must exist on destination")
 }
 
 var commandDefintion = &cobra.Command{
@@ -38,18 +44,22 @@ the files in remote:path.
     rclone cryptcheck remote:path encryptedremote:path
 
 After it has run it will log the status of the encryptedremote:.
+
+If you supply the --one-way flag, it will only check that files in
+the source match the files in the destination, not the other way
+around.  Files which are only in the destination are ignored.
 `,
 	Run: func(command *cobra.Command, args []string) {
 		cmd.CheckArgs(2, 2, command, args)
 		fsrc, fdst := cmd.NewFsSrcDst(args)
 		cmd.Run(false, true, command, func() error {
-			return cryptCheck(fdst, fsrc)
+			return cryptCheck(fdst, fsrc, oneway)
 		})
 	},
 }
 
 // cryptCheck checks the integrity of a crypted remote
-func cryptCheck(fdst, fsrc fs.Fs) error {
+func cryptCheck(fdst, fsrc fs.Fs, oneway bool) error {
 	// Check to see fcrypt is a crypt
 	fcrypt, ok := fdst.(*crypt.Fs)
 	if !ok {
@@ -67,35 +77,36 @@ func cryptCheck(fdst, fsrc fs.Fs) error {
 	//
 	// it returns true if differences were found
 	// it also returns whether it couldn't be hashed
-	checkIdentical := func(dst, src fs.Object) (differ bool, noHash bool) {
+	// it returns an error if the check failed
+	checkIdentical := func(dst, src fs.Object) (differ bool, noHash bool, err error) {
 		cryptDst := dst.(*crypt.Object)
 		underlyingDst := cryptDst.UnWrap()
 		underlyingHash, err := underlyingDst.Hash(hashType)
 		if err != nil {
 			fs.Stats.Error()
 			fs.Errorf(dst, "Error reading hash from underlying %v: %v", underlyingDst, err)
-			return true, false
+			return false, false, err
 		}
 		if underlyingHash == "" {
-			return false, true
+			return false, true, nil
 		}
 		cryptHash, err := fcrypt.ComputeHash(cryptDst, src, hashType)
 		if err != nil {
 			fs.Stats.Error()
 			fs.Errorf(dst, "Error computing hash: %v", err)
-			return true, false
+			return false, false, err
 		}
 		if cryptHash == "" {
-			return false, true
+			return false, true, nil
 		}
 		if cryptHash != underlyingHash {
 			fs.Stats.Error()
 			fs.Errorf(src, "hashes differ (%s:%s) %q vs (%s:%s) %q", fdst.Name(), fdst.Root(), cryptHash, fsrc.Name(), fsrc.Root(), underlyingHash)
-			return true, false
+			return true, false, nil
 		}
 		fs.Debugf(src, "OK")
-		return false, false
+		return false, false, nil
 	}
 
-	return fs.CheckFn(fcrypt, fsrc, checkIdentical)
+	return fs.CheckFn(fcrypt, fsrc, checkIdentical, &fs.CheckOpt{OneWay: oneway})
 }
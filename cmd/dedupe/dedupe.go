@@ -10,11 +10,13 @@ import (
 
 var (
 	dedupeMode = fs.DeduplicateInteractive
+	byHash     = false
 )
 
 func init() {
 	cmd.Root.AddCommand(commandDefintion)
 	commandDefintion.Flags().VarP(&dedupeMode, "dedupe-mode", "", "Dedupe mode interactive|skip|first|newest|oldest|rename.")
+	commandDefintion.Flags().BoolVarP(&byHash, "by-hash", "", false, "Find files with identical contents by hash whatever their names.")
 }
 
 var commandDefintion = &cobra.Command{
@@ -99,6 +101,16 @@ For example to rename all the identically named photos in your Google Photos dir
 Or
 
     rclone dedupe rename "drive:Google Photos"
+
+With ` + "`" + `--by-hash` + "`" + ` dedupe finds files with identical contents whatever
+their names, using the hashes read in the directory listings, so it is
+useful on any remote which supports hashes.  Each group of identical
+files is reported and one of them kept using the modes above, except
+` + "`" + `rename` + "`" + ` which can't be used as the files already have different
+names.  Files without hashes, eg some large objects, are skipped and
+counted.  For example to keep the oldest copy of every file
+
+    rclone dedupe --by-hash oldest remote:path
 `,
 	Run: func(command *cobra.Command, args []string) {
 		cmd.CheckArgs(1, 2, command, args)
@@ -111,6 +123,9 @@ Or
 		}
 		fdst := cmd.NewFsSrc(args)
 		cmd.Run(false, false, command, func() error {
+			if byHash {
+				return fs.DeduplicateByHash(fdst, dedupeMode)
+			}
 			return fs.Deduplicate(fdst, dedupeMode)
 		})
 	},
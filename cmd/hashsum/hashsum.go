@@ -0,0 +1,55 @@
+package hashsum
+
+import (
+	"log"
+	"os"
+
+	"github.com/ncw/rclone/cmd"
+	"github.com/ncw/rclone/fs"
+	"github.com/spf13/cobra"
+)
+
+// Globals
+var (
+	download = false
+)
+
+func init() {
+	cmd.Root.AddCommand(commandDefintion)
+	commandDefintion.Flags().BoolVarP(&download, "download", "", download, "Calculate the hashes by downloading the objects if the remote doesn't support the hash type.")
+}
+
+var commandDefintion = &cobra.Command{
+	Use:   "hashsum <hash> remote:path",
+	Short: `Produces a hashsum file for all the objects in the path.`,
+	Long: `
+Produces a hash file for all the objects in the path using the hash
+named.  The output is in the same format as the standard
+md5sum/sha1sum/sha256sum tools produce.
+
+The hash types supported are MD5, SHA-1, SHA-256 and DropboxHash.
+Case and any "-" in the name are ignored so these are equivalent
+
+    rclone hashsum SHA256 remote:path
+    rclone hashsum sha-256 remote:path
+
+If the remote doesn't support the hash type then rclone will return
+an error unless the ` + "`--download`" + ` flag is used, in which case rclone
+calculates the hash by downloading each object.
+
+` + "`rclone md5sum`" + ` and ` + "`rclone sha1sum`" + ` are shortcuts for
+` + "`rclone hashsum MD5`" + ` and ` + "`rclone hashsum SHA1`" + ` except that they
+show UNSUPPORTED for each object rather than returning an error.
+`,
+	Run: func(command *cobra.Command, args []string) {
+		cmd.CheckArgs(2, 2, command, args)
+		ht, err := fs.ParseHashType(args[0])
+		if err != nil {
+			log.Fatal(err)
+		}
+		fsrc := cmd.NewFsSrc(args[1:])
+		cmd.Run(false, false, command, func() error {
+			return fs.HashSum(fsrc, ht, download, os.Stdout)
+		})
+	},
+}
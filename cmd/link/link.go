@@ -0,0 +1,71 @@
+package link
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ncw/rclone/cmd"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var (
+	expire time.Duration
+)
+
+func init() {
+	cmd.Root.AddCommand(commandDefintion)
+	commandDefintion.Flags().DurationVarP(&expire, "expire", "", 0, "How long the link is valid for, if the remote supports it (default is remote specific)")
+}
+
+// publicLinkExpirer is implemented by remotes which can make public
+// links which expire
+type publicLinkExpirer interface {
+	PublicLinkExpire(remote string, expire time.Duration) (string, error)
+}
+
+var commandDefintion = &cobra.Command{
+	Use:   "link remote:path",
+	Short: `Generate public link to file.`,
+	Long: `
+rclone link will create or retrieve a public link to the given file.
+
+    rclone link remote:path/to/file
+
+Not all remotes support this.  How the link is made depends on the
+remote - for example swift gives a CDN link if the container is CDN
+enabled and a temporary URL otherwise.  If the path is a directory
+then a link is made to the directory if the remote supports it.
+
+Use --expire to set how long the link is valid for, eg
+
+    rclone link --expire 24h remote:path/to/file
+
+This is an error if the remote can't make links which expire.
+`,
+	Run: func(command *cobra.Command, args []string) {
+		cmd.CheckArgs(1, 1, command, args)
+		fsrc, remote := cmd.NewFsFile(args[0])
+		cmd.Run(false, false, command, func() error {
+			doPublicLink := fsrc.Features().PublicLink
+			if doPublicLink == nil {
+				return errors.Errorf("%v doesn't support public links", fsrc)
+			}
+			if expire != 0 {
+				do, ok := fsrc.(publicLinkExpirer)
+				if !ok {
+					return errors.Errorf("%v doesn't support public links which expire", fsrc)
+				}
+				doPublicLink = func(remote string) (string, error) {
+					return do.PublicLinkExpire(remote, expire)
+				}
+			}
+			link, err := doPublicLink(remote)
+			if err != nil {
+				return errors.Wrap(err, "PublicLink call failed")
+			}
+			fmt.Println(link)
+			return nil
+		})
+	},
+}
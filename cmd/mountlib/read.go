@@ -26,7 +26,7 @@ func newReadFileHandle(f *File, o fs.Object) (*ReadFileHandle, error) {
 	var hash *fs.MultiHasher
 	var err error
 	if !f.d.fsys.noChecksum {
-		hash, err = fs.NewMultiHasherTypes(o.Fs().Hashes())
+		hash, err = fs.NewMultiHasherTypes(o.Fs().Hashes().Overlap(fs.DefaultHashes))
 		if err != nil {
 			fs.Errorf(o.Fs(), "newReadFileHandle hash error: %v", err)
 		}
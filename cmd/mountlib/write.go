@@ -26,7 +26,7 @@ func newWriteFileHandle(d *Dir, f *File, src fs.ObjectInfo) (*WriteFileHandle, e
 	var hash *fs.MultiHasher
 	if !f.d.fsys.noChecksum {
 		var err error
-		hash, err = fs.NewMultiHasherTypes(src.Fs().Hashes())
+		hash, err = fs.NewMultiHasherTypes(src.Fs().Hashes().Overlap(fs.DefaultHashes))
 		if err != nil {
 			fs.Errorf(src.Fs(), "newWriteFileHandle hash error: %v", err)
 		}
@@ -28,6 +28,15 @@ move will be used, otherwise it will copy it (server side if possible)
 into ` + "`dest:path`" + ` then delete the original (if no errors on copy) in
 ` + "`source:path`" + `.
 
+Before deleting the original rclone reads the copy back and checks
+its size, and its hash if the source and destination have one in
+common.  Use --verify-move-download to compare the contents when they
+don't, or --no-verify-move to skip the check.
+
+The directories the files were moved out of are left behind in
+` + "`source:path`" + `.  Use --delete-empty-src-dirs to delete the ones
+which are empty once all the files have been moved.
+
 **Important**: Since this can cause data loss, test first with the
 --dry-run flag.
 `,
@@ -0,0 +1,77 @@
+package prefixstats
+
+import (
+	"encoding/json"
+	"os"
+
+	"github.com/ncw/rclone/cmd"
+	"github.com/ncw/rclone/swift"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var (
+	containerOnly bool
+)
+
+func init() {
+	cmd.Root.AddCommand(commandDefintion)
+	commandDefintion.Flags().BoolVarP(&containerOnly, "container-only", "", false, "Only print the totals of the container, without listing it")
+}
+
+// prefixStatser is implemented by remotes which can size prefixes
+type prefixStatser interface {
+	PrefixStats(containerOnly bool) ([]swift.PrefixStat, error)
+}
+
+var commandDefintion = &cobra.Command{
+	Use:   "prefixstats remote:container[/path]",
+	Short: `Prints the size of a container and the directories in it as JSON.`,
+	Long: `
+This prints the total bytes and number of objects in the container,
+read from its headers without listing it, then the totals for the
+path, if given, and for each directory immediately under it, like
+"du --max-depth=1".  The output is JSON, eg
+
+    [
+    	{
+    		"name": "container",
+    		"bytes": 10240,
+    		"count": 12
+    	},
+    	{
+    		"name": "container/path",
+    		"bytes": 4096,
+    		"count": 5
+    	},
+    	{
+    		"name": "container/path/dir",
+    		"bytes": 1024,
+    		"count": 2
+    	}
+    ]
+
+The directories are sized by listing the objects in them.  Use
+--container-only to just read the container totals which is quick
+however big the container is.
+
+This is only supported by swift.
+`,
+	Run: func(command *cobra.Command, args []string) {
+		cmd.CheckArgs(1, 1, command, args)
+		f := cmd.NewFsSrc(args)
+		cmd.Run(false, false, command, func() error {
+			do, ok := f.(prefixStatser)
+			if !ok {
+				return errors.Errorf("%v doesn't support prefixstats", f)
+			}
+			stats, err := do.PrefixStats(containerOnly)
+			if err != nil {
+				return err
+			}
+			out := json.NewEncoder(os.Stdout)
+			out.SetIndent("", "\t")
+			return out.Encode(stats)
+		})
+	},
+}
@@ -0,0 +1,136 @@
+// Show the transfer progress in place on the terminal for --progress
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ncw/rclone/fs"
+)
+
+const (
+	// interval between progress updates on a terminal
+	progressInterval = 500 * time.Millisecond
+	// terminal codes to move the cursor up a line and erase it
+	moveUp    = "\x1b[1A"
+	eraseLine = "\x1b[2K"
+)
+
+// progressDisplay prints a block of text, overwriting the previous
+// block if the output is a terminal
+type progressDisplay struct {
+	mu       sync.Mutex
+	out      io.Writer
+	terminal bool   // set if out is a terminal
+	width    int    // width of the terminal or 0 if unknown
+	text     string // the last block printed
+	lines    int    // number of lines of the block on the terminal
+}
+
+// erase the block from the terminal leaving the cursor where it
+// started
+//
+// Call with mu held
+func (p *progressDisplay) erase() {
+	for ; p.lines > 0; p.lines-- {
+		fmt.Fprint(p.out, moveUp+eraseLine)
+	}
+}
+
+// draw the block on the terminal
+//
+// Call with mu held
+func (p *progressDisplay) draw() {
+	lines := strings.Split(strings.TrimRight(p.text, "\n"), "\n")
+	for i, line := range lines {
+		// Truncate long lines so they don't wrap and spoil the
+		// line count
+		if runes := []rune(line); p.width > 0 && len(runes) >= p.width {
+			lines[i] = string(runes[:p.width-1])
+		}
+	}
+	fmt.Fprintln(p.out, strings.Join(lines, "\n"))
+	p.lines = len(lines)
+}
+
+// print text replacing the previous block if on a terminal
+func (p *progressDisplay) print(text string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.text = strings.TrimLeft(text, "\n")
+	if p.terminal {
+		p.erase()
+	}
+	p.draw()
+}
+
+// log calls logFn to write a log line above the block
+func (p *progressDisplay) log(logFn func()) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.erase()
+	logFn()
+	if p.text != "" {
+		p.draw()
+	}
+}
+
+// startProgress starts the --progress display
+//
+// On a terminal the display is updated in place every
+// progressInterval with the logs printed above it.  Otherwise it is
+// printed every --stats interval.
+//
+// It returns a function which should be called to stop the display,
+// which prints the final statistics.
+func startProgress() func() {
+	fd := int(os.Stdout.Fd())
+	p := &progressDisplay{
+		out:      os.Stdout,
+		terminal: isTerminal(fd),
+	}
+	interval := progressInterval
+	oldLogPrint := fs.GetLogPrint()
+	if p.terminal {
+		p.width = terminalWidth(fd)
+		fs.SetLogPrint(func(level fs.LogLevel, text string) {
+			p.log(func() {
+				oldLogPrint(level, text)
+			})
+		})
+	} else {
+		interval = *statsInterval
+		if interval <= 0 {
+			interval = time.Minute
+		}
+	}
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				p.print(fs.Stats.ProgressString())
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		close(stop)
+		wg.Wait()
+		p.print(fs.Stats.ProgressString())
+		fs.SetLogPrint(oldLogPrint)
+	}
+}
@@ -0,0 +1,23 @@
+// Terminal detection for OSes which are supported by golang.org/x/crypto/ssh/terminal
+// See https://github.com/golang/go/issues/14441 - plan9
+//     https://github.com/golang/go/issues/13085 - solaris
+
+// +build !solaris,!plan9
+
+package cmd
+
+import "golang.org/x/crypto/ssh/terminal"
+
+// isTerminal returns true if fd is a terminal
+func isTerminal(fd int) bool {
+	return terminal.IsTerminal(fd)
+}
+
+// terminalWidth returns the width of the terminal fd or 0 if unknown
+func terminalWidth(fd int) int {
+	width, _, err := terminal.GetSize(fd)
+	if err != nil {
+		return 0
+	}
+	return width
+}
@@ -0,0 +1,17 @@
+// Terminal detection for OSes which are not supported by golang.org/x/crypto/ssh/terminal
+// See https://github.com/golang/go/issues/14441 - plan9
+//     https://github.com/golang/go/issues/13085 - solaris
+
+// +build solaris plan9
+
+package cmd
+
+// isTerminal returns false as terminals can't be detected
+func isTerminal(fd int) bool {
+	return false
+}
+
+// terminalWidth returns 0 as the width is unknown
+func terminalWidth(fd int) int {
+	return 0
+}
@@ -10,8 +10,13 @@ import (
 	"github.com/spf13/cobra"
 )
 
+var (
+	size = int64(-1)
+)
+
 func init() {
 	cmd.Root.AddCommand(commandDefintion)
+	commandDefintion.Flags().Int64VarP(&size, "size", "", size, "File size hint - if known the input is uploaded in one go and checked against it")
 }
 
 var commandDefintion = &cobra.Command{
@@ -39,7 +44,20 @@ setting this cutoff too high will decrease your performance.
 Note that the upload can also not be retried because the data is
 not kept around until the upload succeeds. If you need to transfer
 a lot of data, you're better off caching locally and then
-` + "`rclone move`" + ` it to the destination.`,
+` + "`rclone move`" + ` it to the destination.
+
+If you know the size of the input pass it with ` + "`--size`" + `, eg
+
+    tar cf - dir | rclone rcat --size $(du -bs dir | cut -f1) remote:path/to/file
+
+This uploads it in one go with its size rather than streaming it,
+which avoids spooling it to disk on remotes which can't stream.  If
+the input ends early, eg because the program writing it died, or
+is longer than the size given, the upload is removed and rcat exits
+with an error.  Without ` + "`--size`" + ` there is no way for rcat to tell
+that the input was truncated.
+
+The modification time of the file is set to the time rcat started.`,
 	Run: func(command *cobra.Command, args []string) {
 		cmd.CheckArgs(1, 1, command, args)
 
@@ -50,7 +68,7 @@ a lot of data, you're better off caching locally and then
 
 		fdst, dstFileName := cmd.NewFsDstFile(args)
 		cmd.Run(false, false, command, func() error {
-			return fs.Rcat(fdst, dstFileName, os.Stdin, time.Now())
+			return fs.RcatSize(fdst, dstFileName, os.Stdin, size, time.Now())
 		})
 	},
 }
@@ -18,6 +18,9 @@ var commandDefintion = &cobra.Command{
 	Long: `
 Produces an sha1sum file for all the objects in the path.  This
 is in the same format as the standard sha1sum tool produces.
+
+Use ` + "`rclone hashsum`" + ` for other hash types or to calculate the
+hashes by downloading the objects.
 `,
 	Run: func(command *cobra.Command, args []string) {
 		cmd.CheckArgs(1, 1, command, args)
@@ -0,0 +1,65 @@
+package userinfo
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/ncw/rclone/cmd"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var (
+	jsonOutput bool
+)
+
+func init() {
+	cmd.Root.AddCommand(commandDefintion)
+	commandDefintion.Flags().BoolVarP(&jsonOutput, "json", "", false, "Format output as JSON")
+}
+
+var commandDefintion = &cobra.Command{
+	Use:   "userinfo remote:",
+	Short: `Prints info about the user and account the remote is connected to.`,
+	Long: `
+This prints the details of the user and account that a remote
+resolves to, which is useful for checking which account or project a
+remote is really using.  The details depend on the remote and not all
+remotes support this.
+
+For example for swift this prints the storage URL, the account name,
+the bytes, objects and containers used and any quotas set.
+
+Use the --json flag for output which is easy to parse in scripts.
+`,
+	Run: func(command *cobra.Command, args []string) {
+		cmd.CheckArgs(1, 1, command, args)
+		f := cmd.NewFsSrc(args)
+		cmd.Run(false, false, command, func() error {
+			doUserInfo := f.Features().UserInfo
+			if doUserInfo == nil {
+				return errors.Errorf("%v doesn't support userinfo", f)
+			}
+			info, err := doUserInfo()
+			if err != nil {
+				return errors.Wrap(err, "UserInfo call failed")
+			}
+			if jsonOutput {
+				out := json.NewEncoder(os.Stdout)
+				out.SetIndent("", "\t")
+				return out.Encode(info)
+			}
+			var keys []string
+			for key := range info {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			for _, key := range keys {
+				fmt.Printf("%s: %s\n", key, info[key])
+			}
+			return nil
+		})
+	},
+}
@@ -110,6 +110,8 @@ func NewFs(name, rpath string) (fs.Fs, error) {
 		WriteMimeType:           false,
 		BucketBased:             true,
 		CanHaveEmptyDirectories: true,
+		SeekOpen:                true,
+		ListRByDirectory:        true,
 	}).Fill(f).Mask(wrappedFs)
 	return f, err
 }
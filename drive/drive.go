@@ -1149,6 +1149,29 @@ func (f *Fs) DirCacheFlush() {
 	f.dirCache.ResetRoot()
 }
 
+// About gets quota information
+func (f *Fs) About() (*fs.Usage, error) {
+	var about *drive.About
+	var err error
+	err = f.pacer.Call(func() (bool, error) {
+		about, err = f.svc.About.Get().Do()
+		return shouldRetry(err)
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get Drive about")
+	}
+	usage := &fs.Usage{
+		Used:    fs.NewUsageValue(about.QuotaBytesUsed),
+		Trashed: fs.NewUsageValue(about.QuotaBytesUsedInTrash),
+		Other:   fs.NewUsageValue(about.QuotaBytesUsedAggregate - about.QuotaBytesUsed), // eg Gmail and Google Photos
+	}
+	if about.QuotaType != "UNLIMITED" && about.QuotaBytesTotal > 0 {
+		usage.Total = fs.NewUsageValue(about.QuotaBytesTotal)
+		usage.Free = fs.NewUsageValue(about.QuotaBytesTotal - about.QuotaBytesUsedAggregate)
+	}
+	return usage, nil
+}
+
 // Hashes returns the supported hash sets.
 func (f *Fs) Hashes() fs.HashSet {
 	return fs.HashSet(fs.HashMD5)
@@ -1439,6 +1462,7 @@ var (
 	_ fs.DirChangeNotifier = (*Fs)(nil)
 	_ fs.PutUncheckeder    = (*Fs)(nil)
 	_ fs.MergeDirser       = (*Fs)(nil)
+	_ fs.Abouter           = (*Fs)(nil)
 	_ fs.Object            = (*Object)(nil)
 	_ fs.MimeTyper         = &Object{}
 )
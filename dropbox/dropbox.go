@@ -34,6 +34,7 @@ import (
 
 	"github.com/dropbox/dropbox-sdk-go-unofficial/dropbox"
 	"github.com/dropbox/dropbox-sdk-go-unofficial/dropbox/files"
+	"github.com/dropbox/dropbox-sdk-go-unofficial/dropbox/users"
 	"github.com/ncw/rclone/fs"
 	"github.com/ncw/rclone/oauthutil"
 	"github.com/ncw/rclone/pacer"
@@ -101,6 +102,7 @@ type Fs struct {
 	root           string       // the path we are working on
 	features       *fs.Features // optional features
 	srv            files.Client // the connection to the dropbox server
+	users          users.Client // to read the user's space usage
 	slashRoot      string       // root with "/" prefix, lowercase
 	slashRootSlash string       // root with "/" prefix and postfix, lowercase
 	pacer          *pacer.Pacer // To pace the API calls
@@ -185,6 +187,7 @@ func NewFs(name, root string) (fs.Fs, error) {
 	f := &Fs{
 		name:  name,
 		srv:   srv,
+		users: users.New(config),
 		pacer: pacer.New().SetMinSleep(minSleep).SetMaxSleep(maxSleep).SetDecayConstant(decayConstant),
 	}
 	f.features = (&fs.Features{
@@ -654,6 +657,48 @@ func (f *Fs) DirMove(src fs.Fs, srcRemote, dstRemote string) error {
 	return nil
 }
 
+// About gets quota information
+func (f *Fs) About() (*fs.Usage, error) {
+	var q *users.SpaceUsage
+	var err error
+	err = f.pacer.Call(func() (bool, error) {
+		q, err = f.users.GetSpaceUsage()
+		return shouldRetry(err)
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "about failed")
+	}
+	return spaceUsage(q), nil
+}
+
+// spaceUsage converts the space usage returned by dropbox into an
+// fs.Usage.  Total and Free are only set if the allocation is known.
+func spaceUsage(q *users.SpaceUsage) *fs.Usage {
+	usage := &fs.Usage{
+		Used: fs.NewUsageValue(int64(q.Used)), // bytes in use
+	}
+	if q.Allocation == nil {
+		return usage
+	}
+	var total, used uint64
+	switch {
+	case q.Allocation.Individual != nil:
+		total, used = q.Allocation.Individual.Allocated, q.Used
+	case q.Allocation.Team != nil:
+		// The space is shared with the rest of the team
+		total, used = q.Allocation.Team.Allocated, q.Allocation.Team.Used
+	default:
+		return usage
+	}
+	var free uint64
+	if total > used {
+		free = total - used
+	}
+	usage.Total = fs.NewUsageValue(int64(total)) // quota of bytes that can be used
+	usage.Free = fs.NewUsageValue(int64(free))   // bytes which can be uploaded before reaching the quota
+	return usage
+}
+
 // Hashes returns the supported hash sets.
 func (f *Fs) Hashes() fs.HashSet {
 	return fs.HashSet(fs.HashDropbox)
@@ -936,5 +981,6 @@ var (
 	_ fs.PutStreamer = (*Fs)(nil)
 	_ fs.Mover       = (*Fs)(nil)
 	_ fs.DirMover    = (*Fs)(nil)
+	_ fs.Abouter     = (*Fs)(nil)
 	_ fs.Object      = (*Object)(nil)
 )
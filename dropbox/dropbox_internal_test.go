@@ -0,0 +1,33 @@
+package dropbox
+
+import (
+	"testing"
+
+	"github.com/dropbox/dropbox-sdk-go-unofficial/dropbox/users"
+	"github.com/ncw/rclone/fs"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSpaceUsage(t *testing.T) {
+	individual := func(allocated uint64) *users.SpaceAllocation {
+		return &users.SpaceAllocation{Individual: users.NewIndividualSpaceAllocation(allocated)}
+	}
+	team := func(used, allocated uint64) *users.SpaceAllocation {
+		return &users.SpaceAllocation{Team: users.NewTeamSpaceAllocation(used, allocated)}
+	}
+	value := fs.NewUsageValue
+	for _, test := range []struct {
+		name string
+		in   *users.SpaceUsage
+		want *fs.Usage
+	}{
+		{"individual", users.NewSpaceUsage(30, individual(100)), &fs.Usage{Total: value(100), Used: value(30), Free: value(70)}},
+		{"over quota", users.NewSpaceUsage(130, individual(100)), &fs.Usage{Total: value(100), Used: value(130), Free: value(0)}},
+		{"team", users.NewSpaceUsage(30, team(80, 100)), &fs.Usage{Total: value(100), Used: value(30), Free: value(20)}},
+		{"team over quota", users.NewSpaceUsage(30, team(120, 100)), &fs.Usage{Total: value(100), Used: value(30), Free: value(0)}},
+		{"no allocation", users.NewSpaceUsage(30, nil), &fs.Usage{Used: value(30)}},
+		{"unknown allocation", users.NewSpaceUsage(30, &users.SpaceAllocation{}), &fs.Usage{Used: value(30)}},
+	} {
+		assert.Equal(t, test.want, spaceUsage(test.in), test.name)
+	}
+}
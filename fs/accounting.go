@@ -6,12 +6,15 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"reflect"
 	"sort"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/VividCortex/ewma"
+	"github.com/pkg/errors"
 	"golang.org/x/net/context" // switch to "context" when we stop supporting go1.6
 	"golang.org/x/time/rate"
 )
@@ -20,15 +23,92 @@ import (
 var (
 	Stats             = NewStats()
 	tokenBucketMu     sync.Mutex // protects the token bucket variables
-	tokenBucket       *rate.Limiter
+	tokenBucket       tokenBuckets
 	prevTokenBucket   = tokenBucket
 	bwLimitToggledOff = false
 	currLimitMu       sync.Mutex // protects changes to the timeslot
 	currLimit         BwTimeSlot
+
+	// ErrorMaxTransferLimitReached is returned from Read when the
+	// max transfer limit is reached with --cutoff-mode hard and
+	// from sync when it is reached with --cutoff-mode soft.
+	ErrorMaxTransferLimitReached = FatalError(errors.New("max transfer limit reached as set by --max-transfer"))
 )
 
 const maxBurstSize = 1 * 1024 * 1024 // must be bigger than the biggest request
 
+// Direction is the direction of a transfer, used to choose which of
+// the upload and download bandwidth limits apply to it
+type Direction int
+
+// Direction values - these are bits as a transfer between two
+// remotes is both an upload and a download
+const (
+	DirectionUpload   Direction = 1 << iota // transfer uploads to a remote
+	DirectionDownload                       // transfer downloads from a remote
+)
+
+// TransferDirection returns the Direction of a transfer from src to
+// dst.  Transfers between local disks have no direction so only the
+// overall bandwidth limit applies to them.
+func TransferDirection(src, dst Info) (d Direction) {
+	if dst != nil && !dst.Features().IsLocal {
+		d |= DirectionUpload
+	}
+	if src != nil && !src.Features().IsLocal {
+		d |= DirectionDownload
+	}
+	return d
+}
+
+// tokenBuckets holds the token buckets for the bandwidth limits, each
+// nil if there isn't a limit
+type tokenBuckets struct {
+	all      *rate.Limiter // limits all transfers
+	upload   *rate.Limiter // limits transfers with DirectionUpload
+	download *rate.Limiter // limits transfers with DirectionDownload
+}
+
+// isSet returns true if any of the buckets are limiting
+func (tbs tokenBuckets) isSet() bool {
+	return tbs.all != nil || tbs.upload != nil || tbs.download != nil
+}
+
+// set the buckets to the limits in slot
+//
+// Call with tokenBucketMu held
+func (tbs *tokenBuckets) set(slot BwTimeSlot) {
+	setTokenBucket(&tbs.all, slot.bandwidth)
+	setTokenBucket(&tbs.upload, slot.upload)
+	setTokenBucket(&tbs.download, slot.download)
+}
+
+// wait for n bytes worth of tokens from each bucket which applies to
+// a transfer in direction d
+func (tbs tokenBuckets) wait(d Direction, n int) {
+	for _, tb := range []*rate.Limiter{
+		tbs.all,
+		d.bucket(DirectionUpload, tbs.upload),
+		d.bucket(DirectionDownload, tbs.download),
+	} {
+		if tb == nil {
+			continue
+		}
+		err := tb.WaitN(context.Background(), n)
+		if err != nil {
+			Errorf(nil, "Token bucket error: %v", err)
+		}
+	}
+}
+
+// bucket returns tb if d includes direction, nil otherwise
+func (d Direction) bucket(direction Direction, tb *rate.Limiter) *rate.Limiter {
+	if d&direction == 0 {
+		return nil
+	}
+	return tb
+}
+
 // make a new empty token bucket with the bandwidth given
 func newTokenBucket(bandwidth SizeSuffix) *rate.Limiter {
 	newTokenBucket := rate.NewLimiter(rate.Limit(bandwidth), maxBurstSize)
@@ -40,17 +120,51 @@ func newTokenBucket(bandwidth SizeSuffix) *rate.Limiter {
 	return newTokenBucket
 }
 
+// setTokenBucket sets the token bucket pointed to by target to limit
+// to bandwidth, or to nil for no limit.
+//
+// An existing bucket has its rate changed rather than being replaced
+// so transfers in progress carry on smoothly at the new rate.
+//
+// Call with tokenBucketMu held
+func setTokenBucket(target **rate.Limiter, bandwidth SizeSuffix) {
+	switch {
+	case bandwidth <= 0:
+		*target = nil
+	case *target == nil:
+		*target = newTokenBucket(bandwidth)
+	default:
+		(*target).SetLimit(rate.Limit(bandwidth))
+	}
+}
+
+// describeLimit returns a description of the limits in slot for logging
+func describeLimit(slot BwTimeSlot) string {
+	describe := func(bandwidth SizeSuffix) string {
+		if bandwidth <= 0 {
+			return "unlimited"
+		}
+		return bandwidth.String() + "Bytes/s"
+	}
+	if slot.split() {
+		return describe(slot.upload) + " upload and " + describe(slot.download) + " download"
+	}
+	return describe(slot.bandwidth)
+}
+
 // Start the token bucket if necessary
 func startTokenBucket() {
 	currLimitMu.Lock()
-	currLimit := bwLimit.LimitAt(time.Now())
+	currLimit = bwLimit.LimitAt(time.Now())
 	currLimitMu.Unlock()
 
-	if currLimit.bandwidth > 0 {
-		tokenBucket = newTokenBucket(currLimit.bandwidth)
-		Infof(nil, "Starting bandwidth limiter at %vBytes/s", &currLimit.bandwidth)
-
-		// Start the SIGUSR2 signal handler to toggle bandwidth.
+	tokenBucket.set(currLimit)
+	if tokenBucket.isSet() {
+		Infof(nil, "Starting bandwidth limiter at %s", describeLimit(currLimit))
+	}
+	if len(bwLimit) > 0 {
+		// Start the SIGUSR2 signal handler to toggle bandwidth,
+		// even if the timetable doesn't limit it right now.
 		// This function does nothing in windows systems.
 		startSignalHandler()
 	}
@@ -67,44 +181,76 @@ func startTokenTicker() {
 	ticker := time.NewTicker(time.Minute)
 	go func() {
 		for range ticker.C {
-			limitNow := bwLimit.LimitAt(time.Now())
 			currLimitMu.Lock()
-
-			if currLimit.bandwidth != limitNow.bandwidth {
-				tokenBucketMu.Lock()
-
-				// If bwlimit is toggled off, the change should only
-				// become active on the next toggle, which causes
-				// an exchange of tokenBucket <-> prevTokenBucket
-				var targetBucket **rate.Limiter
-				if bwLimitToggledOff {
-					targetBucket = &prevTokenBucket
-				} else {
-					targetBucket = &tokenBucket
-				}
-
-				// Set new bandwidth. If unlimited, set tokenbucket to nil.
-				if limitNow.bandwidth > 0 {
-					*targetBucket = newTokenBucket(limitNow.bandwidth)
-					if bwLimitToggledOff {
-						Logf(nil, "Scheduled bandwidth change. "+
-							"Limit will be set to %vBytes/s when toggled on again.", &limitNow.bandwidth)
-					} else {
-						Logf(nil, "Scheduled bandwidth change. Limit set to %vBytes/s", &limitNow.bandwidth)
-					}
-				} else {
-					*targetBucket = nil
-					Logf(nil, "Scheduled bandwidth change. Bandwidth limits disabled")
-				}
-
-				currLimit = limitNow
-				tokenBucketMu.Unlock()
+			limitNow := bwLimit.LimitAt(time.Now())
+			if !currLimit.sameBandwidth(limitNow) {
+				changeBwLimit(limitNow, "Scheduled bandwidth change")
 			}
 			currLimitMu.Unlock()
 		}
 	}()
 }
 
+// changeBwLimit changes the bandwidth limit to limitNow logging the
+// reason for the change
+//
+// Call with currLimitMu held
+func changeBwLimit(limitNow BwTimeSlot, reason string) {
+	tokenBucketMu.Lock()
+	defer tokenBucketMu.Unlock()
+
+	// If bwlimit is toggled off, the change should only
+	// become active on the next toggle, which causes
+	// an exchange of tokenBucket <-> prevTokenBucket
+	var targetBucket *tokenBuckets
+	if bwLimitToggledOff {
+		targetBucket = &prevTokenBucket
+	} else {
+		targetBucket = &tokenBucket
+	}
+
+	// Set new bandwidth. If unlimited, set the buckets to nil.
+	targetBucket.set(limitNow)
+	if targetBucket.isSet() {
+		if bwLimitToggledOff {
+			Logf(nil, "%s. "+
+				"Limit will be set to %s when toggled on again.", reason, describeLimit(limitNow))
+		} else {
+			Logf(nil, "%s. Limit set to %s", reason, describeLimit(limitNow))
+		}
+	} else {
+		Logf(nil, "%s. Bandwidth limits disabled", reason)
+	}
+
+	currLimit = limitNow
+}
+
+// SetBwLimit sets the bandwidth limit to s, which is a single limit
+// or UPLOAD:DOWNLOAD pair as used by --bwlimit.  This replaces any
+// timetable given with --bwlimit.
+func SetBwLimit(s string) error {
+	if strings.ContainsAny(s, " ,") {
+		return errors.Errorf("can only set a single bandwidth limit, not a timetable: %q", s)
+	}
+	var tt BwTimetable
+	if err := tt.Set(s); err != nil {
+		return err
+	}
+	currLimitMu.Lock()
+	defer currLimitMu.Unlock()
+	bwLimit = tt
+	changeBwLimit(tt[0], "Bandwidth limit changed")
+	return nil
+}
+
+// CurrentBwLimit returns the bandwidth limit in force in the form
+// used by --bwlimit
+func CurrentBwLimit() string {
+	currLimitMu.Lock()
+	defer currLimitMu.Unlock()
+	return currLimit.bandwidthString()
+}
+
 // stringSet holds a set of strings
 type stringSet map[string]struct{}
 
@@ -150,7 +296,7 @@ func (ss stringSet) Strings() []string {
 		if acc := Stats.inProgress.get(name); acc != nil {
 			out = acc.String()
 		} else {
-			out = name
+			out = shortenName(name, Config.StatsFileNameLength)
 		}
 		strings = append(strings, " * "+out)
 	}
@@ -159,6 +305,16 @@ func (ss stringSet) Strings() []string {
 	return sorted
 }
 
+// names returns the names in the stringSet sorted
+func (ss stringSet) names() []string {
+	names := make([]string, 0, len(ss))
+	for name := range ss {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
 // String returns all the file names in the stringSet joined by newline
 func (ss stringSet) String() string {
 	return strings.Join(ss.Strings(), "\n")
@@ -166,15 +322,22 @@ func (ss stringSet) String() string {
 
 // StatsInfo limits and accounts all transfers
 type StatsInfo struct {
-	lock         sync.RWMutex
-	bytes        int64
-	errors       int64
-	checks       int64
-	checking     stringSet
-	transfers    int64
-	transferring stringSet
-	start        time.Time
-	inProgress   *inProgress
+	lock              sync.RWMutex
+	bytes             int64
+	errors            int64
+	checks            int64
+	checking          stringSet
+	transfers         int64
+	transferring      stringSet
+	transferQueue     int64 // number of transfers waiting to start
+	transferQueueSize int64 // total size of the transfers waiting to start
+	listing           bool  // set while a sync is still queueing transfers
+	backups           int64
+	deletes           int64
+	deleted           int64
+	renames           int64
+	start             time.Time
+	inProgress        *inProgress
 }
 
 // NewStats cretates an initialised StatsInfo
@@ -187,35 +350,119 @@ func NewStats() *StatsInfo {
 	}
 }
 
+// speed returns the average transfer speed in bytes per second and
+// the time elapsed rounded to 1/10s
+//
+// Call with lock held
+func (s *StatsInfo) speed() (speed float64, elapsed time.Duration) {
+	dt := time.Now().Sub(s.start)
+	if dt > 0 {
+		speed = float64(s.bytes) / dt.Seconds()
+	}
+	return speed, dt - (dt % (time.Second / 10))
+}
+
+// totals returns the total size and number of the transfers known
+// about so far, including those in progress and queued
+//
+// Call with lock held
+func (s *StatsInfo) totals() (totalBytes, totalTransfers int64) {
+	totalBytes = s.bytes + s.transferQueueSize
+	for name := range s.transferring {
+		if bytes, size := s.inProgress.get(name).Progress(); size > bytes {
+			totalBytes += size - bytes
+		}
+	}
+	totalTransfers = s.transfers + int64(len(s.transferring)) + s.transferQueue
+	return totalBytes, totalTransfers
+}
+
+// progress returns the percentage of totalBytes done and the ETA to
+// finish them at speed as a string.  The ETA isn't known while a sync
+// is listing as until it finishes more transfers may be queued.
+// Operations without a listing, eg copyto, have an ETA straight away.
+//
+// Call with lock held
+func (s *StatsInfo) progress(totalBytes int64, speed float64) (percent int, eta string) {
+	if totalBytes > 0 {
+		percent = int(100 * float64(s.bytes) / float64(totalBytes))
+	}
+	eta = "-"
+	if s.listing {
+		// ETA unknown
+	} else if left := totalBytes - s.bytes; left <= 0 {
+		eta = "0s"
+	} else if speed > 0 {
+		eta = fmt.Sprintf("%v", time.Duration(float64(left)/speed)*time.Second)
+	}
+	return percent, eta
+}
+
+// speedString returns speed formatted in the --stats-unit
+func speedString(speed float64) string {
+	if Config.DataRateUnit == "bits" {
+		speed = speed * 8
+	}
+	return SizeSuffix(speed).Unit(strings.Title(Config.DataRateUnit) + "/s")
+}
+
+// oneLineString returns the stats condensed on to one line for
+// --stats-one-line
+//
+// Call with lock held
+func (s *StatsInfo) oneLineString() string {
+	speed, elapsed := s.speed()
+	totalBytes, totalTransfers := s.totals()
+	percent, eta := s.progress(totalBytes, speed)
+	return fmt.Sprintf("%s / %s, %d%%, %s, ETA %s, Errors %d, Checks %d, Transferred %d / %d, Elapsed %v",
+		SizeSuffix(s.bytes).Unit("Bytes"), SizeSuffix(totalBytes).Unit("Bytes"), percent,
+		speedString(speed), eta,
+		s.errors, s.checks, s.transfers, totalTransfers, elapsed)
+}
+
 // String convert the StatsInfo to a string for printing
 func (s *StatsInfo) String() string {
 	s.lock.RLock()
 	defer s.lock.RUnlock()
-	dt := time.Now().Sub(s.start)
-	dtSeconds := dt.Seconds()
-	speed := 0.0
-	if dt > 0 {
-		speed = float64(s.bytes) / dtSeconds
+	if Config.StatsOneLine {
+		return s.oneLineString()
 	}
-	dtRounded := dt - (dt % (time.Second / 10))
+	speed, dtRounded := s.speed()
 	buf := &bytes.Buffer{}
 
-	if Config.DataRateUnit == "bits" {
-		speed = speed * 8
+	// Once all the transfers are known show how far through
+	// them we are
+	transferred := fmt.Sprintf("%10s (%s)", SizeSuffix(s.bytes).Unit("Bytes"), speedString(speed))
+	if !s.listing {
+		totalBytes, _ := s.totals()
+		percent, eta := s.progress(totalBytes, speed)
+		transferred = fmt.Sprintf("%10s / %s, %d%%, %s, ETA %s",
+			SizeSuffix(s.bytes).Unit("Bytes"), SizeSuffix(totalBytes).Unit("Bytes"), percent,
+			speedString(speed), eta)
 	}
 
 	fmt.Fprintf(buf, `
-Transferred:   %10s (%s)
+Transferred:   %s
 Errors:        %10d
 Checks:        %10d
 Transferred:   %10d
 Elapsed time:  %10v
 `,
-		SizeSuffix(s.bytes).Unit("Bytes"), SizeSuffix(speed).Unit(strings.Title(Config.DataRateUnit)+"/s"),
+		transferred,
 		s.errors,
 		s.checks,
 		s.transfers,
 		dtRounded)
+	if s.backups > 0 {
+		fmt.Fprintf(buf, "Backed up:     %10d\n", s.backups)
+	}
+	if s.deleted > 0 {
+		fmt.Fprintf(buf, "Deleted:       %10d\n", s.deleted)
+	}
+	if s.renames > 0 {
+		fmt.Fprintf(buf, "Renamed:       %10d\n", s.renames)
+	}
+	s.stoppingString(buf)
 	if len(s.checking) > 0 {
 		fmt.Fprintf(buf, "Checking:\n%s\n", s.checking)
 	}
@@ -225,8 +472,108 @@ Elapsed time:  %10v
 	return buf.String()
 }
 
+// ProgressString returns the StatsInfo for the --progress display.
+//
+// As well as the things in String it shows the total size of the
+// transfers known about so far, how far through them it is and an
+// ETA to finish them at the average speed.
+func (s *StatsInfo) ProgressString() string {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	if Config.StatsOneLine {
+		return s.oneLineString()
+	}
+	speed, dtRounded := s.speed()
+	totalBytes, totalTransfers := s.totals()
+	percent, eta := s.progress(totalBytes, speed)
+
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, `Transferred:   %10s / %s, %d%%, %s, ETA %s
+Errors:        %10d
+Checks:        %10d
+Transferred:   %10d / %d
+Elapsed time:  %10v
+`,
+		SizeSuffix(s.bytes).Unit("Bytes"), SizeSuffix(totalBytes).Unit("Bytes"), percent,
+		speedString(speed), eta,
+		s.errors,
+		s.checks,
+		s.transfers, totalTransfers,
+		dtRounded)
+	s.stoppingString(buf)
+	if len(s.checking) > 0 {
+		fmt.Fprintf(buf, "Checking:\n%s\n", s.checking)
+	}
+	if len(s.transferring) > 0 {
+		fmt.Fprintf(buf, "Transferring:\n%s\n", s.transferring)
+	}
+	return buf.String()
+}
+
+// stoppingString writes a status line to buf if a stop has been
+// requested and there are transfers still in progress
+//
+// Call with lock held
+func (s *StatsInfo) stoppingString(buf *bytes.Buffer) {
+	if StopRequested() && len(s.transferring) > 0 {
+		fmt.Fprintf(buf, "Stopping:      waiting for %d transfers in progress to finish\n", len(s.transferring))
+	}
+}
+
+// RemoteStats returns the StatsInfo as a map for the JSON log and
+// the remote control API
+func (s *StatsInfo) RemoteStats() map[string]interface{} {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	speed, elapsed := s.speed()
+	totalBytes, totalTransfers := s.totals()
+	return map[string]interface{}{
+		"bytes":          s.bytes,
+		"totalBytes":     totalBytes,
+		"speed":          speed,
+		"errors":         s.errors,
+		"checks":         s.checks,
+		"transfers":      s.transfers,
+		"totalTransfers": totalTransfers,
+		"backups":        s.backups,
+		"deletes":        s.deleted,
+		"renames":        s.renames,
+		"elapsedTime":    elapsed.Seconds(),
+		"checking":       s.checking.names(),
+		"transferring":   s.transferring.names(),
+	}
+}
+
+// TransferringStats returns the stats of each transfer in progress
+// sorted by name
+func (s *StatsInfo) TransferringStats() []map[string]interface{} {
+	s.lock.RLock()
+	names := s.transferring.names()
+	s.lock.RUnlock()
+	out := make([]map[string]interface{}, 0, len(names))
+	for _, name := range names {
+		if acc := s.inProgress.get(name); acc != nil {
+			out = append(out, acc.RemoteStats())
+		} else {
+			out = append(out, map[string]interface{}{"name": name})
+		}
+	}
+	return out
+}
+
 // Log outputs the StatsInfo to the log
+//
+// With --use-json-log the stats are put in the "stats" field.
 func (s *StatsInfo) Log() {
+	if Config.UseJSONLog {
+		if Config.LogLevel >= Config.StatsLogLevel {
+			s.lock.RLock()
+			msg := s.oneLineString()
+			s.lock.RUnlock()
+			logPrintfFields(Config.StatsLogLevel, nil, map[string]interface{}{"stats": s.RemoteStats()}, "%s", msg)
+		}
+		return
+	}
 	LogLevelPrintf(Config.StatsLogLevel, nil, "%v\n", s)
 }
 
@@ -237,6 +584,19 @@ func (s *StatsInfo) Bytes(bytes int64) {
 	s.bytes += bytes
 }
 
+// GetBytes returns the number of bytes transferred so far
+func (s *StatsInfo) GetBytes() int64 {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.bytes
+}
+
+// MaxTransferReached returns whether the bytes transferred so far,
+// including any retries, have reached the --max-transfer limit
+func (s *StatsInfo) MaxTransferReached() bool {
+	return Config.MaxTransfer >= 0 && s.GetBytes() >= int64(Config.MaxTransfer)
+}
+
 // Errors updates the stats for errors
 func (s *StatsInfo) Errors(errors int64) {
 	s.lock.Lock()
@@ -251,7 +611,8 @@ func (s *StatsInfo) GetErrors() int64 {
 	return s.errors
 }
 
-// ResetCounters sets the counters (bytes, checks, errors, transfers) to 0
+// ResetCounters sets the counters (bytes, checks, errors, transfers,
+// backups, deletes, renames) to 0
 func (s *StatsInfo) ResetCounters() {
 	s.lock.RLock()
 	defer s.lock.RUnlock()
@@ -259,6 +620,13 @@ func (s *StatsInfo) ResetCounters() {
 	s.errors = 0
 	s.checks = 0
 	s.transfers = 0
+	s.backups = 0
+	s.deletes = 0
+	s.deleted = 0
+	s.renames = 0
+	s.transferQueue = 0
+	s.transferQueueSize = 0
+	s.listing = false
 }
 
 // ResetErrors sets the errors count to 0
@@ -311,6 +679,37 @@ func (s *StatsInfo) Transferring(remote string) {
 	s.transferring[remote] = struct{}{}
 }
 
+// SetListed records whether a sync has queued all its transfers, so
+// the totals are complete and an ETA can be worked out.  A sync calls
+// it with false when it starts listing.
+func (s *StatsInfo) SetListed(listed bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.listing = !listed
+}
+
+// QueueTransfer adds a transfer of size bytes to the queue of
+// transfers waiting to start
+func (s *StatsInfo) QueueTransfer(size int64) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.transferQueue++
+	if size > 0 {
+		s.transferQueueSize += size
+	}
+}
+
+// DequeueTransfer removes a transfer of size bytes queued with
+// QueueTransfer from the queue as it is about to start
+func (s *StatsInfo) DequeueTransfer(size int64) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.transferQueue--
+	if size > 0 {
+		s.transferQueueSize -= size
+	}
+}
+
 // DoneTransferring removes a transfer from the stats
 //
 // if ok is true then it increments the transfers count
@@ -323,6 +722,58 @@ func (s *StatsInfo) DoneTransferring(remote string, ok bool) {
 	}
 }
 
+// Backup adds a file moved into --backup-dir into the stats
+func (s *StatsInfo) Backup() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.backups++
+}
+
+// GetBackups reads the number of files moved into --backup-dir
+func (s *StatsInfo) GetBackups() int64 {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.backups
+}
+
+// Rename adds a server side rename done by --track-renames into the
+// stats
+func (s *StatsInfo) Rename() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.renames++
+}
+
+// GetRenames reads the number of renames done by --track-renames
+func (s *StatsInfo) GetRenames() int64 {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.renames
+}
+
+// Deleted adds a file which has been deleted into the stats
+func (s *StatsInfo) Deleted() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.deleted++
+}
+
+// GetDeleted reads the number of files which have been deleted
+func (s *StatsInfo) GetDeleted() int64 {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.deleted
+}
+
+// Deletes adds n to the number of deletions attempted, including
+// moves into --backup-dir, and returns the new total
+func (s *StatsInfo) Deletes(n int64) int64 {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.deletes += n
+	return s.deletes
+}
+
 // Account limits and accounts for one transfer
 type Account struct {
 	// The mutex is to make sure Read() and Close() aren't called
@@ -330,20 +781,21 @@ type Account struct {
 	// in http transport calls Read() after Do() returns on
 	// CancelRequest so this race can happen when it apparently
 	// shouldn't.
-	mu      sync.Mutex
-	in      io.ReadCloser
-	origIn  io.ReadCloser
-	size    int64
-	name    string
-	statmu  sync.Mutex         // Separate mutex for stat values.
-	bytes   int64              // Total number of bytes read
-	start   time.Time          // Start time of first read
-	lpTime  time.Time          // Time of last average measurement
-	lpBytes int                // Number of bytes read since last measurement
-	avg     ewma.MovingAverage // Moving average of last few measurements
-	closed  bool               // set if the file is closed
-	exit    chan struct{}      // channel that will be closed when transfer is finished
-	withBuf bool               // is using a buffered in
+	mu        sync.Mutex
+	in        io.ReadCloser
+	origIn    io.ReadCloser
+	size      int64
+	name      string
+	statmu    sync.Mutex         // Separate mutex for stat values.
+	bytes     int64              // Total number of bytes read
+	start     time.Time          // Start time of first read
+	lpTime    time.Time          // Time of last average measurement
+	lpBytes   int                // Number of bytes read since last measurement
+	avg       ewma.MovingAverage // Moving average of last few measurements
+	closed    bool               // set if the file is closed
+	exit      chan struct{}      // channel that will be closed when transfer is finished
+	withBuf   bool               // is using a buffered in
+	direction Direction          // which way the transfer goes for the bandwidth limits
 
 	wholeFileDisabled bool // disables the whole file when doing parts
 }
@@ -370,9 +822,47 @@ func NewAccount(in io.ReadCloser, obj Object) *Account {
 	return NewAccountSizeName(in, obj.Size(), obj.Remote())
 }
 
+// WithDirection sets the direction of the transfer so the upload and
+// download bandwidth limits which apply to it are used
+func (acc *Account) WithDirection(d Direction) *Account {
+	acc.direction = d
+	return acc
+}
+
+// nopCloserTypes are the types ioutil.NopCloser returns - it returns
+// a different one for readers with a WriteTo method
+var nopCloserTypes = map[reflect.Type]bool{
+	reflect.TypeOf(ioutil.NopCloser(nil)):             true,
+	reflect.TypeOf(ioutil.NopCloser(&bytes.Buffer{})): true,
+}
+
+// inMemory returns true if in is read from memory already, or is
+// already buffered, so buffering it again would only use more memory
+func inMemory(in io.Reader) bool {
+	switch x := in.(type) {
+	case *bytes.Reader, *bytes.Buffer, *strings.Reader, *asyncReader:
+		return true
+	case *readCloser:
+		return inMemory(x.Reader)
+	}
+	// ioutil.NopCloser doesn't export its type so look inside it
+	// with reflection
+	if in != nil && nopCloserTypes[reflect.TypeOf(in)] {
+		if wrapped, ok := reflect.ValueOf(in).Field(0).Interface().(io.Reader); ok {
+			return inMemory(wrapped)
+		}
+	}
+	return false
+}
+
 // WithBuffer - If the file is above a certain size it adds an Async reader
+//
+// Readers which are in memory already aren't buffered.
 func (acc *Account) WithBuffer() *Account {
 	acc.withBuf = true
+	if inMemory(acc.in) {
+		return acc
+	}
 	var buffers int
 	if acc.size >= int64(Config.BufferSize) || acc.size == -1 {
 		buffers = int(int64(Config.BufferSize) / asyncBufferSize)
@@ -458,6 +948,11 @@ func (acc *Account) read(in io.Reader, p []byte) (n int, err error) {
 	}
 	acc.statmu.Unlock()
 
+	// Stop the transfer mid stream with --cutoff-mode hard
+	if Config.CutoffMode == CutoffModeHard && Stats.MaxTransferReached() {
+		return 0, ErrorMaxTransferLimitReached
+	}
+
 	n, err = in.Read(p)
 
 	// Update Stats
@@ -468,17 +963,14 @@ func (acc *Account) read(in io.Reader, p []byte) (n int, err error) {
 
 	Stats.Bytes(int64(n))
 
-	// Get the token bucket in use
+	// Get the token buckets in use - don't hold the lock while
+	// waiting so the limit can be changed or toggled meanwhile
 	tokenBucketMu.Lock()
+	tbs := tokenBucket
+	tokenBucketMu.Unlock()
 
 	// Limit the transfer speed if required
-	if tokenBucket != nil {
-		tbErr := tokenBucket.WaitN(context.Background(), n)
-		if tbErr != nil {
-			Errorf(nil, "Token bucket error: %v", err)
-		}
-	}
-	tokenBucketMu.Unlock()
+	tbs.wait(acc.direction, n)
 	return
 }
 
@@ -549,6 +1041,44 @@ func (acc *Account) ETA() (eta time.Duration, ok bool) {
 	return time.Duration(time.Second * time.Duration(int(seconds))), true
 }
 
+// RemoteStats returns the stats for this file as a map for the
+// remote control API.  The percentage and eta are only present if
+// known.
+func (acc *Account) RemoteStats() map[string]interface{} {
+	a, b := acc.Progress()
+	avg, cur := acc.Speed()
+	out := map[string]interface{}{
+		"name":     acc.name,
+		"bytes":    a,
+		"size":     b,
+		"speed":    cur,
+		"speedAvg": avg,
+	}
+	if b > 0 {
+		out["percentage"] = int(100 * float64(a) / float64(b))
+	}
+	if eta, ok := acc.ETA(); ok {
+		out["eta"] = eta.Seconds()
+	}
+	return out
+}
+
+// shortenName shortens name to at most maxLen characters by replacing
+// the middle of it with an ellipsis.  It leaves name alone if maxLen
+// is 0 or less.
+func shortenName(name string, maxLen int) string {
+	runes := []rune(name)
+	if maxLen <= 0 || len(runes) <= maxLen {
+		return name
+	}
+	if maxLen < 2 {
+		return string(runes[:maxLen])
+	}
+	left := (maxLen - 1) / 2
+	right := maxLen - 1 - left
+	return string(runes[:left]) + "…" + string(runes[len(runes)-right:])
+}
+
 // String produces stats for this file
 func (acc *Account) String() string {
 	a, b := acc.Progress()
@@ -562,24 +1092,23 @@ func (acc *Account) String() string {
 			etas = "0s"
 		}
 	}
-	name := []rune(acc.name)
-	if len(name) > 45 {
-		where := len(name) - 42
-		name = append([]rune{'.', '.', '.'}, name[where:]...)
-	}
-
-	if Config.DataRateUnit == "bits" {
-		cur = cur * 8
-	}
-
-	done := ""
-	if b > 0 {
-		done = fmt.Sprintf("%2d%% done, ", int(100*float64(a)/float64(b)))
+	name := shortenName(acc.name, Config.StatsFileNameLength)
+	if b <= 0 {
+		// Size unknown so only the bytes so far can be shown
+		return fmt.Sprintf("%*s: %s, %s",
+			Config.StatsFileNameLength,
+			name,
+			SizeSuffix(a).Unit("Bytes"),
+			speedString(cur),
+		)
 	}
-	return fmt.Sprintf("%45s: %s%s, ETA: %s",
-		string(name),
-		done,
-		SizeSuffix(cur).Unit(strings.Title(Config.DataRateUnit)+"/s"),
+	return fmt.Sprintf("%*s: %2d%% done, %s / %s, %s, ETA: %s",
+		Config.StatsFileNameLength,
+		name,
+		int(100*float64(a)/float64(b)),
+		SizeSuffix(a).Unit("Bytes"),
+		SizeSuffix(b).Unit("Bytes"),
+		speedString(cur),
 		etas,
 	)
 }
@@ -0,0 +1,235 @@
+package fs
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/time/rate"
+)
+
+func TestSetTokenBucket(t *testing.T) {
+	var tb *rate.Limiter
+
+	// Off leaves it off
+	setTokenBucket(&tb, -1)
+	assert.Nil(t, tb)
+
+	// Turning it on makes a new bucket
+	setTokenBucket(&tb, 2*1024*1024)
+	assert.NotNil(t, tb)
+	assert.Equal(t, rate.Limit(2*1024*1024), tb.Limit())
+
+	// Changing the limit changes the rate of the same bucket so
+	// transfers using it aren't disturbed
+	old := tb
+	setTokenBucket(&tb, 10*1024*1024)
+	assert.True(t, old == tb)
+	assert.Equal(t, rate.Limit(10*1024*1024), tb.Limit())
+
+	// Turning it off removes it
+	setTokenBucket(&tb, 0)
+	assert.Nil(t, tb)
+}
+
+func TestTokenBucketsSet(t *testing.T) {
+	var tbs tokenBuckets
+	assert.False(t, tbs.isSet())
+
+	tbs.set(BwTimeSlot{bandwidth: 1024 * 1024})
+	assert.True(t, tbs.isSet())
+	assert.NotNil(t, tbs.all)
+	assert.Nil(t, tbs.upload)
+	assert.Nil(t, tbs.download)
+
+	tbs.set(BwTimeSlot{upload: 1024 * 1024, download: -1})
+	assert.Nil(t, tbs.all)
+	assert.NotNil(t, tbs.upload)
+	assert.Nil(t, tbs.download)
+
+	tbs.set(BwTimeSlot{bandwidth: -1})
+	assert.False(t, tbs.isSet())
+}
+
+func TestTransferDirection(t *testing.T) {
+	local := &aboutFs{features: &Features{IsLocal: true}}
+	remote := &aboutFs{features: &Features{}}
+	assert.Equal(t, DirectionUpload, TransferDirection(local, remote))
+	assert.Equal(t, DirectionDownload, TransferDirection(remote, local))
+	assert.Equal(t, DirectionUpload|DirectionDownload, TransferDirection(remote, remote))
+	assert.Equal(t, Direction(0), TransferDirection(local, local))
+	assert.Equal(t, DirectionUpload, TransferDirection(nil, remote))
+	assert.Equal(t, DirectionDownload, TransferDirection(remote, nil))
+}
+
+func TestDirectionBucket(t *testing.T) {
+	tb := newTokenBucket(1024 * 1024)
+	assert.True(t, tb == DirectionUpload.bucket(DirectionUpload, tb))
+	assert.Nil(t, DirectionUpload.bucket(DirectionDownload, tb))
+	assert.True(t, tb == (DirectionUpload|DirectionDownload).bucket(DirectionDownload, tb))
+}
+
+func TestAccountWithBuffer(t *testing.T) {
+	oldBufferSize := Config.BufferSize
+	defer func() { Config.BufferSize = oldBufferSize }()
+	Config.BufferSize = 4 * asyncBufferSize
+
+	for _, test := range []struct {
+		what     string
+		in       func() io.ReadCloser
+		size     int64
+		buffered bool
+	}{
+		{"big file", func() io.ReadCloser { return ioutil.NopCloser(iotest.OneByteReader(strings.NewReader(""))) }, 10 * asyncBufferSize, true},
+		{"unknown size", func() io.ReadCloser { return ioutil.NopCloser(iotest.OneByteReader(strings.NewReader(""))) }, -1, true},
+		{"small file", func() io.ReadCloser { return ioutil.NopCloser(iotest.OneByteReader(strings.NewReader(""))) }, asyncBufferSize / 2, false},
+		{"in memory", func() io.ReadCloser {
+			return &readCloser{Reader: bytes.NewReader(nil), Closer: ioutil.NopCloser(nil)}
+		}, 10 * asyncBufferSize, false},
+		{"in memory with NopCloser", func() io.ReadCloser { return ioutil.NopCloser(strings.NewReader("")) }, 10 * asyncBufferSize, false},
+		{"in memory with NopCloser without WriteTo", func() io.ReadCloser {
+			return ioutil.NopCloser(&readCloser{Reader: bytes.NewReader(nil), Closer: ioutil.NopCloser(nil)})
+		}, 10 * asyncBufferSize, false},
+	} {
+		acc := NewAccountSizeName(test.in(), test.size, "test").WithBuffer()
+		asyncIn, buffered := acc.in.(*asyncReader)
+		assert.Equal(t, test.buffered, buffered, test.what)
+		if buffered {
+			// sized down to --buffer-size
+			assert.Equal(t, 4, asyncIn.buffers, test.what)
+		}
+		assert.NoError(t, acc.Close(), test.what)
+	}
+}
+
+func TestStatsProgressString(t *testing.T) {
+	s := NewStats()
+	s.SetListed(false)
+	s.QueueTransfer(100)
+	s.QueueTransfer(200)
+	s.QueueTransfer(-1)
+	s.DequeueTransfer(100)
+	s.Bytes(100)
+	s.DoneTransferring("file1", true)
+	out := s.ProgressString()
+	assert.Contains(t, out, "Transferred:    100 Bytes / 300 Bytes, 33%,")
+	assert.Contains(t, out, "Transferred:            1 / 3\n")
+
+	// The ETA is only known once all the transfers are queued
+	assert.Contains(t, out, "ETA -\n")
+	s.SetListed(true)
+
+	s.DequeueTransfer(200)
+	s.DequeueTransfer(-1)
+	s.Bytes(200)
+	s.DoneTransferring("file2", true)
+	s.DoneTransferring("file3", true)
+	out = s.ProgressString()
+	assert.Contains(t, out, "Transferred:    300 Bytes / 300 Bytes, 100%,")
+	assert.Contains(t, out, "ETA 0s\n")
+	assert.Contains(t, out, "Transferred:            3 / 3\n")
+
+	// Operations without a listing, eg copyto, have an ETA
+	s = NewStats()
+	s.QueueTransfer(100)
+	s.Bytes(50)
+	out = s.ProgressString()
+	assert.Contains(t, out, "Transferred:     50 Bytes / 150 Bytes, 33%,")
+	assert.NotContains(t, out, "ETA -\n")
+}
+
+func TestShortenName(t *testing.T) {
+	for _, test := range []struct {
+		in     string
+		maxLen int
+		want   string
+	}{
+		{"", 10, ""},
+		{"abcde", 10, "abcde"},
+		{"abcde", 0, "abcde"},
+		{"abcde", -1, "abcde"},
+		{"abcde", 5, "abcde"},
+		{"abcde", 4, "a…de"},
+		{"abcde", 3, "a…e"},
+		{"abcde", 2, "…e"},
+		{"abcde", 1, "a"},
+		{"directory/subdirectory/file.txt", 15, "directo…ile.txt"},
+		{"ééééé", 4, "é…éé"},
+	} {
+		got := shortenName(test.in, test.maxLen)
+		assert.Equal(t, test.want, got, "%q %d", test.in, test.maxLen)
+		if test.maxLen > 0 {
+			assert.True(t, len([]rune(got)) <= test.maxLen)
+		}
+	}
+}
+
+func TestStatsOneLine(t *testing.T) {
+	oldStatsOneLine := Config.StatsOneLine
+	defer func() { Config.StatsOneLine = oldStatsOneLine }()
+	Config.StatsOneLine = true
+
+	s := NewStats()
+	s.QueueTransfer(300)
+	s.Bytes(100)
+	s.Error()
+	for _, out := range []string{s.String(), s.ProgressString()} {
+		assert.NotContains(t, out, "\n")
+		assert.Contains(t, out, "100 Bytes / 400 Bytes, 25%,")
+		assert.Contains(t, out, ", Errors 1, Checks 0, Transferred 0 / 1, Elapsed ")
+	}
+}
+
+func TestAccountString(t *testing.T) {
+	oldStatsFileNameLength := Config.StatsFileNameLength
+	defer func() { Config.StatsFileNameLength = oldStatsFileNameLength }()
+	Config.StatsFileNameLength = 10
+
+	in := ioutil.NopCloser(strings.NewReader("0123456789"))
+	acc := NewAccountSizeName(in, 20, "a/long/file/name.txt")
+	buf := make([]byte, 5)
+	_, err := acc.Read(buf)
+	require.NoError(t, err)
+	assert.Contains(t, acc.String(), "a/lo…e.txt: 25% done, 5 Bytes / 20 Bytes, ")
+	assert.Contains(t, acc.String(), ", ETA: ")
+	require.NoError(t, acc.Close())
+
+	// Unknown size streams only show the bytes
+	in = ioutil.NopCloser(strings.NewReader("0123456789"))
+	acc = NewAccountSizeName(in, -1, "stream")
+	_, err = acc.Read(buf)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(acc.String(), "    stream: 5 Bytes, "), acc.String())
+	assert.NotContains(t, acc.String(), "ETA")
+	require.NoError(t, acc.Close())
+}
+
+func TestSetBwLimit(t *testing.T) {
+	oldBwLimit := bwLimit
+	defer func() {
+		require.NoError(t, SetBwLimit("off"))
+		bwLimit = oldBwLimit
+	}()
+
+	require.NoError(t, SetBwLimit("1M"))
+	assert.Equal(t, "1M", CurrentBwLimit())
+	tokenBucketMu.Lock()
+	assert.NotNil(t, tokenBucket.all)
+	tokenBucketMu.Unlock()
+
+	require.NoError(t, SetBwLimit("off:2M"))
+	assert.Equal(t, "off:2M", CurrentBwLimit())
+	tokenBucketMu.Lock()
+	assert.Nil(t, tokenBucket.all)
+	assert.NotNil(t, tokenBucket.download)
+	tokenBucketMu.Unlock()
+
+	assert.Error(t, SetBwLimit("08:00,1M 09:00,off"))
+	assert.Error(t, SetBwLimit("potato"))
+	assert.Equal(t, "off:2M", CurrentBwLimit())
+}
@@ -24,7 +24,7 @@ func startSignalHandler() {
 			bwLimitToggledOff = !bwLimitToggledOff
 			tokenBucket, prevTokenBucket = prevTokenBucket, tokenBucket
 			s := "disabled"
-			if tokenBucket != nil {
+			if tokenBucket.isSet() {
 				s = "enabled"
 			}
 			tokenBucketMu.Unlock()
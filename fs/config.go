@@ -9,6 +9,7 @@ import (
 	"crypto/cipher"
 	"crypto/rand"
 	"crypto/sha256"
+	"crypto/tls"
 	"encoding/base64"
 	"fmt"
 	"io"
@@ -81,6 +82,9 @@ var (
 	dumpBodies            = BoolP("dump-bodies", "", false, "Dump HTTP headers and bodies - may contain sensitive info")
 	dumpAuth              = BoolP("dump-auth", "", false, "Dump HTTP headers with auth info")
 	skipVerify            = BoolP("no-check-certificate", "", false, "Do not verify the server SSL certificate. Insecure.")
+	caCert                = StringP("ca-cert", "", "", "CA certificate bundle used to verify servers")
+	clientCert            = StringP("client-cert", "", "", "Client SSL certificate (PEM) for mutual TLS auth")
+	clientKey             = StringP("client-key", "", "", "Client SSL private key (PEM) for mutual TLS auth")
 	AskPassword           = BoolP("ask-password", "", true, "Allow prompt for password for encrypted configuration.")
 	deleteBefore          = BoolP("delete-before", "", false, "When synchronizing, delete files on destination before transfering")
 	deleteDuring          = BoolP("delete-during", "", false, "When synchronizing, delete files during transfer (default)")
@@ -94,19 +98,46 @@ var (
 	ignoreChecksum        = BoolP("ignore-checksum", "", false, "Skip post copy check of checksums.")
 	noTraverse            = BoolP("no-traverse", "", false, "Don't traverse destination file system on copy.")
 	noUpdateModTime       = BoolP("no-update-modtime", "", false, "Don't update destination mod-time if files identical.")
+	noUpdateDirModTime    = BoolP("no-update-dir-modtime", "", false, "Don't set the mod-time of destination directories.")
+	useMetadata           = BoolP("metadata", "M", false, "Copy the metadata of objects between remotes which support it.")
+	noVerifyMove          = BoolP("no-verify-move", "", false, "Don't check the copy before deleting the source when moving.")
+	createEmptySrcDirs    = BoolP("create-empty-src-dirs", "", false, "Create empty source dirs on destination after sync.")
+	deleteEmptySrcDirs    = BoolP("delete-empty-src-dirs", "", false, "Delete empty source dirs after move.")
+	ignoreCaseSync        = BoolP("ignore-case-sync", "", false, "Ignore case when synchronizing.")
+	verifyMoveDownload    = BoolP("verify-move-download", "", false, "When moving without a common hash, download both files to check the copy.")
 	backupDir             = StringP("backup-dir", "", "", "Make backups into hierarchy based in DIR.")
-	suffix                = StringP("suffix", "", "", "Suffix for use with --backup-dir.")
-	useListR              = BoolP("fast-list", "", false, "Use recursive list if available. Uses more memory but fewer transactions.")
+	compareDest           = StringArrayP("compare-dest", "", nil, "Include additional server-side path during comparison (can be repeated).")
+	copyDest              = StringArrayP("copy-dest", "", nil, "Include additional server-side path during comparison and copy matching files from it (can be repeated).")
+	suffix                = StringP("suffix", "", "", "Suffix to add to overwritten and deleted files, in --backup-dir or in place without it.")
+	suffixKeepExtension   = BoolP("suffix-keep-extension", "", false, "Put the --suffix before the file extension, eg file.bak.txt rather than file.txt.bak.")
+	useListR              = BoolP("fast-list", "", false, "Use recursive list if available. Uses more memory but fewer transactions. Used automatically if not set.")
+	fastListMaxEntries    = IntP("fast-list-max-entries", "", 0, "Max number of entries read with --fast-list to hold waiting to be processed before listing directories individually (0 for no limit).")
+	useServerModTime      = BoolP("use-server-modtime", "", false, "Use server modified time instead of object metadata")
 	tpsLimit              = Float64P("tpslimit", "", 0, "Limit HTTP transactions per second to this.")
 	tpsLimitBurst         = IntP("tpslimit-burst", "", 1, "Max burst of transactions for --tpslimit.")
 	bindAddr              = StringP("bind", "", "", "Local address to bind to for outgoing connections, IPv4, IPv6 or name.")
 	disableFeatures       = StringP("disable", "", "", "Disable a comma separated list of features.  Use help to see a list.")
-	userAgent             = StringP("user-agent", "", "rclone/"+Version, "Set the user-agent to a specified string. The default is rclone/ version")
+	immutable             = BoolP("immutable", "", false, "Do not modify files. Fail if existing files have been modified.")
+	partialUploads        = BoolP("partial-uploads", "", false, "Upload to a temporary name then move into place on remotes which can move.")
+	maxDelete             = IntP("max-delete", "", -1, "When synchronizing, limit the number of deletes")
+	maxDeleteErrors       = IntP("max-delete-errors", "", -1, "Stop deleting files after this many errors (-1 for no limit)")
+	orderBy               = StringP("order-by", "", "", "Instructions on how to order the transfers, eg 'size,desc'")
+	maxBacklog            = IntP("max-backlog", "", 10000, "Maximum number of objects in the transfer queue to sort for --order-by.")
+	smallFileTransfers    = Float64P("small-file-transfers", "", 0.25, "Fraction of the --transfers reserved for small files with --transfer-scheduler fair.")
+	statsOneLine          = BoolP("stats-one-line", "", false, "Make the stats fit on one line.")
+	statsFileNameLength   = IntP("stats-file-name-length", "", 45, "Max file name length in stats. 0 for no limit")
+	multiThreadStreams    = IntP("multi-thread-streams", "", 4, "Max number of streams to use for multi-thread downloads.")
+	userAgent             = StringP("user-agent", "", defaultUserAgent, "Set the user-agent to a specified string. The default is rclone/ version")
 	streamingUploadCutoff = SizeSuffix(100 * 1024)
 	logLevel              = LogLevelNotice
 	statsLogLevel         = LogLevelInfo
 	bwLimit               BwTimetable
 	bufferSize            SizeSuffix = 16 << 20
+	multiThreadCutoff     SizeSuffix = 250 << 20
+	maxTransfer           SizeSuffix = -1
+	cutoffMode                       = CutoffModeSoft
+	transferScheduler                = TransferSchedulerFIFO
+	smallFileCutoff       SizeSuffix = 10 << 20
 
 	// Key to use for password en/decryption.
 	// When nil, no encryption will be used for saving.
@@ -118,6 +149,11 @@ func init() {
 	VarP(&statsLogLevel, "stats-log-level", "", "Log level to show --stats output DEBUG|INFO|NOTICE|ERROR")
 	VarP(&bwLimit, "bwlimit", "", "Bandwidth limit in kBytes/s, or use suffix b|k|M|G or a full timetable.")
 	VarP(&bufferSize, "buffer-size", "", "Buffer size when copying files.")
+	VarP(&multiThreadCutoff, "multi-thread-cutoff", "", "Use multi-thread downloads for files above this size.")
+	VarP(&maxTransfer, "max-transfer", "", "Maximum size of data to transfer.")
+	VarP(&cutoffMode, "cutoff-mode", "", "Mode to stop transfers when reaching the --max-transfer limit soft|hard")
+	VarP(&transferScheduler, "transfer-scheduler", "", "How to share the transfer slots between the files fifo|fair")
+	VarP(&smallFileCutoff, "small-file-cutoff", "", "Files below this size are small for --transfer-scheduler fair.")
 	VarP(&streamingUploadCutoff, "streaming-upload-cutoff", "", "Cutoff for switching to chunked upload if file size is unknown. Upload starts after reaching cutoff or when file ends.")
 }
 
@@ -220,7 +256,10 @@ type ConfigInfo struct {
 	DumpBodies            bool
 	DumpAuth              bool
 	Filter                *Filter
-	InsecureSkipVerify    bool // Skip server certificate verification
+	InsecureSkipVerify    bool   // Skip server certificate verification
+	CaCert                string // Path to the CA certificate bundle used to verify servers
+	ClientCert            string // Path to the client certificate for mutual TLS
+	ClientKey             string // Path to the client key for mutual TLS
 	DeleteMode            DeleteMode
 	TrackRenames          bool // Track file renames.
 	LowLevelRetries       int
@@ -231,16 +270,48 @@ type ConfigInfo struct {
 	IgnoreChecksum        bool
 	NoTraverse            bool
 	NoUpdateModTime       bool
+	NoUpdateDirModTime    bool
+	Metadata              bool
+	NoVerifyMove          bool
+	CreateEmptySrcDirs    bool
+	DeleteEmptySrcDirs    bool
+	IgnoreCaseSync        bool
+	VerifyMoveDownload    bool
 	DataRateUnit          string
 	BackupDir             string
 	Suffix                string
 	UseListR              bool
+	AutoListR             bool // use ListR when it is likely to be cheaper if UseListR isn't set
+	FastListMaxEntries    int
+	UseServerModTime      bool
 	BufferSize            SizeSuffix
 	TPSLimit              float64
 	TPSLimitBurst         int
 	BindAddr              net.IP
 	DisableFeatures       []string
 	StreamingUploadCutoff SizeSuffix
+	MultiThreadCutoff     SizeSuffix
+	MultiThreadStreams    int
+	TransferScheduler     TransferScheduler // how to share the transfers between the files
+	SmallFileCutoff       SizeSuffix        // files below this size are small for the fair scheduler
+	SmallFileTransfers    float64           // fraction of the transfers kept for small files
+	PartialUploads        bool
+	Immutable             bool
+	SuffixKeepExtension   bool
+	MaxTransfer           SizeSuffix
+	CutoffMode            CutoffMode
+	MaxDelete             int64
+	MaxDeleteErrors       int64
+	CompareDest           []string
+	CopyDest              []string
+	OrderBy               string // how to order the transfers
+	MaxBacklog            int    // max number of transfers to queue for ordering
+	StatsOneLine          bool   // make the stats fit on one line
+	StatsFileNameLength   int    // max length of file names in the stats, 0 for no limit
+	UseJSONLog            bool   // log in JSON format - set by InitLogging
+	UserAgent             string // the User-Agent sent with every HTTP request
+
+	tlsConfig *tls.Config // made from the TLS options by LoadTLSConfig
 }
 
 // Return the path to the configuration file
@@ -324,6 +395,48 @@ const (
 	DeleteModeDefault = DeleteModeAfter
 )
 
+// CutoffMode describes what happens to transfers in progress when
+// the --max-transfer limit is reached
+type CutoffMode byte
+
+// CutoffMode constants
+const (
+	CutoffModeSoft CutoffMode = iota // let transfers in progress finish
+	CutoffModeHard                   // stop transfers in progress immediately
+)
+
+var cutoffModeToString = []string{
+	CutoffModeSoft: "soft",
+	CutoffModeHard: "hard",
+}
+
+// String turns a CutoffMode into a string
+func (m CutoffMode) String() string {
+	if int(m) >= len(cutoffModeToString) {
+		return fmt.Sprintf("CutoffMode(%d)", m)
+	}
+	return cutoffModeToString[m]
+}
+
+// Set a CutoffMode
+func (m *CutoffMode) Set(s string) error {
+	for n, name := range cutoffModeToString {
+		if strings.EqualFold(s, name) {
+			*m = CutoffMode(n)
+			return nil
+		}
+	}
+	return errors.Errorf("Unknown cutoff mode %q", s)
+}
+
+// Type of the value
+func (m *CutoffMode) Type() string {
+	return "string"
+}
+
+// Check it satisfies the interface
+var _ pflag.Value = (*CutoffMode)(nil)
+
 // LoadConfig loads the config file
 func LoadConfig() {
 	// Read some flags if set
@@ -366,6 +479,9 @@ func LoadConfig() {
 	Config.DumpBodies = *dumpBodies
 	Config.DumpAuth = *dumpAuth
 	Config.InsecureSkipVerify = *skipVerify
+	Config.CaCert = *caCert
+	Config.ClientCert = *clientCert
+	Config.ClientKey = *clientKey
 	Config.LowLevelRetries = *lowLevelRetries
 	Config.UpdateOlder = *updateOlder
 	Config.NoGzip = *noGzip
@@ -374,13 +490,43 @@ func LoadConfig() {
 	Config.IgnoreChecksum = *ignoreChecksum
 	Config.NoTraverse = *noTraverse
 	Config.NoUpdateModTime = *noUpdateModTime
+	Config.NoUpdateDirModTime = *noUpdateDirModTime
+	Config.Metadata = *useMetadata
+	Config.NoVerifyMove = *noVerifyMove
+	Config.CreateEmptySrcDirs = *createEmptySrcDirs
+	Config.DeleteEmptySrcDirs = *deleteEmptySrcDirs
+	Config.IgnoreCaseSync = *ignoreCaseSync
+	Config.VerifyMoveDownload = *verifyMoveDownload
 	Config.BackupDir = *backupDir
 	Config.Suffix = *suffix
+	Config.SuffixKeepExtension = *suffixKeepExtension
 	Config.UseListR = *useListR
+	useListRFlag := pflag.Lookup("fast-list")
+	Config.AutoListR = useListRFlag == nil || !useListRFlag.Changed
+	Config.FastListMaxEntries = *fastListMaxEntries
+	Config.UseServerModTime = *useServerModTime
 	Config.TPSLimit = *tpsLimit
 	Config.TPSLimitBurst = *tpsLimitBurst
 	Config.BufferSize = bufferSize
 	Config.StreamingUploadCutoff = streamingUploadCutoff
+	Config.MultiThreadCutoff = multiThreadCutoff
+	Config.MultiThreadStreams = *multiThreadStreams
+	Config.PartialUploads = *partialUploads
+	Config.Immutable = *immutable
+	Config.MaxTransfer = maxTransfer
+	Config.CutoffMode = cutoffMode
+	Config.MaxDelete = int64(*maxDelete)
+	Config.MaxDeleteErrors = int64(*maxDeleteErrors)
+	Config.CompareDest = *compareDest
+	Config.CopyDest = *copyDest
+	Config.OrderBy = *orderBy
+	Config.MaxBacklog = *maxBacklog
+	Config.TransferScheduler = transferScheduler
+	Config.SmallFileCutoff = smallFileCutoff
+	Config.SmallFileTransfers = *smallFileTransfers
+	Config.StatsOneLine = *statsOneLine
+	Config.UserAgent = *userAgent
+	Config.StatsFileNameLength = *statsFileNameLength
 
 	Config.TrackRenames = *trackRenames
 
@@ -402,8 +548,32 @@ func LoadConfig() {
 		log.Fatalf(`Can't use --size-only and --ignore-size together.`)
 	}
 
-	if Config.Suffix != "" && Config.BackupDir == "" {
-		log.Fatalf(`Can only use --suffix with --backup-dir.`)
+	if Config.IgnoreChecksum {
+		Logf(nil, "--ignore-checksum is set so only the sizes of transferred files will be checked, not their checksums")
+	}
+
+	if err := Config.LoadTLSConfig(); err != nil {
+		log.Fatalf("Failed to configure TLS: %v", err)
+	}
+
+	if Config.InsecureSkipVerify {
+		Logf(nil, "--no-check-certificate is set so server certificates won't be verified - this is insecure")
+	}
+
+	if len(Config.CompareDest) > 0 && len(Config.CopyDest) > 0 {
+		log.Fatalf(`Can't use --compare-dest with --copy-dest.`)
+	}
+
+	if _, err := newTransferOrder(Config.OrderBy); err != nil {
+		log.Fatalf("--order-by: %v", err)
+	}
+
+	if Config.SmallFileTransfers <= 0 || Config.SmallFileTransfers >= 1 {
+		log.Fatalf(`--small-file-transfers must be between 0 and 1.`)
+	}
+
+	if Config.SuffixKeepExtension && Config.Suffix == "" {
+		log.Fatalf(`Can only use --suffix-keep-extension with --suffix.`)
 	}
 
 	if *bindAddr != "" {
@@ -1259,6 +1429,38 @@ func ConfigFileGetInt(section, key string, defaultVal ...int) int {
 	return configData.MustInt(section, key, defaultVal...)
 }
 
+// ConfigFileGetFlag gets the config key under section for a backend
+// which also has a flag called name, eg "chunk_size" and
+// "swift-chunk-size".
+//
+// The value is looked up in this order
+//
+//   - the remote's environment variable, eg RCLONE_CONFIG_MYSWIFT_CHUNK_SIZE
+//   - the backend's environment variable, eg RCLONE_SWIFT_CHUNK_SIZE
+//   - the command line flag if it was set
+//   - the config file
+//
+// It returns false if none of these are set in which case the default
+// should be used.
+//
+// All the swift and s3 flags use this.  They are listed under
+// "Backend options" in docs.md so add any new ones there.
+func ConfigFileGetFlag(section, key, name string) (string, bool) {
+	if value, found := os.LookupEnv(configToEnv(section, key)); found {
+		return value, true
+	}
+	if value, found := os.LookupEnv(optionToEnv(name)); found {
+		return value, true
+	}
+	if flag := pflag.Lookup(name); flag != nil && flag.Changed {
+		return flag.Value.String(), true
+	}
+	if value, err := configData.GetValue(section, key); err == nil {
+		return value, true
+	}
+	return "", false
+}
+
 // ConfigFileSet sets the key in section to value.  It doesn't save
 // the config file.
 func ConfigFileSet(section, key, value string) {
@@ -7,6 +7,8 @@ import (
 	"os"
 	"testing"
 
+	"github.com/Unknwon/goconfig"
+	"github.com/spf13/pflag"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -229,3 +231,41 @@ func hashedKeyCompare(t *testing.T, a, b string, shouldMatch bool) {
 		assert.NotEqual(t, k1, k2)
 	}
 }
+
+func TestConfigFileGetFlag(t *testing.T) {
+	oldConfigData := configData
+	defer func() { configData = oldConfigData }()
+	var err error
+	configData, err = goconfig.LoadFromData([]byte("[mypotato]\ntype = potato\n"))
+	require.NoError(t, err)
+	if pflag.Lookup("potato-chunk-size") == nil {
+		pflag.String("potato-chunk-size", "1M", "Test flag")
+	}
+	flag := pflag.Lookup("potato-chunk-size")
+	defer func() {
+		flag.Changed = false
+		_ = os.Unsetenv("RCLONE_POTATO_CHUNK_SIZE")
+		_ = os.Unsetenv("RCLONE_CONFIG_MYPOTATO_CHUNK_SIZE")
+	}()
+	check := func(want string) {
+		got, found := ConfigFileGetFlag("mypotato", "chunk_size", "potato-chunk-size")
+		assert.Equal(t, want != "", found, want)
+		assert.Equal(t, want, got)
+	}
+
+	// Set each source in turn, lowest precedence first
+	check("")
+	configData.SetValue("mypotato", "chunk_size", "2M")
+	check("2M")
+	require.NoError(t, pflag.Set("potato-chunk-size", "3M"))
+	check("3M")
+	require.NoError(t, os.Setenv("RCLONE_POTATO_CHUNK_SIZE", "4M"))
+	check("4M")
+	require.NoError(t, os.Setenv("RCLONE_CONFIG_MYPOTATO_CHUNK_SIZE", "5M"))
+	check("5M")
+
+	// Other remotes only see the backend settings
+	got, found := ConfigFileGetFlag("othpotato", "chunk_size", "potato-chunk-size")
+	assert.True(t, found)
+	assert.Equal(t, "4M", got)
+}
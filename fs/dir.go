@@ -67,6 +67,12 @@ func (d *Dir) ModTime() time.Time {
 	return time.Now()
 }
 
+// SetModTime sets the modification time
+func (d *Dir) SetModTime(modTime time.Time) *Dir {
+	d.modTime = modTime
+	return d
+}
+
 // Size returns the size of the file
 func (d *Dir) Size() int64 {
 	return d.size
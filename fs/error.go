@@ -239,3 +239,108 @@ func ShouldRetryHTTP(resp *http.Response, retryErrorCodes []int) bool {
 	}
 	return false
 }
+
+// ShouldRetryLowLevel returns true if the operation which returned
+// err should be tried again by a low level retry loop.
+//
+// Errors marked with NoRetryError or FatalError are never retried,
+// those marked with RetryError always are, and otherwise ShouldRetry
+// decides.
+func ShouldRetryLowLevel(err error) bool {
+	if err == nil || IsNoRetryError(err) || IsFatalError(err) {
+		return false
+	}
+	return IsRetryError(err) || ShouldRetry(err)
+}
+
+// ErrorClass says how an error returned from a remote should be
+// retried
+type ErrorClass int
+
+// ErrorClass values
+const (
+	// ErrorClassFail is an error which retrying the operation
+	// straight away won't fix, though retrying the sync might
+	ErrorClassFail ErrorClass = iota
+	// ErrorClassRetry is a transient error so the operation
+	// should be retried
+	ErrorClassRetry
+	// ErrorClassNoRetry is a permanent error which retrying the
+	// sync won't fix either
+	ErrorClassNoRetry
+	// ErrorClassFatal is an error which should stop the sync
+	ErrorClassFatal
+)
+
+// String turns an ErrorClass into a string
+func (class ErrorClass) String() string {
+	switch class {
+	case ErrorClassFail:
+		return "fail"
+	case ErrorClassRetry:
+		return "retry"
+	case ErrorClassNoRetry:
+		return "no retry"
+	case ErrorClassFatal:
+		return "fatal"
+	}
+	return fmt.Sprintf("ErrorClass(%d)", int(class))
+}
+
+// Wrap wraps err with FatalError, NoRetryError or RetryError as the
+// class says so the retries of the sync treat it the same way.
+//
+// nil errors and errors of ErrorClassFail are returned unchanged.
+func (class ErrorClass) Wrap(err error) error {
+	if err == nil {
+		return nil
+	}
+	switch class {
+	case ErrorClassFatal:
+		if !IsFatalError(err) {
+			return FatalError(err)
+		}
+	case ErrorClassNoRetry:
+		if !IsNoRetryError(err) {
+			return NoRetryError(err)
+		}
+	case ErrorClassRetry:
+		if !IsRetryError(err) {
+			return RetryError(err)
+		}
+	}
+	return err
+}
+
+// HTTPErrorClasses says how errors with the HTTP status codes used as
+// keys should be retried
+type HTTPErrorClasses map[int]ErrorClass
+
+// Classify returns how err, returned from a request which got the
+// HTTP status code statusCode, should be retried.  statusCode should
+// be 0 if there wasn't a response.
+//
+// Errors marked with FatalError, NoRetryError or RetryError are
+// classified as such, then the status code is looked up and if it
+// isn't found errors which ShouldRetry says are transient, such as
+// timeouts and connection resets, are retried.  Anything else,
+// including a nil error, is ErrorClassFail.
+func (classes HTTPErrorClasses) Classify(statusCode int, err error) ErrorClass {
+	switch {
+	case err == nil:
+		return ErrorClassFail
+	case IsFatalError(err):
+		return ErrorClassFatal
+	case IsNoRetryError(err):
+		return ErrorClassNoRetry
+	case IsRetryError(err):
+		return ErrorClassRetry
+	}
+	if class, ok := classes[statusCode]; ok {
+		return class
+	}
+	if ShouldRetry(err) {
+		return ErrorClassRetry
+	}
+	return ErrorClassFail
+}
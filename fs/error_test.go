@@ -0,0 +1,73 @@
+package fs
+
+import (
+	"io"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShouldRetryLowLevel(t *testing.T) {
+	for _, test := range []struct {
+		err  error
+		want bool
+	}{
+		{nil, false},
+		{errors.New("potato"), false},
+		{io.ErrUnexpectedEOF, true},
+		{RetryError(errors.New("potato")), true},
+		{errors.Wrap(RetryError(errors.New("potato")), "wrapped"), true},
+		{NoRetryError(io.ErrUnexpectedEOF), false},
+		{FatalError(io.ErrUnexpectedEOF), false},
+	} {
+		assert.Equal(t, test.want, ShouldRetryLowLevel(test.err), test.err)
+	}
+}
+
+func TestHTTPErrorClassesClassify(t *testing.T) {
+	classes := HTTPErrorClasses{
+		403: ErrorClassNoRetry,
+		503: ErrorClassRetry,
+	}
+	potato := errors.New("potato")
+	for _, test := range []struct {
+		statusCode int
+		err        error
+		want       ErrorClass
+	}{
+		{0, nil, ErrorClassFail},
+		{503, nil, ErrorClassFail},
+		{0, potato, ErrorClassFail},
+		{404, potato, ErrorClassFail},
+		{403, potato, ErrorClassNoRetry},
+		{503, potato, ErrorClassRetry},
+		{0, io.ErrUnexpectedEOF, ErrorClassRetry},
+		{403, io.ErrUnexpectedEOF, ErrorClassNoRetry},
+		{403, RetryError(potato), ErrorClassRetry},
+		{503, NoRetryError(potato), ErrorClassNoRetry},
+		{503, FatalError(potato), ErrorClassFatal},
+	} {
+		got := classes.Classify(test.statusCode, test.err)
+		assert.Equal(t, test.want, got, "%d %v", test.statusCode, test.err)
+	}
+}
+
+func TestErrorClassWrap(t *testing.T) {
+	potato := errors.New("potato")
+	assert.Nil(t, ErrorClassFatal.Wrap(nil))
+	assert.Equal(t, potato, ErrorClassFail.Wrap(potato))
+
+	err := ErrorClassRetry.Wrap(potato)
+	assert.True(t, IsRetryError(err))
+	assert.Equal(t, "potato", err.Error())
+	assert.True(t, IsNoRetryError(ErrorClassNoRetry.Wrap(potato)))
+	assert.True(t, IsFatalError(ErrorClassFatal.Wrap(potato)))
+
+	// Already wrapped errors aren't wrapped again
+	err = NoRetryError(potato)
+	assert.Equal(t, err, ErrorClassNoRetry.Wrap(err))
+
+	assert.Equal(t, "no retry", ErrorClassNoRetry.String())
+	assert.Equal(t, "ErrorClass(99)", ErrorClass(99).String())
+}
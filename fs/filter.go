@@ -26,6 +26,11 @@ var (
 	includeRule    = StringArrayP("include", "", nil, "Include files matching pattern")
 	includeFrom    = StringArrayP("include-from", "", nil, "Read include patterns from file")
 	filesFrom      = StringArrayP("files-from", "", nil, "Read list of source-file names from file")
+	ignoreCase     = BoolP("ignore-case", "", false, "Ignore case in filters (case insensitive)")
+	includeMime    = StringArrayP("include-mimetype", "", nil, "Include files with mime type matching pattern, eg image/*")
+	excludeMime    = StringArrayP("exclude-mimetype", "", nil, "Exclude files with mime type matching pattern, eg video/*")
+	mimeNoGuess    = BoolP("mimetype-no-guess", "", false, "Don't guess the mime type from the extension if the remote doesn't supply it")
+	excludeFile    = StringArrayP("exclude-if-present", "", nil, "Exclude directories if filename is present")
 	minAge         = StringP("min-age", "", "", "Don't transfer any file younger than this in s or suffix ms|s|m|h|d|w|M|y")
 	maxAge         = StringP("max-age", "", "", "Don't transfer any file older than this in s or suffix ms|s|m|h|d|w|M|y")
 	minSize        = SizeSuffix(-1)
@@ -105,6 +110,11 @@ type Filter struct {
 	ModTimeTo      time.Time
 	fileRules      rules
 	dirRules       rules
+	ExcludeFile    []string // exclude directories containing these file names
+	IgnoreCase     bool     // match filters and files from case insensitively
+	IncludeMime    []string // only include objects with these mime type patterns
+	ExcludeMime    []string // exclude objects with these mime type patterns
+	MimeNoGuess    bool     // don't guess the mime type from the file extension
 	files          FilesMap // files if filesFrom
 	dirs           FilesMap // dirs from filesFrom
 }
@@ -153,6 +163,16 @@ func NewFilter() (f *Filter, err error) {
 		DeleteExcluded: *deleteExcluded,
 		MinSize:        int64(minSize),
 		MaxSize:        int64(maxSize),
+		ExcludeFile:    *excludeFile,
+		IgnoreCase:     *ignoreCase,
+		IncludeMime:    *includeMime,
+		ExcludeMime:    *excludeMime,
+		MimeNoGuess:    *mimeNoGuess,
+	}
+	for _, pattern := range append(f.IncludeMime, f.ExcludeMime...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, errors.Wrapf(err, "bad mime type pattern %q", pattern)
+		}
 	}
 	addImplicitExclude := false
 
@@ -261,7 +281,7 @@ func (f *Filter) addDirGlobs(Include bool, glob string) error {
 		if dirGlob == "/" {
 			continue
 		}
-		dirRe, err := globToRegexp(dirGlob)
+		dirRe, err := globToRegexp(dirGlob, f.IgnoreCase)
 		if err != nil {
 			return err
 		}
@@ -277,7 +297,7 @@ func (f *Filter) Add(Include bool, glob string) error {
 	if strings.Contains(glob, "**") {
 		isDirRule, isFileRule = true, true
 	}
-	re, err := globToRegexp(glob)
+	re, err := globToRegexp(glob, f.IgnoreCase)
 	if err != nil {
 		return err
 	}
@@ -332,10 +352,19 @@ func (f *Filter) initAddFile() {
 	}
 }
 
+// fold returns remote case folded if --ignore-case is in use so it
+// can be used as a key in the files from maps
+func (f *Filter) fold(remote string) string {
+	if f.IgnoreCase {
+		return strings.ToLower(remote)
+	}
+	return remote
+}
+
 // AddFile adds a single file to the files from list
 func (f *Filter) AddFile(file string) error {
 	f.initAddFile()
-	file = strings.Trim(file, "/")
+	file = f.fold(strings.Trim(file, "/"))
 	f.files[file] = struct{}{}
 	// Put all the parent directories into f.dirs
 	for {
@@ -372,7 +401,44 @@ func (f *Filter) InActive() bool {
 		f.MinSize < 0 &&
 		f.MaxSize < 0 &&
 		f.fileRules.len() == 0 &&
-		f.dirRules.len() == 0)
+		f.dirRules.len() == 0 &&
+		len(f.ExcludeFile) == 0 &&
+		len(f.IncludeMime) == 0 &&
+		len(f.ExcludeMime) == 0)
+}
+
+// excludesDirectories returns true if the filters can exclude whole
+// directories, so a recursive listing may read lots of entries which
+// would be thrown away.
+func (f *Filter) excludesDirectories() bool {
+	return f.files != nil || f.dirRules.len() != 0 || len(f.ExcludeFile) != 0
+}
+
+// isExcludeFile returns true if the leaf name of remote is one of
+// the --exclude-if-present file names
+func (f *Filter) isExcludeFile(remote string) bool {
+	leaf := path.Base(remote)
+	for _, excludeFile := range f.ExcludeFile {
+		if leaf == excludeFile {
+			return true
+		}
+	}
+	return false
+}
+
+// ListContainsExcludeFile returns true if entries contains a file
+// named in --exclude-if-present, meaning the directory they were
+// listed from should be excluded
+func (f *Filter) ListContainsExcludeFile(entries DirEntries) bool {
+	if len(f.ExcludeFile) == 0 {
+		return false
+	}
+	for _, entry := range entries {
+		if o, ok := entry.(Object); ok && f.isExcludeFile(o.Remote()) {
+			return true
+		}
+	}
+	return false
 }
 
 // includeRemote returns whether this remote passes the filter rules.
@@ -391,7 +457,7 @@ func (f *Filter) IncludeDirectory(remote string) bool {
 	remote = strings.Trim(remote, "/")
 	// filesFrom takes precedence
 	if f.files != nil {
-		_, include := f.dirs[remote]
+		_, include := f.dirs[f.fold(remote)]
 		return include
 	}
 	remote += "/"
@@ -408,7 +474,7 @@ func (f *Filter) IncludeDirectory(remote string) bool {
 func (f *Filter) Include(remote string, size int64, modTime time.Time) bool {
 	// filesFrom takes precedence
 	if f.files != nil {
-		_, include := f.files[remote]
+		_, include := f.files[f.fold(remote)]
 		return include
 	}
 	if !f.ModTimeFrom.IsZero() && modTime.Before(f.ModTimeFrom) {
@@ -438,7 +504,54 @@ func (f *Filter) IncludeObject(o Object) bool {
 		modTime = time.Unix(0, 0)
 	}
 
-	return f.Include(o.Remote(), o.Size(), modTime)
+	return f.Include(o.Remote(), o.Size(), modTime) && f.includeMimeType(o)
+}
+
+// mimeType returns the mime type of o for filtering on, without any
+// parameters, or "" if it isn't known.
+//
+// It only reads the mime type from the object if the remote supplies
+// it in the listing so it doesn't cause extra transactions, otherwise
+// it guesses it from the extension unless --mimetype-no-guess is set.
+func (f *Filter) mimeType(o Object) (mimeType string) {
+	if do, ok := o.(MimeTyper); ok {
+		if srcFs, ok := o.Fs().(Fs); ok && srcFs.Features().ListMimeType {
+			mimeType = do.MimeType()
+		}
+	}
+	if mimeType == "" {
+		if f.MimeNoGuess {
+			return ""
+		}
+		mimeType = MimeTypeFromName(o.Remote())
+	}
+	if i := strings.IndexRune(mimeType, ';'); i >= 0 {
+		mimeType = mimeType[:i]
+	}
+	return strings.ToLower(strings.TrimSpace(mimeType))
+}
+
+// matchMimeType returns true if mimeType matches any of the patterns
+func matchMimeType(patterns []string, mimeType string) bool {
+	for _, pattern := range patterns {
+		if match, _ := path.Match(strings.ToLower(pattern), mimeType); match {
+			return true
+		}
+	}
+	return false
+}
+
+// includeMimeType returns whether o passes the --include-mimetype and
+// --exclude-mimetype filters
+func (f *Filter) includeMimeType(o Object) bool {
+	if len(f.IncludeMime) == 0 && len(f.ExcludeMime) == 0 {
+		return true
+	}
+	mimeType := f.mimeType(o)
+	if len(f.IncludeMime) > 0 && !matchMimeType(f.IncludeMime, mimeType) {
+		return false
+	}
+	return !matchMimeType(f.ExcludeMime, mimeType)
 }
 
 // forEachLine calls fn on every line in the file pointed to by path
@@ -474,6 +587,15 @@ func (f *Filter) DumpFilters() string {
 	if !f.ModTimeTo.IsZero() {
 		rules = append(rules, fmt.Sprintf("Last-modified date must be equal or less than: %s", f.ModTimeTo.String()))
 	}
+	for _, excludeFile := range f.ExcludeFile {
+		rules = append(rules, fmt.Sprintf("Exclude directories containing: %s", excludeFile))
+	}
+	for _, pattern := range f.IncludeMime {
+		rules = append(rules, fmt.Sprintf("Include mime type: %s", pattern))
+	}
+	for _, pattern := range f.ExcludeMime {
+		rules = append(rules, fmt.Sprintf("Exclude mime type: %s", pattern))
+	}
 	rules = append(rules, "--- File filter rules ---")
 	for _, rule := range f.fileRules.rules {
 		rules = append(rules, rule.String())
@@ -190,6 +190,101 @@ func TestNewFilterIncludeFiles(t *testing.T) {
 	assert.False(t, f.InActive())
 }
 
+func TestNewFilterIgnoreCase(t *testing.T) {
+	f, err := NewFilter()
+	require.NoError(t, err)
+	f.IgnoreCase = true
+	require.NoError(t, f.Add(true, "*.JPG"))
+	require.NoError(t, f.Add(true, "/Ünïcode/**"))
+	require.NoError(t, f.Add(false, "*"))
+	testInclude(t, f, []includeTest{
+		{"photo.jpg", 0, 0, true},
+		{"PHOTO.JPG", 0, 0, true},
+		{"dir/Photo.Jpg", 0, 0, true},
+		{"ünïcode/file.txt", 0, 0, true},
+		{"ÜNÏCODE/file.txt", 0, 0, true},
+		{"photo.png", 0, 0, false},
+	})
+	testDirInclude(t, f, []includeDirTest{
+		{"ÜNÏCODE", true},
+		{"ünïcode/sub", true},
+	})
+}
+
+func TestNewFilterIgnoreCaseFiles(t *testing.T) {
+	f, err := NewFilter()
+	require.NoError(t, err)
+	f.IgnoreCase = true
+	require.NoError(t, f.AddFile("Dir/File1.JPG"))
+	testInclude(t, f, []includeTest{
+		{"Dir/File1.JPG", 0, 0, true},
+		{"dir/file1.jpg", 0, 0, true},
+		{"dir/file2.jpg", 0, 0, false},
+	})
+	testDirInclude(t, f, []includeDirTest{
+		{"DIR", true},
+		{"other", false},
+	})
+}
+
+// mimeObject is a mockObject with a mime type read from the remote f
+type mimeObject struct {
+	mockObject
+	f        Fs
+	mimeType string
+}
+
+func (o mimeObject) Fs() Info         { return o.f }
+func (o mimeObject) MimeType() string { return o.mimeType }
+
+func TestNewFilterMimeType(t *testing.T) {
+	f, err := NewFilter()
+	require.NoError(t, err)
+	f.IncludeMime = []string{"image/*", "Text/Plain"}
+	f.ExcludeMime = []string{"image/gif"}
+	assert.False(t, f.InActive())
+
+	listFs := &aboutFs{}
+	listFs.features = (&Features{ListMimeType: true}).Fill(listFs)
+	noListFs := &aboutFs{}
+	noListFs.features = new(Features).Fill(noListFs)
+
+	for _, test := range []struct {
+		o    Object
+		want bool
+	}{
+		// mime type read from the listing
+		{mimeObject{mockObject("a.bin"), listFs, "image/png"}, true},
+		{mimeObject{mockObject("a.jpg"), listFs, "text/plain; charset=utf-8"}, true},
+		{mimeObject{mockObject("a.jpg"), listFs, "image/gif"}, false},
+		{mimeObject{mockObject("a.jpg"), listFs, "video/mp4"}, false},
+		// mime type guessed from the extension
+		{mimeObject{mockObject("a.bin"), noListFs, "image/png"}, false},
+		{mimeObject{mockObject("a.jpg"), noListFs, "video/mp4"}, true},
+		{mimeObject{mockObject("a.gif"), noListFs, ""}, false},
+		{mockObject("a.PNG"), true},
+		{mockObject("a.txt"), true},
+		{mockObject("a.mp4"), false},
+		{mockObject("a"), false},
+	} {
+		assert.Equal(t, test.want, f.IncludeObject(test.o), test.o.Remote())
+	}
+
+	// Without guessing only the listing is used
+	f.MimeNoGuess = true
+	assert.False(t, f.IncludeObject(mockObject("a.png")))
+	assert.True(t, f.IncludeObject(mimeObject{mockObject("a"), listFs, "image/png"}))
+
+	// Directories are unaffected
+	assert.True(t, f.IncludeDirectory("video"))
+
+	// Bad patterns are rejected
+	*includeMime = []string{"image/["}
+	defer func() { *includeMime = nil }()
+	_, err = NewFilter()
+	assert.Error(t, err)
+}
+
 func TestNewFilterIncludeFilesDirs(t *testing.T) {
 	f, err := NewFilter()
 	require.NoError(t, err)
@@ -110,9 +110,50 @@ func (x *SizeSuffix) Type() string {
 var _ pflag.Value = (*SizeSuffix)(nil)
 
 // BwTimeSlot represents a bandwidth configuration at a point in time.
+//
+// If upload or download are set then the bandwidth is split into
+// separate limits for each direction and bandwidth isn't used.
 type BwTimeSlot struct {
 	hhmm      int
 	bandwidth SizeSuffix
+	upload    SizeSuffix
+	download  SizeSuffix
+}
+
+// split returns true if the slot has separate upload and download
+// limits
+func (ts BwTimeSlot) split() bool {
+	return ts.upload != 0 || ts.download != 0
+}
+
+// sameBandwidth returns true if ts and other have the same limits
+func (ts BwTimeSlot) sameBandwidth(other BwTimeSlot) bool {
+	return ts.bandwidth == other.bandwidth && ts.upload == other.upload && ts.download == other.download
+}
+
+// bandwidthString returns the limits of the slot in the form they are
+// parsed in
+func (ts BwTimeSlot) bandwidthString() string {
+	if ts.split() {
+		return ts.upload.String() + ":" + ts.download.String()
+	}
+	return ts.bandwidth.String()
+}
+
+// setBandwidth sets the limits of the slot from s which is either a
+// single bandwidth or upload:download bandwidths
+func (ts *BwTimeSlot) setBandwidth(s string) error {
+	i := strings.IndexRune(s, ':')
+	if i < 0 {
+		return ts.bandwidth.Set(s)
+	}
+	if err := ts.upload.Set(s[:i]); err != nil {
+		return errors.Wrap(err, "bad upload bandwidth")
+	}
+	if err := ts.download.Set(s[i+1:]); err != nil {
+		return errors.Wrap(err, "bad download bandwidth")
+	}
+	return nil
 }
 
 // BwTimetable contains all configured time slots.
@@ -122,7 +163,7 @@ type BwTimetable []BwTimeSlot
 func (x BwTimetable) String() string {
 	ret := []string{}
 	for _, ts := range x {
-		ret = append(ret, fmt.Sprintf("%04.4d,%s", ts.hhmm, ts.bandwidth.String()))
+		ret = append(ret, fmt.Sprintf("%04.4d,%s", ts.hhmm, ts.bandwidthString()))
 	}
 	return strings.Join(ret, " ")
 }
@@ -132,6 +173,7 @@ func (x *BwTimetable) Set(s string) error {
 	// The timetable is formatted as:
 	// "hh:mm,bandwidth hh:mm,banwidth..." ex: "10:00,10G 11:30,1G 18:00,off"
 	// If only a single bandwidth identifier is provided, we assume constant bandwidth.
+	// Each bandwidth may be split into "upload:download" ex: "10:00,1M:10M".
 
 	if len(s) == 0 {
 		return errors.New("empty string")
@@ -139,7 +181,7 @@ func (x *BwTimetable) Set(s string) error {
 	// Single value without time specification.
 	if !strings.Contains(s, " ") && !strings.Contains(s, ",") {
 		ts := BwTimeSlot{}
-		if err := ts.bandwidth.Set(s); err != nil {
+		if err := ts.setBandwidth(s); err != nil {
 			return err
 		}
 		ts.hhmm = 0
@@ -147,7 +189,7 @@ func (x *BwTimetable) Set(s string) error {
 		return nil
 	}
 
-	for _, tok := range strings.Split(s, " ") {
+	for _, tok := range strings.Fields(s) {
 		tv := strings.Split(tok, ",")
 
 		// Format must be HH:MM,BW
@@ -179,7 +221,7 @@ func (x *BwTimetable) Set(s string) error {
 			hhmm: (hh * 100) + mm,
 		}
 		// Bandwidth limit for this time slot.
-		if err := ts.bandwidth.Set(tv[1]); err != nil {
+		if err := ts.setBandwidth(tv[1]); err != nil {
 			return err
 		}
 		*x = append(*x, ts)
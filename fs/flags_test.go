@@ -106,6 +106,26 @@ func TestBwTimetableSet(t *testing.T) {
 			},
 			false,
 		},
+		{
+			"08:00,2M  19:00,10M 23:00,off",
+			BwTimetable{
+				BwTimeSlot{hhmm: 800, bandwidth: 2 * 1024 * 1024},
+				BwTimeSlot{hhmm: 1900, bandwidth: 10 * 1024 * 1024},
+				BwTimeSlot{hhmm: 2300, bandwidth: -1},
+			},
+			false,
+		},
+		{"2M:20M", BwTimetable{BwTimeSlot{hhmm: 0, upload: 2 * 1024 * 1024, download: 20 * 1024 * 1024}}, false},
+		{
+			"08:00,1M:10M 23:00,off",
+			BwTimetable{
+				BwTimeSlot{hhmm: 800, upload: 1024 * 1024, download: 10 * 1024 * 1024},
+				BwTimeSlot{hhmm: 2300, bandwidth: -1},
+			},
+			false,
+		},
+		{"1M:bad", BwTimetable{}, true},
+		{"bad:1M", BwTimetable{}, true},
 		{"bad,bad", BwTimetable{}, true},
 		{"bad bad", BwTimetable{}, true},
 		{"bad", BwTimetable{}, true},
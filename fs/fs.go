@@ -50,6 +50,9 @@ var (
 	ErrorNotDeletingDirs             = errors.New("not deleting directories as there were IO errors")
 	ErrorCantMoveOverlapping         = errors.New("can't move files on overlapping remotes")
 	ErrorDirectoryNotEmpty           = errors.New("directory not empty")
+	ErrorImmutableModified           = errors.New("immutable file modified")
+	ErrorMaxDeleteLimitReached       = errors.New("max delete limit reached as set by --max-delete")
+	ErrorMaxDeleteErrorsReached      = FatalError(errors.New("too many errors deleting files as set by --max-delete-errors"))
 )
 
 // RegInfo provides information about a filesystem
@@ -233,6 +236,36 @@ type MimeTyper interface {
 	MimeType() string
 }
 
+// Metadataer is an optional interface for Object
+type Metadataer interface {
+	// Metadata returns the attributes of the Object as a map of
+	// lower case keys to values.
+	//
+	// The keys are the HTTP header names content-type,
+	// content-disposition and content-encoding, delete-at for the
+	// time the object expires in RFC3339 format and meta-<name>
+	// for the user metadata.  The modification time isn't included
+	// as rclone sets that itself.
+	Metadata() (map[string]string, error)
+}
+
+// MetadataSetter is an optional interface for Object
+type MetadataSetter interface {
+	// SetMetadata replaces the attributes of the Object with
+	// metadata which has the keys described in Metadataer.
+	//
+	// Keys the Object can't store are ignored.
+	SetMetadata(metadata map[string]string) error
+}
+
+// DirModTimeReader is an optional interface for Directory
+type DirModTimeReader interface {
+	// ReadModTime reads the modification time of the Directory
+	// where that needs an extra transaction so ModTime doesn't.
+	// It returns ModTime if the time can't be read.
+	ReadModTime() time.Time
+}
+
 // ListRCallback defines a callback function for ListR to use
 //
 // It is called for each tranche of entries read from the listing and
@@ -248,9 +281,15 @@ type Features struct {
 	CaseInsensitive         bool // has case insensitive files
 	DuplicateFiles          bool // allows duplicate files
 	ReadMimeType            bool // can read the mime type of objects
+	ListMimeType            bool // reads the mime type of objects from the listing
 	WriteMimeType           bool // can set the mime type of objects
 	CanHaveEmptyDirectories bool // can have empty directories
 	BucketBased             bool // is bucket based (like s3, swift etc)
+	SeekOpen                bool // can Open objects at an offset with SeekOption
+	IsLocal                 bool // is the local filesystem
+	ReadMetadata            bool // can read the metadata of objects
+	WriteMetadata           bool // can write the metadata of objects
+	ListRByDirectory        bool // ListR sends all of each directory together
 
 	// Purge all files in the root and the root directory
 	//
@@ -341,13 +380,42 @@ type Features struct {
 	// found.
 	//
 	// It should call callback for each tranche of entries read.
-	// These need not be returned in any particular order.  If
-	// callback returns an error then the listing will stop
+	// These need not be returned in any particular order, but if
+	// all the entries below each directory are returned together
+	// (eg in sorted order) then set ListRByDirectory so
+	// directories can be processed before the listing finishes.
+	// If callback returns an error then the listing will stop
 	// immediately.
 	//
 	// Don't implement this unless you have a more efficient way
 	// of listing recursively that doing a directory traversal.
 	ListR ListRFn
+
+	// About gets quota information from the Fs
+	About func() (*Usage, error)
+
+	// UserInfo returns info about the connected user and account
+	UserInfo func() (map[string]string, error)
+
+	// PublicLink generates a public link to the remote path (usually readable by anyone)
+	PublicLink func(remote string) (string, error)
+
+	// OpenWriterAt opens the file at remote for writing at any
+	// offset, creating it if necessary, with size bytes
+	// preallocated
+	//
+	// It is used by multi-thread downloads so the file must be
+	// a complete copy of the source once all the bytes have been
+	// written.
+	OpenWriterAt func(remote string, size int64) (WriterAtCloser, error)
+
+	// DirSetModTime sets the modification time of the directory
+	// dir which must exist, returning ErrorDirNotFound if it
+	// doesn't.
+	//
+	// Remotes which implement this must return the modification
+	// times of directories in their listings.
+	DirSetModTime func(dir string, modTime time.Time) error
 }
 
 // Disable nil's out the named feature.  If it isn't found then it
@@ -430,6 +498,21 @@ func (ft *Features) Fill(f Fs) *Features {
 	if do, ok := f.(ListRer); ok {
 		ft.ListR = do.ListR
 	}
+	if do, ok := f.(Abouter); ok {
+		ft.About = do.About
+	}
+	if do, ok := f.(UserInfoer); ok {
+		ft.UserInfo = do.UserInfo
+	}
+	if do, ok := f.(PublicLinker); ok {
+		ft.PublicLink = do.PublicLink
+	}
+	if do, ok := f.(OpenWriterAter); ok {
+		ft.OpenWriterAt = do.OpenWriterAt
+	}
+	if do, ok := f.(DirSetModTimer); ok {
+		ft.DirSetModTime = do.DirSetModTime
+	}
 	return ft.DisableList(Config.DisableFeatures)
 }
 
@@ -444,9 +527,15 @@ func (ft *Features) Mask(f Fs) *Features {
 	ft.CaseInsensitive = ft.CaseInsensitive && mask.CaseInsensitive
 	ft.DuplicateFiles = ft.DuplicateFiles && mask.DuplicateFiles
 	ft.ReadMimeType = ft.ReadMimeType && mask.ReadMimeType
+	ft.ListMimeType = ft.ListMimeType && mask.ListMimeType
 	ft.WriteMimeType = ft.WriteMimeType && mask.WriteMimeType
 	ft.CanHaveEmptyDirectories = ft.CanHaveEmptyDirectories && mask.CanHaveEmptyDirectories
 	ft.BucketBased = ft.BucketBased && mask.BucketBased
+	ft.SeekOpen = ft.SeekOpen && mask.SeekOpen
+	ft.IsLocal = ft.IsLocal && mask.IsLocal
+	ft.ReadMetadata = ft.ReadMetadata && mask.ReadMetadata
+	ft.WriteMetadata = ft.WriteMetadata && mask.WriteMetadata
+	ft.ListRByDirectory = ft.ListRByDirectory && mask.ListRByDirectory
 	if mask.Purge == nil {
 		ft.Purge = nil
 	}
@@ -483,17 +572,35 @@ func (ft *Features) Mask(f Fs) *Features {
 	if mask.ListR == nil {
 		ft.ListR = nil
 	}
+	if mask.About == nil {
+		ft.About = nil
+	}
+	if mask.UserInfo == nil {
+		ft.UserInfo = nil
+	}
+	if mask.PublicLink == nil {
+		ft.PublicLink = nil
+	}
+	if mask.OpenWriterAt == nil {
+		ft.OpenWriterAt = nil
+	}
+	if mask.DirSetModTime == nil {
+		ft.DirSetModTime = nil
+	}
 	return ft.DisableList(Config.DisableFeatures)
 }
 
 // Wrap makes a Copy of the features passed in, overriding the UnWrap
-// method only if available in f.
+// and About methods only if available in f.
 func (ft *Features) Wrap(f Fs) *Features {
 	copy := new(Features)
 	*copy = *ft
 	if do, ok := f.(UnWrapper); ok {
 		copy.UnWrap = do.UnWrap
 	}
+	if do, ok := f.(Abouter); ok {
+		copy.About = do.About
+	}
 	return copy
 }
 
@@ -630,6 +737,67 @@ type ListRer interface {
 	ListR(dir string, callback ListRCallback) error
 }
 
+// Abouter is an optional interface for Fs
+type Abouter interface {
+	// About gets quota information from the Fs
+	About() (*Usage, error)
+}
+
+// UserInfoer is an optional interface for Fs
+type UserInfoer interface {
+	// UserInfo returns info about the connected user and account
+	//
+	// The keys and values are backend specific.
+	UserInfo() (map[string]string, error)
+}
+
+// PublicLinker is an optional interface for Fs
+type PublicLinker interface {
+	// PublicLink generates a public link to the remote path (usually readable by anyone)
+	PublicLink(remote string) (string, error)
+}
+
+// WriterAtCloser wraps io.WriterAt and io.Closer
+type WriterAtCloser interface {
+	io.WriterAt
+	io.Closer
+}
+
+// OpenWriterAter is an optional interface for Fs
+type OpenWriterAter interface {
+	// OpenWriterAt opens the file at remote for writing at any
+	// offset, creating it if necessary, with size bytes
+	// preallocated
+	OpenWriterAt(remote string, size int64) (WriterAtCloser, error)
+}
+
+// DirSetModTimer is an optional interface for Fs
+type DirSetModTimer interface {
+	// DirSetModTime sets the modification time of the directory
+	// dir which must exist, returning ErrorDirNotFound if it
+	// doesn't.
+	DirSetModTime(dir string, modTime time.Time) error
+}
+
+// Usage is returned by the About call
+//
+// If a value is nil then it isn't supported by that backend
+type Usage struct {
+	Total   *int64 `json:"total,omitempty"`   // quota of bytes that can be used
+	Used    *int64 `json:"used,omitempty"`    // bytes in use
+	Trashed *int64 `json:"trashed,omitempty"` // bytes in trash
+	Other   *int64 `json:"other,omitempty"`   // other usage eg gmail in drive
+	Free    *int64 `json:"free,omitempty"`    // bytes which can be uploaded before reaching the quota
+	Objects *int64 `json:"objects,omitempty"` // objects in the storage system
+}
+
+// NewUsageValue makes a valid value for the Usage struct
+func NewUsageValue(value int64) *int64 {
+	p := new(int64)
+	*p = value
+	return p
+}
+
 // ObjectsChan is a channel of Objects
 type ObjectsChan chan Object
 
@@ -640,6 +808,19 @@ type Objects []Object
 // operation.
 type ObjectPair struct {
 	src, dst Object
+	remote   string // name for src in the dst if dst is nil and it differs
+}
+
+// dstRemote returns the name the src of the pair should have in the
+// dst
+func (pair ObjectPair) dstRemote() string {
+	if pair.dst != nil {
+		return pair.dst.Remote()
+	}
+	if pair.remote != "" {
+		return pair.remote
+	}
+	return pair.src.Remote()
 }
 
 // ObjectPairChan is a channel of ObjectPair
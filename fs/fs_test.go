@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestFeaturesDisable(t *testing.T) {
@@ -52,3 +53,37 @@ func TestFeaturesDisableList(t *testing.T) {
 	assert.False(t, ft.CaseInsensitive)
 	assert.False(t, ft.DuplicateFiles)
 }
+
+// aboutFs is a minimal Fs which implements the Abouter interface
+type aboutFs struct {
+	Fs
+	features *Features
+}
+
+func (f *aboutFs) About() (*Usage, error) {
+	return &Usage{Used: NewUsageValue(1)}, nil
+}
+
+func (f *aboutFs) Features() *Features {
+	return f.features
+}
+
+func TestFeaturesAbout(t *testing.T) {
+	f := &aboutFs{}
+	f.features = new(Features).Fill(f)
+	require.NotNil(t, f.features.About)
+	usage, err := f.features.About()
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), *usage.Used)
+
+	// Masking with an Fs without About removes it
+	ft := new(Features).Fill(f).Mask(&aboutFs{features: new(Features)})
+	assert.Nil(t, ft.About)
+
+	// Wrapping passes About through or overrides it
+	wrapped := f.features.Wrap(&aboutFs{})
+	assert.NotNil(t, wrapped.About)
+	noAbout := &Features{}
+	assert.Nil(t, noAbout.Wrap(struct{ Fs }{}).About)
+	assert.NotNil(t, noAbout.Wrap(f).About)
+}
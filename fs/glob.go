@@ -12,9 +12,14 @@ import (
 
 // globToRegexp converts an rsync style glob to a regexp
 //
+// If ignoreCase is set the regexp will match regardless of case.
+//
 // documented in filtering.md
-func globToRegexp(glob string) (*regexp.Regexp, error) {
+func globToRegexp(glob string, ignoreCase bool) (*regexp.Regexp, error) {
 	var re bytes.Buffer
+	if ignoreCase {
+		_, _ = re.WriteString("(?i)")
+	}
 	if strings.HasPrefix(glob, "/") {
 		glob = glob[1:]
 		_, _ = re.WriteRune('^')
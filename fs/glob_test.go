@@ -41,7 +41,7 @@ func TestGlobToRegexp(t *testing.T) {
 		{`a\*b`, `(^|/)a\*b$`, ``},
 		{`a\\b`, `(^|/)a\\b$`, ``},
 	} {
-		gotRe, err := globToRegexp(test.in)
+		gotRe, err := globToRegexp(test.in, false)
 		if test.error == "" {
 			got := gotRe.String()
 			require.NoError(t, err, test.in)
@@ -54,6 +54,15 @@ func TestGlobToRegexp(t *testing.T) {
 	}
 }
 
+func TestGlobToRegexpIgnoreCase(t *testing.T) {
+	re, err := globToRegexp(`*.{jpg,png}`, true)
+	require.NoError(t, err)
+	assert.Equal(t, `(?i)(^|/)[^/]*\.(jpg|png)$`, re.String())
+	assert.True(t, re.MatchString("dir/PHOTO.JPG"))
+	assert.True(t, re.MatchString("photo.Png"))
+	assert.False(t, re.MatchString("photo.gif"))
+}
+
 func TestGlobToDirGlobs(t *testing.T) {
 	for _, test := range []struct {
 		in   string
@@ -96,7 +105,7 @@ func TestGlobToDirGlobs(t *testing.T) {
 		{"/sausage3**", []string{`/sausage3**/`, "/"}},
 		{"/a/*.jpg", []string{`/a/`, "/"}},
 	} {
-		_, err := globToRegexp(test.in)
+		_, err := globToRegexp(test.in, false)
 		assert.NoError(t, err)
 		got := globToDirGlobs(test.in)
 		assert.Equal(t, test.want, got, test.in)
@@ -3,6 +3,7 @@ package fs
 import (
 	"crypto/md5"
 	"crypto/sha1"
+	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
 	"hash"
@@ -31,24 +32,83 @@ const (
 	// https://www.dropbox.com/developers/reference/content-hash
 	HashDropbox
 
+	// HashSHA256 indicates SHA-256 support
+	HashSHA256
+
 	// HashNone indicates no hashes are supported
 	HashNone HashType = 0
 )
 
 // SupportedHashes returns a set of all the supported hashes by
-// HashStream and MultiHasher.
-var SupportedHashes = NewHashSet(HashMD5, HashSHA1, HashDropbox)
+// HashStreamTypes and NewMultiHasherTypes.
+var SupportedHashes = NewHashSet(HashMD5, HashSHA1, HashDropbox, HashSHA256)
+
+// DefaultHashes is the set of hashes calculated by HashStream and
+// MultiHasher when no particular hashes are asked for.  The others in
+// SupportedHashes are only calculated when asked for.
+var DefaultHashes = NewHashSet(HashMD5, HashSHA1, HashDropbox)
 
 // HashWidth returns the width in characters for any HashType
 var HashWidth = map[HashType]int{
 	HashMD5:     32,
 	HashSHA1:    40,
 	HashDropbox: 64,
+	HashSHA256:  64,
+}
+
+// hashDefinition describes how to name and calculate a HashType
+type hashDefinition struct {
+	name    string           // name returned by String()
+	newHash func() hash.Hash // make a new hasher
+}
+
+// hashDefinitions holds all the hash types known about, including
+// any registered with RegisterHash
+var hashDefinitions = map[HashType]hashDefinition{
+	HashMD5:     {"MD5", md5.New},
+	HashSHA1:    {"SHA-1", sha1.New},
+	HashDropbox: {"DropboxHash", dbhash.New},
+	HashSHA256:  {"SHA-256", sha256.New},
+}
+
+// RegisterHash adds a new hash type with the name and width (of the
+// hex encoded hash) given which is calculated with the hashers
+// returned by newHash.
+//
+// It returns the new HashType which will be part of SupportedHashes
+// but not DefaultHashes.  It should be called from an init function.
+func RegisterHash(name string, width int, newHash func() hash.Hash) HashType {
+	t := HashType(1)
+	for SupportedHashes.Contains(t) {
+		t <<= 1
+	}
+	hashDefinitions[t] = hashDefinition{name, newHash}
+	HashWidth[t] = width
+	SupportedHashes.Add(t)
+	return t
+}
+
+// normaliseHashName makes a hash name lower case and removes any
+// "-" so "SHA-256", "sha256" and "SHA256" all match
+func normaliseHashName(name string) string {
+	return strings.Replace(strings.ToLower(name), "-", "", -1)
+}
+
+// ParseHashType returns the HashType for the name given, eg "MD5",
+// "SHA-1", "sha256".  Case and any "-" are ignored.
+func ParseHashType(name string) (HashType, error) {
+	normalised := normaliseHashName(name)
+	for t, def := range hashDefinitions {
+		if normaliseHashName(def.name) == normalised {
+			return t, nil
+		}
+	}
+	return HashNone, errors.Errorf("unknown hash type %q - must be one of %v", name, SupportedHashes)
 }
 
-// HashStream will calculate hashes of all supported hash types.
+// HashStream will calculate hashes of the DefaultHashes types.
 func HashStream(r io.Reader) (map[HashType]string, error) {
-	return HashStreamTypes(r, SupportedHashes)
+	return HashStreamTypes(r, DefaultHashes)
 }
 
 // HashStreamTypes will calculate hashes of the requested hash types.
@@ -72,19 +132,15 @@ func HashStreamTypes(r io.Reader, set HashSet) (map[HashType]string, error) {
 // String returns a string representation of the hash type.
 // The function will panic if the hash type is unknown.
 func (h HashType) String() string {
-	switch h {
-	case HashNone:
+	if h == HashNone {
 		return "None"
-	case HashMD5:
-		return "MD5"
-	case HashSHA1:
-		return "SHA-1"
-	case HashDropbox:
-		return "DropboxHash"
-	default:
+	}
+	def, ok := hashDefinitions[h]
+	if !ok {
 		err := fmt.Sprintf("internal error: unknown hash type: 0x%x", int(h))
 		panic(err)
 	}
+	return def.name
 }
 
 // hashFromTypes will return hashers for all the requested types.
@@ -97,17 +153,12 @@ func hashFromTypes(set HashSet) (map[HashType]hash.Hash, error) {
 	var hashers = make(map[HashType]hash.Hash)
 	types := set.Array()
 	for _, t := range types {
-		switch t {
-		case HashMD5:
-			hashers[t] = md5.New()
-		case HashSHA1:
-			hashers[t] = sha1.New()
-		case HashDropbox:
-			hashers[t] = dbhash.New()
-		default:
+		def, ok := hashDefinitions[t]
+		if !ok {
 			err := fmt.Sprintf("internal error: Unsupported hash type %v", t)
 			panic(err)
 		}
+		hashers[t] = def.newHash()
 	}
 	return hashers, nil
 }
@@ -132,10 +183,10 @@ type MultiHasher struct {
 	h    map[HashType]hash.Hash // Hashes
 }
 
-// NewMultiHasher will return a hash writer that will write all
-// supported hash types.
+// NewMultiHasher will return a hash writer that will write the
+// DefaultHashes types.
 func NewMultiHasher() *MultiHasher {
-	h, err := NewMultiHasherTypes(SupportedHashes)
+	h, err := NewMultiHasherTypes(DefaultHashes)
 	if err != nil {
 		panic("internal error: could not create multihasher")
 	}
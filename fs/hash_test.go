@@ -68,6 +68,7 @@ var hashTestSet = []hashTest{
 			fs.HashMD5:     "bf13fc19e5151ac57d4252e0e0f87abe",
 			fs.HashSHA1:    "3ab6543c08a75f292a5ecedac87ec41642d12166",
 			fs.HashDropbox: "214d2fcf3566e94c99ad2f59bd993daca46d8521a0c447adf4b324f53fddc0c7",
+			fs.HashSHA256:  "c839e57675862af5c21bd0a15413c3ec579e0d5522dab600bc6c3489b05b8f54",
 		},
 	},
 	// Empty data set
@@ -77,6 +78,7 @@ var hashTestSet = []hashTest{
 			fs.HashMD5:     "d41d8cd98f00b204e9800998ecf8427e",
 			fs.HashSHA1:    "da39a3ee5e6b4b0d3255bfef95601890afd80709",
 			fs.HashDropbox: "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+			fs.HashSHA256:  "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
 		},
 	},
 }
@@ -93,12 +95,12 @@ func TestMultiHasher(t *testing.T) {
 			require.True(t, ok, "test output for hash not found")
 			assert.Equal(t, v, expect)
 		}
-		// Test that all are present
-		for k, v := range test.output {
-			expect, ok := sums[k]
+		// Test that all the default hashes are present
+		for _, k := range fs.DefaultHashes.Array() {
+			_, ok := sums[k]
 			require.True(t, ok, "test output for hash not found")
-			assert.Equal(t, v, expect)
 		}
+		assert.Len(t, sums, fs.DefaultHashes.Count())
 	}
 }
 
@@ -127,28 +129,29 @@ func TestHashStream(t *testing.T) {
 			require.True(t, ok)
 			assert.Equal(t, v, expect)
 		}
-		// Test that all are present
-		for k, v := range test.output {
-			expect, ok := sums[k]
+		// Test that all the default hashes are present
+		for _, k := range fs.DefaultHashes.Array() {
+			_, ok := sums[k]
 			require.True(t, ok)
-			assert.Equal(t, v, expect)
 		}
+		assert.Len(t, sums, fs.DefaultHashes.Count())
 	}
 }
 
 func TestHashStreamTypes(t *testing.T) {
-	h := fs.HashSHA1
-	for _, test := range hashTestSet {
-		sums, err := fs.HashStreamTypes(bytes.NewBuffer(test.input), fs.NewHashSet(h))
-		require.NoError(t, err)
-		assert.Len(t, sums, 1)
-		assert.Equal(t, sums[h], test.output[h])
+	for _, h := range []fs.HashType{fs.HashSHA1, fs.HashSHA256} {
+		for _, test := range hashTestSet {
+			sums, err := fs.HashStreamTypes(bytes.NewBuffer(test.input), fs.NewHashSet(h))
+			require.NoError(t, err)
+			assert.Len(t, sums, 1)
+			assert.Equal(t, sums[h], test.output[h])
+		}
 	}
 }
 
 func TestHashSetStringer(t *testing.T) {
-	h := fs.NewHashSet(fs.HashSHA1, fs.HashMD5, fs.HashDropbox)
-	assert.Equal(t, h.String(), "[MD5, SHA-1, DropboxHash]")
+	h := fs.NewHashSet(fs.HashSHA1, fs.HashMD5, fs.HashDropbox, fs.HashSHA256)
+	assert.Equal(t, h.String(), "[MD5, SHA-1, DropboxHash, SHA-256]")
 	h = fs.NewHashSet(fs.HashSHA1)
 	assert.Equal(t, h.String(), "[SHA-1]")
 	h = fs.NewHashSet()
@@ -161,3 +164,25 @@ func TestHashStringer(t *testing.T) {
 	h = fs.HashNone
 	assert.Equal(t, h.String(), "None")
 }
+
+func TestParseHashType(t *testing.T) {
+	for _, test := range []struct {
+		in      string
+		want    fs.HashType
+		wantErr bool
+	}{
+		{"MD5", fs.HashMD5, false},
+		{"md5", fs.HashMD5, false},
+		{"SHA-1", fs.HashSHA1, false},
+		{"sha1", fs.HashSHA1, false},
+		{"SHA256", fs.HashSHA256, false},
+		{"sha-256", fs.HashSHA256, false},
+		{"DropboxHash", fs.HashDropbox, false},
+		{"potato", fs.HashNone, true},
+		{"", fs.HashNone, true},
+	} {
+		got, err := fs.ParseHashType(test.in)
+		assert.Equal(t, test.want, got, test.in)
+		assert.Equal(t, test.wantErr, err != nil, test.in)
+	}
+}
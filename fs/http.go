@@ -3,15 +3,20 @@
 package fs
 
 import (
-	"bytes"
 	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
 	"net"
 	"net/http"
 	"net/http/httputil"
 	"reflect"
+	"regexp"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/pkg/errors"
 	"golang.org/x/net/context" // switch to "context" when we stop supporting go1.6
 	"golang.org/x/time/rate"
 )
@@ -25,6 +30,8 @@ var (
 	transport   http.RoundTripper
 	noTransport sync.Once
 	tpsBucket   *rate.Limiter // for limiting number of http transactions per second
+	// the User-Agent sent unless --user-agent is set
+	defaultUserAgent = "rclone/" + Version
 )
 
 // Start the token bucket if necessary
@@ -111,29 +118,98 @@ func setDefaults(a, b interface{}) {
 // Transport returns an http.RoundTripper with the correct timeouts
 func (ci *ConfigInfo) Transport() http.RoundTripper {
 	noTransport.Do(func() {
-		// Start with a sensible set of defaults then override.
-		// This also means we get new stuff when it gets added to go
-		t := new(http.Transport)
-		setDefaults(t, http.DefaultTransport.(*http.Transport))
-		t.Proxy = http.ProxyFromEnvironment
-		t.MaxIdleConnsPerHost = 4 * (ci.Checkers + ci.Transfers + 1)
-		t.TLSHandshakeTimeout = ci.ConnectTimeout
-		t.ResponseHeaderTimeout = ci.Timeout
-		t.TLSClientConfig = &tls.Config{InsecureSkipVerify: ci.InsecureSkipVerify}
-		t.DisableCompression = *noGzip
-		// Set in http_old.go initTransport
-		//   t.Dial
-		// Set in http_new.go initTransport
-		//   t.DialContext
-		//   t.IdelConnTimeout
-		//   t.ExpectContinueTimeout
-		ci.initTransport(t)
-		// Wrap that http.Transport in our own transport
-		transport = NewTransport(t, ci.DumpHeaders, ci.DumpBodies, ci.DumpAuth)
+		transport = ci.NewTransportCustom(nil)
 	})
 	return transport
 }
 
+// NewTransportCustom returns a new Transport with the correct
+// timeouts which isn't shared with any other users.
+//
+// If customize is not nil then it is called with the http.Transport
+// so the caller can change any of the defaults, eg the TLS config,
+// before it is wrapped for logging.
+func (ci *ConfigInfo) NewTransportCustom(customize func(*http.Transport)) *Transport {
+	// Start with a sensible set of defaults then override.
+	// This also means we get new stuff when it gets added to go
+	t := new(http.Transport)
+	setDefaults(t, http.DefaultTransport.(*http.Transport))
+	t.Proxy = http.ProxyFromEnvironment
+	t.MaxIdleConnsPerHost = 4 * (ci.Checkers + ci.Transfers + 1)
+	t.TLSHandshakeTimeout = ci.ConnectTimeout
+	t.ResponseHeaderTimeout = ci.Timeout
+	t.TLSClientConfig = ci.TLSClientConfig()
+	t.DisableCompression = *noGzip
+	// Set in http_old.go initTransport
+	//   t.Dial
+	// Set in http_new.go initTransport
+	//   t.DialContext
+	//   t.IdelConnTimeout
+	//   t.ExpectContinueTimeout
+	ci.initTransport(t)
+	if customize != nil {
+		customize(t)
+	}
+	// Wrap that http.Transport in our own transport
+	transport := NewTransport(t, ci.DumpHeaders, ci.DumpBodies, ci.DumpAuth)
+	if ci.UserAgent != "" {
+		transport.SetUserAgent(ci.UserAgent)
+	}
+	return transport
+}
+
+// LoadTLSConfig reads the certificate files into the tls.Config
+// used by the transports made from ci, so they are only read once.
+// LoadConfig calls it for Config.
+func (ci *ConfigInfo) LoadTLSConfig() error {
+	config, err := ci.TLSConfig()
+	if err != nil {
+		return err
+	}
+	ci.tlsConfig = config
+	return nil
+}
+
+// TLSClientConfig returns a copy of the tls.Config read by
+// LoadTLSConfig for the caller to change.  If it hasn't been called
+// then only --no-check-certificate is used.
+func (ci *ConfigInfo) TLSClientConfig() *tls.Config {
+	if ci.tlsConfig == nil {
+		return &tls.Config{InsecureSkipVerify: ci.InsecureSkipVerify}
+	}
+	return ci.tlsConfig.Clone()
+}
+
+// TLSConfig makes a new tls.Config from --no-check-certificate,
+// --ca-cert, --client-cert and --client-key.
+//
+// The certificate files are read each time it is called and any
+// errors include the path of the file.
+func (ci *ConfigInfo) TLSConfig() (*tls.Config, error) {
+	config := &tls.Config{InsecureSkipVerify: ci.InsecureSkipVerify}
+	if ci.CaCert != "" {
+		pem, err := ioutil.ReadFile(ci.CaCert)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read --ca-cert %q", ci.CaCert)
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, errors.Errorf("no PEM encoded certificates found in --ca-cert %q", ci.CaCert)
+		}
+	}
+	if (ci.ClientCert == "") != (ci.ClientKey == "") {
+		return nil, errors.New("--client-cert and --client-key must be set together")
+	}
+	if ci.ClientCert != "" {
+		cert, err := tls.LoadX509KeyPair(ci.ClientCert, ci.ClientKey)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to load --client-cert %q and --client-key %q", ci.ClientCert, ci.ClientKey)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
 // Client returns an http.Client with the correct timeouts
 func (ci *ConfigInfo) Client() *http.Client {
 	return &http.Client{
@@ -149,6 +225,7 @@ type Transport struct {
 	logHeader bool
 	logBody   bool
 	logAuth   bool
+	userAgent string
 }
 
 // NewTransport wraps the http.Transport passed in and logs all
@@ -159,9 +236,16 @@ func NewTransport(transport *http.Transport, logHeader, logBody, logAuth bool) *
 		logHeader: logHeader,
 		logBody:   logBody,
 		logAuth:   logAuth,
+		userAgent: defaultUserAgent,
 	}
 }
 
+// SetUserAgent sets the User-Agent sent with every request, replacing
+// any set by the libraries using the transport
+func (t *Transport) SetUserAgent(userAgent string) {
+	t.userAgent = userAgent
+}
+
 // A mutex to protect this map
 var checkedHostMu sync.RWMutex
 
@@ -199,36 +283,91 @@ func checkServerTime(req *http.Request, resp *http.Response) {
 	checkedHostMu.Unlock()
 }
 
-var authBuf = []byte("Authorization: ")
+// sensitiveHeaders are the lower case names of the headers whose
+// values are redacted from the dumps unless --dump-auth is set
+var sensitiveHeaders = map[string]bool{
+	"authorization":                   true,
+	"proxy-authorization":             true,
+	"cookie":                          true,
+	"set-cookie":                      true,
+	"x-auth-token":                    true,
+	"x-auth-key":                      true,
+	"x-auth-new-token":                true,
+	"x-storage-token":                 true,
+	"x-storage-pass":                  true,
+	"x-subject-token":                 true,
+	"x-amz-security-token":            true,
+	"x-account-meta-temp-url-key":     true,
+	"x-account-meta-temp-url-key-2":   true,
+	"x-container-meta-temp-url-key":   true,
+	"x-container-meta-temp-url-key-2": true,
+}
 
-// cleanAuth gets rid of one Authorization: header within the first 4k
-func cleanAuth(buf []byte) []byte {
-	// Find how much buffer to check
-	n := 4096
-	if len(buf) < n {
-		n = len(buf)
-	}
-	// See if there is an Authorization: header
-	i := bytes.Index(buf[:n], authBuf)
-	if i < 0 {
-		return buf
+var (
+	// matches the values of sensitive query parameters and form fields
+	sensitiveParamRe = regexp.MustCompile(`(?im)((?:^|[?&])(?:temp_url_sig|x-amz-signature|x-amz-security-token|signature|sig|access_token|refresh_token|client_secret|password)=)([^&\s]*)()`)
+	// matches the values of sensitive fields in JSON bodies
+	sensitiveJSONRe = regexp.MustCompile(`(?i)("(?:password|apikey|api_key|access_token|refresh_token|id_token|client_secret|secret|token)"\s*:\s*")((?:[^"\\]|\\.)*)(")`)
+	// matches the id of the token in Keystone v2 auth responses
+	keystoneTokenRe = regexp.MustCompile(`("token"\s*:\s*\{[^{}]*?"id"\s*:\s*")([^"]*)(")`)
+)
+
+// redact returns the replacement for a sensitive value which shows
+// its length but not what it is
+func redact(value string) string {
+	if value == "" {
+		return ""
 	}
-	i += len(authBuf)
-	// Overwrite the next 4 chars with 'X'
-	for j := 0; i < len(buf) && j < 4; j++ {
-		if buf[i] == '\n' {
-			break
+	return fmt.Sprintf("XXXX(%d)", len(value))
+}
+
+// redactHeader returns the replacement for the value of the sensitive
+// header name, keeping the scheme of Authorization headers
+func redactHeader(name, value string) string {
+	if name == "authorization" || name == "proxy-authorization" {
+		if parts := strings.SplitN(value, " ", 2); len(parts) == 2 {
+			return parts[0] + " " + redact(parts[1])
 		}
-		buf[i] = 'X'
-		i++
 	}
-	// Snip out to the next '\n'
-	j := bytes.IndexByte(buf[i:], '\n')
-	if j < 0 {
-		return buf[:i]
+	return redact(value)
+}
+
+// redactMatches redacts the second group of each match of re in s.
+// re must have three groups which make up the whole match.
+func redactMatches(re *regexp.Regexp, s string) string {
+	return re.ReplaceAllStringFunc(s, func(match string) string {
+		m := re.FindStringSubmatch(match)
+		return m[1] + redact(m[2]) + m[3]
+	})
+}
+
+// redactDump redacts the sensitive headers, query parameters and
+// body fields in buf, a dumped HTTP request or response
+func redactDump(buf []byte) []byte {
+	dump := string(buf)
+	headerEnd := strings.Index(dump, "\r\n\r\n")
+	if headerEnd < 0 {
+		headerEnd = len(dump)
+	}
+	lines := strings.Split(dump[:headerEnd], "\n")
+	for i, line := range lines {
+		colon := strings.IndexByte(line, ':')
+		if colon < 0 {
+			continue
+		}
+		name := strings.ToLower(strings.TrimSpace(line[:colon]))
+		if !sensitiveHeaders[name] {
+			continue
+		}
+		value := strings.TrimRight(line[colon+1:], "\r")
+		cr := line[colon+1+len(value):]
+		lines[i] = line[:colon+1] + " " + redactHeader(name, strings.TrimSpace(value)) + cr
 	}
-	n = copy(buf[i:], buf[i+j:])
-	return buf[:i+n]
+	dump = strings.Join(lines, "\n") + dump[headerEnd:]
+	dump = redactMatches(sensitiveParamRe, dump)
+	dump = redactMatches(sensitiveJSONRe, dump)
+	dump = redactMatches(keystoneTokenRe, dump)
+	return []byte(dump)
 }
 
 // RoundTrip implements the RoundTripper interface.
@@ -237,16 +376,16 @@ func (t *Transport) RoundTrip(req *http.Request) (resp *http.Response, err error
 	if tpsBucket != nil {
 		tbErr := tpsBucket.Wait(context.Background()) // FIXME switch to req.Context() when we drop go1.6 support
 		if tbErr != nil {
-			Errorf(nil, "HTTP token bucket error: %v", err)
+			Errorf(nil, "HTTP token bucket error: %v", tbErr)
 		}
 	}
 	// Force user agent
-	req.Header.Set("User-Agent", *userAgent)
+	req.Header.Set("User-Agent", t.userAgent)
 	// Logf request
 	if t.logHeader || t.logBody || t.logAuth {
 		buf, _ := httputil.DumpRequestOut(req, t.logBody)
 		if !t.logAuth {
-			buf = cleanAuth(buf)
+			buf = redactDump(buf)
 		}
 		Debugf(nil, "%s", separatorReq)
 		Debugf(nil, "%s (req %p)", "HTTP REQUEST", req)
@@ -263,6 +402,9 @@ func (t *Transport) RoundTrip(req *http.Request) (resp *http.Response, err error
 			Debugf(nil, "Error: %v", err)
 		} else {
 			buf, _ := httputil.DumpResponse(resp, t.logBody)
+			if !t.logAuth {
+				buf = redactDump(buf)
+			}
 			Debugf(nil, "%s", string(buf))
 		}
 		Debugf(nil, "%s", separatorResp)
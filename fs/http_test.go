@@ -3,11 +3,19 @@
 package fs
 
 import (
+	"encoding/pem"
 	"fmt"
+	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 // returns the "%p" reprentation of the thing passed in
@@ -39,7 +47,7 @@ func TestSetDefaults(t *testing.T) {
 	assert.Equal(t, old.MaxResponseHeaderBytes, new.MaxResponseHeaderBytes, "when checking .MaxResponseHeaderBytes")
 }
 
-func TestCleanAuth(t *testing.T) {
+func TestRedactDump(t *testing.T) {
 	for _, test := range []struct {
 		in   string
 		want string
@@ -48,17 +56,166 @@ func TestCleanAuth(t *testing.T) {
 		{"floo", "floo"},
 		{"Authorization: ", "Authorization: "},
 		{"Authorization: \n", "Authorization: \n"},
-		{"Authorization: A", "Authorization: X"},
-		{"Authorization: A\n", "Authorization: X\n"},
-		{"Authorization: AAAA", "Authorization: XXXX"},
-		{"Authorization: AAAA\n", "Authorization: XXXX\n"},
-		{"Authorization: AAAAA", "Authorization: XXXX"},
-		{"Authorization: AAAAA\n", "Authorization: XXXX\n"},
-		{"Authorization: AAAA\n", "Authorization: XXXX\n"},
-		{"Authorization: AAAAAAAAA\nPotato: Help\n", "Authorization: XXXX\nPotato: Help\n"},
-		{"Sausage: 1\nAuthorization: AAAAAAAAA\nPotato: Help\n", "Sausage: 1\nAuthorization: XXXX\nPotato: Help\n"},
+		{"Authorization: A", "Authorization: XXXX(1)"},
+		{"Authorization: A\n", "Authorization: XXXX(1)\n"},
+		{"Authorization: AAAA", "Authorization: XXXX(4)"},
+		{"Authorization: AAAA\n", "Authorization: XXXX(4)\n"},
+		{"Authorization: AAAAA", "Authorization: XXXX(5)"},
+		{"Authorization: AAAAA\n", "Authorization: XXXX(5)\n"},
+		{"Authorization: AAAAAAAAA\nPotato: Help\n", "Authorization: XXXX(9)\nPotato: Help\n"},
+		{"Sausage: 1\nAuthorization: AAAAAAAAA\nPotato: Help\n", "Sausage: 1\nAuthorization: XXXX(9)\nPotato: Help\n"},
+		{"Authorization: Bearer AAAA\r\n", "Authorization: Bearer XXXX(4)\r\n"},
+		{"X-Auth-Token: AAAA\r\nx-storage-token: BBB\r\nX-Auth-User: user\r\n", "X-Auth-Token: XXXX(4)\r\nx-storage-token: XXXX(3)\r\nX-Auth-User: user\r\n"},
+		{"GET /v1/c/o?temp_url_sig=abcdef&temp_url_expires=123 HTTP/1.1\r\n", "GET /v1/c/o?temp_url_sig=XXXX(6)&temp_url_expires=123 HTTP/1.1\r\n"},
+		{
+			"POST /token HTTP/1.1\r\nHost: h\r\n\r\ngrant_type=refresh_token&refresh_token=AAAA&client_secret=BB",
+			"POST /token HTTP/1.1\r\nHost: h\r\n\r\ngrant_type=refresh_token&refresh_token=XXXX(4)&client_secret=XXXX(2)",
+		},
+		{
+			"HTTP/1.1 200 OK\r\n\r\n{\"access_token\": \"AAAA\", \"expires_in\": 3600}",
+			"HTTP/1.1 200 OK\r\n\r\n{\"access_token\": \"XXXX(4)\", \"expires_in\": 3600}",
+		},
+		{
+			"HTTP/1.1 200 OK\r\n\r\n{\"access\": {\"token\": {\"expires\": \"2018\", \"id\": \"AAAAA\"}}}",
+			"HTTP/1.1 200 OK\r\n\r\n{\"access\": {\"token\": {\"expires\": \"2018\", \"id\": \"XXXX(5)\"}}}",
+		},
+		{
+			"POST /v2.0/tokens HTTP/1.1\r\n\r\n{\"auth\": {\"passwordCredentials\": {\"username\": \"user\", \"password\": \"pa\\\"ss\"}}}",
+			"POST /v2.0/tokens HTTP/1.1\r\n\r\n{\"auth\": {\"passwordCredentials\": {\"username\": \"user\", \"password\": \"XXXX(6)\"}}}",
+		},
 	} {
-		got := string(cleanAuth([]byte(test.in)))
+		got := string(redactDump([]byte(test.in)))
 		assert.Equal(t, test.want, got, test.in)
 	}
 }
+
+func TestTPSLimit(t *testing.T) {
+	oldTPSLimit, oldTPSLimitBurst, oldTPSBucket := Config.TPSLimit, Config.TPSLimitBurst, tpsBucket
+	defer func() {
+		Config.TPSLimit, Config.TPSLimitBurst, tpsBucket = oldTPSLimit, oldTPSLimitBurst, oldTPSBucket
+	}()
+	Config.TPSLimit = 20
+	Config.TPSLimitBurst = 0 // check this is raised to 1
+	startHTTPTokenBucket()
+	require.NotNil(t, tpsBucket)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+	client := &http.Client{Transport: NewTransport(new(http.Transport), false, false, false)}
+
+	// The limiter is shared between concurrent requests which
+	// wait for their turn rather than failing
+	const requests = 5
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := client.Get(ts.URL)
+			if assert.NoError(t, err) {
+				_ = resp.Body.Close()
+			}
+		}()
+	}
+	wg.Wait()
+	// The first request goes straight away, the others at 20/s
+	assert.True(t, time.Since(start) >= (requests-1)*time.Second/20-10*time.Millisecond)
+}
+
+func TestTransportUserAgent(t *testing.T) {
+	var userAgent string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userAgent = r.Header.Get("User-Agent")
+	}))
+	defer ts.Close()
+	get := func(transport http.RoundTripper) {
+		req, err := http.NewRequest("GET", ts.URL, nil)
+		require.NoError(t, err)
+		// Libraries setting their own User-Agent are overridden
+		req.Header.Set("User-Agent", "library/1.0")
+		resp, err := transport.RoundTrip(req)
+		require.NoError(t, err)
+		_ = resp.Body.Close()
+	}
+
+	transport := NewTransport(new(http.Transport), false, false, false)
+	get(transport)
+	assert.Equal(t, "rclone/"+Version, userAgent)
+
+	transport.SetUserAgent("potato/1.0")
+	get(transport)
+	assert.Equal(t, "potato/1.0", userAgent)
+
+	ci := &ConfigInfo{UserAgent: "sausage/2.0"}
+	get(ci.NewTransportCustom(nil))
+	assert.Equal(t, "sausage/2.0", userAgent)
+}
+
+func TestTLSConfigErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rclone-tls")
+	require.NoError(t, err)
+	defer func() { _ = os.RemoveAll(dir) }()
+	notPEM := filepath.Join(dir, "not.pem")
+	require.NoError(t, ioutil.WriteFile(notPEM, []byte("potato"), 0600))
+	missing := filepath.Join(dir, "missing.pem")
+
+	for _, test := range []struct {
+		ci   ConfigInfo
+		want string
+	}{
+		{ConfigInfo{CaCert: missing}, "failed to read --ca-cert \"" + missing},
+		{ConfigInfo{CaCert: notPEM}, "no PEM encoded certificates found in --ca-cert \"" + notPEM},
+		{ConfigInfo{ClientCert: notPEM}, "--client-cert and --client-key must be set together"},
+		{ConfigInfo{ClientKey: notPEM}, "--client-cert and --client-key must be set together"},
+		{ConfigInfo{ClientCert: missing, ClientKey: notPEM}, "failed to load --client-cert \"" + missing},
+	} {
+		_, err := test.ci.TLSConfig()
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), test.want)
+		err = test.ci.LoadTLSConfig()
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), test.want)
+		// Transports can still be made without the certificates
+		assert.NotNil(t, test.ci.NewTransportCustom(nil))
+	}
+}
+
+func TestTLSConfigCACert(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+	get := func(ci *ConfigInfo) error {
+		resp, err := (&http.Client{Transport: ci.NewTransportCustom(nil)}).Get(srv.URL)
+		if err == nil {
+			assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+			err = resp.Body.Close()
+		}
+		return err
+	}
+
+	// Without the CA the server certificate should be rejected
+	ci := &ConfigInfo{}
+	require.Error(t, get(ci))
+
+	dir, err := ioutil.TempDir("", "rclone-tls")
+	require.NoError(t, err)
+	defer func() { _ = os.RemoveAll(dir) }()
+	ci.CaCert = filepath.Join(dir, "ca.pem")
+	pemBytes := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	require.NoError(t, ioutil.WriteFile(ci.CaCert, pemBytes, 0600))
+
+	// The CA isn't used until it is loaded
+	require.Error(t, get(ci))
+	require.NoError(t, ci.LoadTLSConfig())
+	require.NoError(t, get(ci))
+
+	// It is only read once so later transports work without it
+	require.NoError(t, os.Remove(ci.CaCert))
+	require.NoError(t, get(ci))
+
+	// --no-check-certificate accepts it without the CA
+	ci = &ConfigInfo{InsecureSkipVerify: true}
+	require.NoError(t, get(ci))
+}
@@ -0,0 +1,367 @@
+// Streaming recursive listings a directory at a time
+
+package fs
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// errListRStopped is returned by the ListR callback when the listing
+// is no longer needed
+var errListRStopped = errors.New("recursive listing stopped")
+
+// listRStream reads the recursive listing of a directory with ListR
+// in the background and hands it out a directory at a time with
+// listDir, so directories can be processed while the listing carries
+// on and their entries freed as they go.
+//
+// If the remote sends all of each directory together
+// (Features.ListRByDirectory) then a directory is handed out as soon
+// as the listing has moved past it, otherwise only once the listing
+// is complete.
+//
+// At most maxEntries entries (if > 0) are held for directories which
+// haven't been asked for yet.  When there are more than that the
+// listing pauses and any directories asked for which aren't complete
+// are listed individually with List instead, so the memory used is
+// bounded without throwing away what has been read.
+type listRStream struct {
+	f          Fs
+	root       string
+	includeAll bool
+	maxLevel   int
+	listR      ListRFn
+	grouped    bool // the listing sends each directory together
+	maxEntries int  // max entries to hold or 0 for no limit
+
+	start     sync.Once
+	mu        sync.Mutex
+	cond      *sync.Cond
+	dirs      map[string]*listRDir
+	current   string // directory of the last entry read
+	count     int    // entries held for directories not asked for
+	paused    bool   // set while the listing waits for count to fall
+	logPaused bool   // set once the pause has been logged
+	done      bool   // set when the listing has finished
+	err       error  // error from the listing
+}
+
+// listRDir is the state of a single directory in a listRStream
+type listRDir struct {
+	entries   DirEntries
+	found     bool // it has an entry in its parent
+	synthetic bool // that entry was made up rather than read
+	complete  bool // the listing has moved past it
+	wanted    bool // its entries have been asked for
+	served    bool // its entries have been returned
+	excluded  bool // it and everything below it is being ignored
+}
+
+// newListRStream makes a listRStream to list path in f with listR
+//
+// The listing isn't started until the first call of listDir.
+func newListRStream(f Fs, path string, includeAll bool, maxLevel int, listR ListRFn) *listRStream {
+	s := &listRStream{
+		f:          f,
+		root:       path,
+		includeAll: includeAll,
+		maxLevel:   maxLevel,
+		listR:      listR,
+		grouped:    f.Features().ListRByDirectory,
+		maxEntries: fastListLimit(),
+		dirs:       make(map[string]*listRDir),
+		current:    path,
+	}
+	s.cond = sync.NewCond(&s.mu)
+	return s
+}
+
+// dir returns the state for dirPath, creating it if necessary
+//
+// Call with the lock held
+func (s *listRStream) dir(dirPath string) *listRDir {
+	d := s.dirs[dirPath]
+	if d == nil {
+		d = new(listRDir)
+		s.dirs[dirPath] = d
+	}
+	return d
+}
+
+// isBelow returns whether dirPath is dir or is inside it
+func isBelow(dirPath, dir string) bool {
+	return dir == "" || dirPath == dir || strings.HasPrefix(dirPath, dir+"/")
+}
+
+// hold adds entry to the directory dirPath if it is still needed
+//
+// Call with the lock held
+func (s *listRStream) hold(dirPath string, entry DirEntry) {
+	d := s.dir(dirPath)
+	if d.served || d.excluded {
+		return
+	}
+	d.entries = append(d.entries, entry)
+	if !d.wanted {
+		s.count++
+	}
+}
+
+// ensureDir makes sure dirPath and its parents have entries in their
+// parents, making them up if necessary
+//
+// Call with the lock held
+func (s *listRStream) ensureDir(dirPath string) {
+	for dirPath != s.root {
+		d := s.dir(dirPath)
+		if d.found {
+			return
+		}
+		d.found, d.synthetic = true, true
+		s.hold(parentDir(dirPath), NewDir(dirPath, time.Now()))
+		dirPath = parentDir(dirPath)
+	}
+}
+
+// addDir adds the directory entry dir replacing any made up entry for
+// it
+//
+// Call with the lock held
+func (s *listRStream) addDir(dir Directory) {
+	dirPath := dir.Remote()
+	d := s.dir(dirPath)
+	if d.found && !d.synthetic {
+		return
+	}
+	if d.synthetic {
+		d.synthetic = false
+		parent := s.dir(parentDir(dirPath))
+		for i, entry := range parent.entries {
+			if _, ok := entry.(Directory); ok && entry.Remote() == dirPath {
+				parent.entries[i] = dir
+				break
+			}
+		}
+		return
+	}
+	d.found = true
+	s.hold(parentDir(dirPath), dir)
+	s.ensureDir(parentDir(dirPath))
+}
+
+// discard marks dirPath and everything below it as not needed and
+// frees their entries
+//
+// Call with the lock held
+func (s *listRStream) discard(dirPath string) {
+	s.dir(dirPath).excluded = true
+	for subPath, d := range s.dirs {
+		if isBelow(subPath, dirPath) {
+			if !d.wanted {
+				s.count -= len(d.entries)
+			}
+			d.entries = nil
+			d.excluded = true
+		}
+	}
+	s.cond.Broadcast()
+}
+
+// moveTo records that the listing has moved on to entries in
+// dirPath.  If the listing is grouped then directories it has left
+// are complete and it is an error if it returns to one.
+//
+// Call with the lock held
+func (s *listRStream) moveTo(dirPath string) error {
+	if !s.grouped {
+		return nil
+	}
+	for dir := s.current; !isBelow(dirPath, dir); dir = parentDir(dir) {
+		s.dir(dir).complete = true
+	}
+	s.current = dirPath
+	for dir := dirPath; ; dir = parentDir(dir) {
+		if d := s.dirs[dir]; d != nil && d.complete {
+			return errors.Errorf("recursive listing returned entries in %q after moving on from %q", dirPath, dir)
+		}
+		if dir == s.root {
+			break
+		}
+	}
+	s.cond.Broadcast()
+	return nil
+}
+
+// add adds an entry read from the listing
+//
+// Call with the lock held
+func (s *listRStream) add(entry DirEntry) error {
+	remote := entry.Remote()
+	if s.root != "" && !strings.HasPrefix(remote, s.root+"/") {
+		return nil
+	}
+	dirPath := parentDir(remote)
+	err := s.moveTo(dirPath)
+	if err != nil {
+		return err
+	}
+	for dir := dirPath; ; dir = parentDir(dir) {
+		if d := s.dirs[dir]; d != nil && d.excluded {
+			return nil
+		}
+		if dir == s.root {
+			break
+		}
+	}
+	relative := remote
+	if s.root != "" {
+		relative = strings.TrimPrefix(remote, s.root+"/")
+	}
+	slashes := strings.Count(relative, "/")
+	switch x := entry.(type) {
+	case Object:
+		if !s.includeAll && Config.Filter.isExcludeFile(remote) {
+			// Its entries are dropped but the directory is kept
+			Debugf(logDirName(s.f, dirPath), "Excluded from sync (and deletion) as it contains an --exclude-if-present file")
+			s.discard(dirPath)
+		}
+		if isPartialUpload(remote) {
+			Debugf(x, "Excluded from sync (and deletion) as a partial upload")
+		} else if s.includeAll || Config.Filter.IncludeObject(x) {
+			if s.maxLevel < 0 || slashes <= s.maxLevel-1 {
+				s.hold(dirPath, x)
+				s.ensureDir(dirPath)
+			} else {
+				// Make sure we include any parent directories of excluded objects
+				for ; slashes > s.maxLevel-1; slashes-- {
+					remote = parentDir(remote)
+				}
+				s.ensureDir(remote)
+			}
+		} else {
+			Debugf(x, "Excluded from sync (and deletion)")
+		}
+	case Directory:
+		if s.includeAll || Config.Filter.IncludeDirectory(remote) {
+			if s.maxLevel < 0 || slashes <= s.maxLevel-1 {
+				s.addDir(x)
+			}
+		} else {
+			Debugf(x, "Excluded from sync (and deletion)")
+		}
+	}
+	return nil
+}
+
+// run reads the listing with ListR
+func (s *listRStream) run() {
+	err := s.listR(s.root, func(entries DirEntries) error {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.err != nil {
+			return errListRStopped
+		}
+		for _, entry := range entries {
+			err := s.add(entry)
+			if err != nil {
+				return err
+			}
+		}
+		for s.maxEntries > 0 && s.count > s.maxEntries && s.err == nil {
+			if !s.logPaused {
+				Infof(s.f, "Pausing recursive listing with %d entries waiting (--fast-list-max-entries) - listing directories individually until it catches up", s.count)
+				s.logPaused = true
+			}
+			s.paused = true
+			s.cond.Broadcast()
+			s.cond.Wait()
+		}
+		s.paused = false
+		s.cond.Broadcast()
+		return nil
+	})
+	s.mu.Lock()
+	if err != nil && s.err == nil {
+		s.err = err
+	}
+	s.done = true
+	s.cond.Broadcast()
+	s.mu.Unlock()
+}
+
+// listDir returns the entries of dir sorted, waiting for the listing
+// to reach them if necessary
+//
+// excluded is set if the directory was excluded with
+// --exclude-if-present.
+func (s *listRStream) listDir(dir string) (entries DirEntries, excluded bool, err error) {
+	s.start.Do(func() { go s.run() })
+	s.mu.Lock()
+	d := s.dir(dir)
+	if !d.wanted {
+		d.wanted = true
+		s.count -= len(d.entries)
+		if s.count <= s.maxEntries {
+			// The listing can carry on now
+			s.paused = false
+		}
+		s.cond.Broadcast()
+	}
+	for {
+		switch {
+		case d.excluded:
+			d.served = true
+			s.mu.Unlock()
+			return nil, true, nil
+		case s.err != nil:
+			err = s.err
+			s.mu.Unlock()
+			return nil, false, err
+		case s.done || d.complete:
+			entries, found := d.entries, d.found || dir == s.root
+			d.entries, d.served = nil, true
+			s.mu.Unlock()
+			if !found {
+				return nil, false, ErrorDirNotFound
+			}
+			sort.Stable(entries)
+			return entries, false, nil
+		case s.paused:
+			d.entries, d.served = nil, true
+			s.mu.Unlock()
+			Debugf(logDirName(s.f, dir), "Listing directory individually while recursive listing is paused")
+			entries, excluded, err = listDirSorted(s.f, s.includeAll, dir)
+			if excluded {
+				s.mu.Lock()
+				s.discard(dir)
+				s.mu.Unlock()
+			}
+			return entries, excluded, err
+		}
+		s.cond.Wait()
+	}
+}
+
+// skip discards the entries below dir as they won't be asked for
+func (s *listRStream) skip(dir string) {
+	s.mu.Lock()
+	s.discard(dir)
+	s.mu.Unlock()
+}
+
+// stop finishes the listing if it is still running
+//
+// listDir must not be called after this.
+func (s *listRStream) stop() {
+	s.mu.Lock()
+	if s.err == nil {
+		s.err = errListRStopped
+	}
+	s.cond.Broadcast()
+	s.mu.Unlock()
+}
@@ -0,0 +1,181 @@
+package fs
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// listRFs is a minimal Fs for testing listRStream which lists
+// directories from a map
+type listRFs struct {
+	aboutFs
+	mu     sync.Mutex
+	dirs   map[string]DirEntries
+	listed []string
+}
+
+func newListRFs(grouped bool, dirs map[string]DirEntries) *listRFs {
+	f := &listRFs{dirs: dirs}
+	f.features = &Features{ListRByDirectory: grouped}
+	return f
+}
+
+func (f *listRFs) String() string { return "listRFs" }
+
+func (f *listRFs) List(dir string) (DirEntries, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.listed = append(f.listed, dir)
+	entries, ok := f.dirs[dir]
+	if !ok {
+		return nil, ErrorDirNotFound
+	}
+	return entries, nil
+}
+
+// remotes returns the Remote of each entry, with a "/" after
+// directories
+func remotes(entries DirEntries) (names []string) {
+	for _, entry := range entries {
+		name := entry.Remote()
+		if _, ok := entry.(Directory); ok {
+			name += "/"
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+// listDirTimeout calls s.listDir failing the test if it doesn't
+// return promptly
+func listDirTimeout(t *testing.T, s *listRStream, dir string) (entries DirEntries, excluded bool, err error) {
+	done := make(chan struct{})
+	go func() {
+		entries, excluded, err = s.listDir(dir)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatalf("timed out listing %q", dir)
+	}
+	return entries, excluded, err
+}
+
+func TestListRStreamGrouped(t *testing.T) {
+	release := make(chan struct{})
+	listR := func(dir string, callback ListRCallback) error {
+		err := callback(DirEntries{mockObject("a/y"), mockObject("a/x"), mockObject("b/z")})
+		if err != nil {
+			return err
+		}
+		<-release
+		return callback(DirEntries{mockObject("c")})
+	}
+	s := newListRStream(newListRFs(true, nil), "", true, -1, listR)
+	defer s.stop()
+
+	// "a" is handed out while the listing is still running
+	entries, excluded, err := listDirTimeout(t, s, "a")
+	require.NoError(t, err)
+	assert.False(t, excluded)
+	assert.Equal(t, []string{"a/x", "a/y"}, remotes(entries))
+
+	close(release)
+	entries, _, err = listDirTimeout(t, s, "")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a/", "b/", "c"}, remotes(entries))
+
+	entries, _, err = listDirTimeout(t, s, "b")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"b/z"}, remotes(entries))
+
+	_, _, err = listDirTimeout(t, s, "potato")
+	assert.Equal(t, ErrorDirNotFound, err)
+}
+
+func TestListRStreamOutOfOrder(t *testing.T) {
+	entries := DirEntries{mockObject("a/x"), mockObject("b/y"), mockObject("a/z")}
+	s := newListRStream(newListRFs(true, nil), "", true, -1, makeListRCallback(entries, nil))
+	defer s.stop()
+	_, _, err := listDirTimeout(t, s, "")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `recursive listing returned entries in "a" after moving on from "a"`)
+
+	// Without grouping the order doesn't matter
+	s = newListRStream(newListRFs(false, nil), "", true, -1, makeListRCallback(entries, nil))
+	defer s.stop()
+	got, _, err := listDirTimeout(t, s, "a")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a/x", "a/z"}, remotes(got))
+}
+
+func TestListRStreamMaxEntries(t *testing.T) {
+	release := make(chan struct{})
+	listR := func(dir string, callback ListRCallback) error {
+		err := callback(DirEntries{mockObject("a/x"), mockObject("a/y")})
+		if err != nil {
+			return err
+		}
+		<-release
+		return callback(DirEntries{mockObject("b/z")})
+	}
+	f := newListRFs(true, map[string]DirEntries{
+		"": {newDir("a"), newDir("b")},
+	})
+	s := newListRStream(f, "", true, -1, listR)
+	s.maxEntries = 1
+	defer s.stop()
+
+	// The listing pauses with too many entries waiting so the
+	// root is listed on its own
+	entries, _, err := listDirTimeout(t, s, "")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a/", "b/"}, remotes(entries))
+	assert.Equal(t, []string{""}, f.listed)
+
+	// Asking for "a" lets the listing carry on so it is read from
+	// the listing rather than listed again
+	close(release)
+	entries, _, err = listDirTimeout(t, s, "a")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a/x", "a/y"}, remotes(entries))
+	entries, _, err = listDirTimeout(t, s, "b")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"b/z"}, remotes(entries))
+	assert.Equal(t, []string{""}, f.listed)
+}
+
+func TestListRStreamExcludeIfPresent(t *testing.T) {
+	oldFilter := Config.Filter
+	defer func() { Config.Filter = oldFilter }()
+	var err error
+	Config.Filter, err = NewFilter()
+	require.NoError(t, err)
+	Config.Filter.ExcludeFile = []string{".ignore"}
+
+	entries := DirEntries{
+		mockObject("a"),
+		mockObject("b/c"),
+		mockObject("b/.ignore"),
+		mockObject("b/d/e"),
+		mockObject("f/g"),
+	}
+	s := newListRStream(newListRFs(true, nil), "", false, -1, makeListRCallback(entries, nil))
+	defer s.stop()
+	got, excluded, err := listDirTimeout(t, s, "")
+	require.NoError(t, err)
+	assert.False(t, excluded)
+	assert.Equal(t, []string{"a", "b/", "f/"}, remotes(got))
+	got, excluded, err = listDirTimeout(t, s, "b")
+	require.NoError(t, err)
+	assert.True(t, excluded)
+	assert.Nil(t, got)
+	got, _, err = listDirTimeout(t, s, "f")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"f/g"}, remotes(got))
+}
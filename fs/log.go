@@ -3,12 +3,16 @@
 package fs
 
 import (
+	"encoding/json"
 	"fmt"
 	"log"
 	"os"
+	"path"
 	"reflect"
 	"runtime"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/spf13/pflag"
@@ -82,21 +86,100 @@ var (
 	logFile        = StringP("log-file", "", "", "Log everything to this file")
 	useSyslog      = BoolP("syslog", "", false, "Use Syslog for logging")
 	syslogFacility = StringP("syslog-facility", "", "DAEMON", "Facility for syslog, eg KERN,USER,...")
+	useJSONLog     = BoolP("use-json-log", "", false, "Use json log format.")
 )
 
-// logPrint sends the text to the logger of level
-var logPrint = func(level LogLevel, text string) {
-	text = fmt.Sprintf("%-6s: %s", level, text)
+// LogPrintFn is a function which sends the text to the logger of
+// level
+type LogPrintFn func(level LogLevel, text string)
+
+// logPrint is where LogPrint sends the logs - use GetLogPrint and
+// SetLogPrint to read and change it
+var logPrint LogPrintFn = func(level LogLevel, text string) {
+	if !Config.UseJSONLog {
+		text = fmt.Sprintf("%-6s: %s", level, text)
+	}
 	log.Print(text)
 }
 
-// logPrintf produces a log string from the arguments passed in
-func logPrintf(level LogLevel, o interface{}, text string, args ...interface{}) {
-	out := fmt.Sprintf(text, args...)
+// logPrintMu protects logPrint
+var logPrintMu sync.RWMutex
+
+// LogPrint sends the text to the logger of level
+func LogPrint(level LogLevel, text string) {
+	GetLogPrint()(level, text)
+}
+
+// GetLogPrint returns the function LogPrint sends the logs to
+func GetLogPrint() LogPrintFn {
+	logPrintMu.RLock()
+	defer logPrintMu.RUnlock()
+	return logPrint
+}
+
+// SetLogPrint replaces the function LogPrint sends the logs to, for
+// instance so they can be interleaved with the --progress display,
+// returning the old one so it can be restored.
+func SetLogPrint(fn LogPrintFn) LogPrintFn {
+	logPrintMu.Lock()
+	defer logPrintMu.Unlock()
+	old := logPrint
+	logPrint = fn
+	return old
+}
+
+// logSource returns the file:line of the first caller outside this
+// file for the "source" field of the JSON log
+func logSource() string {
+	for skip := 2; ; skip++ {
+		_, file, line, ok := runtime.Caller(skip)
+		if !ok {
+			return ""
+		}
+		if !strings.HasSuffix(file, "/fs/log.go") {
+			return fmt.Sprintf("%s:%d", path.Join(path.Base(path.Dir(file)), path.Base(file)), line)
+		}
+	}
+}
+
+// jsonLogLine makes a JSON object for the log message text about o,
+// adding any extra fields passed in
+func jsonLogLine(level LogLevel, o interface{}, text string, fields map[string]interface{}) string {
+	entry := map[string]interface{}{
+		"level":  strings.ToLower(level.String()),
+		"time":   time.Now().Format(time.RFC3339Nano),
+		"msg":    text,
+		"source": logSource(),
+	}
 	if o != nil {
+		entry["object"] = fmt.Sprintf("%v", o)
+		entry["objectType"] = fmt.Sprintf("%T", o)
+	}
+	for k, v := range fields {
+		entry[k] = v
+	}
+	out, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Sprintf(`{"level":"error","msg":%q}`, "failed to make JSON log: "+err.Error())
+	}
+	return string(out)
+}
+
+// logPrintfFields produces a log string from the arguments passed
+// in, adding fields to it if using the JSON log
+func logPrintfFields(level LogLevel, o interface{}, fields map[string]interface{}, text string, args ...interface{}) {
+	out := fmt.Sprintf(text, args...)
+	if Config.UseJSONLog {
+		out = jsonLogLine(level, o, out, fields)
+	} else if o != nil {
 		out = fmt.Sprintf("%v: %s", o, out)
 	}
-	logPrint(level, out)
+	LogPrint(level, out)
+}
+
+// logPrintf produces a log string from the arguments passed in
+func logPrintf(level LogLevel, o interface{}, text string, args ...interface{}) {
+	logPrintfFields(level, o, nil, text, args...)
 }
 
 // LogLevelPrintf writes logs at the given level
@@ -202,6 +285,13 @@ func InitLogging() {
 		redirectStderr(f)
 	}
 
+	// JSON log output is one object per line without the date
+	// prefix, which is in the "time" field instead
+	Config.UseJSONLog = *useJSONLog
+	if Config.UseJSONLog {
+		log.SetFlags(0)
+	}
+
 	// Syslog output
 	if *useSyslog {
 		if *logFile != "" {
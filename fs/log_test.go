@@ -0,0 +1,78 @@
+package fs
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJSONLog(t *testing.T) {
+	oldUseJSONLog := Config.UseJSONLog
+	defer func() { Config.UseJSONLog = oldUseJSONLog }()
+	var lines []string
+	oldLogPrint := SetLogPrint(func(level LogLevel, text string) {
+		lines = append(lines, text)
+	})
+	defer SetLogPrint(oldLogPrint)
+
+	Config.UseJSONLog = false
+	logPrintf(LogLevelError, mockObject("potato"), "hello %d", 42)
+	Config.UseJSONLog = true
+	logPrintf(LogLevelError, mockObject("potato"), "hello %d", 42)
+	logPrintf(LogLevelInfo, nil, "no object")
+	logPrintfFields(LogLevelInfo, nil, map[string]interface{}{"stats": 1}, "with fields")
+	require.Len(t, lines, 4)
+
+	assert.Equal(t, "potato: hello 42", lines[0])
+
+	var entry map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(lines[1]), &entry))
+	assert.Equal(t, "error", entry["level"])
+	assert.Equal(t, "hello 42", entry["msg"])
+	assert.Equal(t, "potato", entry["object"])
+	assert.Equal(t, "fs.mockObject", entry["objectType"])
+	assert.True(t, strings.HasPrefix(entry["source"].(string), "fs/log_test.go:"), entry["source"])
+	assert.NotEmpty(t, entry["time"])
+
+	entry = nil
+	require.NoError(t, json.Unmarshal([]byte(lines[2]), &entry))
+	assert.Equal(t, "info", entry["level"])
+	assert.NotContains(t, entry, "object")
+
+	entry = nil
+	require.NoError(t, json.Unmarshal([]byte(lines[3]), &entry))
+	assert.Equal(t, float64(1), entry["stats"])
+}
+
+func TestSetLogPrint(t *testing.T) {
+	var mu sync.Mutex
+	var lines []string
+	oldLogPrint := SetLogPrint(func(level LogLevel, text string) {
+		mu.Lock()
+		lines = append(lines, text)
+		mu.Unlock()
+	})
+	defer SetLogPrint(oldLogPrint)
+
+	// The logs can be redirected while logging
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			LogPrint(LogLevelInfo, "hello")
+		}
+	}()
+	inner := GetLogPrint()
+	for i := 0; i < 100; i++ {
+		SetLogPrint(func(level LogLevel, text string) {
+			inner(level, text)
+		})
+	}
+	wg.Wait()
+	assert.Len(t, lines, 100)
+}
@@ -0,0 +1,177 @@
+// Multi-thread downloads
+
+package fs
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// multiThreadChunkSize is what the parts are rounded up to so the
+// streams write whole chunks
+const multiThreadChunkSize = 64 * 1024
+
+// doMultiThreadCopy returns the number of streams to download src to
+// f with, or 0 if it shouldn't be a multi-thread download
+//
+// This needs f to be able to write at offsets and src to be able to
+// be opened at offsets and to know its size.
+func doMultiThreadCopy(f Fs, src Object) int {
+	if Config.MultiThreadStreams <= 1 || f.Features().OpenWriterAt == nil {
+		return 0
+	}
+	srcFs, ok := src.Fs().(Fs)
+	if !ok || !srcFs.Features().SeekOpen {
+		return 0
+	}
+	size := src.Size()
+	if size < 0 || size < int64(Config.MultiThreadCutoff) {
+		return 0
+	}
+	// Don't use more streams than there are chunks
+	streams := Config.MultiThreadStreams
+	if chunks := (size + multiThreadChunkSize - 1) / multiThreadChunkSize; int64(streams) > chunks {
+		streams = int(chunks)
+	}
+	if streams <= 1 {
+		return 0
+	}
+	return streams
+}
+
+// offsetWriter writes to an io.WriterAt starting at offset
+type offsetWriter struct {
+	out    io.WriterAt
+	offset int64
+}
+
+// Write p at the offset, advancing it
+func (w *offsetWriter) Write(p []byte) (n int, err error) {
+	n, err = w.out.WriteAt(p, w.offset)
+	w.offset += int64(n)
+	return n, err
+}
+
+// multiThreadCopyState is the state of a multi-thread download
+type multiThreadCopyState struct {
+	src      Object
+	out      WriterAtCloser
+	acc      *Account
+	size     int64
+	partSize int64
+}
+
+// copyStream downloads the part for stream, retrying from where it
+// got to if it fails
+func (mc *multiThreadCopyState) copyStream(stream int) error {
+	start := int64(stream) * mc.partSize
+	end := start + mc.partSize
+	if end > mc.size {
+		end = mc.size
+	}
+	Debugf(mc.src, "multi-thread copy: stream %d downloading %d-%d", stream+1, start, end)
+	maxTries := Config.LowLevelRetries
+	for tries := 1; ; tries++ {
+		in, err := mc.src.Open(&SeekOption{Offset: start})
+		if err == nil {
+			var n int64
+			w := &offsetWriter{out: mc.out, offset: start}
+			n, err = io.Copy(w, mc.acc.accountPart(io.LimitReader(in, end-start)))
+			start += n
+			closeErr := in.Close()
+			if err == nil && start < end {
+				err = io.ErrUnexpectedEOF
+			}
+			if err == nil {
+				err = closeErr
+			}
+		}
+		if err == nil {
+			return nil
+		}
+		if tries >= maxTries || !ShouldRetryLowLevel(err) {
+			return errors.Wrapf(err, "multi-thread copy: stream %d failed", stream+1)
+		}
+		Debugf(mc.src, "multi-thread copy: stream %d failed at offset %d: %v - low level retry %d/%d", stream+1, start, err, tries, maxTries)
+	}
+}
+
+// multiThreadCopy downloads src to remote on f in streams parts at
+// once, each written at its offset in the file
+//
+// Each part is retried on its own if it fails.  The hash of the
+// assembled file is checked by Copy as usual.
+func multiThreadCopy(f Fs, remote string, src Object, streams int) (newDst Object, err error) {
+	size := src.Size()
+	partSize := (size + int64(streams) - 1) / int64(streams)
+	partSize = (partSize + multiThreadChunkSize - 1) / multiThreadChunkSize * multiThreadChunkSize
+	// Rounding up may mean fewer streams are needed
+	streams = int((size + partSize - 1) / partSize)
+
+	out, err := f.Features().OpenWriterAt(remote, size)
+	if err != nil {
+		return nil, errors.Wrap(err, "multi-thread copy: failed to open destination")
+	}
+	mc := &multiThreadCopyState{
+		src:      src,
+		out:      out,
+		acc:      NewAccount(ioutil.NopCloser(bytes.NewReader(nil)), src).WithDirection(TransferDirection(src.Fs(), f)),
+		size:     size,
+		partSize: partSize,
+	}
+	defer func() {
+		_ = mc.acc.Close()
+	}()
+	Debugf(src, "Starting multi-thread copy with %d parts of size %v", streams, SizeSuffix(partSize))
+
+	var (
+		wg       sync.WaitGroup
+		errMu    sync.Mutex
+		firstErr error
+	)
+	for stream := 0; stream < streams; stream++ {
+		wg.Add(1)
+		go func(stream int) {
+			defer wg.Done()
+			err := mc.copyStream(stream)
+			if err != nil {
+				errMu.Lock()
+				if firstErr == nil {
+					firstErr = err
+				}
+				errMu.Unlock()
+			}
+		}(stream)
+	}
+	wg.Wait()
+	err = firstErr
+	closeErr := out.Close()
+	if err == nil && closeErr != nil {
+		err = errors.Wrap(closeErr, "multi-thread copy: failed to close destination")
+	}
+
+	newDst, dstErr := f.NewObject(remote)
+	if err != nil {
+		if dstErr == nil {
+			removeFailedCopy(newDst)
+		}
+		return nil, err
+	}
+	if dstErr != nil {
+		return nil, errors.Wrap(dstErr, "multi-thread copy: failed to find destination")
+	}
+	err = newDst.SetModTime(src.ModTime())
+	switch err {
+	case ErrorCantSetModTime, ErrorCantSetModTimeWithoutDelete:
+		// Not changing the modtime is OK as Copy doesn't either
+	case nil:
+	default:
+		return nil, errors.Wrap(err, "multi-thread copy: failed to set modification time")
+	}
+	Debugf(src, "Finished multi-thread copy with %d parts of size %v", streams, SizeSuffix(partSize))
+	return newDst, nil
+}
@@ -116,10 +116,14 @@ func CheckHashes(src ObjectInfo, dst Object) (equal bool, hash HashType, err err
 // Otherwise the file is considered to be not equal including if there
 // were errors reading info.
 func Equal(src ObjectInfo, dst Object) bool {
-	return equal(src, dst, Config.SizeOnly, Config.CheckSum)
+	return equal(src, dst, Config.SizeOnly, Config.CheckSum, false, true)
 }
 
-func equal(src ObjectInfo, dst Object, sizeOnly, checkSum bool) bool {
+// equal implements Equal.  If immutable is set then files with
+// different mtimes are considered not equal without checking the
+// hashes or updating the mtime of the dst.  If updateModTime isn't
+// set then the dst is never modified, even if only its mtime differs.
+func equal(src ObjectInfo, dst Object, sizeOnly, checkSum, immutable, updateModTime bool) bool {
 	if !Config.IgnoreSize {
 		if src.Size() != dst.Size() {
 			Debugf(src, "Sizes differ")
@@ -165,6 +169,11 @@ func equal(src ObjectInfo, dst Object, sizeOnly, checkSum bool) bool {
 
 	Debugf(src, "Modification times differ by %s: %v, %v", dt, srcModTime, dstModTime)
 
+	// Can't update the modification time of immutable files
+	if immutable {
+		return false
+	}
+
 	// Check if the hashes are the same
 	same, hash, _ := CheckHashes(src, dst)
 	if !same {
@@ -177,7 +186,7 @@ func equal(src ObjectInfo, dst Object, sizeOnly, checkSum bool) bool {
 	}
 
 	// mod time differs but hash is the same to reset mod time if required
-	if !Config.NoUpdateModTime {
+	if updateModTime && !Config.NoUpdateModTime {
 		if Config.DryRun {
 			Logf(src, "Not updating modification time as --dry-run")
 		} else {
@@ -228,6 +237,27 @@ func MimeType(o ObjectInfo) (mimeType string) {
 	return MimeTypeFromName(o.Remote())
 }
 
+// GetMetadata returns the metadata of o if it has any, or nil if it
+// doesn't support metadata
+//
+// The keys rclone sets itself, ie the modification time, are removed.
+func GetMetadata(o ObjectInfo) (metadata map[string]string, err error) {
+	do, ok := o.(Metadataer)
+	if !ok {
+		return nil, nil
+	}
+	metadata, err = do.Metadata()
+	if err != nil {
+		return nil, err
+	}
+	for k := range metadata {
+		if strings.EqualFold(k, "meta-mtime") {
+			delete(metadata, k)
+		}
+	}
+	return metadata, nil
+}
+
 // Used to remove a failed copy
 //
 // Returns whether the file was succesfully removed or not
@@ -247,7 +277,8 @@ func removeFailedCopy(dst Object) bool {
 // Wrapper to override the remote for an object
 type overrideRemoteObject struct {
 	Object
-	remote string
+	remote   string
+	metadata map[string]string
 }
 
 // Remote returns the overriden remote name
@@ -264,15 +295,41 @@ func (o *overrideRemoteObject) MimeType() string {
 	return ""
 }
 
-// Check interface is satisfied
-var _ MimeTyper = (*overrideRemoteObject)(nil)
+// Metadata returns the metadata to upload the object with, which is
+// nil unless it is being copied with --metadata
+func (o *overrideRemoteObject) Metadata() (map[string]string, error) {
+	return o.metadata, nil
+}
+
+// Check interfaces are satisfied
+var (
+	_ MimeTyper  = (*overrideRemoteObject)(nil)
+	_ Metadataer = (*overrideRemoteObject)(nil)
+)
+
+// copyMetadata returns true if the metadata of src should be copied
+// to f, that is if --metadata is set and both ends support it
+func copyMetadata(f Fs, src Object) bool {
+	if !Config.Metadata || !f.Features().WriteMetadata {
+		return false
+	}
+	srcFs, ok := src.Fs().(Fs)
+	return ok && srcFs.Features().ReadMetadata
+}
 
 // Copy src object to dst or f if nil.  If dst is nil then it uses
 // remote as the name of the new object.
 func Copy(f Fs, dst Object, remote string, src Object) (err error) {
+	_, err = copyObject(f, dst, remote, src)
+	return err
+}
+
+// copyObject implements Copy returning the new object.  It returns a
+// nil object with --dry-run.
+func copyObject(f Fs, dst Object, remote string, src Object) (newObj Object, err error) {
 	if Config.DryRun {
 		Logf(src, "Not copying as --dry-run")
-		return nil
+		return nil, nil
 	}
 	maxTries := Config.LowLevelRetries
 	tries := 0
@@ -288,7 +345,23 @@ func Copy(f Fs, dst Object, remote string, src Object) (err error) {
 		}
 	}
 	hashOption := &HashesOption{Hashes: common}
+	// Read the metadata to upload with if required.  Sources with
+	// metadata are always wrapped so it is only uploaded if wanted.
+	var metadata map[string]string
+	_, srcHasMetadata := src.(Metadataer)
+	if copyMetadata(f, src) {
+		metadata, err = GetMetadata(src)
+		if err != nil {
+			Stats.Error()
+			Errorf(src, "Failed to read metadata: %v", err)
+			return nil, err
+		}
+	}
 	var actionTaken string
+	// With --partial-uploads the upload is made to partialRemote
+	// then moved into place over existing once it is checked
+	existing := dst
+	partialRemote := ""
 	for {
 		// Try server side copy first - if has optional interface and
 		// is same underlying remote
@@ -304,27 +377,58 @@ func Copy(f Fs, dst Object, remote string, src Object) (err error) {
 		}
 		// If can't server side copy, do it manually
 		if err == ErrorCantCopy {
-			var in0 io.ReadCloser
-			in0, err = src.Open(hashOption)
-			if err != nil {
-				err = errors.Wrap(err, "failed to open source object")
-			} else {
-				in := NewAccount(in0, src).WithBuffer() // account and buffer the transfer
-				var wrappedSrc ObjectInfo = src
-				// We try to pass the original object if possible
-				if src.Remote() != remote {
-					wrappedSrc = &overrideRemoteObject{Object: src, remote: remote}
-				}
+			if partialRemote == "" {
+				partialRemote = partialUploadName(f, remote)
+			}
+			uploadRemote := remote
+			if partialRemote != "" {
+				uploadRemote = partialRemote
+			}
+			// The parts are written into the file in place so only
+			// replace an existing file this way via partialRemote,
+			// otherwise a failed download would lose it
+			if streams := doMultiThreadCopy(f, src); streams > 0 && (!doUpdate || partialRemote != "") {
+				// Split the download into parts written at their offsets
 				if doUpdate {
-					actionTaken = "Copied (replaced existing)"
-					err = dst.Update(in, wrappedSrc, hashOption)
+					actionTaken = "Multi-thread Copied (replaced existing)"
 				} else {
-					actionTaken = "Copied (new)"
-					dst, err = f.Put(in, wrappedSrc, hashOption)
+					actionTaken = "Multi-thread Copied (new)"
 				}
-				closeErr := in.Close()
-				if err == nil {
-					err = closeErr
+				dst, err = multiThreadCopy(f, uploadRemote, src, streams)
+				if err == nil && metadata != nil {
+					// The parts were written without the metadata
+					if do, ok := dst.(MetadataSetter); ok {
+						err = do.SetMetadata(metadata)
+					}
+				}
+			} else {
+				var in0 io.ReadCloser
+				if srcFs, ok := src.Fs().(Fs); ok && srcFs.Features().SeekOpen {
+					// Carry on from where it failed if reading fails
+					in0, err = newReOpen(src, maxTries, hashOption)
+				} else {
+					in0, err = src.Open(hashOption)
+				}
+				if err != nil {
+					err = errors.Wrap(err, "failed to open source object")
+				} else {
+					in := NewAccount(in0, src).WithDirection(TransferDirection(src.Fs(), f)).WithBuffer() // account and buffer the transfer
+					var wrappedSrc ObjectInfo = src
+					// We try to pass the original object if possible
+					if src.Remote() != uploadRemote || srcHasMetadata {
+						wrappedSrc = &overrideRemoteObject{Object: src, remote: uploadRemote, metadata: metadata}
+					}
+					if doUpdate && partialRemote == "" {
+						actionTaken = "Copied (replaced existing)"
+						err = dst.Update(in, wrappedSrc, hashOption)
+					} else {
+						actionTaken = "Copied (new)"
+						dst, err = f.Put(in, wrappedSrc, hashOption)
+					}
+					closeErr := in.Close()
+					if err == nil {
+						err = closeErr
+					}
 				}
 			}
 		}
@@ -333,7 +437,7 @@ func Copy(f Fs, dst Object, remote string, src Object) (err error) {
 			break
 		}
 		// Retry if err returned a retry error
-		if IsRetryError(err) || ShouldRetry(err) {
+		if ShouldRetryLowLevel(err) {
 			Debugf(src, "Received error: %v - low level retry %d/%d", err, tries, maxTries)
 			continue
 		}
@@ -343,7 +447,10 @@ func Copy(f Fs, dst Object, remote string, src Object) (err error) {
 	if err != nil {
 		Stats.Error()
 		Errorf(src, "Failed to copy: %v", err)
-		return err
+		if partialRemote != "" {
+			removePartialUpload(f, partialRemote)
+		}
+		return nil, err
 	}
 
 	// Verify sizes are the same after transfer
@@ -352,13 +459,13 @@ func Copy(f Fs, dst Object, remote string, src Object) (err error) {
 		err = errors.Errorf("corrupted on transfer: sizes differ %d vs %d", src.Size(), dst.Size())
 		Errorf(dst, "%v", err)
 		removeFailedCopy(dst)
-		return err
+		return nil, err
 	}
 
 	// Verify hashes are the same after transfer - ignoring blank hashes
 	// TODO(klauspost): This could be extended, so we always create a hash type matching
 	// the destination, and calculate it while sending.
-	if hashType != HashNone {
+	if hashType != HashNone && !Config.IgnoreChecksum {
 		var srcSum string
 		srcSum, err = src.Hash(hashType)
 		if err != nil {
@@ -370,18 +477,34 @@ func Copy(f Fs, dst Object, remote string, src Object) (err error) {
 			if err != nil {
 				Stats.Error()
 				Errorf(dst, "Failed to read hash: %v", err)
-			} else if !Config.IgnoreChecksum && !HashEquals(srcSum, dstSum) {
+			} else if !HashEquals(srcSum, dstSum) {
 				Stats.Error()
 				err = errors.Errorf("corrupted on transfer: %v hash differ %q vs %q", hashType, srcSum, dstSum)
 				Errorf(dst, "%v", err)
 				removeFailedCopy(dst)
-				return err
+				return nil, err
 			}
 		}
 	}
 
+	// Move the upload into place if it was checked
+	if partialRemote != "" {
+		if err != nil {
+			removeFailedCopy(dst)
+			return nil, err
+		}
+		Debugf(dst, "Moving upload into place at %q", remote)
+		dst, err = movePartialUpload(f, existing, dst, remote)
+		if err != nil {
+			Stats.Error()
+			Errorf(src, "Failed to copy: %v", err)
+			removePartialUpload(f, partialRemote)
+			return nil, err
+		}
+	}
+
 	Infof(src, actionTaken)
-	return err
+	return dst, err
 }
 
 // Move src object to dst or fdst if nil.  If dst is nil then it uses
@@ -420,10 +543,70 @@ func Move(fdst Fs, dst Object, remote string, src Object) (err error) {
 		Errorf(src, "Not deleting source as copy failed: %v", err)
 		return err
 	}
+	// Check the copy is good before deleting the only other one
+	if !Config.NoVerifyMove {
+		err = verifyMove(fdst, remote, src)
+		if err != nil {
+			Stats.Error()
+			Errorf(src, "Not deleting source as the copy failed verification: %v", err)
+			return err
+		}
+	}
 	// Delete src if no error on copy
 	return DeleteFile(src)
 }
 
+// verifyMove checks the copy of src at remote in fdst before Move
+// deletes src.  The copy is read again from fdst rather than using
+// the object Copy made as Copy has already checked that.
+//
+// The sizes must match, and the hashes if there is a common hash.
+// Without one the contents are compared if --verify-move-download is
+// set.  If the copy doesn't match an error is returned.  The copy is
+// left alone as it may have replaced an existing file.
+func verifyMove(fdst Fs, remote string, src Object) error {
+	dst, err := fdst.NewObject(remote)
+	if err != nil {
+		return errors.Wrap(err, "failed to find the copy")
+	}
+	err = checkMoveCopy(dst, src)
+	if err != nil {
+		return err
+	}
+	Debugf(src, "Verified copy before deleting source")
+	return nil
+}
+
+// checkMoveCopy returns an error if dst isn't a good copy of src
+func checkMoveCopy(dst, src Object) error {
+	if !Config.IgnoreSize && src.Size() >= 0 && src.Size() != dst.Size() {
+		return errors.Errorf("sizes differ %d vs %d", src.Size(), dst.Size())
+	}
+	if !Config.IgnoreChecksum {
+		same, hash, err := CheckHashes(src, dst)
+		if err != nil {
+			return errors.Wrap(err, "failed to read hashes")
+		}
+		if hash != HashNone {
+			if !same {
+				return errors.Errorf("%v hash differ", hash)
+			}
+			return nil
+		}
+	}
+	if !Config.VerifyMoveDownload {
+		return nil
+	}
+	differ, err := CheckIdentical(dst, src)
+	if err != nil {
+		return errors.Wrap(err, "failed to download to compare")
+	}
+	if differ {
+		return errors.New("contents differ")
+	}
+	return nil
+}
+
 // CanServerSideMove returns true if fdst support server side moves or
 // server side copies
 //
@@ -452,7 +635,7 @@ func deleteFileWithBackupDir(dst Object, backupDir Fs) (err error) {
 		if !SameConfig(dst.Fs(), backupDir) {
 			err = errors.New("parameter to --backup-dir has to be on the same remote as destination")
 		} else {
-			remoteWithSuffix := dst.Remote() + Config.Suffix
+			remoteWithSuffix := suffixName(dst.Remote())
 			overwritten, _ := backupDir.NewObject(remoteWithSuffix)
 			err = Move(backupDir, overwritten, remoteWithSuffix, dst)
 		}
@@ -464,11 +647,41 @@ func deleteFileWithBackupDir(dst Object, backupDir Fs) (err error) {
 		Errorf(dst, "Couldn't %s: %v", action, err)
 	} else if !Config.DryRun {
 		Infof(dst, actioned)
+		if backupDir != nil {
+			Stats.Backup()
+		} else {
+			Stats.Deleted()
+		}
 	}
 	Stats.DoneChecking(dst.Remote())
 	return err
 }
 
+// suffixName returns remote with --suffix added, before the
+// extension if --suffix-keep-extension is set
+func suffixName(remote string) string {
+	if Config.Suffix == "" {
+		return remote
+	}
+	if Config.SuffixKeepExtension {
+		ext := path.Ext(remote)
+		return remote[:len(remote)-len(ext)] + Config.Suffix + ext
+	}
+	return remote + Config.Suffix
+}
+
+// isSuffixed returns true if remote looks like it was made by
+// suffixName
+func isSuffixed(remote string) bool {
+	if Config.Suffix == "" {
+		return false
+	}
+	if Config.SuffixKeepExtension {
+		remote = remote[:len(remote)-len(path.Ext(remote))]
+	}
+	return strings.HasSuffix(remote, Config.Suffix)
+}
+
 // DeleteFile deletes a single file respecting --dry-run and accumulating stats and errors.
 //
 // If useBackupDir is set and --backup-dir is in effect then it moves
@@ -482,31 +695,85 @@ func DeleteFile(dst Object) (err error) {
 //
 // If backupDir is set the files will be placed into that directory
 // instead of being deleted.
-func deleteFilesWithBackupDir(toBeDeleted ObjectsChan, backupDir Fs) error {
+//
+// Once more than --max-delete files have been deleted (or moved into
+// backupDir) the rest are left alone and ErrorMaxDeleteLimitReached
+// is returned at the end.
+//
+// Failures to delete individual files are counted and the deletions
+// carry on, unless there are more than --max-delete-errors of them in
+// which case the rest of the files are left alone and
+// ErrorMaxDeleteErrorsReached is returned.
+//
+// It returns the number of files deleted and the number which failed.
+func deleteFilesWithBackupDir(toBeDeleted ObjectsChan, backupDir Fs) (deleted, failed int64, err error) {
+	defer startStoppable()()
 	var wg sync.WaitGroup
 	wg.Add(Config.Transfers)
-	var errorCount int32
+	var notDeletedCount int64
+	var stoppedCount int64
+	var abandonedCount int64
 	for i := 0; i < Config.Transfers; i++ {
 		go func() {
 			defer wg.Done()
 			for dst := range toBeDeleted {
+				// Drain the channel without deleting once asked to stop
+				if StopRequested() {
+					atomic.AddInt64(&stoppedCount, 1)
+					continue
+				}
+				// or once there have been too many errors
+				if Config.MaxDeleteErrors >= 0 && atomic.LoadInt64(&failed) > Config.MaxDeleteErrors {
+					atomic.AddInt64(&abandonedCount, 1)
+					continue
+				}
+				if Config.MaxDelete >= 0 && Stats.Deletes(1) > Config.MaxDelete {
+					Debugf(dst, "Not deleting as --max-delete %d reached", Config.MaxDelete)
+					atomic.AddInt64(&notDeletedCount, 1)
+					continue
+				}
 				err := deleteFileWithBackupDir(dst, backupDir)
 				if err != nil {
-					atomic.AddInt32(&errorCount, 1)
+					atomic.AddInt64(&failed, 1)
+				} else {
+					atomic.AddInt64(&deleted, 1)
 				}
 			}
 		}()
 	}
 	Infof(nil, "Waiting for deletions to finish")
 	wg.Wait()
-	if errorCount > 0 {
-		return errors.Errorf("failed to delete %d files", errorCount)
+	if abandonedCount > 0 {
+		Errorf(nil, "Not deleted %d files after %d errors: %v", abandonedCount, failed, ErrorMaxDeleteErrorsReached)
+		return deleted, failed, ErrorMaxDeleteErrorsReached
 	}
-	return nil
+	if failed > 0 {
+		return deleted, failed, errors.Errorf("failed to delete %d files", failed)
+	}
+	if stoppedCount > 0 {
+		Errorf(nil, "Not deleted %d files: %v", stoppedCount, ErrorStopRequested)
+		return deleted, failed, ErrorStopRequested
+	}
+	if notDeletedCount > 0 {
+		Errorf(nil, "Not deleted %d files: %v", notDeletedCount, ErrorMaxDeleteLimitReached)
+		return deleted, failed, NoRetryError(ErrorMaxDeleteLimitReached)
+	}
+	return deleted, failed, nil
 }
 
 // DeleteFiles removes all the files passed in the channel
 func DeleteFiles(toBeDeleted ObjectsChan) error {
+	_, _, err := deleteFilesWithBackupDir(toBeDeleted, nil)
+	return err
+}
+
+// DeleteFilesCount removes all the files passed in the channel
+// returning the number of files deleted and the number which failed
+// to delete.
+//
+// Individual failures don't stop the deletions unless there are more
+// than --max-delete-errors of them.
+func DeleteFilesCount(toBeDeleted ObjectsChan) (deleted, failed int64, err error) {
 	return deleteFilesWithBackupDir(toBeDeleted, nil)
 }
 
@@ -613,12 +880,25 @@ func DirEntryType(d DirEntry) string {
 //
 // Files will be returned in sorted order
 func ListDirSorted(fs Fs, includeAll bool, dir string) (entries DirEntries, err error) {
+	entries, _, err = listDirSorted(fs, includeAll, dir)
+	return entries, err
+}
+
+// listDirSorted is ListDirSorted which also returns whether the
+// directory was excluded with --exclude-if-present, in which case it
+// returns no entries.
+func listDirSorted(f Fs, includeAll bool, dir string) (entries DirEntries, excluded bool, err error) {
 	// Get unfiltered entries from the fs
-	entries, err = fs.List(dir)
+	entries, err = f.List(dir)
 	if err != nil {
-		return nil, err
+		return nil, false, err
 	}
-	return filterAndSortDir(entries, includeAll, dir, Config.Filter.IncludeObject, Config.Filter.IncludeDirectory)
+	if !includeAll && Config.Filter.ListContainsExcludeFile(entries) {
+		Debugf(logDirName(f, dir), "Excluded from sync (and deletion) as it contains an --exclude-if-present file")
+		return nil, true, nil
+	}
+	entries, err = filterAndSortDir(entries, includeAll, dir, Config.Filter.IncludeObject, Config.Filter.IncludeDirectory)
+	return entries, false, err
 }
 
 // filter (if required) and check the entries, then sort them
@@ -636,7 +916,10 @@ func filterAndSortDir(entries DirEntries, includeAll bool, dir string,
 		switch x := entry.(type) {
 		case Object:
 			// Make sure we don't delete excluded files if not required
-			if !includeAll && !IncludeObject(x) {
+			if isPartialUpload(x.Remote()) {
+				ok = false
+				Debugf(x, "Excluded from sync (and deletion) as a partial upload")
+			} else if !includeAll && !IncludeObject(x) {
 				ok = false
 				Debugf(x, "Excluded from sync (and deletion)")
 			}
@@ -778,21 +1061,43 @@ func Overlapping(fdst, fsrc Info) bool {
 //
 // it returns true if differences were found
 // it also returns whether it couldn't be hashed
-func checkIdentical(dst, src Object) (differ bool, noHash bool) {
+// it returns an error if the check failed which has already been logged
+func checkIdentical(dst, src Object) (differ bool, noHash bool, err error) {
 	same, hash, err := CheckHashes(src, dst)
 	if err != nil {
 		// CheckHashes will log and count errors
-		return true, false
+		return false, false, err
 	}
 	if hash == HashNone {
-		return false, true
+		return false, true, nil
 	}
 	if !same {
 		Stats.Error()
 		Errorf(src, "%v differ", hash)
-		return true, false
+		return true, false, nil
+	}
+	return false, false, nil
+}
+
+// CheckOpt contains options for the Check functions
+//
+// If any of the io.Writers are set then the paths of the files in
+// that category are written to it, one per line, in a format
+// suitable for --files-from.
+type CheckOpt struct {
+	OneWay       bool      // if set ignore the files which are only in fdst
+	MissingOnSrc io.Writer // files in fdst but not in fsrc
+	MissingOnDst io.Writer // files in fsrc but not in fdst
+	Match        io.Writer // files which are identical
+	Differ       io.Writer // files which differ
+	Error        io.Writer // files which couldn't be checked because of an error
+}
+
+// report writes the path of o to w if it is set
+func (opt *CheckOpt) report(w io.Writer, o Object) {
+	if w != nil {
+		syncFprintf(w, "%s\n", o.Remote())
 	}
-	return false, false
 }
 
 // CheckFn checks the files in fsrc and fdst according to Size and
@@ -802,13 +1107,24 @@ func checkIdentical(dst, src Object) (differ bool, noHash bool) {
 //
 // it returns true if differences were found
 // it also returns whether it couldn't be hashed
-func CheckFn(fdst, fsrc Fs, checkFunction func(a, b Object) (differ bool, noHash bool)) error {
+// it returns an error if the check failed which it should have logged
+//
+// Files which differ and files which couldn't be checked because of
+// an error are counted and reported separately.
+//
+// opt may be nil for the default options.
+func CheckFn(fdst, fsrc Fs, checkFunction func(a, b Object) (differ bool, noHash bool, err error), opt *CheckOpt) error {
+	if opt == nil {
+		opt = &CheckOpt{}
+	}
 	dstFiles, srcFiles, err := readFilesMaps(fdst, false, fsrc, false, "")
 	if err != nil {
 		return err
 	}
 	differences := int32(0)
 	noHashes := int32(0)
+	errored := int32(0)
+	matches := int32(0)
 
 	// FIXME could do this as it goes along and make it use less
 	// memory.
@@ -824,11 +1140,16 @@ func CheckFn(fdst, fsrc Fs, checkFunction func(a, b Object) (differ bool, noHash
 		}
 	}
 
-	Logf(fdst, "%d files not in %v", len(dstFiles), fsrc)
-	for _, dst := range dstFiles {
-		Stats.Error()
-		Errorf(dst, "File not in %v", fsrc)
-		atomic.AddInt32(&differences, 1)
+	if opt.OneWay {
+		Debugf(fdst, "Ignoring %d files not in %v as --one-way is set", len(dstFiles), fsrc)
+	} else {
+		Logf(fdst, "%d files not in %v", len(dstFiles), fsrc)
+		for _, dst := range dstFiles {
+			Stats.Error()
+			Errorf(dst, "File not in %v", fsrc)
+			atomic.AddInt32(&differences, 1)
+			opt.report(opt.MissingOnSrc, dst)
+		}
 	}
 
 	Logf(fsrc, "%d files not in %s", len(srcFiles), fdst)
@@ -836,6 +1157,7 @@ func CheckFn(fdst, fsrc Fs, checkFunction func(a, b Object) (differ bool, noHash
 		Stats.Error()
 		Errorf(src, "File not in %v", fdst)
 		atomic.AddInt32(&differences, 1)
+		opt.report(opt.MissingOnDst, src)
 	}
 
 	checks := make(chan [2]Object, Config.Transfers)
@@ -846,16 +1168,16 @@ func CheckFn(fdst, fsrc Fs, checkFunction func(a, b Object) (differ bool, noHash
 		close(checks)
 	}()
 
-	checkIdentical := func(dst, src Object) (differ bool, noHash bool) {
+	checkIdentical := func(dst, src Object) (differ bool, noHash bool, err error) {
 		Stats.Checking(src.Remote())
 		defer Stats.DoneChecking(src.Remote())
 		if !Config.IgnoreSize && src.Size() != dst.Size() {
 			Stats.Error()
 			Errorf(src, "Sizes differ")
-			return true, false
+			return true, false, nil
 		}
 		if Config.SizeOnly {
-			return false, false
+			return false, false, nil
 		}
 		return checkFunction(dst, src)
 	}
@@ -866,11 +1188,17 @@ func CheckFn(fdst, fsrc Fs, checkFunction func(a, b Object) (differ bool, noHash
 		go func() {
 			defer checkerWg.Done()
 			for check := range checks {
-				differ, noHash := checkIdentical(check[0], check[1])
-				if differ {
+				differ, noHash, err := checkIdentical(check[0], check[1])
+				if err != nil {
+					atomic.AddInt32(&errored, 1)
+					opt.report(opt.Error, check[1])
+				} else if differ {
 					atomic.AddInt32(&differences, 1)
+					opt.report(opt.Differ, check[1])
 				} else {
 					Debugf(check[0], "OK")
+					atomic.AddInt32(&matches, 1)
+					opt.report(opt.Match, check[1])
 				}
 				if noHash {
 					atomic.AddInt32(&noHashes, 1)
@@ -881,19 +1209,34 @@ func CheckFn(fdst, fsrc Fs, checkFunction func(a, b Object) (differ bool, noHash
 
 	Infof(fdst, "Waiting for checks to finish")
 	checkerWg.Wait()
-	Logf(fdst, "%d differences found", Stats.GetErrors())
+	if opt.OneWay {
+		Logf(fdst, "%d differences found checking one way from %v", differences, fsrc)
+	} else {
+		Logf(fdst, "%d differences found", differences)
+	}
+	Logf(fdst, "%d matching files", matches)
+	if errored > 0 {
+		Logf(fdst, "%d files could not be checked because of errors", errored)
+	}
 	if noHashes > 0 {
 		Logf(fdst, "%d hashes could not be checked", noHashes)
 	}
-	if differences > 0 {
+	switch {
+	case differences > 0 && errored > 0:
+		return errors.Errorf("%d differences found and %d files could not be checked", differences, errored)
+	case differences > 0:
 		return errors.Errorf("%d differences found", differences)
+	case errored > 0:
+		return errors.Errorf("%d files could not be checked", errored)
 	}
 	return nil
 }
 
 // Check the files in fsrc and fdst according to Size and hash
-func Check(fdst, fsrc Fs) error {
-	return CheckFn(fdst, fsrc, checkIdentical)
+//
+// opt may be nil for the default options.
+func Check(fdst, fsrc Fs, opt *CheckOpt) error {
+	return CheckFn(fdst, fsrc, checkIdentical, opt)
 }
 
 // ReadFill reads as much data from r into buf as it can
@@ -950,14 +1293,14 @@ func CheckIdentical(dst, src Object) (differ bool, err error) {
 	if err != nil {
 		return true, errors.Wrapf(err, "failed to open %q", dst)
 	}
-	in1 = NewAccount(in1, dst).WithBuffer() // account and buffer the transfer
+	in1 = NewAccount(in1, dst).WithDirection(TransferDirection(dst.Fs(), nil)).WithBuffer() // account and buffer the transfer
 	defer CheckClose(in1, &err)
 
 	in2, err := src.Open()
 	if err != nil {
 		return true, errors.Wrapf(err, "failed to open %q", src)
 	}
-	in2 = NewAccount(in2, src).WithBuffer() // account and buffer the transfer
+	in2 = NewAccount(in2, src).WithDirection(TransferDirection(src.Fs(), nil)).WithBuffer() // account and buffer the transfer
 	defer CheckClose(in2, &err)
 
 	return CheckEqualReaders(in1, in2)
@@ -965,17 +1308,27 @@ func CheckIdentical(dst, src Object) (differ bool, err error) {
 
 // CheckDownload checks the files in fsrc and fdst according to Size
 // and the actual contents of the files.
-func CheckDownload(fdst, fsrc Fs) error {
-	check := func(a, b Object) (differ bool, noHash bool) {
-		differ, err := CheckIdentical(a, b)
+//
+// The files are read from both remotes at once and compared as they
+// are read, stopping at the first block which differs.  The bytes
+// read are counted in the stats and obey --bwlimit.
+//
+// opt may be nil for the default options.
+func CheckDownload(fdst, fsrc Fs, opt *CheckOpt) error {
+	check := func(a, b Object) (differ bool, noHash bool, err error) {
+		differ, err = CheckIdentical(a, b)
 		if err != nil {
 			Stats.Error()
 			Errorf(a, "Failed to download: %v", err)
-			return true, true
+			return false, false, err
+		}
+		if differ {
+			Stats.Error()
+			Errorf(a, "Contents differ")
 		}
-		return differ, false
+		return differ, false, nil
 	}
-	return CheckFn(fdst, fsrc, check)
+	return CheckFn(fdst, fsrc, check, opt)
 }
 
 // ListFn lists the Fs to the supplied function
@@ -1036,7 +1389,7 @@ func ListLong(f Fs, w io.Writer) error {
 //
 // Lists in parallel which may get them out of order
 func Md5sum(f Fs, w io.Writer) error {
-	return hashLister(HashMD5, f, w)
+	return hashLister(HashMD5, false, f, w)
 }
 
 // Sha1sum list the Fs to the supplied writer
@@ -1045,7 +1398,7 @@ func Md5sum(f Fs, w io.Writer) error {
 //
 // Lists in parallel which may get them out of order
 func Sha1sum(f Fs, w io.Writer) error {
-	return hashLister(HashSHA1, f, w)
+	return hashLister(HashSHA1, false, f, w)
 }
 
 // DropboxHashSum list the Fs to the supplied writer
@@ -1054,14 +1407,59 @@ func Sha1sum(f Fs, w io.Writer) error {
 //
 // Lists in parallel which may get them out of order
 func DropboxHashSum(f Fs, w io.Writer) error {
-	return hashLister(HashDropbox, f, w)
+	return hashLister(HashDropbox, false, f, w)
 }
 
-func hashLister(ht HashType, f Fs, w io.Writer) error {
+// HashSum list the Fs to the supplied writer with the hashes of type
+// ht in the format of the standard md5sum/sha1sum/sha256sum tools.
+//
+// If the Fs doesn't support ht then the hashes are calculated by
+// reading the objects if download is set, otherwise an error is
+// returned.
+//
+// Obeys includes and excludes
+//
+// Lists in parallel which may get them out of order
+func HashSum(f Fs, ht HashType, download bool, w io.Writer) error {
+	if !f.Hashes().Contains(ht) {
+		if !download {
+			return errors.Errorf("%v doesn't support hash type %v - use --download to calculate it", f, ht)
+		}
+		return hashLister(ht, true, f, w)
+	}
+	return hashLister(ht, false, f, w)
+}
+
+// hashSumDownload calculates the hash of type ht of o by reading it
+func hashSumDownload(f Fs, o Object, ht HashType) (sum string, err error) {
+	Stats.Transferring(o.Remote())
+	defer func() {
+		Stats.DoneTransferring(o.Remote(), err == nil)
+	}()
+	in, err := o.Open()
+	if err != nil {
+		return "", errors.Wrap(err, "failed to open")
+	}
+	in = NewAccount(in, o).WithDirection(TransferDirection(f, nil)).WithBuffer() // account and buffer the transfer
+	defer CheckClose(in, &err)
+	sums, err := HashStreamTypes(in, NewHashSet(ht))
+	if err != nil {
+		return "", errors.Wrap(err, "failed to read")
+	}
+	return sums[ht], nil
+}
+
+func hashLister(ht HashType, download bool, f Fs, w io.Writer) error {
 	return ListFn(f, func(o Object) {
-		Stats.Checking(o.Remote())
-		sum, err := o.Hash(ht)
-		Stats.DoneChecking(o.Remote())
+		var sum string
+		var err error
+		if download {
+			sum, err = hashSumDownload(f, o, ht)
+		} else {
+			Stats.Checking(o.Remote())
+			sum, err = o.Hash(ht)
+			Stats.DoneChecking(o.Remote())
+		}
 		if err == ErrHashUnsupported {
 			sum = "UNSUPPORTED"
 		} else if err != nil {
@@ -1131,6 +1529,49 @@ func Mkdir(f Fs, dir string) error {
 	return nil
 }
 
+// DirModTime returns the modification time of dir, reading it if
+// that needs an extra transaction.  Use it rather than ModTime where
+// the time is really needed, eg to set it on another directory.
+func DirModTime(dir DirEntry) time.Time {
+	if do, ok := dir.(DirModTimeReader); ok {
+		return do.ReadModTime()
+	}
+	return dir.ModTime()
+}
+
+// SetDirModTime sets the modification time of the directory dir on f
+// to modTime if f supports it.
+//
+// dst is the existing directory if known and the time isn't set if
+// it is already within --modify-window.  It returns ErrorDirNotFound
+// if the directory doesn't exist.
+func SetDirModTime(f Fs, dst Directory, dir string, modTime time.Time) error {
+	setDirModTime := f.Features().DirSetModTime
+	if setDirModTime == nil || Config.NoUpdateDirModTime {
+		return nil
+	}
+	if dst != nil {
+		dt := DirModTime(dst).Sub(modTime)
+		if dt < Config.ModifyWindow && dt > -Config.ModifyWindow {
+			Debugf(logDirName(f, dir), "Directory modification time the same (differ by %s, within tolerance %s)", dt, Config.ModifyWindow)
+			return nil
+		}
+	}
+	if Config.DryRun {
+		Logf(logDirName(f, dir), "Not setting directory modification time as dry run is set")
+		return nil
+	}
+	err := setDirModTime(dir, modTime)
+	if err != nil {
+		if err != ErrorDirNotFound {
+			Stats.Error()
+		}
+		return err
+	}
+	Debugf(logDirName(f, dir), "Set directory modification time to %v", modTime)
+	return nil
+}
+
 // TryRmdir removes a container but not if not empty.  It doesn't
 // count errors but may return one.
 func TryRmdir(f Fs, dir string) error {
@@ -1291,6 +1732,12 @@ func (objs objectsSortedByModTime) Less(i, j int) bool {
 	return objs[i].ModTime().Before(objs[j].ModTime())
 }
 
+type objectsSortedByRemote []Object
+
+func (objs objectsSortedByRemote) Len() int           { return len(objs) }
+func (objs objectsSortedByRemote) Swap(i, j int)      { objs[i], objs[j] = objs[j], objs[i] }
+func (objs objectsSortedByRemote) Less(i, j int) bool { return objs[i].Remote() < objs[j].Remote() }
+
 // DeduplicateMode is how the dedupe command chooses what to do
 type DeduplicateMode int
 
@@ -1471,6 +1918,126 @@ func Deduplicate(f Fs, mode DeduplicateMode) error {
 	return nil
 }
 
+// dedupeInteractiveByHash interactively dedupes the slice of objects
+// with identical contents
+func dedupeInteractiveByHash(label string, objs []Object) {
+	fmt.Printf("%s: %d files with identical contents\n", label, len(objs))
+	for i, o := range objs {
+		fmt.Printf("  %d: %12d bytes, %s, %s\n", i+1, o.Size(), o.ModTime().Format("2006-01-02 15:04:05.000000000"), o.Remote())
+	}
+	switch Command([]string{"sSkip and do nothing", "kKeep just one (choose which in next step)"}) {
+	case 's':
+	case 'k':
+		keep := ChooseNumber("Enter the number of the file to keep", 1, len(objs))
+		dedupeDeleteAllButOne(keep-1, label, objs)
+	}
+}
+
+// DeduplicateByHash finds files in f with identical contents,
+// whatever their names, using the hashes from the listing.  It keeps
+// one file of each group of identical files as chosen by mode.
+//
+// Only the hashes of files with the same size as another are read, as
+// on some remotes, eg local, reading a hash reads the whole file.
+//
+// Files without a hash, eg some large objects, are skipped and
+// counted.  DeduplicateRename can't be used as the files in a group
+// already have different names.
+func DeduplicateByHash(f Fs, mode DeduplicateMode) error {
+	if mode == DeduplicateRename {
+		return errors.New("can't use rename mode to dedupe by hash")
+	}
+	ht := f.Hashes().GetOne()
+	if ht == HashNone {
+		return errors.Errorf("%v: can't dedupe by hash as the remote doesn't support any hashes", f)
+	}
+	Infof(f, "Looking for files with identical %v hashes using %v mode.", ht, mode)
+
+	// Group the files by size first so only the files whose size
+	// matches another's need their hashes read
+	bySize := map[int64][]Object{}
+	err := Walk(f, "", true, Config.MaxDepth, func(dirPath string, entries DirEntries, err error) error {
+		if err != nil {
+			return err
+		}
+		entries.ForObject(func(o Object) {
+			bySize[o.Size()] = append(bySize[o.Size()], o)
+		})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// Then group those by size and hash
+	type sizeHash struct {
+		size int64
+		hash string
+	}
+	var unverifiable int
+	files := map[sizeHash][]Object{}
+	for size, objs := range bySize {
+		if len(objs) <= 1 {
+			continue
+		}
+		for _, o := range objs {
+			hash, err := o.Hash(ht)
+			if err != nil {
+				Debugf(o, "Failed to read %v hash: %v", ht, err)
+				hash = ""
+			}
+			if hash == "" {
+				unverifiable++
+				continue
+			}
+			key := sizeHash{size, hash}
+			files[key] = append(files[key], o)
+		}
+	}
+	// Deal with the groups in order of their first file so the
+	// output is the same each time
+	groups := map[string][]Object{}
+	labels := map[string]string{}
+	var firsts []string
+	for key, objs := range files {
+		if len(objs) <= 1 {
+			continue
+		}
+		sort.Sort(objectsSortedByRemote(objs))
+		first := objs[0].Remote()
+		groups[first] = objs
+		labels[first] = fmt.Sprintf("%v %s", ht, key.hash)
+		firsts = append(firsts, first)
+	}
+	sort.Strings(firsts)
+	for _, first := range firsts {
+		objs, label := groups[first], labels[first]
+		remotes := make([]string, len(objs))
+		for i, o := range objs {
+			remotes[i] = o.Remote()
+		}
+		Logf(label, "Found %d files with identical contents: %s", len(objs), strings.Join(remotes, ", "))
+		switch mode {
+		case DeduplicateInteractive:
+			dedupeInteractiveByHash(label, objs)
+		case DeduplicateFirst:
+			dedupeDeleteAllButOne(0, label, objs)
+		case DeduplicateNewest:
+			sort.Stable(objectsSortedByModTime(objs)) // sort oldest first
+			dedupeDeleteAllButOne(len(objs)-1, label, objs)
+		case DeduplicateOldest:
+			sort.Stable(objectsSortedByModTime(objs)) // sort oldest first
+			dedupeDeleteAllButOne(0, label, objs)
+		default:
+			// skip
+		}
+	}
+	if unverifiable > 0 {
+		Logf(f, "Skipped %d files which don't have a %v hash", unverifiable, ht)
+	}
+	return nil
+}
+
 // listToChan will transfer all objects in the listing to the output
 //
 // If an error occurs, the error will be logged, and it will close the
@@ -1563,7 +2130,7 @@ func Cat(f Fs, w io.Writer, offset, count int64) error {
 				size = count
 			}
 		}
-		in = NewAccountSizeName(in, size, o.Remote()).WithBuffer() // account and buffer the transfer
+		in = NewAccountSizeName(in, size, o.Remote()).WithDirection(TransferDirection(f, nil)).WithBuffer() // account and buffer the transfer
 		defer func() {
 			err = in.Close()
 			if err != nil {
@@ -1589,12 +2156,14 @@ func Rcat(fdst Fs, dstFileName string, in0 io.ReadCloser, modTime time.Time) (er
 	defer func() {
 		Stats.DoneTransferring(dstFileName, err == nil)
 		if otherErr := in0.Close(); otherErr != nil {
-			Debugf(fdst, "Rcat: failed to close source: %v", err)
+			Debugf(fdst, "Rcat: failed to close source: %v", otherErr)
 		}
 	}()
 
-	hashOption := &HashesOption{Hashes: fdst.Hashes()}
-	hash, err := NewMultiHasherTypes(fdst.Hashes())
+	// Only the default hashes, others are only calculated when asked for
+	hashes := fdst.Hashes().Overlap(DefaultHashes)
+	hashOption := &HashesOption{Hashes: hashes}
+	hash, err := NewMultiHasherTypes(hashes)
 	if err != nil {
 		return err
 	}
@@ -1617,7 +2186,7 @@ func Rcat(fdst Fs, dstFileName string, in0 io.ReadCloser, modTime time.Time) (er
 	if n, err := io.ReadFull(trackingIn, buf); err == io.EOF || err == io.ErrUnexpectedEOF {
 		Debugf(fdst, "File to upload is small (%d bytes), uploading instead of streaming", n)
 		in := ioutil.NopCloser(bytes.NewReader(buf[:n]))
-		in = NewAccountSizeName(in, int64(n), dstFileName).WithBuffer()
+		in = NewAccountSizeName(in, int64(n), dstFileName).WithDirection(TransferDirection(nil, fdst)).WithBuffer()
 		objInfo := NewStaticObjectInfo(dstFileName, modTime, int64(n), false, nil, nil)
 		if Config.DryRun {
 			Logf("stdin", "Not uploading as --dry-run")
@@ -1648,7 +2217,7 @@ func Rcat(fdst Fs, dstFileName string, in0 io.ReadCloser, modTime time.Time) (er
 		fStreamTo = tmpLocalFs
 	}
 
-	in = NewAccountSizeName(in, -1, dstFileName).WithBuffer()
+	in = NewAccountSizeName(in, -1, dstFileName).WithDirection(TransferDirection(nil, fdst)).WithBuffer()
 
 	if Config.DryRun {
 		Logf("stdin", "Not uploading as --dry-run")
@@ -1671,6 +2240,69 @@ func Rcat(fdst Fs, dstFileName string, in0 io.ReadCloser, modTime time.Time) (er
 	return nil
 }
 
+// RcatSize reads data from the Reader until EOF and uploads it to a
+// file on remote like Rcat, but size is the number of bytes expected
+// so it is uploaded with Put rather than streamed or spooled.
+//
+// If fewer or more bytes than size are read, eg because the writer
+// to a pipe died, the upload is removed and an error returned.  If
+// size is negative it calls Rcat.
+func RcatSize(fdst Fs, dstFileName string, in0 io.ReadCloser, size int64, modTime time.Time) (err error) {
+	if size < 0 {
+		return Rcat(fdst, dstFileName, in0, modTime)
+	}
+
+	Stats.Transferring(dstFileName)
+	defer func() {
+		Stats.DoneTransferring(dstFileName, err == nil)
+		if otherErr := in0.Close(); otherErr != nil {
+			Debugf(fdst, "RcatSize: failed to close source: %v", otherErr)
+		}
+	}()
+
+	if Config.DryRun {
+		Logf("stdin", "Not uploading as --dry-run")
+		// prevents "broken pipe" errors
+		_, err = io.Copy(ioutil.Discard, in0)
+		return err
+	}
+
+	// Only the default hashes, others are only calculated when asked for
+	hashes := fdst.Hashes().Overlap(DefaultHashes)
+	hashOption := &HashesOption{Hashes: hashes}
+	hash, err := NewMultiHasherTypes(hashes)
+	if err != nil {
+		return err
+	}
+	readCounter := NewCountingReader(in0)
+	in := ioutil.NopCloser(io.TeeReader(readCounter, hash))
+	in = NewAccountSizeName(in, size, dstFileName).WithDirection(TransferDirection(nil, fdst)).WithBuffer()
+
+	objInfo := NewStaticObjectInfo(dstFileName, modTime, size, false, nil, nil)
+	dst, err := fdst.Put(in, objInfo, hashOption)
+	if err != nil {
+		return err
+	}
+	read := int64(readCounter.BytesRead())
+	if read != size {
+		Stats.Error()
+		err = errors.Errorf("read %d bytes but expected %d - input truncated or too long", read, size)
+		Errorf(dst, "%v", err)
+		if removeErr := dst.Remove(); removeErr != nil {
+			Errorf(dst, "Failed to remove after bad upload: %v", removeErr)
+		}
+		return err
+	}
+	src := NewStaticObjectInfo(dstFileName, modTime, size, false, hash.Sums(), fdst)
+	if !Equal(src, dst) {
+		Stats.Error()
+		err = errors.Errorf("corrupted on transfer")
+		Errorf(dst, "%v", err)
+		return err
+	}
+	return nil
+}
+
 // Rmdirs removes any empty directories (or directories only
 // containing empty directories) under f, including f.
 func Rmdirs(f Fs, dir string) error {
@@ -1761,6 +2393,9 @@ func moveOrCopyFile(fdst Fs, fsrc Fs, dstFileName string, srcFileName string, cp
 	}
 
 	if NeedTransfer(dstObj, srcObj) {
+		if dstObj != nil && Config.Immutable {
+			return immutableModified(dstObj)
+		}
 		Stats.Transferring(srcFileName)
 		err = Op(fdst, dstObj, dstFileName, srcObj)
 		Stats.DoneTransferring(srcFileName, err == nil)
@@ -3,6 +3,9 @@
 package fs
 
 import (
+	"io"
+	"io/ioutil"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -90,3 +93,231 @@ func TestFilterAndSortUnknown(t *testing.T) {
 	assert.Error(t, err, "error")
 	assert.Nil(t, newEntries)
 }
+
+func TestDeleteFilesCountMaxErrors(t *testing.T) {
+	oldTransfers, oldMaxDeleteErrors := Config.Transfers, Config.MaxDeleteErrors
+	defer func() {
+		Config.Transfers, Config.MaxDeleteErrors = oldTransfers, oldMaxDeleteErrors
+	}()
+	Config.Transfers = 1
+
+	// mockObjects always fail to Remove
+	deleteMocks := func() (deleted, failed int64, err error) {
+		toBeDeleted := make(ObjectsChan, 10)
+		for i := 0; i < 10; i++ {
+			toBeDeleted <- mockObject(string('a' + rune(i)))
+		}
+		close(toBeDeleted)
+		return DeleteFilesCount(toBeDeleted)
+	}
+
+	// All failures are counted with no limit
+	Config.MaxDeleteErrors = -1
+	deleted, failed, err := deleteMocks()
+	require.Error(t, err)
+	assert.Equal(t, int64(0), deleted)
+	assert.Equal(t, int64(10), failed)
+	assert.False(t, IsFatalError(err))
+
+	// The deletions stop once over the limit
+	Config.MaxDeleteErrors = 2
+	deleted, failed, err = deleteMocks()
+	assert.Equal(t, ErrorMaxDeleteErrorsReached, err)
+	assert.True(t, IsFatalError(err))
+	assert.Equal(t, int64(0), deleted)
+	assert.Equal(t, int64(3), failed)
+}
+
+// metadataObject is a mockObject with metadata on an Fs
+type metadataObject struct {
+	mockObject
+	fs       Fs
+	metadata map[string]string
+}
+
+func (o metadataObject) Fs() Info { return o.fs }
+
+func (o metadataObject) Metadata() (map[string]string, error) {
+	metadata := make(map[string]string, len(o.metadata))
+	for k, v := range o.metadata {
+		metadata[k] = v
+	}
+	return metadata, nil
+}
+
+func TestGetMetadata(t *testing.T) {
+	metadata, err := GetMetadata(mockObject("potato"))
+	require.NoError(t, err)
+	assert.Nil(t, metadata)
+
+	o := metadataObject{mockObject: "potato", metadata: map[string]string{
+		"content-type": "text/plain",
+		"meta-color":   "blue",
+		"Meta-Mtime":   "1500000000",
+	}}
+	metadata, err = GetMetadata(o)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"content-type": "text/plain", "meta-color": "blue"}, metadata)
+}
+
+func TestCopyMetadata(t *testing.T) {
+	oldMetadata := Config.Metadata
+	defer func() { Config.Metadata = oldMetadata }()
+	withMetadata := &aboutFs{features: &Features{ReadMetadata: true, WriteMetadata: true}}
+	withoutMetadata := &aboutFs{features: &Features{}}
+	for _, test := range []struct {
+		metadata bool
+		src, dst Fs
+		want     bool
+	}{
+		{false, withMetadata, withMetadata, false},
+		{true, withMetadata, withMetadata, true},
+		{true, withoutMetadata, withMetadata, false},
+		{true, withMetadata, withoutMetadata, false},
+	} {
+		Config.Metadata = test.metadata
+		src := metadataObject{mockObject: "potato", fs: test.src}
+		assert.Equal(t, test.want, copyMetadata(test.dst, src), "%+v", test)
+	}
+}
+
+// hashFs is a minimal Fs with the hashes given
+type hashFs struct {
+	aboutFs
+	hashes HashSet
+}
+
+func (f *hashFs) Hashes() HashSet { return f.hashes }
+
+// contentsObject is a mockObject with contents and their MD5SUM on f
+type contentsObject struct {
+	mockObject
+	f        Fs
+	contents string
+	md5sum   string
+}
+
+func (o contentsObject) Fs() Info    { return o.f }
+func (o contentsObject) Size() int64 { return int64(len(o.contents)) }
+func (o contentsObject) Hash(ht HashType) (string, error) {
+	return o.md5sum, nil
+}
+func (o contentsObject) Open(options ...OpenOption) (io.ReadCloser, error) {
+	return ioutil.NopCloser(strings.NewReader(o.contents)), nil
+}
+
+func TestCheckMoveCopy(t *testing.T) {
+	oldIgnoreSize, oldVerifyMoveDownload := Config.IgnoreSize, Config.VerifyMoveDownload
+	defer func() {
+		Config.IgnoreSize, Config.VerifyMoveDownload = oldIgnoreSize, oldVerifyMoveDownload
+	}()
+	md5Fs := &hashFs{aboutFs: aboutFs{features: &Features{}}, hashes: NewHashSet(HashMD5)}
+	noHashFs := &hashFs{aboutFs: aboutFs{features: &Features{}}, hashes: NewHashSet()}
+	for _, test := range []struct {
+		f                  Fs
+		dstContents        string
+		dstMD5             string
+		ignoreSize         bool
+		verifyMoveDownload bool
+		wantErr            string
+	}{
+		{md5Fs, "hello", "md5", false, false, ""},
+		{md5Fs, "hell", "md5", false, false, "sizes differ 5 vs 4"},
+		{md5Fs, "hell", "md5", true, false, ""},
+		{md5Fs, "HELLO", "MD5", false, false, "MD5 hash differ"},
+		{md5Fs, "hello", "", false, false, ""},
+		{noHashFs, "HELLO", "", false, false, ""},
+		{noHashFs, "HELLO", "", false, true, "contents differ"},
+		{noHashFs, "hello", "", false, true, ""},
+	} {
+		Config.IgnoreSize, Config.VerifyMoveDownload = test.ignoreSize, test.verifyMoveDownload
+		src := contentsObject{mockObject: "potato", f: test.f, contents: "hello", md5sum: "md5"}
+		dst := contentsObject{mockObject: "potato", f: test.f, contents: test.dstContents, md5sum: test.dstMD5}
+		err := checkMoveCopy(dst, src)
+		if test.wantErr == "" {
+			assert.NoError(t, err, "%+v", test)
+		} else {
+			assert.EqualError(t, err, test.wantErr, "%+v", test)
+		}
+	}
+}
+
+// removeObject is a contentsObject which records whether it was removed
+type removeObject struct {
+	contentsObject
+	removed *bool
+}
+
+func (o removeObject) Remove() error {
+	*o.removed = true
+	return nil
+}
+
+// newObjectFs is a hashFs whose NewObject returns the objects given
+type newObjectFs struct {
+	hashFs
+	objects map[string]Object
+}
+
+func (f *newObjectFs) NewObject(remote string) (Object, error) {
+	if o, ok := f.objects[remote]; ok {
+		return o, nil
+	}
+	return nil, ErrorObjectNotFound
+}
+
+func TestVerifyMove(t *testing.T) {
+	md5Fs := &newObjectFs{hashFs: hashFs{aboutFs: aboutFs{features: &Features{}}, hashes: NewHashSet(HashMD5)}}
+	src := contentsObject{mockObject: "potato", f: md5Fs, contents: "hello", md5sum: "md5"}
+	removed := false
+	dst := removeObject{
+		contentsObject: contentsObject{mockObject: "potato", f: md5Fs, contents: "HELLO", md5sum: "MD5"},
+		removed:        &removed,
+	}
+	md5Fs.objects = map[string]Object{"potato": dst}
+
+	// The copy is read again and, as it may have replaced an
+	// existing file, is kept if it doesn't match
+	assert.EqualError(t, verifyMove(md5Fs, "potato", src), "MD5 hash differ")
+	assert.False(t, removed)
+
+	dst.md5sum = "md5"
+	md5Fs.objects["potato"] = dst
+	assert.NoError(t, verifyMove(md5Fs, "potato", src))
+	assert.EqualError(t, verifyMove(md5Fs, "missing", src), "failed to find the copy: object not found")
+}
+
+// hashCountObject is a contentsObject which counts the reads of its
+// hash
+type hashCountObject struct {
+	contentsObject
+	hashes *int
+}
+
+func (o hashCountObject) Hash(ht HashType) (string, error) {
+	*o.hashes++
+	return o.contentsObject.Hash(ht)
+}
+
+// dedupeFs is a listRFs with MD5 hashes
+type dedupeFs struct {
+	*listRFs
+}
+
+func (f dedupeFs) Hashes() HashSet { return NewHashSet(HashMD5) }
+
+func TestDeduplicateByHashOnlyReadsSameSizes(t *testing.T) {
+	oldMaxDepth := Config.MaxDepth
+	defer func() { Config.MaxDepth = oldMaxDepth }()
+	Config.MaxDepth = -1
+	hashes := 0
+	object := func(remote, contents string) Object {
+		return hashCountObject{contentsObject: contentsObject{mockObject: mockObject(remote), contents: contents, md5sum: contents}, hashes: &hashes}
+	}
+	f := dedupeFs{newListRFs(false, map[string]DirEntries{
+		"":  {object("a", "one"), object("b", "one"), object("c", "three!"), newDir("d")},
+		"d": {object("d/e", "four"), object("d/f", "two")},
+	})}
+	require.NoError(t, DeduplicateByHash(f, DeduplicateSkip))
+	assert.Equal(t, 3, hashes, "only the files of size 3 have their hashes read")
+}
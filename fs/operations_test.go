@@ -33,6 +33,7 @@ import (
 	"regexp"
 	"sort"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -425,6 +426,35 @@ func TestHashSums(t *testing.T) {
 		!strings.Contains(res, "                                                                  potato2\n") {
 		t.Errorf("potato2 missing: %q", res)
 	}
+
+	// SHA-256 Sum - this is an error if not supported
+
+	buf.Reset()
+	err = fs.HashSum(r.fremote, fs.HashSHA256, false, &buf)
+	if !r.fremote.Hashes().Contains(fs.HashSHA256) {
+		require.Error(t, err)
+	} else {
+		require.NoError(t, err)
+		res = buf.String()
+		assert.Contains(t, res, "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855  empty space\n")
+		assert.Contains(t, res, "d398f81cd00b370b116d049d2f3b73a3a7ed35446486effb789791a7e0b98e9c  potato2\n")
+	}
+
+	// SHA-256 Sum with download always works, only downloading
+	// if the remote doesn't support it
+
+	buf.Reset()
+	fs.Stats.ResetCounters()
+	err = fs.HashSum(r.fremote, fs.HashSHA256, true, &buf)
+	require.NoError(t, err)
+	res = buf.String()
+	assert.Contains(t, res, "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855  empty space\n")
+	assert.Contains(t, res, "d398f81cd00b370b116d049d2f3b73a3a7ed35446486effb789791a7e0b98e9c  potato2\n")
+	if r.fremote.Hashes().Contains(fs.HashSHA256) {
+		assert.Equal(t, int64(0), fs.Stats.GetTransfers())
+	} else {
+		assert.Equal(t, int64(2), fs.Stats.GetTransfers())
+	}
 }
 
 func TestCount(t *testing.T) {
@@ -464,14 +494,53 @@ func TestDelete(t *testing.T) {
 	fstest.CheckItems(t, r.fremote, file3)
 }
 
-func testCheck(t *testing.T, checkFunction func(fdst, fsrc fs.Fs) error) {
+func TestDeleteFilesCount(t *testing.T) {
+	r := NewRun(t)
+	defer r.Finalise()
+	r.WriteObject("small", "1234567890", t2)
+	r.WriteObject("medium", "------------------------------------------------------------", t1)
+
+	objs, _, err := fs.WalkGetAll(r.fremote, "", true, -1)
+	require.NoError(t, err)
+	toBeDeleted := make(fs.ObjectsChan, len(objs))
+	for _, o := range objs {
+		toBeDeleted <- o
+	}
+	close(toBeDeleted)
+
+	fs.Stats.ResetCounters()
+	deleted, failed, err := fs.DeleteFilesCount(toBeDeleted)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), deleted)
+	assert.Equal(t, int64(0), failed)
+	assert.Equal(t, int64(2), fs.Stats.GetDeleted())
+	assert.Equal(t, int64(0), fs.Stats.GetTransfers())
+	fstest.CheckItems(t, r.fremote)
+}
+
+// Test delete doesn't delete anything once a stop is requested
+func TestDeleteStopRequested(t *testing.T) {
 	r := NewRun(t)
 	defer r.Finalise()
+	file1 := r.WriteObject("small", "1234567890", t2)
+	fstest.CheckItems(t, r.fremote, file1)
+
+	fs.RequestStop()
+	defer fs.CancelStop()
 
-	check := func(i int, wantErrors int64) {
+	err := fs.Delete(r.fremote)
+	assert.Equal(t, fs.ErrorStopRequested, err)
+	fstest.CheckItems(t, r.fremote, file1)
+}
+
+func testCheck(t *testing.T, checkFunction func(fdst, fsrc fs.Fs, opt *fs.CheckOpt) error) {
+	r := NewRun(t)
+	defer r.Finalise()
+
+	check := func(i int, wantErrors int64, oneway bool) {
 		fs.Debugf(r.fremote, "%d: Starting check test", i)
 		oldErrors := fs.Stats.GetErrors()
-		err := checkFunction(r.flocal, r.fremote)
+		err := checkFunction(r.flocal, r.fremote, &fs.CheckOpt{OneWay: oneway})
 		gotErrors := fs.Stats.GetErrors() - oldErrors
 		if wantErrors == 0 && err != nil {
 			t.Errorf("%d: Got error when not expecting one: %v", i, err)
@@ -488,15 +557,17 @@ func testCheck(t *testing.T, checkFunction func(fdst, fsrc fs.Fs) error) {
 	file1 := r.WriteBoth("rutabaga", "is tasty", t3)
 	fstest.CheckItems(t, r.fremote, file1)
 	fstest.CheckItems(t, r.flocal, file1)
-	check(1, 0)
+	check(1, 0, false)
 
 	file2 := r.WriteFile("potato2", "------------------------------------------------------------", t1)
 	fstest.CheckItems(t, r.flocal, file1, file2)
-	check(2, 1)
+	check(2, 1, false)
+	check(2, 0, true)
 
 	file3 := r.WriteObject("empty space", "", t2)
 	fstest.CheckItems(t, r.fremote, file1, file3)
-	check(3, 2)
+	check(3, 2, false)
+	check(3, 1, true)
 
 	file2r := file2
 	if fs.Config.SizeOnly {
@@ -505,11 +576,21 @@ func testCheck(t *testing.T, checkFunction func(fdst, fsrc fs.Fs) error) {
 		r.WriteObject("potato2", "------------------------------------------------------------", t1)
 	}
 	fstest.CheckItems(t, r.fremote, file1, file2r, file3)
-	check(4, 1)
+	check(4, 1, false)
+	check(4, 1, true)
 
 	r.WriteFile("empty space", "", t2)
 	fstest.CheckItems(t, r.flocal, file1, file2, file3)
-	check(5, 0)
+	check(5, 0, false)
+
+	// Same size but different contents
+	file1r := r.WriteObject("rutabaga", "is TASTY", t3)
+	fstest.CheckItems(t, r.fremote, file1r, file2r, file3)
+	if fs.Config.SizeOnly {
+		check(6, 0, false)
+	} else {
+		check(6, 1, false)
+	}
 }
 
 func TestCheck(t *testing.T) {
@@ -520,6 +601,42 @@ func TestCheckDownload(t *testing.T) {
 	testCheck(t, fs.CheckDownload)
 }
 
+func TestCheckReport(t *testing.T) {
+	r := NewRun(t)
+	defer r.Finalise()
+	file1 := r.WriteBoth("rutabaga", "is tasty", t3)
+	r.WriteFile("potato2", "------------------------------------------------------------", t1)
+	r.WriteFile("differ", "local", t1)
+	r.WriteObject("differ", "remote plus", t1)
+	r.WriteObject("empty space", "", t2)
+	fstest.CheckItems(t, r.fremote, file1,
+		fstest.NewItem("differ", "remote plus", t1),
+		fstest.NewItem("empty space", "", t2))
+
+	var missingOnSrc, missingOnDst, match, differ, errored bytes.Buffer
+	opt := &fs.CheckOpt{
+		MissingOnSrc: &missingOnSrc,
+		MissingOnDst: &missingOnDst,
+		Match:        &match,
+		Differ:       &differ,
+		Error:        &errored,
+	}
+	err := fs.Check(r.flocal, r.fremote, opt)
+	require.Error(t, err)
+	assert.Equal(t, "potato2\n", missingOnSrc.String())
+	assert.Equal(t, "empty space\n", missingOnDst.String())
+	assert.Equal(t, "rutabaga\n", match.String())
+	assert.Equal(t, "differ\n", differ.String())
+	assert.Equal(t, "", errored.String())
+
+	// Nothing is reported missing on the source with --one-way
+	missingOnSrc.Reset()
+	opt.OneWay = true
+	err = fs.Check(r.flocal, r.fremote, opt)
+	require.Error(t, err)
+	assert.Equal(t, "", missingOnSrc.String())
+}
+
 func TestCheckSizeOnly(t *testing.T) {
 	fs.Config.SizeOnly = true
 	defer func() { fs.Config.SizeOnly = false }()
@@ -667,6 +784,47 @@ func TestDeduplicateRename(t *testing.T) {
 	}))
 }
 
+func TestDeduplicateByHash(t *testing.T) {
+	r := NewRun(t)
+	defer r.Finalise()
+	if r.fremote.Hashes().GetOne() == fs.HashNone {
+		t.Skip("Can't dedupe by hash")
+	}
+
+	file1 := r.WriteObject("one.txt", "This is one", t2)
+	file2 := r.WriteObject("dir/copy of one.txt", "This is one", t1)
+	file3 := r.WriteObject("one again.txt", "This is one", t3)
+	file4 := r.WriteObject("two.txt", "This is two", t1)
+	file5 := r.WriteObject("another two.txt", "This is two", t2)
+	fstest.CheckItems(t, r.fremote, file1, file2, file3, file4, file5)
+
+	err := fs.DeduplicateByHash(r.fremote, fs.DeduplicateRename)
+	require.Error(t, err)
+
+	// The groups are found in order of their first file each time
+	var found []string
+	oldLogPrint := fs.SetLogPrint(func(level fs.LogLevel, text string) {
+		if i := strings.Index(text, "Found "); i >= 0 {
+			found = append(found, text[i:])
+		}
+	})
+	defer fs.SetLogPrint(oldLogPrint)
+	for i := 0; i < 5; i++ {
+		found = nil
+		err = fs.DeduplicateByHash(r.fremote, fs.DeduplicateSkip)
+		require.NoError(t, err)
+		assert.Equal(t, []string{
+			"Found 2 files with identical contents: another two.txt, two.txt",
+			"Found 3 files with identical contents: dir/copy of one.txt, one again.txt, one.txt",
+		}, found)
+	}
+	fstest.CheckItems(t, r.fremote, file1, file2, file3, file4, file5)
+
+	err = fs.DeduplicateByHash(r.fremote, fs.DeduplicateOldest)
+	require.NoError(t, err)
+	fstest.CheckItems(t, r.fremote, file2, file4)
+}
+
 // This should really be a unit test, but the test framework there
 // doesn't have enough tools to make it easy
 func TestMergeDirs(t *testing.T) {
@@ -767,6 +925,30 @@ func TestRcat(t *testing.T) {
 	check()
 }
 
+func TestRcatSize(t *testing.T) {
+	r := NewRun(t)
+	defer r.Finalise()
+
+	data := "this is some really nice test data"
+
+	// The right size uploads
+	in := ioutil.NopCloser(strings.NewReader(data))
+	err := fs.RcatSize(r.fremote, "sized", in, int64(len(data)), t1)
+	require.NoError(t, err)
+
+	// A short read is an error and isn't left behind
+	in = ioutil.NopCloser(strings.NewReader(data[:10]))
+	err = fs.RcatSize(r.fremote, "truncated", in, int64(len(data)), t1)
+	require.Error(t, err)
+
+	// No size streams as Rcat does
+	in = ioutil.NopCloser(strings.NewReader(data))
+	err = fs.RcatSize(r.fremote, "unsized", in, -1, t2)
+	require.NoError(t, err)
+
+	fstest.CheckItems(t, r.fremote, fstest.NewItem("sized", data, t1), fstest.NewItem("unsized", data, t2))
+}
+
 func TestRmdirs(t *testing.T) {
 	r := NewRun(t)
 	defer r.Finalise()
@@ -880,6 +1062,184 @@ func TestCopyFile(t *testing.T) {
 	fstest.CheckItems(t, r.fremote, file2)
 }
 
+// flakyObject is an object whose readers fail after reading
+// breakAt bytes the first time it is opened at each multiple of 64k
+type flakyObject struct {
+	fs.Object
+	breakAt int64
+	mu      sync.Mutex
+	offsets map[int64]int
+}
+
+// flakyReader fails with io.ErrUnexpectedEOF after reading n bytes
+type flakyReader struct {
+	io.ReadCloser
+	n int64
+}
+
+func (r *flakyReader) Read(p []byte) (int, error) {
+	if r.n <= 0 {
+		return 0, io.ErrUnexpectedEOF
+	}
+	if int64(len(p)) > r.n {
+		p = p[:r.n]
+	}
+	n, err := r.ReadCloser.Read(p)
+	r.n -= int64(n)
+	return n, err
+}
+
+func (o *flakyObject) Open(options ...fs.OpenOption) (io.ReadCloser, error) {
+	var offset int64
+	for _, option := range options {
+		if x, ok := option.(*fs.SeekOption); ok {
+			offset = x.Offset
+		}
+	}
+	in, err := o.Object.Open(options...)
+	if err != nil {
+		return nil, err
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.offsets[offset]++
+	if o.offsets[offset] > 1 || offset%(64*1024) != 0 {
+		return in, nil
+	}
+	return &flakyReader{ReadCloser: in, n: o.breakAt}, nil
+}
+
+func TestCopyMultiThread(t *testing.T) {
+	r := NewRun(t)
+	defer r.Finalise()
+	if r.fremote.Features().OpenWriterAt == nil {
+		t.Skip("remote can't do multi-thread downloads")
+	}
+	oldCutoff, oldStreams := fs.Config.MultiThreadCutoff, fs.Config.MultiThreadStreams
+	defer func() {
+		fs.Config.MultiThreadCutoff, fs.Config.MultiThreadStreams = oldCutoff, oldStreams
+	}()
+	fs.Config.MultiThreadCutoff = 100 * 1024
+	fs.Config.MultiThreadStreams = 4
+
+	contents := strings.Repeat("0123456789abcdef", 20*1024)
+	file1 := r.WriteFile("file1", contents, t1)
+	fstest.CheckItems(t, r.flocal, file1)
+	src, err := r.flocal.NewObject(file1.Path)
+	require.NoError(t, err)
+
+	// Each part fails part way through once and is resumed
+	flaky := &flakyObject{Object: src, breakAt: 10000, offsets: map[int64]int{}}
+	err = fs.Copy(r.fremote, nil, file1.Path, flaky)
+	require.NoError(t, err)
+	fstest.CheckItems(t, r.fremote, file1)
+	// The parts are rounded up to 64k so there are 3 of them
+	assert.Equal(t, map[int64]int{
+		0:              1,
+		10000:          1,
+		131072:         1,
+		131072 + 10000: 1,
+		262144:         1,
+		262144 + 10000: 1,
+	}, flaky.offsets)
+}
+
+func TestCopyMultiThreadUpdate(t *testing.T) {
+	r := NewRun(t)
+	defer r.Finalise()
+	if r.fremote.Features().OpenWriterAt == nil {
+		t.Skip("remote can't do multi-thread downloads")
+	}
+	oldCutoff, oldStreams := fs.Config.MultiThreadCutoff, fs.Config.MultiThreadStreams
+	defer func() {
+		fs.Config.MultiThreadCutoff, fs.Config.MultiThreadStreams = oldCutoff, oldStreams
+	}()
+	fs.Config.MultiThreadCutoff = 100 * 1024
+	fs.Config.MultiThreadStreams = 4
+
+	r.WriteObject("file1", "existing contents", t1)
+	contents := strings.Repeat("0123456789abcdef", 20*1024)
+	file1 := r.WriteFile("file1", contents, t2)
+	src, err := r.flocal.NewObject(file1.Path)
+	require.NoError(t, err)
+	dst, err := r.fremote.NewObject(file1.Path)
+	require.NoError(t, err)
+
+	// Existing files are replaced with a single stream so a failed
+	// download doesn't lose them
+	flaky := &flakyObject{Object: src, breakAt: 10000, offsets: map[int64]int{}}
+	err = fs.Copy(r.fremote, dst, file1.Path, flaky)
+	require.NoError(t, err)
+	fstest.CheckItems(t, r.fremote, file1)
+	assert.Equal(t, map[int64]int{0: 1, 10000: 1}, flaky.offsets)
+}
+
+// brokenObject is an object whose readers always fail
+type brokenObject struct {
+	fs.Object
+}
+
+func (o *brokenObject) Open(options ...fs.OpenOption) (io.ReadCloser, error) {
+	in, err := o.Object.Open(options...)
+	if err != nil {
+		return nil, err
+	}
+	return &flakyReader{ReadCloser: in, n: 5}, nil
+}
+
+// listRemoteNames lists the names in the root of f without filtering
+func listRemoteNames(t *testing.T, f fs.Fs) (names []string) {
+	entries, err := f.List("")
+	require.NoError(t, err)
+	for _, entry := range entries {
+		names = append(names, entry.Remote())
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestCopyPartialUploads(t *testing.T) {
+	r := NewRun(t)
+	defer r.Finalise()
+	if r.fremote.Features().Move == nil {
+		t.Skip("remote can't move")
+	}
+	oldPartialUploads, oldLowLevelRetries := fs.Config.PartialUploads, fs.Config.LowLevelRetries
+	defer func() {
+		fs.Config.PartialUploads, fs.Config.LowLevelRetries = oldPartialUploads, oldLowLevelRetries
+	}()
+	fs.Config.PartialUploads = true
+	fs.Config.LowLevelRetries = 1
+
+	file1 := r.WriteFile("file1", "file1 contents", t1)
+	src, err := r.flocal.NewObject(file1.Path)
+	require.NoError(t, err)
+
+	// A successful upload is moved into place
+	err = fs.Copy(r.fremote, nil, file1.Path, src)
+	require.NoError(t, err)
+	fstest.CheckItems(t, r.fremote, file1)
+	assert.Equal(t, []string{"file1"}, listRemoteNames(t, r.fremote))
+
+	// A failed upload doesn't replace the existing file or leave a
+	// partial behind
+	dst, err := r.fremote.NewObject(file1.Path)
+	require.NoError(t, err)
+	file2 := r.WriteFile("file1", "file1 contents changed", t2)
+	src, err = r.flocal.NewObject(file2.Path)
+	require.NoError(t, err)
+	err = fs.Copy(r.fremote, dst, file2.Path, &brokenObject{Object: src})
+	require.Error(t, err)
+	fstest.CheckItems(t, r.fremote, file1)
+	assert.Equal(t, []string{"file1"}, listRemoteNames(t, r.fremote))
+
+	// ...but a successful one does
+	err = fs.Copy(r.fremote, dst, file2.Path, src)
+	require.NoError(t, err)
+	fstest.CheckItems(t, r.fremote, file2)
+	assert.Equal(t, []string{"file1"}, listRemoteNames(t, r.fremote))
+}
+
 // testFsInfo is for unit testing fs.Info
 type testFsInfo struct {
 	name      string
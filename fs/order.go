@@ -0,0 +1,204 @@
+// Ordering of the transfers for --order-by
+
+package fs
+
+import (
+	"container/heap"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// lessFn returns true if a should be transferred before b
+type lessFn func(a, b ObjectPair) bool
+
+// transferOrder describes how transfers should be ordered
+type transferOrder struct {
+	less  lessFn // ascending order of the transfers
+	mixed bool   // alternate between the ends of the order
+}
+
+// newTransferOrder parses an --order-by string such as "size,desc"
+// into a transferOrder.  It returns nil if orderBy is empty.
+func newTransferOrder(orderBy string) (*transferOrder, error) {
+	if orderBy == "" {
+		return nil, nil
+	}
+	parts := strings.Split(strings.ToLower(orderBy), ",")
+	if len(parts) > 2 {
+		return nil, errors.Errorf("bad --order-by string %q", orderBy)
+	}
+	o := &transferOrder{}
+	switch strings.TrimSpace(parts[0]) {
+	case "name":
+		o.less = func(a, b ObjectPair) bool {
+			return a.src.Remote() < b.src.Remote()
+		}
+	case "size":
+		o.less = func(a, b ObjectPair) bool {
+			return a.src.Size() < b.src.Size()
+		}
+	case "modtime":
+		o.less = func(a, b ObjectPair) bool {
+			return a.src.ModTime().Before(b.src.ModTime())
+		}
+	default:
+		return nil, errors.Errorf("unknown --order-by comparison %q - must be name, size or modtime", parts[0])
+	}
+	direction := "asc"
+	if len(parts) == 2 {
+		direction = strings.TrimSpace(parts[1])
+	}
+	switch direction {
+	case "asc", "ascending":
+	case "desc", "descending":
+		less := o.less
+		o.less = func(a, b ObjectPair) bool {
+			return less(b, a)
+		}
+	case "mixed":
+		o.mixed = true
+	default:
+		return nil, errors.Errorf("unknown --order-by direction %q - must be asc, desc or mixed", direction)
+	}
+	return o, nil
+}
+
+// queueItem is an ObjectPair waiting in a transferQueue
+type queueItem struct {
+	pair  ObjectPair
+	seq   uint64 // when it was pushed, to keep items which sort equal in order
+	index [2]int // position in the pairHeap from the start then the end
+}
+
+// pairHeap is a heap of the items in a transferQueue with the next
+// one to transfer from the start of the order at the top, or from the
+// end if fromEnd is set.
+//
+// It implements heap.Interface.
+type pairHeap struct {
+	less    lessFn
+	fromEnd bool
+	items   []*queueItem
+}
+
+// end returns which end of the order the heap takes items from, 0
+// for the start or 1 for the end
+func (h *pairHeap) end() int {
+	if h.fromEnd {
+		return 1
+	}
+	return 0
+}
+
+// Len is part of heap.Interface
+func (h *pairHeap) Len() int {
+	return len(h.items)
+}
+
+// Less is part of heap.Interface
+func (h *pairHeap) Less(i, j int) bool {
+	a, b := h.items[i], h.items[j]
+	if h.fromEnd {
+		a, b = b, a
+	}
+	if h.less(a.pair, b.pair) {
+		return true
+	}
+	if h.less(b.pair, a.pair) {
+		return false
+	}
+	return a.seq < b.seq
+}
+
+// Swap is part of heap.Interface
+func (h *pairHeap) Swap(i, j int) {
+	h.items[i], h.items[j] = h.items[j], h.items[i]
+	h.items[i].index[h.end()] = i
+	h.items[j].index[h.end()] = j
+}
+
+// Push is part of heap.Interface
+func (h *pairHeap) Push(x interface{}) {
+	item := x.(*queueItem)
+	item.index[h.end()] = len(h.items)
+	h.items = append(h.items, item)
+}
+
+// Pop is part of heap.Interface
+func (h *pairHeap) Pop() interface{} {
+	n := len(h.items) - 1
+	item := h.items[n]
+	h.items[n] = nil
+	h.items = h.items[:n]
+	return item
+}
+
+// transferQueue holds ObjectPairs waiting to be transferred in the
+// order given by a transferOrder
+type transferQueue struct {
+	order   *transferOrder
+	heaps   []*pairHeap // from the start of the order, then the end if mixed
+	fromEnd bool        // if mixed, take the next item from the end
+	seq     uint64      // number of items pushed
+}
+
+// newTransferQueue makes a new empty queue sorted by order
+func newTransferQueue(order *transferOrder) *transferQueue {
+	q := &transferQueue{
+		order:   order,
+		heaps:   []*pairHeap{{less: order.less}},
+		fromEnd: order.mixed,
+	}
+	if order.mixed {
+		q.heaps = append(q.heaps, &pairHeap{less: order.less, fromEnd: true})
+	}
+	return q
+}
+
+// Len returns the number of items in the queue
+func (q *transferQueue) Len() int {
+	return q.heaps[0].Len()
+}
+
+// Push adds pair to the queue after any items which sort equal to it
+func (q *transferQueue) Push(pair ObjectPair) {
+	item := &queueItem{pair: pair, seq: q.seq}
+	q.seq++
+	for _, h := range q.heaps {
+		heap.Push(h, item)
+	}
+}
+
+// next returns the heap with the next item to be transferred at the
+// top
+func (q *transferQueue) next() *pairHeap {
+	if q.fromEnd {
+		return q.heaps[1]
+	}
+	return q.heaps[0]
+}
+
+// Peek returns the next item to be transferred without removing it.
+//
+// The queue must not be empty.
+func (q *transferQueue) Peek() ObjectPair {
+	return q.next().items[0].pair
+}
+
+// Pop removes the next item to be transferred and returns it.
+//
+// The queue must not be empty.
+func (q *transferQueue) Pop() ObjectPair {
+	from := q.next()
+	item := heap.Pop(from).(*queueItem)
+	for _, h := range q.heaps {
+		if h != from {
+			heap.Remove(h, item.index[h.end()])
+		}
+	}
+	if q.order.mixed {
+		q.fromEnd = !q.fromEnd
+	}
+	return item.pair
+}
@@ -0,0 +1,207 @@
+package fs
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// sizedObject is a mockObject with a size
+type sizedObject struct {
+	mockObject
+	size int64
+}
+
+func (o sizedObject) Size() int64 { return o.size }
+
+func TestNewTransferOrder(t *testing.T) {
+	for _, test := range []struct {
+		in      string
+		wantErr bool
+		isNil   bool
+		mixed   bool
+	}{
+		{"", false, true, false},
+		{"size", false, false, false},
+		{"size,desc", false, false, false},
+		{"Size,Descending", false, false, false},
+		{"modtime,asc", false, false, false},
+		{"name", false, false, false},
+		{"size,mixed", false, false, true},
+		{"potato", true, true, false},
+		{"size,potato", true, true, false},
+		{"size,asc,more", true, true, false},
+	} {
+		order, err := newTransferOrder(test.in)
+		if test.wantErr {
+			assert.Error(t, err, test.in)
+		} else {
+			assert.NoError(t, err, test.in)
+		}
+		assert.Equal(t, test.isNil, order == nil, test.in)
+		if order != nil {
+			assert.Equal(t, test.mixed, order.mixed, test.in)
+		}
+	}
+}
+
+// pairs makes ObjectPairs of sizedObjects with the sizes given
+func pairs(sizes ...int64) (out []ObjectPair) {
+	for _, size := range sizes {
+		out = append(out, ObjectPair{src: sizedObject{mockObject(string('a' + rune(size))), size}})
+	}
+	return out
+}
+
+// sizes returns the sizes of the sources of the ObjectPairs
+func sizes(in []ObjectPair) (out []int64) {
+	for _, pair := range in {
+		out = append(out, pair.src.Size())
+	}
+	return out
+}
+
+func TestTransferQueue(t *testing.T) {
+	for _, test := range []struct {
+		orderBy string
+		want    []int64
+	}{
+		{"size", []int64{1, 2, 3, 4, 5}},
+		{"size,desc", []int64{5, 4, 3, 2, 1}},
+		{"size,mixed", []int64{5, 1, 4, 2, 3}},
+		{"name,desc", []int64{5, 4, 3, 2, 1}},
+	} {
+		order, err := newTransferOrder(test.orderBy)
+		require.NoError(t, err)
+		q := newTransferQueue(order)
+		for _, pair := range pairs(3, 1, 5, 2, 4) {
+			q.Push(pair)
+		}
+		var got []ObjectPair
+		for q.Len() > 0 {
+			next := q.Peek()
+			got = append(got, q.Pop())
+			assert.Equal(t, next, got[len(got)-1])
+		}
+		assert.Equal(t, test.want, sizes(got), test.orderBy)
+	}
+}
+
+// TestTransferQueueStable checks the queue gives the same order as a
+// stable sort, so items which sort equal come out in the order they
+// were pushed, or the reverse of it when taken from the end
+func TestTransferQueueStable(t *testing.T) {
+	rand.Seed(1)
+	var in []ObjectPair
+	for i := 0; i < 1000; i++ {
+		in = append(in, ObjectPair{src: sizedObject{mockObject(fmt.Sprint(i)), rand.Int63n(50)}})
+	}
+	for _, orderBy := range []string{"size", "size,desc", "size,mixed"} {
+		order, err := newTransferOrder(orderBy)
+		require.NoError(t, err)
+		sorted := append([]ObjectPair(nil), in...)
+		sort.SliceStable(sorted, func(i, j int) bool {
+			return order.less(sorted[i], sorted[j])
+		})
+		var want []ObjectPair
+		if order.mixed {
+			for i, j := 0, len(sorted)-1; i <= j; i, j = i+1, j-1 {
+				want = append(want, sorted[j])
+				if i < j {
+					want = append(want, sorted[i])
+				}
+			}
+		} else {
+			want = sorted
+		}
+
+		q := newTransferQueue(order)
+		for _, pair := range in {
+			q.Push(pair)
+		}
+		var got []ObjectPair
+		for q.Len() > 0 {
+			got = append(got, q.Pop())
+		}
+		assert.Equal(t, want, got, orderBy)
+	}
+}
+
+func TestOrderTransfers(t *testing.T) {
+	oldMaxBacklog := Config.MaxBacklog
+	defer func() { Config.MaxBacklog = oldMaxBacklog }()
+
+	order, err := newTransferOrder("size,desc")
+	require.NoError(t, err)
+	for _, test := range []struct {
+		maxBacklog int
+		want       []int64
+	}{
+		{0, []int64{5, 4, 3, 2, 1}},
+		{100, []int64{5, 4, 3, 2, 1}},
+		// Only the best of each 2 waiting is sent
+		{2, []int64{3, 5, 2, 4, 1}},
+	} {
+		Config.MaxBacklog = test.maxBacklog
+		s := &syncCopyMove{
+			order: order,
+			abort: make(chan struct{}),
+		}
+		in := make(ObjectPairChan, 10)
+		out := make(ObjectPairChan)
+		for _, pair := range pairs(3, 1, 5, 2, 4) {
+			in <- pair
+		}
+		close(in)
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go s.orderTransfers(in, out, &wg)
+		var got []ObjectPair
+		for pair := range out {
+			got = append(got, pair)
+		}
+		wg.Wait()
+		assert.Equal(t, test.want, sizes(got), test.maxBacklog)
+	}
+}
+
+func TestOrderTransfersWaitsForChecking(t *testing.T) {
+	oldMaxBacklog := Config.MaxBacklog
+	defer func() { Config.MaxBacklog = oldMaxBacklog }()
+	Config.MaxBacklog = 0
+
+	order, err := newTransferOrder("size,desc")
+	require.NoError(t, err)
+	s := &syncCopyMove{
+		order: order,
+		abort: make(chan struct{}),
+	}
+	in := make(ObjectPairChan)
+	out := make(ObjectPairChan)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go s.orderTransfers(in, out, &wg)
+	for _, pair := range pairs(1, 2) {
+		in <- pair
+	}
+
+	// Nothing is sent until the checking has finished
+	select {
+	case pair := <-out:
+		t.Fatalf("sent %v before the checking finished", pair.src)
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(in)
+	var got []ObjectPair
+	for pair := range out {
+		got = append(got, pair)
+	}
+	wg.Wait()
+	assert.Equal(t, []int64{2, 1}, sizes(got))
+}
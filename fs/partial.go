@@ -0,0 +1,78 @@
+// Uploads to a temporary name which are moved into place
+
+package fs
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"regexp"
+
+	"github.com/pkg/errors"
+)
+
+// partialUploadSuffix is added to the names of partial uploads along
+// with some random hex digits
+const partialUploadSuffix = ".partial-"
+
+// partialUploadRe matches the names of partial uploads
+var partialUploadRe = regexp.MustCompile(regexp.QuoteMeta(partialUploadSuffix) + `[0-9a-f]{8}$`)
+
+// isPartialUpload returns true if remote is the name of an upload in
+// progress with --partial-uploads
+//
+// These are left out of listings so syncs don't copy, delete or back
+// them up while another rclone is uploading them.
+func isPartialUpload(remote string) bool {
+	return partialUploadRe.MatchString(remote)
+}
+
+// partialUploadName returns the name to upload to for remote if
+// --partial-uploads is in use and f can Move, or "" if the upload
+// should go straight to remote
+func partialUploadName(f Fs, remote string) string {
+	if !Config.PartialUploads || f.Features().Move == nil {
+		return ""
+	}
+	var random [4]byte
+	if _, err := rand.Read(random[:]); err != nil {
+		Errorf(remote, "Failed to make partial upload name - uploading in place: %v", err)
+		return ""
+	}
+	return remote + partialUploadSuffix + hex.EncodeToString(random[:])
+}
+
+// removePartialUpload removes the partial upload partialRemote on f
+// after a failed upload
+func removePartialUpload(f Fs, partialRemote string) {
+	partial, err := f.NewObject(partialRemote)
+	if err == nil {
+		removeFailedCopy(partial)
+	}
+}
+
+// movePartialUpload moves the completed upload partial into place at
+// remote, replacing existing if set
+func movePartialUpload(f Fs, existing, partial Object, remote string) (Object, error) {
+	doMove := f.Features().Move
+	// Moving onto an existing name would make a duplicate
+	if existing != nil && f.Features().DuplicateFiles {
+		err := existing.Remove()
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to remove existing file before moving upload into place")
+		}
+		existing = nil
+	}
+	dst, err := doMove(partial, remote)
+	if err != nil && existing != nil {
+		// Some remotes can't move onto an existing file
+		Debugf(partial, "Removing existing file and retrying move into place: %v", err)
+		err = existing.Remove()
+		if err == nil {
+			dst, err = doMove(partial, remote)
+		}
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to move upload into place")
+	}
+	return dst, nil
+}
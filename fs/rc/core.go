@@ -0,0 +1,122 @@
+// Remote control functions for rclone itself
+
+package rc
+
+import (
+	"github.com/ncw/rclone/fs"
+)
+
+func init() {
+	Add(Call{
+		Path:  "rc/noop",
+		Fn:    rcNoop,
+		Title: "Echo the input to the output",
+		Help: `
+This echoes the input parameters to the output parameters for testing
+purposes.  It can be used to check that rclone is still alive and to
+check that parameter passing is working properly.`,
+	})
+	Add(Call{
+		Path:  "rc/list",
+		Fn:    rcList,
+		Title: "List all the registered remote control commands",
+		Help: `
+This lists all the registered remote control commands as a JSON map in
+the commands response.`,
+	})
+	Add(Call{
+		Path:  "core/stats",
+		Fn:    rcStats,
+		Title: "Returns stats about current transfers",
+		Help: `
+This returns the same stats as the periodic --stats output as numbers,
+eg
+
+    {
+        "bytes": 1234,
+        "checks": 2,
+        "elapsedTime": 12.3,
+        "errors": 0,
+        "speed": 100.5,
+        "transfers": 1,
+        ...
+    }`,
+	})
+	Add(Call{
+		Path:  "core/transferring",
+		Fn:    rcTransferring,
+		Title: "Returns the transfers in progress",
+		Help: `
+This returns a list of the transfers in progress in the transferring
+response, each with its name, bytes, size, speed and speedAvg in
+bytes/s, and its percentage and eta in seconds if known.`,
+	})
+	Add(Call{
+		Path:  "core/bwlimit",
+		Fn:    rcBwlimit,
+		Title: "Set the bandwidth limit",
+		Help: `
+This sets the bandwidth limit to the rate parameter, which can be
+anything --bwlimit accepts except a timetable, eg "1M", "off" or
+"1M:10M" for separate upload and download limits.  It replaces any
+timetable set with --bwlimit.
+
+The limit in force is returned in the rate response.  If the rate
+parameter isn't given the limit isn't changed.`,
+	})
+	Add(Call{
+		Path:  "core/stop",
+		Fn:    rcStop,
+		Title: "Stop the sync gracefully",
+		Help: `
+This stops any sync, copy or move in progress from starting new
+transfers.  The transfers in progress are allowed to finish, then the
+command exits with an error.`,
+	})
+}
+
+// Echo the input to the output
+func rcNoop(in Params) (out Params, err error) {
+	return in, nil
+}
+
+// List the registered commands
+func rcList(in Params) (out Params, err error) {
+	return Params{
+		"commands": calls.list(),
+	}, nil
+}
+
+// Return the stats
+func rcStats(in Params) (out Params, err error) {
+	return Params(fs.Stats.RemoteStats()), nil
+}
+
+// Return the transfers in progress
+func rcTransferring(in Params) (out Params, err error) {
+	return Params{
+		"transferring": fs.Stats.TransferringStats(),
+	}, nil
+}
+
+// Set the bandwidth limit
+func rcBwlimit(in Params) (out Params, err error) {
+	rate, err := in.GetString("rate")
+	if err == nil {
+		err = fs.SetBwLimit(rate)
+		if err != nil {
+			return nil, ErrParamInvalid{err}
+		}
+	} else if _, ok := err.(ErrParamNotFound); !ok {
+		return nil, err
+	}
+	return Params{
+		"rate": fs.CurrentBwLimit(),
+	}, nil
+}
+
+// Stop the sync gracefully
+func rcStop(in Params) (out Params, err error) {
+	fs.RequestStop()
+	return nil, nil
+}
@@ -0,0 +1,62 @@
+package rc
+
+import (
+	"testing"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRcList(t *testing.T) {
+	out, err := rcList(nil)
+	require.NoError(t, err)
+	var paths []string
+	for _, call := range out["commands"].([]*Call) {
+		paths = append(paths, call.Path)
+	}
+	assert.Contains(t, paths, "core/bwlimit")
+	assert.Contains(t, paths, "core/stats")
+	assert.Contains(t, paths, "core/stop")
+	assert.Contains(t, paths, "core/transferring")
+	assert.Contains(t, paths, "rc/noop")
+}
+
+func TestRcBwlimit(t *testing.T) {
+	defer func() {
+		require.NoError(t, fs.SetBwLimit("off"))
+	}()
+
+	out, err := rcBwlimit(Params{"rate": "1M:10M"})
+	require.NoError(t, err)
+	assert.Equal(t, Params{"rate": "1M:10M"}, out)
+
+	out, err = rcBwlimit(Params{})
+	require.NoError(t, err)
+	assert.Equal(t, Params{"rate": "1M:10M"}, out)
+
+	_, err = rcBwlimit(Params{"rate": "08:00,1M 09:00,off"})
+	assert.True(t, isBadRequest(err))
+
+	_, err = rcBwlimit(Params{"rate": 1})
+	assert.True(t, isBadRequest(err))
+}
+
+func TestRcStatsAndTransferring(t *testing.T) {
+	out, err := rcStats(nil)
+	require.NoError(t, err)
+	assert.Contains(t, out, "bytes")
+	assert.Contains(t, out, "transferring")
+
+	out, err = rcTransferring(nil)
+	require.NoError(t, err)
+	assert.Contains(t, out, "transferring")
+}
+
+func TestRcStop(t *testing.T) {
+	defer fs.CancelStop()
+	assert.False(t, fs.StopRequested())
+	_, err := rcStop(nil)
+	require.NoError(t, err)
+	assert.True(t, fs.StopRequested())
+}
@@ -0,0 +1,134 @@
+// Package rc implements a remote control server and registry for rclone
+//
+// Remote control functions are registered with Add under a path and
+// are called over HTTP with the parameters in a JSON object.  They
+// return their results as a JSON object too, so more functions and
+// more parameters can be added without changing the shape of the
+// existing ones.
+package rc
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Params is the input and output type for the Func
+type Params map[string]interface{}
+
+// Func defines a type for a remote control function
+type Func func(in Params) (out Params, err error)
+
+// Call defines info about a remote control function and is used in
+// the Add function to create new entry points.
+type Call struct {
+	Path  string // path to activate this RC
+	Fn    Func   `json:"-"` // function to call
+	Title string // help for the function
+	Help  string // multi-line markdown formatted help
+}
+
+// registry holds the list of all the registered remote control functions
+type registry struct {
+	mu   sync.RWMutex
+	call map[string]*Call
+}
+
+// calls is the global registry of Call objects
+var calls = &registry{
+	call: make(map[string]*Call),
+}
+
+// add a call to the registry
+func (r *registry) add(call Call) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	call.Path = strings.Trim(call.Path, "/")
+	call.Help = strings.TrimSpace(call.Help)
+	if _, found := r.call[call.Path]; found {
+		panic(fmt.Sprintf("remote control function %q registered twice", call.Path))
+	}
+	r.call[call.Path] = &call
+}
+
+// get a Call from a path or nil
+func (r *registry) get(path string) *Call {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.call[path]
+}
+
+// list returns all the calls sorted by path
+func (r *registry) list() (out []*Call) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	paths := make([]string, 0, len(r.call))
+	for path := range r.call {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		out = append(out, r.call[path])
+	}
+	return out
+}
+
+// Add a function to the global registry
+//
+// It panics if a function with the same path is already registered.
+func Add(call Call) {
+	calls.add(call)
+}
+
+// ErrParamNotFound is returned if a required parameter is missing
+type ErrParamNotFound string
+
+// Error turns this error into a string
+func (e ErrParamNotFound) Error() string {
+	return fmt.Sprintf("didn't find key %q in input", string(e))
+}
+
+// ErrParamInvalid is returned if a parameter has the wrong type or
+// value
+type ErrParamInvalid struct {
+	error
+}
+
+// isBadRequest returns true if err was caused by bad parameters
+func isBadRequest(err error) bool {
+	switch errors.Cause(err).(type) {
+	case ErrParamNotFound, ErrParamInvalid:
+		return true
+	}
+	return false
+}
+
+// Get gets a parameter from the input
+//
+// If the parameter isn't found then it returns an ErrParamNotFound
+func (p Params) Get(key string) (interface{}, error) {
+	value, ok := p[key]
+	if !ok {
+		return nil, ErrParamNotFound(key)
+	}
+	return value, nil
+}
+
+// GetString gets a string parameter from the input
+//
+// If the parameter isn't found then it returns an ErrParamNotFound,
+// and if it isn't a string an ErrParamInvalid.
+func (p Params) GetString(key string) (string, error) {
+	value, err := p.Get(key)
+	if err != nil {
+		return "", err
+	}
+	s, ok := value.(string)
+	if !ok {
+		return "", ErrParamInvalid{errors.Errorf("expecting string value for key %q (was %T)", key, value)}
+	}
+	return s, nil
+}
@@ -0,0 +1,49 @@
+package rc
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistry(t *testing.T) {
+	r := &registry{call: make(map[string]*Call)}
+	fn := func(in Params) (Params, error) { return in, nil }
+	r.add(Call{Path: "/b/call/", Fn: fn, Help: "\nhelp\n"})
+	r.add(Call{Path: "a/call", Fn: fn})
+
+	call := r.get("b/call")
+	require.NotNil(t, call)
+	assert.Equal(t, "b/call", call.Path)
+	assert.Equal(t, "help", call.Help)
+	assert.Nil(t, r.get("potato"))
+
+	list := r.list()
+	require.Len(t, list, 2)
+	assert.Equal(t, "a/call", list[0].Path)
+	assert.Equal(t, "b/call", list[1].Path)
+
+	assert.Panics(t, func() {
+		r.add(Call{Path: "a/call", Fn: fn})
+	})
+}
+
+func TestParamsGetString(t *testing.T) {
+	in := Params{
+		"string": "one",
+		"number": 1.0,
+	}
+	s, err := in.GetString("string")
+	require.NoError(t, err)
+	assert.Equal(t, "one", s)
+
+	_, err = in.GetString("potato")
+	assert.Equal(t, ErrParamNotFound("potato"), err)
+	assert.True(t, isBadRequest(err))
+
+	_, err = in.GetString("number")
+	require.Error(t, err)
+	assert.IsType(t, ErrParamInvalid{}, err)
+	assert.True(t, isBadRequest(err))
+}
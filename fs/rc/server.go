@@ -0,0 +1,192 @@
+// Remote control HTTP server
+
+package rc
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/pkg/errors"
+)
+
+// Flags
+var (
+	enabled = fs.BoolP("rc", "", false, "Enable the remote control server.")
+	addr    = fs.StringP("rc-addr", "", "localhost:5572", "IPaddress:Port to bind the remote control server to.")
+	user    = fs.StringP("rc-user", "", "", "User name for authentication with the remote control server.")
+	pass    = fs.StringP("rc-pass", "", "", "Password for authentication with the remote control server.")
+)
+
+// Start the remote control server if --rc is set
+//
+// It returns a function which should be called to stop the server,
+// or nil if it wasn't started.
+func Start() (stop func(), err error) {
+	if !*enabled {
+		return nil, nil
+	}
+	if (*user == "") != (*pass == "") {
+		return nil, errors.New("need both --rc-user and --rc-pass for authentication")
+	}
+	s, err := newServer(*addr, *user, *pass)
+	if err != nil {
+		return nil, err
+	}
+	fs.Logf(nil, "Serving remote control on http://%s/", s.listener.Addr())
+	return s.stop, nil
+}
+
+// server is a remote control server
+type server struct {
+	user     string        // user name for authentication if set
+	pass     string        // password for authentication
+	listener net.Listener  // what the server is listening on
+	done     chan struct{} // closed when the server has stopped
+}
+
+// newServer starts a remote control server listening on addr
+func newServer(addr, user, pass string) (*server, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to start remote control server")
+	}
+	s := &server{
+		user:     user,
+		pass:     pass,
+		listener: listener,
+		done:     make(chan struct{}),
+	}
+	go func() {
+		defer close(s.done)
+		// This returns an error when stop closes the listener
+		_ = http.Serve(listener, s)
+	}()
+	return s, nil
+}
+
+// stop the server, waiting for it to finish
+func (s *server) stop() {
+	_ = s.listener.Close()
+	<-s.done
+}
+
+// authenticated returns true if the request has the right user and
+// password
+func (s *server) authenticated(r *http.Request) bool {
+	user, pass, ok := r.BasicAuth()
+	if !ok {
+		return false
+	}
+	userOK := subtle.ConstantTimeCompare([]byte(user), []byte(s.user)) == 1
+	passOK := subtle.ConstantTimeCompare([]byte(pass), []byte(s.pass)) == 1
+	return userOK && passOK
+}
+
+// writeJSON writes out as the JSON response with the status given
+func writeJSON(w http.ResponseWriter, status int, out Params) {
+	buf, err := json.MarshalIndent(out, "", "\t")
+	if err != nil {
+		fs.Errorf(nil, "rc: failed to make JSON output: %v", err)
+		status = http.StatusInternalServerError
+		buf = []byte(`{"error": "failed to make JSON output"}`)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, err = w.Write(append(buf, '\n'))
+	if err != nil {
+		fs.Errorf(nil, "rc: failed to write JSON output: %v", err)
+	}
+}
+
+// writeError writes err as the JSON response with the status given
+func writeError(w http.ResponseWriter, path string, in Params, err error, status int) {
+	fs.Errorf(nil, "rc: %q: error: %v", path, err)
+	writeJSON(w, status, Params{
+		"status": status,
+		"error":  err.Error(),
+		"input":  in,
+		"path":   path,
+	})
+}
+
+// isJSON returns true if the body of the request is JSON
+func isJSON(r *http.Request) bool {
+	contentType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return contentType == "application/json"
+}
+
+// readParams reads the parameters from the URL query, any form in
+// the body and any JSON object in the body, in that order
+func readParams(r *http.Request) (Params, error) {
+	in := Params{}
+	err := r.ParseForm()
+	if err != nil {
+		return in, errors.Wrap(err, "failed to parse form/URL parameters")
+	}
+	for k, vs := range r.Form {
+		if len(vs) > 0 {
+			in[k] = vs[len(vs)-1]
+		}
+	}
+	if isJSON(r) {
+		err = json.NewDecoder(r.Body).Decode(&in)
+		if err != nil && err != io.EOF {
+			return in, errors.Wrap(err, "failed to read input JSON")
+		}
+	}
+	return in, nil
+}
+
+// ServeHTTP calls the remote control function for the path of the
+// request and returns its result
+func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.Trim(r.URL.Path, "/")
+	if s.user != "" && !s.authenticated(r) {
+		w.Header().Set("WWW-Authenticate", `Basic realm="rclone"`)
+		writeError(w, path, nil, errors.New("authentication required"), http.StatusUnauthorized)
+		return
+	}
+	if r.Method != "POST" {
+		w.Header().Set("Allow", "POST")
+		writeError(w, path, nil, errors.Errorf("method %q not allowed", r.Method), http.StatusMethodNotAllowed)
+		return
+	}
+	// Without authentication only accept requests a web page can't
+	// make without the browser asking first, so other sites can't
+	// post forms to the server.
+	if s.user == "" && !isJSON(r) {
+		writeError(w, path, nil, errors.New("need Content-Type: application/json without --rc-user and --rc-pass"), http.StatusUnsupportedMediaType)
+		return
+	}
+	call := calls.get(path)
+	if call == nil {
+		writeError(w, path, nil, errors.Errorf("couldn't find method %q", path), http.StatusNotFound)
+		return
+	}
+	in, err := readParams(r)
+	if err != nil {
+		writeError(w, path, in, err, http.StatusBadRequest)
+		return
+	}
+	fs.Debugf(nil, "rc: %q: with parameters %+v", path, in)
+	out, err := call.Fn(in)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if isBadRequest(err) {
+			status = http.StatusBadRequest
+		}
+		writeError(w, path, in, err, status)
+		return
+	}
+	if out == nil {
+		out = Params{}
+	}
+	fs.Debugf(nil, "rc: %q: reply %+v", path, out)
+	writeJSON(w, http.StatusOK, out)
+}
@@ -0,0 +1,106 @@
+package rc
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// post makes a POST request to the server at path returning the
+// status and the decoded JSON reply
+func post(t *testing.T, s *server, path, contentType, body string, auth bool) (int, Params) {
+	req, err := http.NewRequest("POST", "http://"+s.listener.Addr().String()+"/"+path, strings.NewReader(body))
+	require.NoError(t, err)
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if auth {
+		req.SetBasicAuth("user", "pass")
+	}
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, resp.Body.Close())
+	}()
+	assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+	var out Params
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&out))
+	return resp.StatusCode, out
+}
+
+func TestServer(t *testing.T) {
+	s, err := newServer("localhost:0", "", "")
+	require.NoError(t, err)
+	defer s.stop()
+
+	// JSON parameters
+	status, out := post(t, s, "rc/noop", "application/json", `{"potato":"1","sausage":2}`, false)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, Params{"potato": "1", "sausage": 2.0}, out)
+
+	// URL parameters with an empty JSON body
+	status, out = post(t, s, "rc/noop?potato=1", "application/json", "", false)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, Params{"potato": "1"}, out)
+
+	// Forms and other bodies which a web page could post aren't
+	// accepted without authentication
+	for _, contentType := range []string{"application/x-www-form-urlencoded", "text/plain", ""} {
+		status, out = post(t, s, "rc/noop?potato=1", contentType, url.Values{"sausage": {"2"}}.Encode(), false)
+		assert.Equal(t, http.StatusUnsupportedMediaType, status, contentType)
+		assert.Contains(t, out["error"], "application/json", contentType)
+	}
+
+	// Bad JSON
+	status, out = post(t, s, "rc/noop", "application/json", `{`, false)
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Contains(t, out["error"], "failed to read input JSON")
+
+	// Unknown function
+	status, out = post(t, s, "potato", "application/json", "", false)
+	assert.Equal(t, http.StatusNotFound, status)
+	assert.Equal(t, "potato", out["path"])
+
+	// Bad parameters
+	status, _ = post(t, s, "core/bwlimit", "application/json", `{"rate":"potato"}`, false)
+	assert.Equal(t, http.StatusBadRequest, status)
+
+	// Only POST is allowed
+	resp, err := http.Get("http://" + s.listener.Addr().String() + "/rc/noop")
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+	assert.Equal(t, "POST", resp.Header.Get("Allow"))
+}
+
+func TestServerAuth(t *testing.T) {
+	s, err := newServer("localhost:0", "user", "pass")
+	require.NoError(t, err)
+	defer s.stop()
+
+	status, _ := post(t, s, "rc/noop", "", "", false)
+	assert.Equal(t, http.StatusUnauthorized, status)
+
+	status, _ = post(t, s, "rc/noop", "", "", true)
+	assert.Equal(t, http.StatusOK, status)
+
+	// Forms are accepted with authentication
+	status, out := post(t, s, "rc/noop?potato=1", "application/x-www-form-urlencoded", url.Values{"sausage": {"2"}}.Encode(), true)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, Params{"potato": "1", "sausage": "2"}, out)
+}
+
+func TestServerStop(t *testing.T) {
+	s, err := newServer("localhost:0", "", "")
+	require.NoError(t, err)
+	addr := s.listener.Addr().String()
+	s.stop()
+
+	_, err = http.Post("http://"+addr+"/rc/noop", "", nil)
+	assert.Error(t, err)
+}
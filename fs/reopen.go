@@ -0,0 +1,92 @@
+package fs
+
+import (
+	"io"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// reOpen is a reader for an object which, if reading fails part way
+// through, reopens the object at the offset read so far and carries
+// on rather than the transfer starting again from the beginning.
+//
+// The object's Fs should have the SeekOpen feature.  Whatever reads
+// from it sees the data as one stream, so the hash of the complete
+// object is checked as usual once it is transferred.
+type reOpen struct {
+	mu       sync.Mutex
+	src      Object        // object to read
+	options  []OpenOption  // options to open it with
+	rc       io.ReadCloser // current reader
+	read     int64         // bytes read so far
+	tries    int           // number of reopens so far
+	maxTries int           // maximum number of reopens
+	err      error         // if set, returned by Read
+}
+
+// newReOpen opens src with options, reopening it up to maxTries times
+// if reading fails
+func newReOpen(src Object, maxTries int, options ...OpenOption) (io.ReadCloser, error) {
+	h := &reOpen{
+		src:      src,
+		options:  options,
+		maxTries: maxTries,
+	}
+	err := h.open()
+	if err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// open the object at the offset read so far - call with the lock held
+func (h *reOpen) open() error {
+	options := h.options
+	if h.read > 0 {
+		options = append(options[:len(options):len(options)], &SeekOption{Offset: h.read})
+	}
+	rc, err := h.src.Open(options...)
+	if err != nil {
+		return err
+	}
+	h.rc = rc
+	return nil
+}
+
+// Read bytes, reopening the object if reading fails with an error
+// which might go away on a retry
+func (h *reOpen) Read(p []byte) (n int, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.err != nil {
+		return 0, h.err
+	}
+	n, err = h.rc.Read(p)
+	h.read += int64(n)
+	if err == nil || err == io.EOF || h.tries >= h.maxTries || !ShouldRetryLowLevel(err) {
+		return n, err
+	}
+	h.tries++
+	Logf(h.src, "Reopening at offset %d after read failed: %v - low level retry %d/%d", h.read, err, h.tries, h.maxTries)
+	_ = h.rc.Close()
+	h.rc = nil
+	if reopenErr := h.open(); reopenErr != nil {
+		h.err = errors.Wrap(reopenErr, "failed to reopen")
+		return n, h.err
+	}
+	return n, nil
+}
+
+// Close the current reader
+func (h *reOpen) Close() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.err == nil {
+		h.err = errors.New("reopen: read after close")
+	}
+	if h.rc == nil {
+		return nil
+	}
+	return h.rc.Close()
+}
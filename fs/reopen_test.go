@@ -0,0 +1,75 @@
+package fs
+
+import (
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// reOpenTestObject is an object whose readers fail after reading
+// breakAt bytes until it has been opened more than failures times
+type reOpenTestObject struct {
+	mockObject
+	data     string
+	breakAt  int
+	failures int
+	offsets  []int64
+}
+
+// failingReader returns err after reading all of in
+type failingReader struct {
+	in  io.Reader
+	err error
+}
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	n, err := r.in.Read(p)
+	if err == io.EOF {
+		err = r.err
+	}
+	return n, err
+}
+
+func (o *reOpenTestObject) Open(options ...OpenOption) (io.ReadCloser, error) {
+	var offset int64
+	for _, option := range options {
+		if x, ok := option.(*SeekOption); ok {
+			offset = x.Offset
+		}
+	}
+	o.offsets = append(o.offsets, offset)
+	data := o.data[offset:]
+	if len(o.offsets) <= o.failures {
+		return ioutil.NopCloser(&failingReader{
+			in:  strings.NewReader(data[:o.breakAt]),
+			err: io.ErrUnexpectedEOF,
+		}), nil
+	}
+	return ioutil.NopCloser(strings.NewReader(data)), nil
+}
+
+func TestReOpen(t *testing.T) {
+	o := &reOpenTestObject{mockObject: "potato", data: "0123456789", breakAt: 3, failures: 2}
+	in, err := newReOpen(o, 10)
+	require.NoError(t, err)
+	got, err := ioutil.ReadAll(in)
+	require.NoError(t, err)
+	require.NoError(t, in.Close())
+	assert.Equal(t, "0123456789", string(got))
+	assert.Equal(t, []int64{0, 3, 6}, o.offsets)
+}
+
+func TestReOpenGivesUp(t *testing.T) {
+	o := &reOpenTestObject{mockObject: "potato", data: "0123456789", breakAt: 3, failures: 5}
+	in, err := newReOpen(o, 2)
+	require.NoError(t, err)
+	got, err := ioutil.ReadAll(in)
+	assert.Equal(t, io.ErrUnexpectedEOF, err)
+	assert.Equal(t, "012345678", string(got))
+	assert.Equal(t, []int64{0, 3, 6}, o.offsets)
+	require.NoError(t, in.Close())
+}
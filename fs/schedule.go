@@ -0,0 +1,150 @@
+// Sharing the transfer slots between the files for --transfer-scheduler
+
+package fs
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/pflag"
+)
+
+// TransferScheduler describes how the transfers are shared between
+// the transfer slots
+type TransferScheduler byte
+
+// TransferScheduler constants
+const (
+	TransferSchedulerFIFO TransferScheduler = iota // transfer the files in the order they are found
+	TransferSchedulerFair                          // reserve some slots for small files
+)
+
+var transferSchedulerToString = []string{
+	TransferSchedulerFIFO: "fifo",
+	TransferSchedulerFair: "fair",
+}
+
+// String turns a TransferScheduler into a string
+func (m TransferScheduler) String() string {
+	if int(m) >= len(transferSchedulerToString) {
+		return fmt.Sprintf("TransferScheduler(%d)", m)
+	}
+	return transferSchedulerToString[m]
+}
+
+// Set a TransferScheduler
+func (m *TransferScheduler) Set(s string) error {
+	for n, name := range transferSchedulerToString {
+		if strings.EqualFold(s, name) {
+			*m = TransferScheduler(n)
+			return nil
+		}
+	}
+	return errors.Errorf("Unknown transfer scheduler %q", s)
+}
+
+// Type of the value
+func (m *TransferScheduler) Type() string {
+	return "string"
+}
+
+// Check it satisfies the interface
+var _ pflag.Value = (*TransferScheduler)(nil)
+
+// smallTransfers returns how many of the transfers slots are reserved
+// for small files with --transfer-scheduler fair.
+//
+// At least one slot is reserved and one left for large files, so it
+// returns 0 if there is only one slot.
+func smallTransfers(transfers int, fraction float64) int {
+	if transfers <= 1 {
+		return 0
+	}
+	n := int(math.Ceil(float64(transfers) * fraction))
+	if n < 1 {
+		n = 1
+	}
+	if n > transfers-1 {
+		n = transfers - 1
+	}
+	return n
+}
+
+// isSmallTransfer returns true if pair should be transferred in the
+// slots reserved for small files.  Files of unknown size are large.
+func isSmallTransfer(pair ObjectPair) bool {
+	size := pair.src.Size()
+	return size >= 0 && size < int64(Config.SmallFileCutoff)
+}
+
+// scheduleTransfers reads ObjectPairs on in and shares them between
+// the transfer slots for --transfer-scheduler fair.
+//
+// The small files are sent to small, read by the slots reserved for
+// them, or to general if it is free.  The large files are only sent
+// to general, which takes them before the small files.  Each kind is
+// sent in the order it was read.  Up to Config.MaxBacklog files are
+// queued at once, and small and general are closed when in is closed
+// and emptied.
+func (s *syncCopyMove) scheduleTransfers(in, small, general ObjectPairChan, wg *sync.WaitGroup) {
+	defer wg.Done()
+	defer close(small)
+	defer close(general)
+	var smallQueue, largeQueue []ObjectPair
+	for in != nil || len(smallQueue) > 0 || len(largeQueue) > 0 {
+		var (
+			inCh        = in
+			smallCh     ObjectPairChan
+			generalCh   ObjectPairChan
+			nextSmall   ObjectPair
+			nextGeneral ObjectPair
+		)
+		if Config.MaxBacklog > 0 && len(smallQueue)+len(largeQueue) >= Config.MaxBacklog {
+			inCh = nil
+		}
+		if len(smallQueue) > 0 {
+			smallCh = small
+			nextSmall = smallQueue[0]
+			generalCh = general
+			nextGeneral = smallQueue[0]
+		}
+		if len(largeQueue) > 0 {
+			generalCh = general
+			nextGeneral = largeQueue[0]
+		}
+		select {
+		case pair, ok := <-inCh:
+			if !ok {
+				in = nil
+				continue
+			}
+			if isSmallTransfer(pair) {
+				smallQueue = append(smallQueue, pair)
+			} else {
+				largeQueue = append(largeQueue, pair)
+			}
+		case smallCh <- nextSmall:
+			smallQueue[0] = ObjectPair{}
+			smallQueue = smallQueue[1:]
+		case generalCh <- nextGeneral:
+			if len(largeQueue) > 0 {
+				largeQueue[0] = ObjectPair{}
+				largeQueue = largeQueue[1:]
+			} else {
+				smallQueue[0] = ObjectPair{}
+				smallQueue = smallQueue[1:]
+			}
+		case <-s.abort:
+			// Discard anything sent until in is closed so the
+			// senders don't block
+			if in != nil {
+				for range in {
+				}
+			}
+			return
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package fs
+
+import (
+	"runtime"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransferSchedulerSet(t *testing.T) {
+	var m TransferScheduler
+	require.NoError(t, m.Set("Fair"))
+	assert.Equal(t, TransferSchedulerFair, m)
+	assert.Equal(t, "fair", m.String())
+	require.NoError(t, m.Set("fifo"))
+	assert.Equal(t, TransferSchedulerFIFO, m)
+	assert.Error(t, m.Set("potato"))
+	assert.Equal(t, "TransferScheduler(99)", TransferScheduler(99).String())
+}
+
+func TestSmallTransfers(t *testing.T) {
+	for _, test := range []struct {
+		transfers int
+		fraction  float64
+		want      int
+	}{
+		{1, 0.25, 0},
+		{2, 0.25, 1},
+		{4, 0.25, 1},
+		{8, 0.25, 2},
+		{10, 0.25, 3},
+		{4, 0.01, 1},
+		{4, 0.99, 3},
+	} {
+		got := smallTransfers(test.transfers, test.fraction)
+		assert.Equal(t, test.want, got, "%d %f", test.transfers, test.fraction)
+	}
+}
+
+func TestScheduleTransfers(t *testing.T) {
+	oldSmallFileCutoff := Config.SmallFileCutoff
+	defer func() { Config.SmallFileCutoff = oldSmallFileCutoff }()
+	Config.SmallFileCutoff = 3
+
+	s := &syncCopyMove{
+		abort: make(chan struct{}),
+	}
+	in := make(ObjectPairChan, 10)
+	small := make(ObjectPairChan)
+	general := make(ObjectPairChan)
+	for _, pair := range pairs(3, 1, 5, 2, 4) {
+		in <- pair
+	}
+	close(in)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go s.scheduleTransfers(in, small, general, &wg)
+	// Let the queues fill up before starting to read
+	for len(in) > 0 {
+		runtime.Gosched()
+	}
+
+	// The slots for small files only get small files
+	pair := <-small
+	assert.Equal(t, int64(1), pair.src.Size())
+
+	// The other slots get the large files first
+	var got []ObjectPair
+	for pair := range general {
+		got = append(got, pair)
+	}
+	assert.Equal(t, []int64{3, 5, 4, 2}, sizes(got))
+	_, ok := <-small
+	assert.False(t, ok)
+	wg.Wait()
+}
@@ -0,0 +1,75 @@
+// Stopping syncs gracefully
+
+package fs
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+)
+
+// ErrorStopRequested is returned from sync when it stopped early as
+// RequestStop was called
+var ErrorStopRequested = FatalError(errors.New("stop requested"))
+
+var (
+	// stopRequested is non zero if a stop has been requested
+	stopRequested int32
+	// stopMu protects stopCh
+	stopMu sync.Mutex
+	// stopCh is closed when a stop is requested
+	stopCh = make(chan struct{})
+	// stoppable counts the operations running which stop when
+	// RequestStop is called
+	stoppable int32
+)
+
+// RequestStop asks any syncs in progress to stop starting new
+// transfers.  The transfers in progress are allowed to finish then
+// the sync returns ErrorStopRequested.
+func RequestStop() {
+	stopMu.Lock()
+	defer stopMu.Unlock()
+	if atomic.SwapInt32(&stopRequested, 1) == 0 {
+		close(stopCh)
+	}
+}
+
+// CancelStop cancels a stop requested with RequestStop
+func CancelStop() {
+	stopMu.Lock()
+	defer stopMu.Unlock()
+	if atomic.SwapInt32(&stopRequested, 0) != 0 {
+		stopCh = make(chan struct{})
+	}
+}
+
+// StopRequested returns true if RequestStop has been called
+func StopRequested() bool {
+	return atomic.LoadInt32(&stopRequested) != 0
+}
+
+// StopRequestedChan returns a channel which is closed when
+// RequestStop is called, or already closed if it has been
+func StopRequestedChan() <-chan struct{} {
+	stopMu.Lock()
+	defer stopMu.Unlock()
+	return stopCh
+}
+
+// startStoppable marks an operation which stops when RequestStop is
+// called as running.  It returns a function to call when it has
+// finished.
+func startStoppable() func() {
+	atomic.AddInt32(&stoppable, 1)
+	return func() {
+		atomic.AddInt32(&stoppable, -1)
+	}
+}
+
+// Stoppable returns true if any operations which stop when
+// RequestStop is called, eg syncs, are running
+func Stoppable() bool {
+	return atomic.LoadInt32(&stoppable) > 0
+}
@@ -5,6 +5,7 @@ package fs
 import (
 	"fmt"
 	"sort"
+	"strings"
 	"sync"
 	"time"
 
@@ -13,6 +14,10 @@ import (
 
 var oldSyncMethod = BoolP("old-sync-method", "", false, "Deprecated - use --fast-list instead")
 
+// If --files-from lists no more than this many files then
+// --no-traverse is used automatically
+const noTraverseFilesFromMax = 100
+
 type syncCopyMove struct {
 	// parameters
 	fdst       Fs
@@ -21,39 +26,53 @@ type syncCopyMove struct {
 	DoMove     bool
 	dir        string
 	// internal state
-	noTraverse     bool                // if set don't trafevers the dst
-	deletersWg     sync.WaitGroup      // for delete before go routine
-	deleteFilesCh  chan Object         // channel to receive deletes if delete before
-	trackRenames   bool                // set if we should do server side renames
-	dstFilesMu     sync.Mutex          // protect dstFiles
-	dstFiles       map[string]Object   // dst files, always filled
-	srcFiles       map[string]Object   // src files, only used if deleteBefore
-	srcFilesChan   chan Object         // passes src objects
-	srcFilesResult chan error          // error result of src listing
-	dstFilesResult chan error          // error result of dst listing
-	dstEmptyDirsMu sync.Mutex          // protect dstEmptyDirs
-	dstEmptyDirs   []DirEntry          // potentially empty directories
-	abort          chan struct{}       // signal to abort the copiers
-	checkerWg      sync.WaitGroup      // wait for checkers
-	toBeChecked    ObjectPairChan      // checkers channel
-	transfersWg    sync.WaitGroup      // wait for transfers
-	toBeUploaded   ObjectPairChan      // copiers channel
-	errorMu        sync.Mutex          // Mutex covering the errors variables
-	err            error               // normal error from copy process
-	noRetryErr     error               // error with NoRetry set
-	fatalErr       error               // fatal error
-	commonHash     HashType            // common hash type between src and dst
-	renameMapMu    sync.Mutex          // mutex to protect the below
-	renameMap      map[string][]Object // dst files by hash - only used by trackRenames
-	renamerWg      sync.WaitGroup      // wait for renamers
-	toBeRenamed    ObjectPairChan      // renamers channel
-	trackRenamesWg sync.WaitGroup      // wg for background track renames
-	trackRenamesCh chan Object         // objects are pumped in here
-	renameCheck    []Object            // accumulate files to check for rename here
-	backupDir      Fs                  // place to store overwrites/deletes
-	suffix         string              // suffix to add to files placed in backupDir
-	srcListDir     listDirFn           // function to call to list a directory in the src
-	dstListDir     listDirFn           // function to call to list a directory in the dst
+	noTraverse      bool                 // if set don't trafevers the dst
+	deletersWg      sync.WaitGroup       // for delete before go routine
+	deleteFilesCh   chan Object          // channel to receive deletes if delete before
+	trackRenames    bool                 // set if we should do server side renames
+	dstFilesMu      sync.Mutex           // protect dstFiles
+	dstFiles        map[string]Object    // dst files, always filled
+	srcFiles        map[string]Object    // src files, only used if deleteBefore
+	srcFilesChan    chan Object          // passes src objects
+	srcFilesResult  chan error           // error result of src listing
+	dstFilesResult  chan error           // error result of dst listing
+	dstEmptyDirsMu  sync.Mutex           // protect dstEmptyDirs
+	dstEmptyDirs    []DirEntry           // potentially empty directories
+	createEmptyDirs bool                 // set if we should make the empty src directories in the dst
+	srcEmptyDirsMu  sync.Mutex           // protect srcEmptyDirs
+	srcEmptyDirs    []string             // empty src directories to make in the dst
+	deleteSrcDirs   bool                 // set if we should delete the emptied src directories after a move
+	srcMoveDirsMu   sync.Mutex           // protect srcMoveDirs
+	srcMoveDirs     DirEntries           // src directories to delete if empty after a move
+	setDirModTime   bool                 // set if we should set the modtimes of dst directories
+	srcDirsMu       sync.Mutex           // protect srcDirs and dstDirs
+	srcDirs         DirEntries           // src directories to set the dst modtimes from
+	dstDirs         map[string]Directory // existing dst directories matching srcDirs
+	abort           chan struct{}        // signal to abort the copiers
+	stopOnce        sync.Once            // make sure the stop is only logged once
+	checkerWg       sync.WaitGroup       // wait for checkers
+	toBeChecked     ObjectPairChan       // checkers channel
+	transfersWg     sync.WaitGroup       // wait for transfers
+	toBeUploaded    ObjectPairChan       // copiers channel
+	order           *transferOrder       // how to order the transfers if set
+	toBeOrdered     ObjectPairChan       // ordered copiers channel if order is set
+	errorMu         sync.Mutex           // Mutex covering the errors variables
+	err             error                // normal error from copy process
+	noRetryErr      error                // error with NoRetry set
+	fatalErr        error                // fatal error
+	commonHash      HashType             // common hash type between src and dst
+	renameMapMu     sync.Mutex           // mutex to protect the below
+	renameMap       map[string][]Object  // dst files by hash - only used by trackRenames
+	renamerWg       sync.WaitGroup       // wait for renamers
+	toBeRenamed     ObjectPairChan       // renamers channel
+	trackRenamesWg  sync.WaitGroup       // wg for background track renames
+	trackRenamesCh  ObjectPairChan       // objects are pumped in here
+	renameCheck     []ObjectPair         // accumulate files to check for rename here
+	backupDir       Fs                   // place to store overwrites/deletes
+	compareDirs     []Fs                 // dirs from --compare-dest or --copy-dest
+	srcListDir      listDirFn            // function to call to list a directory in the src
+	dstListDir      listDirFn            // function to call to list a directory in the dst
+	listStops       []func()             // functions to call to stop the listings
 }
 
 func newSyncCopyMove(fdst, fsrc Fs, deleteMode DeleteMode, DoMove bool) (*syncCopyMove, error) {
@@ -74,12 +93,25 @@ func newSyncCopyMove(fdst, fsrc Fs, deleteMode DeleteMode, DoMove bool) (*syncCo
 		trackRenames:   Config.TrackRenames,
 		commonHash:     fsrc.Hashes().Overlap(fdst.Hashes()).GetOne(),
 		toBeRenamed:    make(ObjectPairChan, Config.Transfers),
-		trackRenamesCh: make(chan Object, Config.Checkers),
+		trackRenamesCh: make(ObjectPairChan, Config.Checkers),
+		dstDirs:        make(map[string]Directory),
+	}
+	order, err := newTransferOrder(Config.OrderBy)
+	if err != nil {
+		return nil, FatalError(err)
+	}
+	if order != nil {
+		s.order = order
+		s.toBeOrdered = make(ObjectPairChan)
 	}
 	if s.noTraverse && s.deleteMode != DeleteModeOff {
 		Errorf(nil, "Ignoring --no-traverse with sync")
 		s.noTraverse = false
 	}
+	if s.trackRenames && Config.Immutable {
+		Errorf(fdst, "Ignoring --track-renames as renames modify files in the destination with --immutable")
+		s.trackRenames = false
+	}
 	if s.trackRenames {
 		// Don't track renames for remotes without server-side move support.
 		if !CanServerSideMove(fdst) {
@@ -101,6 +133,21 @@ func newSyncCopyMove(fdst, fsrc Fs, deleteMode DeleteMode, DoMove bool) (*syncCo
 			s.noTraverse = false
 		}
 	}
+	s.createEmptyDirs = Config.CreateEmptySrcDirs && s.deleteMode != DeleteModeOnly
+	s.deleteSrcDirs = Config.DeleteEmptySrcDirs && s.DoMove
+	// Only set the directory modtimes if both ends support them
+	// as that means the src listing has them too
+	if !Config.NoUpdateDirModTime && s.deleteMode != DeleteModeOnly {
+		s.setDirModTime = fdst.Features().DirSetModTime != nil && fsrc.Features().DirSetModTime != nil
+	}
+	// Look up a short --files-from list on the destination
+	// rather than listing it, as the destination may be huge
+	if !s.noTraverse && !s.trackRenames && s.deleteMode == DeleteModeOff {
+		if files := Config.Filter.Files(); files != nil && len(files) <= noTraverseFilesFromMax {
+			Debugf(fdst, "Using --no-traverse as --files-from has only %d files", len(files))
+			s.noTraverse = true
+		}
+	}
 	// Make Fs for --backup-dir if required
 	if Config.BackupDir != "" {
 		var err error
@@ -109,7 +156,7 @@ func newSyncCopyMove(fdst, fsrc Fs, deleteMode DeleteMode, DoMove bool) (*syncCo
 			return nil, FatalError(errors.Errorf("Failed to make fs for --backup-dir %q: %v", Config.BackupDir, err))
 		}
 		if !CanServerSideMove(s.backupDir) {
-			return nil, FatalError(errors.New("can't use --backup-dir on a remote which doesn't support server side move or copy"))
+			Logf(s.backupDir, "The remote can't move or copy files on the server so files will be downloaded and uploaded again to move them into --backup-dir")
 		}
 		if !SameConfig(fdst, s.backupDir) {
 			return nil, FatalError(errors.New("parameter to --backup-dir has to be on the same remote as destination"))
@@ -120,44 +167,91 @@ func newSyncCopyMove(fdst, fsrc Fs, deleteMode DeleteMode, DoMove bool) (*syncCo
 		if Overlapping(fsrc, s.backupDir) {
 			return nil, FatalError(errors.New("source and parameter to --backup-dir mustn't overlap"))
 		}
-		s.suffix = Config.Suffix
+	} else if Config.Suffix != "" {
+		// Rename the files alongside themselves with --suffix
+		s.backupDir = fdst
+		if !CanServerSideMove(fdst) {
+			Logf(fdst, "The remote can't move or copy files on the server so files will be downloaded and uploaded again to add --suffix")
+		}
+	}
+	// Make Fs for --compare-dest or --copy-dest if required
+	compareCopyDirs := Config.CompareDest
+	if len(Config.CopyDest) > 0 {
+		compareCopyDirs = Config.CopyDest
+		if fdst.Features().Copy == nil {
+			return nil, FatalError(errors.New("can't use --copy-dest as the destination doesn't support server side copy"))
+		}
+	}
+	if len(compareCopyDirs) > 0 && DoMove {
+		Errorf(fdst, "Ignoring --compare-dest and --copy-dest with move")
+		compareCopyDirs = nil
+	}
+	for _, dir := range compareCopyDirs {
+		f, err := NewFs(dir)
+		if err != nil {
+			return nil, FatalError(errors.Errorf("Failed to make fs for --compare-dest or --copy-dest %q: %v", dir, err))
+		}
+		if len(Config.CopyDest) > 0 && !SameConfig(fdst, f) {
+			return nil, FatalError(errors.New("parameter to --copy-dest has to be on the same remote as destination"))
+		}
+		if Overlapping(fdst, f) {
+			return nil, FatalError(errors.New("destination and parameter to --compare-dest or --copy-dest mustn't overlap"))
+		}
+		s.compareDirs = append(s.compareDirs, f)
 	}
 	s.srcListDir = s.makeListDir(fsrc, false)
 	s.dstListDir = s.makeListDir(fdst, Config.Filter.DeleteExcluded)
+	if Config.BackupDir == "" && Config.Suffix != "" {
+		s.dstListDir = excludeSuffixed(s.dstListDir)
+	}
 	return s, nil
 }
 
+// excludeSuffixed wraps listDir so objects with --suffix are left
+// out, so old versions renamed in place aren't synced themselves
+func excludeSuffixed(listDir listDirFn) listDirFn {
+	return func(dir string) (entries DirEntries, err error) {
+		entries, err = listDir(dir)
+		if err != nil {
+			return nil, err
+		}
+		newEntries := entries[:0] // in place filter
+		for _, entry := range entries {
+			if _, ok := entry.(Object); ok && isSuffixed(entry.Remote()) {
+				Debugf(entry, "Excluded from sync (and deletion) as it has --suffix")
+				continue
+			}
+			newEntries = append(newEntries, entry)
+		}
+		return newEntries, nil
+	}
+}
+
 // list a directory into entries, err
 type listDirFn func(dir string) (entries DirEntries, err error)
 
+// errorDirExcluded is returned by a listDirFn if the directory was
+// excluded with --exclude-if-present
+var errorDirExcluded = errors.New("directory excluded with --exclude-if-present")
+
 // makeListDir makes a listing function for the given fs and includeAll flags
+//
+// If --fast-list is in use then the recursive listing is read in the
+// background and handed out a directory at a time.  It is stopped
+// when the sync finishes.
 func (s *syncCopyMove) makeListDir(f Fs, includeAll bool) listDirFn {
-	if !Config.UseListR || f.Features().ListR == nil {
-		return func(dir string) (entries DirEntries, err error) {
-			return ListDirSorted(f, includeAll, dir)
+	listDirSortedFn := listDirSorted
+	if shouldUseListR(f, includeAll, Config.MaxDepth) {
+		stream := newListRStream(f, s.dir, includeAll, Config.MaxDepth, f.Features().ListR)
+		s.listStops = append(s.listStops, stream.stop)
+		listDirSortedFn = func(f Fs, includeAll bool, dir string) (DirEntries, bool, error) {
+			return stream.listDir(dir)
 		}
 	}
-	var (
-		mu      sync.Mutex
-		started bool
-		dirs    DirTree
-		dirsErr error
-	)
 	return func(dir string) (entries DirEntries, err error) {
-		mu.Lock()
-		defer mu.Unlock()
-		if !started {
-			dirs, dirsErr = NewDirTree(f, s.dir, includeAll, Config.MaxDepth)
-			started = true
-		}
-		if dirsErr != nil {
-			return nil, dirsErr
-		}
-		entries, ok := dirs[dir]
-		if !ok {
-			err = ErrorDirNotFound
-		} else {
-			delete(dirs, dir)
+		entries, excluded, err := listDirSortedFn(f, includeAll, dir)
+		if excluded {
+			return nil, errorDirExcluded
 		}
 		return entries, err
 	}
@@ -173,6 +267,20 @@ func (s *syncCopyMove) aborting() bool {
 	return false
 }
 
+// Check to see if a stop has been requested with RequestStop.  If so
+// the sync is aborted with ErrorStopRequested so no new transfers or
+// deletions are started - the ones in progress are left to finish.
+func (s *syncCopyMove) stopping() bool {
+	if !StopRequested() {
+		return false
+	}
+	s.stopOnce.Do(func() {
+		Errorf(s.fdst, "%v", ErrorStopRequested)
+		s.processError(ErrorStopRequested)
+	})
+	return true
+}
+
 // This reads the map and pumps it into the channel passed in, closing
 // the channel at the end
 func (s *syncCopyMove) pumpMapToChan(files map[string]Object, out chan<- Object) {
@@ -238,8 +346,10 @@ func NeedTransfer(dst, src Object) bool {
 			Debugf(src, "Destination mod time is within %v of source but sizes differ, transferring", modifyWindow)
 		}
 	} else {
-		// Check to see if changed or not
-		if Equal(src, dst) {
+		// Check to see if changed or not - with --immutable a
+		// different mtime counts as a change as the dst can't be
+		// updated
+		if equal(src, dst, Config.SizeOnly, Config.CheckSum, Config.Immutable, true) {
 			Debugf(src, "Unchanged skipping")
 			return false
 		}
@@ -247,6 +357,34 @@ func NeedTransfer(dst, src Object) bool {
 	return true
 }
 
+// immutableModified reports that dst exists but differs from the
+// source so would be overwritten if it wasn't for --immutable
+//
+// With --dry-run it just logs and returns nil.
+func immutableModified(dst Object) error {
+	if Config.DryRun {
+		Logf(dst, "Would fail as source and destination differ and --immutable is set (not failing as --dry-run)")
+		return nil
+	}
+	Stats.Error()
+	Errorf(dst, "Source and destination exist but do not match: %v", ErrorImmutableModified)
+	return NoRetryError(ErrorImmutableModified)
+}
+
+// immutableDeleted reports that dst would be deleted if it wasn't
+// for --immutable
+//
+// With --dry-run it just logs and returns nil.
+func immutableDeleted(dst Object) error {
+	if Config.DryRun {
+		Logf(dst, "Would fail as not in the source and --immutable is set (not failing as --dry-run)")
+		return nil
+	}
+	Stats.Error()
+	Errorf(dst, "Not deleting as --immutable is set: %v", ErrorImmutableModified)
+	return NoRetryError(ErrorImmutableModified)
+}
+
 // This checks the types of errors returned while copying files
 func (s *syncCopyMove) processError(err error) {
 	if err == nil {
@@ -289,7 +427,7 @@ func (s *syncCopyMove) currentError() error {
 func (s *syncCopyMove) pairChecker(in ObjectPairChan, out ObjectPairChan, wg *sync.WaitGroup) {
 	defer wg.Done()
 	for {
-		if s.aborting() {
+		if s.aborting() || s.stopping() {
 			return
 		}
 		select {
@@ -299,22 +437,42 @@ func (s *syncCopyMove) pairChecker(in ObjectPairChan, out ObjectPairChan, wg *sy
 			}
 			src := pair.src
 			Stats.Checking(src.Remote())
+			// Find the destination object if it wasn't listed
+			if s.noTraverse && pair.dst == nil {
+				dst, err := s.fdst.NewObject(pair.dstRemote())
+				if err == nil {
+					pair.dst = dst
+				} else if err != ErrorObjectNotFound {
+					s.processError(errors.Wrapf(err, "error reading destination object %q", src.Remote()))
+					Stats.DoneChecking(src.Remote())
+					continue
+				}
+			}
 			// Check to see if can store this
 			if src.Storable() {
 				if NeedTransfer(pair.dst, pair.src) {
 					// If destination already exists, then we must move it into --backup-dir if required
-					if pair.dst != nil && s.backupDir != nil {
-						remoteWithSuffix := pair.dst.Remote() + s.suffix
+					if pair.dst == nil && s.compareOrCopyDest(src, pair.dstRemote()) {
+						// Found in --compare-dest or --copy-dest so no need to transfer
+					} else if pair.dst != nil && Config.Immutable {
+						s.processError(immutableModified(pair.dst))
+					} else if pair.dst != nil && s.backupDir != nil {
+						remoteWithSuffix := suffixName(pair.dst.Remote())
 						overwritten, _ := s.backupDir.NewObject(remoteWithSuffix)
 						err := Move(s.backupDir, overwritten, remoteWithSuffix, pair.dst)
 						if err != nil {
 							s.processError(err)
 						} else {
+							if !Config.DryRun {
+								Stats.Backup()
+							}
 							// If successful zero out the dst as it is no longer there and copy the file
 							pair.dst = nil
+							Stats.QueueTransfer(src.Size())
 							out <- pair
 						}
 					} else {
+						Stats.QueueTransfer(src.Size())
 						out <- pair
 					}
 				} else {
@@ -332,6 +490,45 @@ func (s *syncCopyMove) pairChecker(in ObjectPairChan, out ObjectPairChan, wg *sy
 	}
 }
 
+// compareOrCopyDest looks for src in the --compare-dest or --copy-dest
+// directories in order.  If an identical file is found there it
+// returns true as src doesn't need transferring, having server side
+// copied it into the destination as remote first with --copy-dest.
+func (s *syncCopyMove) compareOrCopyDest(src Object, remote string) bool {
+	for _, f := range s.compareDirs {
+		compareDst, err := f.NewObject(src.Remote())
+		if err != nil {
+			if err != ErrorObjectNotFound {
+				Debugf(src, "Failed to find in %v: %v", f, err)
+			}
+			continue
+		}
+		// Only compare as the --compare-dest and --copy-dest
+		// files mustn't be changed, even their mtimes
+		if !equal(src, compareDst, Config.SizeOnly, Config.CheckSum, false, false) {
+			continue
+		}
+		if len(Config.CopyDest) == 0 {
+			Debugf(src, "Found unchanged in --compare-dest %v, skipping", f)
+			return true
+		}
+		newDst, err := copyObject(s.fdst, nil, remote, compareDst)
+		if err != nil {
+			// Transfer it from the source instead
+			Debugf(src, "Failed to copy from --copy-dest %v: %v", f, err)
+			return false
+		}
+		// Set the mtime of the copy rather than the original
+		if newDst != nil && !Equal(src, newDst) {
+			Debugf(src, "Copy from --copy-dest %v differs, transferring from source", f)
+			return false
+		}
+		Debugf(src, "Found unchanged in --copy-dest %v, copied on the server", f)
+		return true
+	}
+	return false
+}
+
 // pairRenamer reads Objects~s on in and attempts to rename them,
 // otherwise it sends them out if they need transferring.
 func (s *syncCopyMove) pairRenamer(in ObjectPairChan, out ObjectPairChan, wg *sync.WaitGroup) {
@@ -346,8 +543,9 @@ func (s *syncCopyMove) pairRenamer(in ObjectPairChan, out ObjectPairChan, wg *sy
 				return
 			}
 			src := pair.src
-			if !s.tryRename(src) {
+			if !s.tryRename(pair) {
 				// pass on if not renamed
+				Stats.QueueTransfer(src.Size())
 				out <- pair
 			}
 		case <-s.abort:
@@ -369,12 +567,26 @@ func (s *syncCopyMove) pairCopyOrMove(in ObjectPairChan, fdst Fs, wg *sync.WaitG
 			if !ok {
 				return
 			}
+			// Don't start any new transfers once over --max-transfer
+			if Stats.MaxTransferReached() {
+				Errorf(s.fdst, "%v", ErrorMaxTransferLimitReached)
+				s.processError(ErrorMaxTransferLimitReached)
+				return
+			}
+			// Don't start any new transfers once asked to stop
+			if s.stopping() {
+				return
+			}
 			src := pair.src
+			Stats.DequeueTransfer(src.Size())
 			Stats.Transferring(src.Remote())
+			// Keep the name of an existing dst or dst directory
+			// which may only match case insensitively
+			remote := pair.dstRemote()
 			if s.DoMove {
-				err = Move(fdst, pair.dst, src.Remote(), src)
+				err = Move(fdst, pair.dst, remote, src)
 			} else {
-				err = Copy(fdst, pair.dst, src.Remote(), src)
+				err = Copy(fdst, pair.dst, remote, src)
 			}
 			s.processError(err)
 			Stats.DoneTransferring(src.Remote(), err == nil)
@@ -399,11 +611,79 @@ func (s *syncCopyMove) stopCheckers() {
 	s.checkerWg.Wait()
 }
 
+// orderTransfers reads ObjectPairs on in and sends them to out in the
+// order set by --order-by, closing out when in is closed and emptied.
+//
+// Nothing is sent until in is closed, that is the checking has
+// finished, or Config.MaxBacklog are waiting, so the order applies to
+// all the transfers or to the Config.MaxBacklog best of them.
+func (s *syncCopyMove) orderTransfers(in ObjectPairChan, out ObjectPairChan, wg *sync.WaitGroup) {
+	defer wg.Done()
+	defer close(out)
+	queue := newTransferQueue(s.order)
+	for in != nil || queue.Len() > 0 {
+		var (
+			inCh  = in
+			outCh ObjectPairChan
+			next  ObjectPair
+		)
+		full := Config.MaxBacklog > 0 && queue.Len() >= Config.MaxBacklog
+		if full {
+			inCh = nil
+		}
+		if queue.Len() > 0 && (in == nil || full) {
+			outCh = out
+			next = queue.Peek()
+		}
+		select {
+		case pair, ok := <-inCh:
+			if !ok {
+				in = nil
+				continue
+			}
+			queue.Push(pair)
+		case outCh <- next:
+			queue.Pop()
+		case <-s.abort:
+			// Discard anything sent until in is closed so the
+			// senders don't block
+			if in != nil {
+				for range in {
+				}
+			}
+			return
+		}
+	}
+}
+
 // This starts the background transfers
 func (s *syncCopyMove) startTransfers() {
+	in := s.toBeUploaded
+	if s.order != nil {
+		s.transfersWg.Add(1)
+		go s.orderTransfers(s.toBeUploaded, s.toBeOrdered, &s.transfersWg)
+		in = s.toBeOrdered
+	}
+	if Config.TransferScheduler == TransferSchedulerFair {
+		if nSmall := smallTransfers(Config.Transfers, Config.SmallFileTransfers); nSmall > 0 {
+			Debugf(s.fdst, "Reserving %d of %d transfers for files smaller than %v", nSmall, Config.Transfers, Config.SmallFileCutoff)
+			small := make(ObjectPairChan)
+			general := make(ObjectPairChan)
+			s.transfersWg.Add(1 + Config.Transfers)
+			go s.scheduleTransfers(in, small, general, &s.transfersWg)
+			for i := 0; i < Config.Transfers; i++ {
+				if i < nSmall {
+					go s.pairCopyOrMove(small, s.fdst, &s.transfersWg)
+				} else {
+					go s.pairCopyOrMove(general, s.fdst, &s.transfersWg)
+				}
+			}
+			return
+		}
+	}
 	s.transfersWg.Add(Config.Transfers)
 	for i := 0; i < Config.Transfers; i++ {
-		go s.pairCopyOrMove(s.toBeUploaded, s.fdst, &s.transfersWg)
+		go s.pairCopyOrMove(in, s.fdst, &s.transfersWg)
 	}
 }
 
@@ -443,8 +723,8 @@ func (s *syncCopyMove) startTrackRenames() {
 	s.trackRenamesWg.Add(1)
 	go func() {
 		defer s.trackRenamesWg.Done()
-		for o := range s.trackRenamesCh {
-			s.renameCheck = append(s.renameCheck, o)
+		for pair := range s.trackRenamesCh {
+			s.renameCheck = append(s.renameCheck, pair)
 		}
 	}()
 }
@@ -466,7 +746,7 @@ func (s *syncCopyMove) startDeleters() {
 	s.deletersWg.Add(1)
 	go func() {
 		defer s.deletersWg.Done()
-		err := deleteFilesWithBackupDir(s.deleteFilesCh, s.backupDir)
+		_, _, err := deleteFilesWithBackupDir(s.deleteFilesCh, s.backupDir)
 		s.processError(err)
 	}()
 }
@@ -501,18 +781,21 @@ func (s *syncCopyMove) deleteFiles(checkSrcMap bool) error {
 					continue
 				}
 			}
-			if s.aborting() {
+			if s.aborting() || s.stopping() {
 				break
 			}
 			toDelete <- o
 		}
 		close(toDelete)
 	}()
-	return deleteFilesWithBackupDir(toDelete, s.backupDir)
+	_, _, err := deleteFilesWithBackupDir(toDelete, s.backupDir)
+	return err
 }
 
-// This deletes the empty directories in the slice passed in.  It
-// ignores any errors deleting directories
+// This deletes the empty directories in the slice passed in.  Any
+// errors deleting directories are logged with a count of them but
+// otherwise ignored.  Directories which aren't empty, eg because they
+// contain excluded files, are expected so only logged at debug.
 func deleteEmptyDirectories(f Fs, entries DirEntries) error {
 	if len(entries) == 0 {
 		return nil
@@ -532,8 +815,10 @@ func deleteEmptyDirectories(f Fs, entries DirEntries) error {
 		if ok {
 			// TryRmdir only deletes empty directories
 			err := TryRmdir(f, dir.Remote())
-			if err != nil {
-				Debugf(logDirName(f, dir.Remote()), "Failed to Rmdir: %v", err)
+			if errors.Cause(err) == ErrorDirectoryNotEmpty {
+				Debugf(logDirName(f, dir.Remote()), "Not deleting as not empty")
+			} else if err != nil {
+				Logf(logDirName(f, dir.Remote()), "Failed to Rmdir: %v", err)
 				errorCount++
 			} else {
 				okCount++
@@ -543,7 +828,7 @@ func deleteEmptyDirectories(f Fs, entries DirEntries) error {
 		}
 	}
 	if errorCount > 0 {
-		Debugf(f, "failed to delete %d directories", errorCount)
+		Logf(f, "failed to delete %d directories", errorCount)
 	}
 	if okCount > 0 {
 		Debugf(f, "deleted %d directories", okCount)
@@ -551,6 +836,99 @@ func deleteEmptyDirectories(f Fs, entries DirEntries) error {
 	return nil
 }
 
+// addEmptyDir records dir as an empty source directory to make in
+// the destination, unless it is only empty because the filters
+// excluded everything in it
+//
+// dstDir is where dir goes in the dst, which only differs in case
+// with --ignore-case-sync.
+func (s *syncCopyMove) addEmptyDir(dir, dstDir string) {
+	if !Config.Filter.InActive() {
+		entries, err := s.fsrc.List(dir)
+		if err != nil {
+			s.processError(errors.Wrapf(err, "error reading source directory %q", dir))
+			return
+		}
+		if len(entries) != 0 {
+			Debugf(logDirName(s.fsrc, dir), "Not making directory as it is only empty because of the filters")
+			return
+		}
+	}
+	s.srcEmptyDirsMu.Lock()
+	s.srcEmptyDirs = append(s.srcEmptyDirs, dstDir)
+	s.srcEmptyDirsMu.Unlock()
+}
+
+// makeEmptyDirs makes the empty source directories in the destination
+func (s *syncCopyMove) makeEmptyDirs() error {
+	var err error
+	sort.Strings(s.srcEmptyDirs)
+	for _, dir := range s.srcEmptyDirs {
+		if s.aborting() || s.stopping() {
+			break
+		}
+		mkdirErr := Mkdir(s.fdst, dir)
+		if mkdirErr != nil {
+			Errorf(logDirName(s.fdst, dir), "Failed to make directory: %v", mkdirErr)
+			err = mkdirErr
+		}
+	}
+	if len(s.srcEmptyDirs) > 0 {
+		Debugf(s.fdst, "made %d empty directories", len(s.srcEmptyDirs))
+	}
+	return err
+}
+
+// addDir records the src directory, and the matching dst directory if
+// known, so the modification time of the dst can be set once its
+// contents have been transferred, and so the src can be deleted after
+// a move if it is empty
+//
+// dstRemote is where src goes in the dst, which only differs from
+// src.Remote() in case with --ignore-case-sync.
+func (s *syncCopyMove) addDir(src Directory, dst Directory, dstRemote string) {
+	if s.deleteSrcDirs {
+		s.srcMoveDirsMu.Lock()
+		s.srcMoveDirs = append(s.srcMoveDirs, src)
+		s.srcMoveDirsMu.Unlock()
+	}
+	if !s.setDirModTime {
+		return
+	}
+	if dstRemote != src.Remote() {
+		src = NewDirCopy(src).SetRemote(dstRemote).SetModTime(DirModTime(src))
+	}
+	s.srcDirsMu.Lock()
+	s.srcDirs = append(s.srcDirs, src)
+	if dst != nil {
+		s.dstDirs[dstRemote] = dst
+	}
+	s.srcDirsMu.Unlock()
+}
+
+// setDirModTimes sets the modification times of the directories in
+// the destination to those of the source starting from the longest
+// path so setting them doesn't disturb their parents
+func (s *syncCopyMove) setDirModTimes() error {
+	var err error
+	sort.Sort(s.srcDirs)
+	for i := len(s.srcDirs) - 1; i >= 0; i-- {
+		if s.aborting() || s.stopping() {
+			break
+		}
+		src := s.srcDirs[i]
+		dir := src.Remote()
+		setErr := SetDirModTime(s.fdst, s.dstDirs[dir], dir, DirModTime(src))
+		if setErr == ErrorDirNotFound {
+			Debugf(logDirName(s.fdst, dir), "Not setting modification time of directory as it doesn't exist")
+		} else if setErr != nil {
+			Errorf(logDirName(s.fdst, dir), "Failed to set directory modification time: %v", setErr)
+			err = setErr
+		}
+	}
+	return err
+}
+
 // renameHash makes a string with the size and the hash for rename detection
 //
 // it may return an empty string in which case no hash could be made
@@ -598,8 +976,8 @@ func (s *syncCopyMove) makeRenameMap() {
 
 	// first make a map of possible sizes we need to check
 	possibleSizes := map[int64]struct{}{}
-	for _, obj := range s.renameCheck {
-		possibleSizes[obj.Size()] = struct{}{}
+	for _, pair := range s.renameCheck {
+		possibleSizes[pair.src.Size()] = struct{}{}
 	}
 
 	// pump all the dstFiles into in
@@ -630,9 +1008,11 @@ func (s *syncCopyMove) makeRenameMap() {
 	Infof(s.fdst, "Finished making map for --track-renames")
 }
 
-// tryRename renames a src object when doing track renames if
-// possible, it returns true if the object was renamed.
-func (s *syncCopyMove) tryRename(src Object) bool {
+// tryRename renames a dst object to the name of the src object of
+// pair when doing track renames if possible, it returns true if the
+// object was renamed.
+func (s *syncCopyMove) tryRename(pair ObjectPair) bool {
+	src := pair.src
 	Stats.Checking(src.Remote())
 	defer Stats.DoneChecking(src.Remote())
 
@@ -649,10 +1029,11 @@ func (s *syncCopyMove) tryRename(src Object) bool {
 	}
 
 	// Find dst object we are about to overwrite if it exists
-	dstOverwritten, _ := s.fdst.NewObject(src.Remote())
+	remote := pair.dstRemote()
+	dstOverwritten, _ := s.fdst.NewObject(remote)
 
-	// Rename dst to have name src.Remote()
-	err := Move(s.fdst, dstOverwritten, src.Remote(), dst)
+	// Rename dst to have name remote
+	err := Move(s.fdst, dstOverwritten, remote, dst)
 	if err != nil {
 		Debugf(src, "Failed to rename to %q: %v", dst.Remote(), err)
 		return false
@@ -663,17 +1044,38 @@ func (s *syncCopyMove) tryRename(src Object) bool {
 	delete(s.dstFiles, dst.Remote())
 	s.dstFilesMu.Unlock()
 
+	if !Config.DryRun {
+		Stats.Rename()
+	}
 	Infof(src, "Renamed from %q", dst.Remote())
 	return true
 }
 
 // listDirJob describe a directory listing that needs to be done
 type listDirJob struct {
-	remote   string
-	srcDepth int
-	dstDepth int
-	noSrc    bool
-	noDst    bool
+	remote    string
+	dstRemote string // remote of the dst if its case differs with --ignore-case-sync
+	srcDepth  int
+	dstDepth  int
+	noSrc     bool
+	noDst     bool
+}
+
+// dstDir returns the directory to list in the dst
+func (job *listDirJob) dstDir() string {
+	if job.dstRemote != "" {
+		return job.dstRemote
+	}
+	return job.remote
+}
+
+// dstPath returns where remote, an entry in the src directory of the
+// job, goes in the dst
+func (job *listDirJob) dstPath(remote string) string {
+	if job.dstRemote == "" {
+		return remote
+	}
+	return job.dstRemote + strings.TrimPrefix(remote, job.remote)
 }
 
 // Syncs fsrc into fdst
@@ -699,6 +1101,7 @@ func (s *syncCopyMove) run() error {
 	}
 
 	// Start background checking and transferring pipeline
+	Stats.SetListed(false)
 	s.startCheckers()
 	s.startRenamers()
 	s.startTransfers()
@@ -752,20 +1155,25 @@ func (s *syncCopyMove) run() error {
 	traversing.Wait()
 	close(in)
 	wg.Wait()
+	for _, stop := range s.listStops {
+		stop()
+	}
 
 	s.stopTrackRenames()
 	if s.trackRenames {
 		// Build the map of the remaining dstFiles by hash
 		s.makeRenameMap()
 		// Attempt renames for all the files which don't have a matching dst
-		for _, src := range s.renameCheck {
-			s.toBeRenamed <- ObjectPair{src, nil}
+		for _, pair := range s.renameCheck {
+			s.toBeRenamed <- pair
 		}
 	}
 
 	// Stop background checking and transferring pipeline
 	s.stopCheckers()
 	s.stopRenamers()
+	// Everything to be transferred has been queued now
+	Stats.SetListed(true)
 	s.stopTransfers()
 	s.stopDeleters()
 
@@ -786,6 +1194,25 @@ func (s *syncCopyMove) run() error {
 			s.processError(deleteEmptyDirectories(s.fdst, s.dstEmptyDirs))
 		}
 	}
+
+	// Make the empty directories
+	if s.createEmptyDirs {
+		s.processError(s.makeEmptyDirs())
+	}
+
+	// Set the directory modtimes now their contents are finished
+	if s.setDirModTime {
+		s.processError(s.setDirModTimes())
+	}
+
+	// Delete the src directories the move has emptied
+	if s.deleteSrcDirs {
+		if s.currentError() != nil {
+			Errorf(s.fsrc, "%v", ErrorNotDeletingDirs)
+		} else {
+			s.processError(deleteEmptyDirectories(s.fsrc, s.srcMoveDirs))
+		}
+	}
 	return s.currentError()
 }
 
@@ -796,6 +1223,10 @@ func (s *syncCopyMove) dstOnly(dst DirEntry, job listDirJob, jobs *[]listDirJob)
 	}
 	switch x := dst.(type) {
 	case Object:
+		if Config.Immutable {
+			s.processError(immutableDeleted(x))
+			return
+		}
 		switch s.deleteMode {
 		case DeleteModeAfter:
 			// record object as needs deleting
@@ -817,7 +1248,7 @@ func (s *syncCopyMove) dstOnly(dst DirEntry, job listDirJob, jobs *[]listDirJob)
 			})
 		}
 		// Record directory as it is potentially empty and needs deleting
-		if s.fdst.Features().CanHaveEmptyDirectories {
+		if s.fdst.Features().CanHaveEmptyDirectories || s.createEmptyDirs {
 			s.dstEmptyDirsMu.Lock()
 			s.dstEmptyDirs = append(s.dstEmptyDirs, dst)
 			s.dstEmptyDirsMu.Unlock()
@@ -833,23 +1264,39 @@ func (s *syncCopyMove) srcOnly(src DirEntry, job listDirJob, jobs *[]listDirJob)
 	if s.deleteMode == DeleteModeOnly {
 		return
 	}
+	dstRemote := job.dstPath(src.Remote())
 	switch x := src.(type) {
 	case Object:
+		pair := ObjectPair{src: x}
+		if dstRemote != x.Remote() {
+			// Put it in the dst directory with the case found there
+			pair.remote = dstRemote
+		}
 		if s.trackRenames {
 			// Save object to check for a rename later
-			s.trackRenamesCh <- x
+			s.trackRenamesCh <- pair
+		} else if s.noTraverse || len(s.compareDirs) > 0 {
+			// Check to see if it is on the destination with
+			// --no-traverse or in --compare-dest or --copy-dest
+			s.toBeChecked <- pair
 		} else {
 			// No need to check since doesn't exist
-			s.toBeUploaded <- ObjectPair{x, nil}
+			Stats.QueueTransfer(x.Size())
+			s.toBeUploaded <- pair
 		}
 	case Directory:
+		s.addDir(x, nil, dstRemote)
 		// Do the same thing to the entire contents of the directory
 		if job.srcDepth > 0 {
-			*jobs = append(*jobs, listDirJob{
+			newJob := listDirJob{
 				remote:   src.Remote(),
 				srcDepth: job.srcDepth - 1,
 				noDst:    true,
-			})
+			}
+			if dstRemote != src.Remote() {
+				newJob.dstRemote = dstRemote
+			}
+			*jobs = append(*jobs, newJob)
 		}
 	default:
 		panic("Bad object in DirEntries")
@@ -865,7 +1312,7 @@ func (s *syncCopyMove) transfer(dst, src DirEntry, job listDirJob, jobs *[]listD
 		}
 		dstX, ok := dst.(Object)
 		if ok {
-			s.toBeChecked <- ObjectPair{srcX, dstX}
+			s.toBeChecked <- ObjectPair{src: srcX, dst: dstX}
 		} else {
 			// FIXME src is file, dst is directory
 			err := errors.New("can't overwrite directory with file")
@@ -874,14 +1321,19 @@ func (s *syncCopyMove) transfer(dst, src DirEntry, job listDirJob, jobs *[]listD
 		}
 	case Directory:
 		// Do the same thing to the entire contents of the directory
-		_, ok := dst.(Directory)
+		dstX, ok := dst.(Directory)
 		if ok {
+			s.addDir(srcX, dstX, dst.Remote())
 			if job.srcDepth > 0 && job.dstDepth > 0 {
-				*jobs = append(*jobs, listDirJob{
+				newJob := listDirJob{
 					remote:   src.Remote(),
 					srcDepth: job.srcDepth - 1,
 					dstDepth: job.dstDepth - 1,
-				})
+				}
+				if dst.Remote() != src.Remote() {
+					newJob.dstRemote = dst.Remote()
+				}
+				*jobs = append(*jobs, newJob)
 			}
 		} else {
 			// FIXME src is dir, dst is file
@@ -965,6 +1417,62 @@ func matchListings(srcList, dstList DirEntries) (srcOnly DirEntries, dstOnly Dir
 	return
 }
 
+// matchListingsIgnoreCase is like matchListings but matches the
+// entries case insensitively for --ignore-case-sync.
+//
+// Source entries whose names only differ by case collide - the first
+// is used and the error is returned.  Destination entries which only
+// differ by case from the matched one are ignored rather than
+// returned in dstOnly so they are never deleted.
+func matchListingsIgnoreCase(srcList, dstList DirEntries) (srcOnly DirEntries, dstOnly DirEntries, matches []matchPair, err error) {
+	// Group the dst entries by their lower case names
+	dstByName := make(map[string]DirEntries, len(dstList))
+	for _, dst := range dstList {
+		name := strings.ToLower(dst.Remote())
+		dstByName[name] = append(dstByName[name], dst)
+	}
+	srcByName := make(map[string]DirEntry, len(srcList))
+	matched := make(map[string]DirEntry, len(srcList))
+	for _, src := range srcList {
+		name := strings.ToLower(src.Remote())
+		if prev, found := srcByName[name]; found {
+			if prev.Remote() == src.Remote() {
+				Logf(src, "Duplicate %s found in source - ignoring", DirEntryType(src))
+			} else {
+				err = errors.Errorf("can't sync %q as its name only differs by case from %q", src.Remote(), prev.Remote())
+				Errorf(src, "%v", err)
+			}
+			continue
+		}
+		srcByName[name] = src
+		dsts := dstByName[name]
+		if len(dsts) == 0 {
+			srcOnly = append(srcOnly, src)
+			continue
+		}
+		// Prefer the dst with the same case
+		dst := dsts[0]
+		for _, x := range dsts {
+			if x.Remote() == src.Remote() {
+				dst = x
+				break
+			}
+		}
+		matched[name] = dst
+		matches = append(matches, matchPair{src: src, dst: dst})
+	}
+	for _, dst := range dstList {
+		match, found := matched[strings.ToLower(dst.Remote())]
+		switch {
+		case !found:
+			dstOnly = append(dstOnly, dst)
+		case match != dst:
+			Logf(dst, "Not deleting %s as its name only differs by case from %q", DirEntryType(dst), match.Remote())
+		}
+	}
+	return srcOnly, dstOnly, matches, err
+}
+
 // processJob processes a listDirJob listing the source and
 // destination directories, comparing them and returning a slice of
 // more jobs
@@ -985,16 +1493,26 @@ func (s *syncCopyMove) processJob(job listDirJob) (jobs []listDirJob) {
 			srcList, srcListErr = s.srcListDir(job.remote)
 		}()
 	}
-	if !job.noDst {
+	if !job.noDst && !s.noTraverse {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			dstList, dstListErr = s.dstListDir(job.remote)
+			dstList, dstListErr = s.dstListDir(job.dstDir())
 		}()
 	}
 
 	// Wait for listings to complete and report errors
 	wg.Wait()
+	// Skip directories excluded with --exclude-if-present on
+	// either side so they don't cause deletions, unless deleting
+	// excluded files
+	if dstListErr == errorDirExcluded || (srcListErr == errorDirExcluded && !Config.Filter.DeleteExcluded) {
+		return nil
+	}
+	srcExcluded := srcListErr == errorDirExcluded
+	if srcExcluded {
+		srcList, srcListErr = nil, nil
+	}
 	if srcListErr != nil {
 		s.processError(errors.Wrapf(srcListErr, "error reading source directory %q", job.remote))
 		return nil
@@ -1002,12 +1520,30 @@ func (s *syncCopyMove) processJob(job listDirJob) (jobs []listDirJob) {
 	if dstListErr == ErrorDirNotFound {
 		// Copy the stuff anyway
 	} else if dstListErr != nil {
-		s.processError(errors.Wrapf(dstListErr, "error reading destination directory %q", job.remote))
+		s.processError(errors.Wrapf(dstListErr, "error reading destination directory %q", job.dstDir()))
 		return nil
 	}
 
+	// Note the empty source directories which need making
+	if s.createEmptyDirs && !job.noSrc && !srcExcluded && len(srcList) == 0 && job.remote != s.dir {
+		dstExists := !job.noDst && !s.noTraverse && dstListErr == nil
+		if !dstExists {
+			s.addEmptyDir(job.remote, job.dstDir())
+		}
+	}
+
 	// Work out what to do and do it
-	srcOnly, dstOnly, matches := matchListings(srcList, dstList)
+	var (
+		srcOnly, dstOnly DirEntries
+		matches          []matchPair
+	)
+	if Config.IgnoreCaseSync {
+		var err error
+		srcOnly, dstOnly, matches, err = matchListingsIgnoreCase(srcList, dstList)
+		s.processError(err)
+	} else {
+		srcOnly, dstOnly, matches = matchListings(srcList, dstList)
+	}
 	for _, src := range srcOnly {
 		if s.aborting() {
 			return nil
@@ -1043,6 +1579,7 @@ func runSyncCopyMove(fdst, fsrc Fs, deleteMode DeleteMode, DoMove bool) error {
 	if deleteMode != DeleteModeOff && DoMove {
 		return FatalError(errors.New("can't delete and move at the same time"))
 	}
+	defer startStoppable()()
 	// Run an extra pass to delete only
 	if deleteMode == DeleteModeBefore {
 		if Config.TrackRenames {
@@ -127,3 +127,98 @@ func TestMatchListings(t *testing.T) {
 		assert.Equal(t, test.matches, matches, test.what)
 	}
 }
+
+func TestMatchListingsIgnoreCase(t *testing.T) {
+	var (
+		a   = mockObject("a")
+		bUp = mockObject("B")
+		b   = mockObject("b")
+		cUp = mockObject("C")
+		c   = mockObject("c")
+		dUp = mockObject("D")
+		e   = mockObject("e")
+		fUp = mockObject("F")
+		f   = mockObject("f")
+	)
+
+	for _, test := range []struct {
+		what    string
+		srcList DirEntries
+		dstList DirEntries
+		srcOnly DirEntries
+		dstOnly DirEntries
+		matches []matchPair
+		wantErr bool
+	}{
+		{
+			what:    "same case",
+			srcList: DirEntries{a, b},
+			dstList: DirEntries{b, c},
+			srcOnly: DirEntries{a},
+			dstOnly: DirEntries{c},
+			matches: []matchPair{{b, b}},
+		},
+		{
+			what:    "different case",
+			srcList: DirEntries{bUp, dUp, e},
+			dstList: DirEntries{a, b, e},
+			srcOnly: DirEntries{dUp},
+			dstOnly: DirEntries{a},
+			matches: []matchPair{{bUp, b}, {e, e}},
+		},
+		{
+			what:    "same case preferred and others not deleted",
+			srcList: DirEntries{c, f},
+			dstList: DirEntries{cUp, fUp, c, f},
+			matches: []matchPair{{c, c}, {f, f}},
+		},
+		{
+			what:    "collision in source",
+			srcList: DirEntries{bUp, cUp, b},
+			dstList: DirEntries{b},
+			srcOnly: DirEntries{cUp},
+			matches: []matchPair{{bUp, b}},
+			wantErr: true,
+		},
+		{
+			what:    "duplicate in source",
+			srcList: DirEntries{b, b},
+			dstList: DirEntries{},
+			srcOnly: DirEntries{b},
+		},
+	} {
+		srcOnly, dstOnly, matches, err := matchListingsIgnoreCase(test.srcList, test.dstList)
+		assert.Equal(t, test.srcOnly, srcOnly, test.what)
+		assert.Equal(t, test.dstOnly, dstOnly, test.what)
+		assert.Equal(t, test.matches, matches, test.what)
+		assert.Equal(t, test.wantErr, err != nil, test.what)
+	}
+}
+
+func TestStoppable(t *testing.T) {
+	assert.False(t, Stoppable())
+	end1 := startStoppable()
+	assert.True(t, Stoppable())
+	end2 := startStoppable()
+	end1()
+	assert.True(t, Stoppable())
+	end2()
+	assert.False(t, Stoppable())
+}
+
+func TestSrcOnlyDstRemote(t *testing.T) {
+	s := &syncCopyMove{toBeUploaded: make(ObjectPairChan, 2)}
+	a := mockObject("Dir/a")
+	b := mockObject("Dir/b")
+	s.srcOnly(a, listDirJob{remote: "Dir", dstRemote: "dir"}, nil)
+	s.srcOnly(b, listDirJob{remote: "Dir"}, nil)
+	Stats.ResetCounters()
+
+	// The src objects are passed on unchanged with their dst names
+	pair := <-s.toBeUploaded
+	assert.Equal(t, a, pair.src)
+	assert.Equal(t, "dir/a", pair.dstRemote())
+	pair = <-s.toBeUploaded
+	assert.Equal(t, b, pair.src)
+	assert.Equal(t, "Dir/b", pair.dstRemote())
+}
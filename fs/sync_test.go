@@ -3,11 +3,15 @@
 package fs_test
 
 import (
+	"path"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/ncw/rclone/fs"
 	"github.com/ncw/rclone/fstest"
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -59,6 +63,26 @@ func TestCopyNoTraverse(t *testing.T) {
 	fstest.CheckItems(t, r.fremote, file1)
 }
 
+// Now with --no-traverse checking existing files on the destination
+func TestCopyNoTraverseExisting(t *testing.T) {
+	r := NewRun(t)
+	defer r.Finalise()
+
+	fs.Config.NoTraverse = true
+	defer func() { fs.Config.NoTraverse = false }()
+
+	file1 := r.WriteBoth("unchanged", "potato", t1)
+	file2 := r.WriteFile("changed", "new contents", t2)
+	r.WriteObject("changed", "old", t1)
+
+	fs.Stats.ResetCounters()
+	err := fs.CopyDir(r.fremote, r.flocal)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), fs.Stats.GetTransfers())
+
+	fstest.CheckItems(t, r.fremote, file1, file2)
+}
+
 // Now with --no-traverse
 func TestSyncNoTraverse(t *testing.T) {
 	r := NewRun(t)
@@ -95,6 +119,69 @@ func TestCopyWithDepth(t *testing.T) {
 	fstest.CheckItems(t, r.fremote, file2)
 }
 
+// Test copy with --order-by
+func TestCopyOrderBy(t *testing.T) {
+	r := NewRun(t)
+	defer r.Finalise()
+	file1 := r.WriteFile("small", "a", t1)
+	file2 := r.WriteFile("sub dir/medium", "hello", t2)
+	file3 := r.WriteFile("large", "hello world", t3)
+
+	oldTransfers, oldLogLevel := fs.Config.Transfers, fs.Config.LogLevel
+	defer func() {
+		fs.Config.OrderBy = ""
+		fs.Config.Transfers, fs.Config.LogLevel = oldTransfers, oldLogLevel
+	}()
+	fs.Config.OrderBy = "size,desc"
+	fs.Config.Transfers = 1
+	fs.Config.LogLevel = fs.LogLevelInfo
+	var (
+		mu     sync.Mutex
+		copied []string
+	)
+	oldLogPrint := fs.SetLogPrint(func(level fs.LogLevel, text string) {
+		if strings.HasSuffix(text, ": Copied (new)") {
+			mu.Lock()
+			copied = append(copied, strings.TrimSuffix(text, ": Copied (new)"))
+			mu.Unlock()
+		}
+	})
+	defer fs.SetLogPrint(oldLogPrint)
+
+	fs.Stats.ResetCounters()
+	err := fs.CopyDir(r.fremote, r.flocal)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), fs.Stats.GetTransfers())
+	assert.Equal(t, []string{"large", "sub dir/medium", "small"}, copied)
+
+	fstest.CheckItems(t, r.flocal, file1, file2, file3)
+	fstest.CheckItems(t, r.fremote, file1, file2, file3)
+
+	// A bad --order-by is an error
+	fs.Config.OrderBy = "potato"
+	err = fs.CopyDir(r.fremote, r.flocal)
+	assert.Error(t, err)
+}
+
+// Test copy stops when requested
+func TestCopyStopRequested(t *testing.T) {
+	r := NewRun(t)
+	defer r.Finalise()
+	file1 := r.WriteFile("sub dir/hello world", "hello world", t1)
+
+	fs.RequestStop()
+	defer fs.CancelStop()
+
+	fs.Stats.ResetCounters()
+	err := fs.CopyDir(r.fremote, r.flocal)
+	assert.Equal(t, fs.ErrorStopRequested, err)
+	assert.Equal(t, int64(0), fs.Stats.GetTransfers())
+	assert.False(t, fs.Stoppable(), "only while the copy is running")
+
+	fstest.CheckItems(t, r.flocal, file1)
+	fstest.CheckItems(t, r.fremote)
+}
+
 // Test a server side copy if possible, or the backup path if not
 func TestServerSideCopy(t *testing.T) {
 	r := NewRun(t)
@@ -145,6 +232,77 @@ func TestCopyRedownload(t *testing.T) {
 	fstest.CheckItems(t, r.flocal, file1)
 }
 
+// Test that partial uploads on the destination are left alone
+func TestSyncIgnoresPartialUploads(t *testing.T) {
+	r := NewRun(t)
+	defer r.Finalise()
+
+	file1 := r.WriteFile("file1", "potato", t1)
+	partial := r.WriteObject("file1.partial-0123abcd", "pota", t1)
+	fstest.CheckItems(t, r.flocal, file1)
+
+	fs.Stats.ResetCounters()
+	err := fs.Sync(r.fremote, r.flocal)
+	require.NoError(t, err)
+
+	_, err = r.fremote.NewObject(partial.Path)
+	require.NoError(t, err, "partial upload was deleted")
+	fstest.CheckItems(t, r.fremote, file1)
+}
+
+// Test that --immutable refuses to change or delete files in the
+// destination but adds new ones
+func TestSyncImmutable(t *testing.T) {
+	r := NewRun(t)
+	defer r.Finalise()
+	fs.Config.Immutable = true
+	defer func() { fs.Config.Immutable = false }()
+
+	// New files are copied
+	file1 := r.WriteFile("existing", "potato", t1)
+	fs.Stats.ResetCounters()
+	err := fs.Sync(r.fremote, r.flocal)
+	require.NoError(t, err)
+	fstest.CheckItems(t, r.fremote, file1)
+
+	// Changes in contents, modification times and deletions all
+	// fail, but only report with --dry-run
+	checkFails := func(what string, remote ...fstest.Item) {
+		fs.Stats.ResetCounters()
+		fs.Config.DryRun = true
+		err := fs.Sync(r.fremote, r.flocal)
+		fs.Config.DryRun = false
+		require.NoError(t, err, what)
+
+		fs.Stats.ResetCounters()
+		err = fs.Sync(r.fremote, r.flocal)
+		require.Error(t, err, what)
+		assert.True(t, fs.IsNoRetryError(err), what)
+		assert.Contains(t, err.Error(), fs.ErrorImmutableModified.Error(), what)
+		fstest.CheckItems(t, r.fremote, remote...)
+	}
+	r.WriteFile("existing", "tomatoes", t1)
+	checkFails("contents", file1)
+	r.WriteFile("existing", "potato", t2)
+	checkFails("modification time", file1)
+
+	// Other comparisons still check the hashes when the
+	// modification times differ
+	if r.fremote.Hashes().Overlap(r.flocal.Hashes()).Count() > 0 {
+		src, err := r.flocal.NewObject("existing")
+		require.NoError(t, err)
+		dst, err := r.fremote.NewObject("existing")
+		require.NoError(t, err)
+		fs.Config.NoUpdateModTime = true
+		assert.True(t, fs.Equal(src, dst))
+		fs.Config.NoUpdateModTime = false
+	}
+
+	r.WriteFile("existing", "potato", t1)
+	extra := r.WriteObject("extra", "carrot", t1)
+	checkFails("deletion", file1, extra)
+}
+
 // Create a file and sync it. Change the last modified date and resync.
 // If we're only doing sync by size and checksum, we expect nothing to
 // to be transferred on the second sync.
@@ -790,8 +948,10 @@ func TestSyncWithTrackRenames(t *testing.T) {
 
 	if canTrackRenames {
 		assert.Equal(t, fs.Stats.GetTransfers(), int64(0))
+		assert.Equal(t, fs.Stats.GetRenames(), int64(1))
 	} else {
 		assert.Equal(t, fs.Stats.GetTransfers(), int64(1))
+		assert.Equal(t, fs.Stats.GetRenames(), int64(0))
 	}
 }
 
@@ -899,9 +1059,6 @@ func testSyncBackupDir(t *testing.T, suffix string) {
 	r := NewRun(t)
 	defer r.Finalise()
 
-	if !fs.CanServerSideMove(r.fremote) {
-		t.Skip("Skipping test as remote does not support server side move")
-	}
 	r.Mkdir(r.fremote)
 
 	fs.Config.BackupDir = r.fremoteName + "/backup"
@@ -928,6 +1085,7 @@ func testSyncBackupDir(t *testing.T, suffix string) {
 	fs.Stats.ResetCounters()
 	err = fs.Sync(fdst, r.flocal)
 	require.NoError(t, err)
+	assert.Equal(t, int64(2), fs.Stats.GetBackups())
 
 	// one should be moved to the backup dir and the new one installed
 	file1.Path = "backup/one" + suffix
@@ -949,6 +1107,7 @@ func testSyncBackupDir(t *testing.T, suffix string) {
 	fs.Stats.ResetCounters()
 	err = fs.Sync(fdst, r.flocal)
 	require.NoError(t, err)
+	assert.Equal(t, int64(2), fs.Stats.GetBackups())
 
 	// one should be moved to the backup dir and the new one installed
 	file1a.Path = "backup/one" + suffix
@@ -961,3 +1120,393 @@ func testSyncBackupDir(t *testing.T, suffix string) {
 }
 func TestSyncBackupDir(t *testing.T)           { testSyncBackupDir(t, "") }
 func TestSyncBackupDirWithSuffix(t *testing.T) { testSyncBackupDir(t, ".bak") }
+
+// Test with Suffix set and no BackupDir
+func testSyncSuffix(t *testing.T, keepExtension bool) {
+	r := NewRun(t)
+	defer r.Finalise()
+	r.Mkdir(r.fremote)
+
+	fs.Config.Suffix = ".bak"
+	fs.Config.SuffixKeepExtension = keepExtension
+	defer func() {
+		fs.Config.Suffix = ""
+		fs.Config.SuffixKeepExtension = false
+	}()
+	suffixed := func(name string) string {
+		if keepExtension {
+			return name + ".bak.txt"
+		}
+		return name + ".txt.bak"
+	}
+
+	// Make the setup so we have one, two, three in the dest
+	// and one (different), two (same) in the source
+	file1 := r.WriteObject("one.txt", "one", t1)
+	file2 := r.WriteObject("two.txt", "two", t1)
+	file3 := r.WriteObject("three.txt", "three", t1)
+	file2a := r.WriteFile("two.txt", "two", t1)
+	file1a := r.WriteFile("one.txt", "oneA", t2)
+
+	fstest.CheckItems(t, r.fremote, file1, file2, file3)
+	fstest.CheckItems(t, r.flocal, file1a, file2a)
+
+	fs.Stats.ResetCounters()
+	err := fs.Sync(r.fremote, r.flocal)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), fs.Stats.GetBackups())
+
+	// one should be renamed with the suffix and the new one
+	// installed, two unchanged and three renamed
+	file1.Path = suffixed("one")
+	file3.Path = suffixed("three")
+	fstest.CheckItems(t, r.fremote, file1, file1a, file2, file3)
+
+	// Syncing again leaves the renamed files alone
+	fs.Stats.ResetCounters()
+	err = fs.Sync(r.fremote, r.flocal)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), fs.Stats.GetBackups())
+	fstest.CheckItems(t, r.fremote, file1, file1a, file2, file3)
+
+	// Overwriting again replaces the previous version
+	file1b := r.WriteFile("one.txt", "oneBB", t3)
+	fs.Stats.ResetCounters()
+	err = fs.Sync(r.fremote, r.flocal)
+	require.NoError(t, err)
+	file1a.Path = suffixed("one")
+	fstest.CheckItems(t, r.fremote, file1a, file1b, file2, file3)
+}
+func TestSyncSuffix(t *testing.T)              { testSyncSuffix(t, false) }
+func TestSyncSuffixKeepExtension(t *testing.T) { testSyncSuffix(t, true) }
+
+// Test that --max-transfer stops the sync once the limit is reached
+func testSyncMaxTransfer(t *testing.T, cutoffMode fs.CutoffMode) {
+	r := NewRun(t)
+	defer r.Finalise()
+	oldTransfers := fs.Config.Transfers
+	fs.Config.Transfers = 1
+	fs.Config.MaxTransfer = 5
+	fs.Config.CutoffMode = cutoffMode
+	defer func() {
+		fs.Config.Transfers = oldTransfers
+		fs.Config.MaxTransfer = -1
+		fs.Config.CutoffMode = fs.CutoffModeSoft
+	}()
+
+	r.WriteFile("one", "one one one", t1)
+	r.WriteFile("two", "two two two", t1)
+
+	fs.Stats.ResetCounters()
+	err := fs.Sync(r.fremote, r.flocal)
+	require.Error(t, err)
+	assert.Equal(t, fs.ErrorMaxTransferLimitReached, errors.Cause(err))
+	assert.True(t, fs.IsFatalError(err))
+
+	objs, _, err := fs.WalkGetAll(r.fremote, "", true, -1)
+	require.NoError(t, err)
+	switch cutoffMode {
+	case fs.CutoffModeSoft:
+		// the transfer in progress finishes but no more are started
+		assert.Equal(t, 1, len(objs))
+	case fs.CutoffModeHard:
+		// the transfer in progress is stopped part way
+		assert.Equal(t, 0, len(objs))
+	}
+}
+
+func TestSyncMaxTransferSoft(t *testing.T) { testSyncMaxTransfer(t, fs.CutoffModeSoft) }
+func TestSyncMaxTransferHard(t *testing.T) { testSyncMaxTransfer(t, fs.CutoffModeHard) }
+
+// Test that --max-delete stops deleting but carries on copying
+func TestSyncMaxDelete(t *testing.T) {
+	r := NewRun(t)
+	defer r.Finalise()
+	fs.Config.MaxDelete = 1
+	defer func() { fs.Config.MaxDelete = -1 }()
+
+	file1 := r.WriteFile("new", "potato", t1)
+	r.WriteObject("extra1", "carrot", t1)
+	r.WriteObject("extra2", "turnip", t1)
+	r.WriteObject("extra3", "swede", t1)
+
+	fs.Stats.ResetCounters()
+	err := fs.Sync(r.fremote, r.flocal)
+	require.Error(t, err)
+	assert.True(t, fs.IsNoRetryError(err))
+	assert.Contains(t, err.Error(), fs.ErrorMaxDeleteLimitReached.Error())
+
+	_, err = r.fremote.NewObject(file1.Path)
+	require.NoError(t, err, "new file wasn't copied")
+	objs, _, err := fs.WalkGetAll(r.fremote, "", true, -1)
+	require.NoError(t, err)
+	assert.Equal(t, 3, len(objs), "should have deleted exactly one file")
+}
+
+// Test --compare-dest and --copy-dest skip files found unchanged in
+// the extra directory, copying them from there with --copy-dest
+func testSyncCompareOrCopyDest(t *testing.T, copyDest bool) {
+	r := NewRun(t)
+	defer r.Finalise()
+
+	fcompare, compareName, finaliseCompare, err := fstest.RandomRemote(*fstest.RemoteName, *fstest.SubDir)
+	require.NoError(t, err)
+	defer finaliseCompare()
+	if copyDest {
+		if r.fremote.Features().Copy == nil {
+			t.Skip("Can't test --copy-dest without server side copy")
+		}
+		fs.Config.CopyDest = []string{compareName}
+		defer func() { fs.Config.CopyDest = nil }()
+	} else {
+		fs.Config.CompareDest = []string{compareName}
+		defer func() { fs.Config.CompareDest = nil }()
+	}
+
+	file1 := r.WriteFile("one", "unchanged", t1)
+	file2 := r.WriteFile("two", "new", t1)
+	file3 := r.WriteFile("three", "changed", t2)
+	file4 := r.WriteFile("four", "touched", t2)
+	compare1 := r.WriteObjectTo(fcompare, "one", "unchanged", t1, false)
+	compare3 := r.WriteObjectTo(fcompare, "three", "old", t1, false)
+	compare4 := r.WriteObjectTo(fcompare, "four", "touched", t1, false)
+
+	fs.Stats.ResetCounters()
+	err = fs.Sync(r.fremote, r.flocal)
+	require.NoError(t, err)
+
+	if copyDest {
+		fstest.CheckItems(t, r.fremote, file1, file2, file3, file4)
+	} else if fcompare.Hashes().Overlap(r.flocal.Hashes()).Count() > 0 {
+		// four only differs by mtime so is found unchanged
+		fstest.CheckItems(t, r.fremote, file2, file3)
+	} else {
+		fstest.CheckItems(t, r.fremote, file2, file3, file4)
+	}
+
+	// The --compare-dest or --copy-dest files are never changed
+	fstest.CheckItems(t, fcompare, compare1, compare3, compare4)
+}
+
+func TestSyncCompareDest(t *testing.T) { testSyncCompareOrCopyDest(t, false) }
+func TestSyncCopyDest(t *testing.T)    { testSyncCompareOrCopyDest(t, true) }
+
+// Test that --exclude-if-present skips directories containing the
+// file without deleting anything in them
+func TestSyncExcludeIfPresent(t *testing.T) {
+	r := NewRun(t)
+	defer r.Finalise()
+	fs.Config.Filter.ExcludeFile = []string{".ignore"}
+	defer func() { fs.Config.Filter.ExcludeFile = nil }()
+
+	file1 := r.WriteFile("one", "one", t1)
+	r.WriteFile("skip/.ignore", "", t1)
+	r.WriteFile("skip/two", "two", t1)
+	file3 := r.WriteObject("skip/three", "three", t1)
+
+	fs.Stats.ResetCounters()
+	err := fs.Sync(r.fremote, r.flocal)
+	require.NoError(t, err)
+
+	fstest.CheckItems(t, r.fremote, file1, file3)
+}
+
+// checkDirModTime checks the modification time of dir in f from a
+// listing of its parent
+func checkDirModTime(t *testing.T, f fs.Fs, dir string, want time.Time) {
+	parent := path.Dir(dir)
+	if parent == "." {
+		parent = ""
+	}
+	entries, err := f.List(parent)
+	require.NoError(t, err)
+	for _, entry := range entries {
+		if _, ok := entry.(fs.Directory); ok && entry.Remote() == dir {
+			dt, ok := fstest.CheckTimeEqualWithPrecision(want, entry.ModTime(), fs.Config.ModifyWindow)
+			assert.True(t, ok, "%s: modification time differs by %v", dir, dt)
+			return
+		}
+	}
+	t.Errorf("directory %q not found", dir)
+}
+
+// Test that sync sets the modification times of the directories
+func TestSyncDirModTime(t *testing.T) {
+	r := NewRun(t)
+	defer r.Finalise()
+	if r.flocal.Features().DirSetModTime == nil || r.fremote.Features().DirSetModTime == nil {
+		t.Skip("Can't set the modification time of directories")
+	}
+	file1 := r.WriteFile("a/one", "one", t1)
+	file2 := r.WriteFile("a/b/two", "two", t1)
+	require.NoError(t, r.flocal.Features().DirSetModTime("a", t2))
+	require.NoError(t, r.flocal.Features().DirSetModTime("a/b", t2))
+
+	fs.Stats.ResetCounters()
+	err := fs.Sync(r.fremote, r.flocal)
+	require.NoError(t, err)
+	fstest.CheckItems(t, r.fremote, file1, file2)
+	checkDirModTime(t, r.fremote, "a", t2)
+	checkDirModTime(t, r.fremote, "a/b", t2)
+
+	// Not changed with --no-update-dir-modtime
+	require.NoError(t, r.flocal.Features().DirSetModTime("a/b", t3))
+	fs.Config.NoUpdateDirModTime = true
+	defer func() { fs.Config.NoUpdateDirModTime = false }()
+	err = fs.Sync(r.fremote, r.flocal)
+	require.NoError(t, err)
+	checkDirModTime(t, r.fremote, "a/b", t2)
+
+	fs.Config.NoUpdateDirModTime = false
+	err = fs.Sync(r.fremote, r.flocal)
+	require.NoError(t, err)
+	checkDirModTime(t, r.fremote, "a", t2)
+	checkDirModTime(t, r.fremote, "a/b", t3)
+}
+
+// Test that --create-empty-src-dirs makes the empty source directories
+func TestSyncCreateEmptySrcDirs(t *testing.T) {
+	r := NewRun(t)
+	defer r.Finalise()
+	file1 := r.WriteFile("a/big", "------------------------------------------------------------", t1)
+	r.WriteFile("small/file", "one", t1)
+	require.NoError(t, r.flocal.Mkdir("empty"))
+	require.NoError(t, r.flocal.Mkdir("a/empty"))
+	fstest.CheckListingWithPrecision(t, r.flocal, []fstest.Item{file1, fstest.NewItem("small/file", "one", t1)}, []string{"a", "a/empty", "empty", "small"}, fs.Config.ModifyWindow)
+
+	// Directories only empty because of the filters aren't made
+	fs.Config.Filter.MinSize = 40
+	fs.Config.CreateEmptySrcDirs = true
+	defer func() {
+		fs.Config.Filter.MinSize = -1
+		fs.Config.CreateEmptySrcDirs = false
+	}()
+
+	fs.Stats.ResetCounters()
+	err := fs.Sync(r.fremote, r.flocal)
+	require.NoError(t, err)
+	fstest.CheckListingWithPrecision(t, r.fremote, []fstest.Item{file1}, []string{"a", "a/empty", "empty"}, fs.Config.ModifyWindow)
+
+	// Directories removed from the source are removed from the destination
+	require.NoError(t, r.flocal.Rmdir("a/empty"))
+	err = fs.Sync(r.fremote, r.flocal)
+	require.NoError(t, err)
+	fstest.CheckListingWithPrecision(t, r.fremote, []fstest.Item{file1}, []string{"a", "empty"}, fs.Config.ModifyWindow)
+}
+
+// Test that --delete-empty-src-dirs removes the directories a move
+// has emptied
+func TestMoveDeleteEmptySrcDirs(t *testing.T) {
+	r := NewRun(t)
+	defer r.Finalise()
+	file1 := r.WriteFile("a/big", "------------------------------------------------------------", t1)
+	file2 := r.WriteFile("a/b/big", "------------------------------------------------------------", t2)
+	file3 := r.WriteFile("c/small", "one", t1)
+	require.NoError(t, r.flocal.Mkdir("d"))
+
+	// The filter leaves c/small behind so c mustn't be deleted
+	fs.Config.Filter.MinSize = 40
+	fs.Config.DeleteEmptySrcDirs = true
+	defer func() {
+		fs.Config.Filter.MinSize = -1
+		fs.Config.DeleteEmptySrcDirs = false
+	}()
+
+	// Leaving c behind isn't reported as a failure
+	var (
+		mu     sync.Mutex
+		logged []string
+	)
+	oldLogPrint := fs.SetLogPrint(func(level fs.LogLevel, text string) {
+		if level <= fs.LogLevelNotice {
+			mu.Lock()
+			logged = append(logged, text)
+			mu.Unlock()
+		}
+	})
+	defer fs.SetLogPrint(oldLogPrint)
+
+	fs.Stats.ResetCounters()
+	err := fs.MoveDir(r.fremote, r.flocal)
+	require.NoError(t, err)
+	fstest.CheckListingWithPrecision(t, r.flocal, []fstest.Item{file3}, []string{"c"}, fs.Config.ModifyWindow)
+	assert.Empty(t, logged)
+	fstest.CheckItems(t, r.fremote, file1, file2)
+}
+
+// Test syncing with --ignore-case-sync
+func TestSyncIgnoreCase(t *testing.T) {
+	r := NewRun(t)
+	defer r.Finalise()
+	r.WriteFile("Photo.JPG", "jpeg", t1)
+	r.WriteFile("Dir/file", "file", t1)
+	file1 := r.WriteObject("photo.jpg", "jpeg", t1)
+	file2 := r.WriteObject("dir/file", "file", t1)
+	fstest.CheckItems(t, r.fremote, file1, file2)
+
+	fs.Config.IgnoreCaseSync = true
+	defer func() { fs.Config.IgnoreCaseSync = false }()
+
+	// Nothing is transferred or deleted as only the case differs
+	fs.Stats.ResetCounters()
+	err := fs.Sync(r.fremote, r.flocal)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), fs.Stats.GetTransfers())
+	fstest.CheckItems(t, r.fremote, file1, file2)
+
+	// Changed files are updated keeping the case of the destination
+	r.WriteFile("Photo.JPG", "jpeg2", t2)
+	r.WriteFile("Dir/file", "file2", t2)
+	fs.Stats.ResetCounters()
+	err = fs.Sync(r.fremote, r.flocal)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), fs.Stats.GetTransfers())
+	file1 = fstest.NewItem("photo.jpg", "jpeg2", t2)
+	file2 = fstest.NewItem("dir/file", "file2", t2)
+	fstest.CheckItems(t, r.fremote, file1, file2)
+
+	// New files in a directory which only matches by case go in
+	// the destination directory rather than making a new one
+	r.WriteFile("Dir/new", "new", t1)
+	r.WriteFile("Dir/Sub/deep", "deep", t1)
+	fs.Stats.ResetCounters()
+	err = fs.Sync(r.fremote, r.flocal)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), fs.Stats.GetTransfers())
+	file3 := fstest.NewItem("dir/new", "new", t1)
+	file4 := fstest.NewItem("dir/Sub/deep", "deep", t1)
+	fstest.CheckListingWithPrecision(t, r.fremote, []fstest.Item{file1, file2, file3, file4}, []string{"dir", "dir/Sub"}, fs.Config.ModifyWindow)
+
+	// Source files which only differ by case are an error
+	r.WriteFile("photo.jpg", "other", t1)
+	fs.Stats.ResetCounters()
+	err = fs.Sync(r.fremote, r.flocal)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "only differs by case")
+	fstest.CheckItems(t, r.fremote, file1, file2, file3, file4)
+}
+
+// Test syncing with --transfer-scheduler fair
+func TestSyncFairScheduler(t *testing.T) {
+	r := NewRun(t)
+	defer r.Finalise()
+	oldTransfers := fs.Config.Transfers
+	fs.Config.TransferScheduler = fs.TransferSchedulerFair
+	fs.Config.SmallFileCutoff = 10
+	fs.Config.Transfers = 4
+	defer func() {
+		fs.Config.TransferScheduler = fs.TransferSchedulerFIFO
+		fs.Config.SmallFileCutoff = 10 << 20
+		fs.Config.Transfers = oldTransfers
+	}()
+	file1 := r.WriteFile("small1", "one", t1)
+	file2 := r.WriteFile("small2", "two", t1)
+	file3 := r.WriteFile("dir/large1", "------------------------------------------------------------", t1)
+	file4 := r.WriteFile("dir/large2", "------------------------------------------------------------", t2)
+
+	fs.Stats.ResetCounters()
+	err := fs.Sync(r.fremote, r.flocal)
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), fs.Stats.GetTransfers())
+	fstest.CheckItems(t, r.fremote, file1, file2, file3, file4)
+}
@@ -41,7 +41,7 @@ func startSysLog() bool {
 	}
 	log.SetFlags(0)
 	log.SetOutput(w)
-	logPrint = func(level LogLevel, text string) {
+	SetLogPrint(func(level LogLevel, text string) {
 		switch level {
 		case LogLevelEmergency:
 			_ = w.Emerg(text)
@@ -60,6 +60,6 @@ func startSysLog() bool {
 		case LogLevelDebug:
 			_ = w.Debug(text)
 		}
-	}
+	})
 	return true
 }
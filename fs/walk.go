@@ -54,12 +54,61 @@ type WalkFunc func(path string, entries DirEntries, err error) error
 //
 // NB (f, path) to be replaced by fs.Dir at some point
 func Walk(f Fs, path string, includeAll bool, maxLevel int, fn WalkFunc) error {
-	if (maxLevel < 0 || maxLevel > 1) && Config.UseListR && f.Features().ListR != nil {
+	if shouldUseListR(f, includeAll, maxLevel) {
 		return WalkR(f, path, includeAll, maxLevel, fn)
 	}
 	return WalkN(f, path, includeAll, maxLevel, fn)
 }
 
+// autoListRMaxEntries is the default --fast-list-max-entries when
+// ListR is used automatically
+const autoListRMaxEntries = 100000
+
+// shouldUseListR decides whether the recursive listing of f should be used
+// to list maxLevel levels.
+//
+// ListR is used if --fast-list is set.  If --fast-list isn't set at
+// all then it is used automatically if the remote sends its listing
+// a directory at a time, unless something suggests listing each
+// directory will be cheaper.  The decision and the reason for it are
+// logged at DEBUG.
+func shouldUseListR(f Fs, includeAll bool, maxLevel int) bool {
+	if f.Features().ListR == nil || (maxLevel >= 0 && maxLevel <= 1) {
+		return false
+	}
+	if Config.UseListR {
+		return true
+	}
+	if !Config.AutoListR {
+		return false
+	}
+	reason := ""
+	switch {
+	case !f.Features().ListRByDirectory:
+		reason = "the remote doesn't send its listing a directory at a time"
+	case maxLevel >= 0:
+		reason = "--max-depth is set"
+	case !includeAll && Config.Filter.excludesDirectories():
+		reason = "filters may exclude directories"
+	}
+	if reason != "" {
+		Debugf(f, "Not using recursive listing automatically as %s", reason)
+		return false
+	}
+	Debugf(f, "Using recursive listing automatically as the remote supports it - use --fast-list=false to disable")
+	return true
+}
+
+// fastListLimit returns the maximum number of entries read with
+// ListR to hold for directories which haven't been asked for yet or
+// 0 for no limit
+func fastListLimit() int {
+	if Config.FastListMaxEntries == 0 && !Config.UseListR {
+		return autoListRMaxEntries
+	}
+	return Config.FastListMaxEntries
+}
+
 // WalkN lists the directory.
 //
 // It implements Walk using non recursive directory listing.
@@ -71,6 +120,11 @@ func WalkN(f Fs, path string, includeAll bool, maxLevel int, fn WalkFunc) error
 //
 // It implements Walk using recursive directory listing if
 // available, or returns ErrorCantListR if not.
+//
+// The listing is read in the background and each directory is
+// passed to fn as it becomes available.  If more than
+// --fast-list-max-entries entries are waiting then directories are
+// listed individually until the listing catches up.
 func WalkR(f Fs, path string, includeAll bool, maxLevel int, fn WalkFunc) error {
 	listR := f.Features().ListR
 	if listR == nil {
@@ -266,18 +320,47 @@ func (dt DirTree) String() string {
 	return out.String()
 }
 
-func walkRDirTree(f Fs, path string, includeAll bool, maxLevel int, listR ListRFn) (DirTree, error) {
+// prune empties the directories in excluded and removes all the
+// directories below them
+func (dt DirTree) prune(excluded map[string]struct{}) {
+	for dirPath := range dt {
+		for excludedPath := range excluded {
+			if dirPath == excludedPath {
+				dt[dirPath] = nil
+			} else if excludedPath == "" || strings.HasPrefix(dirPath, excludedPath+"/") {
+				delete(dt, dirPath)
+				break
+			}
+		}
+	}
+}
+
+// walkRDirTree makes a DirTree using listR
+//
+// It also returns the directories which were excluded with
+// --exclude-if-present which are left empty in the DirTree
+func walkRDirTree(f Fs, path string, includeAll bool, maxLevel int, listR ListRFn) (DirTree, map[string]struct{}, error) {
 	dirs := make(DirTree)
+	excluded := make(map[string]struct{})
 	var mu sync.Mutex
 	err := listR(path, func(entries DirEntries) error {
 		mu.Lock()
 		defer mu.Unlock()
+		if !includeAll {
+			for _, entry := range entries {
+				if o, ok := entry.(Object); ok && Config.Filter.isExcludeFile(o.Remote()) {
+					excluded[parentDir(o.Remote())] = struct{}{}
+				}
+			}
+		}
 		for _, entry := range entries {
 			slashes := strings.Count(entry.Remote(), "/")
 			switch x := entry.(type) {
 			case Object:
 				// Make sure we don't delete excluded files if not required
-				if includeAll || Config.Filter.IncludeObject(x) {
+				if isPartialUpload(x.Remote()) {
+					Debugf(x, "Excluded from sync (and deletion) as a partial upload")
+				} else if includeAll || Config.Filter.IncludeObject(x) {
 					if maxLevel < 0 || slashes <= maxLevel-1 {
 						dirs.add(x)
 					} else {
@@ -309,14 +392,20 @@ func walkRDirTree(f Fs, path string, includeAll bool, maxLevel int, listR ListRF
 		return nil
 	})
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	dirs.checkParents(path)
+	if len(excluded) > 0 {
+		for excludedPath := range excluded {
+			Debugf(logDirName(f, excludedPath), "Excluded from sync (and deletion) as it contains an --exclude-if-present file")
+		}
+		dirs.prune(excluded)
+	}
 	if len(dirs) == 0 {
 		dirs[path] = nil
 	}
 	dirs.Sort()
-	return dirs, nil
+	return dirs, excluded, nil
 }
 
 // Create a DirTree using List
@@ -348,44 +437,77 @@ func walkNDirTree(f Fs, path string, includeAll bool, maxLevel int, listDir list
 //
 // NB (f, path) to be replaced by fs.Dir at some point
 func NewDirTree(f Fs, path string, includeAll bool, maxLevel int) (DirTree, error) {
-	if ListR := f.Features().ListR; (maxLevel < 0 || maxLevel > 1) && Config.UseListR && ListR != nil {
-		return walkRDirTree(f, path, includeAll, maxLevel, ListR)
+	dirs, _, err := newDirTree(f, path, includeAll, maxLevel)
+	return dirs, err
+}
+
+// newDirTree is NewDirTree which also returns the directories which
+// were excluded with --exclude-if-present
+func newDirTree(f Fs, path string, includeAll bool, maxLevel int) (DirTree, map[string]struct{}, error) {
+	if shouldUseListR(f, includeAll, maxLevel) {
+		return walkRDirTree(f, path, includeAll, maxLevel, f.Features().ListR)
 	}
-	return walkNDirTree(f, path, includeAll, maxLevel, ListDirSorted)
+	return newDirTreeN(f, path, includeAll, maxLevel)
 }
 
-func walkR(f Fs, path string, includeAll bool, maxLevel int, fn WalkFunc, listR ListRFn) error {
-	dirs, err := walkRDirTree(f, path, includeAll, maxLevel, listR)
+// newDirTreeN is newDirTree using non recursive directory listing
+func newDirTreeN(f Fs, path string, includeAll bool, maxLevel int) (DirTree, map[string]struct{}, error) {
+	var mu sync.Mutex
+	excluded := make(map[string]struct{})
+	listDir := func(f Fs, includeAll bool, dir string) (DirEntries, error) {
+		entries, isExcluded, err := listDirSorted(f, includeAll, dir)
+		if isExcluded {
+			mu.Lock()
+			excluded[dir] = struct{}{}
+			mu.Unlock()
+		}
+		return entries, err
+	}
+	dirs, err := walkNDirTree(f, path, includeAll, maxLevel, listDir)
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
-	skipping := false
-	skipPrefix := ""
-	emptyDir := DirEntries{}
-	for _, dirPath := range dirs.Dirs() {
-		if skipping {
-			// Skip over directories as required
-			if strings.HasPrefix(dirPath, skipPrefix) {
-				continue
+	return dirs, excluded, nil
+}
+
+// walkR walks the directories using a listRStream
+//
+// Errors from the recursive listing are returned rather than being
+// passed to fn.
+func walkR(f Fs, path string, includeAll bool, maxLevel int, fn WalkFunc, listR ListRFn) error {
+	s := newListRStream(f, path, includeAll, maxLevel, listR)
+	defer s.stop()
+	var listErr error
+	var mu sync.Mutex
+	listDir := func(f Fs, includeAll bool, dir string) (DirEntries, error) {
+		entries, excluded, err := s.listDir(dir)
+		if err != nil {
+			mu.Lock()
+			if listErr == nil {
+				listErr = err
 			}
-			skipping = false
+			mu.Unlock()
 		}
-		entries := dirs[dirPath]
-		if entries == nil {
-			entries = emptyDir
+		if excluded || entries == nil {
+			entries = DirEntries{}
+		}
+		return entries, err
+	}
+	walkFn := func(dirPath string, entries DirEntries, err error) error {
+		if err != nil {
+			return err
 		}
 		err = fn(dirPath, entries, nil)
 		if err == ErrorSkipDir {
-			skipping = true
-			skipPrefix = dirPath
-			if skipPrefix != "" {
-				skipPrefix += "/"
-			}
-		} else if err != nil {
-			return err
+			s.skip(dirPath)
 		}
+		return err
+	}
+	err := walk(f, path, includeAll, maxLevel, walkFn, listDir)
+	if listErr != nil {
+		return listErr
 	}
-	return nil
+	return err
 }
 
 // WalkGetAll runs Walk getting all the results
@@ -177,7 +177,8 @@ func (ls *listDirs) Walk() {
 
 // WalkR does the walkR and tests the expectations
 func (ls *listDirs) WalkR() {
-	err := walkR(nil, "", ls.includeAll, ls.maxLevel, ls.WalkFn, ls.ListR)
+	f := &aboutFs{features: &Features{}}
+	err := walkR(f, "", ls.includeAll, ls.maxLevel, ls.WalkFn, ls.ListR)
 	assert.Equal(ls.t, ls.finalError, err)
 	if ls.finalError == nil {
 		ls.IsFinished()
@@ -583,8 +584,100 @@ a/
   b/
 `, nil, "", 2},
 	} {
-		r, err := walkRDirTree(nil, test.root, true, test.level, makeListRCallback(test.entries, test.err))
+		r, _, err := walkRDirTree(nil, test.root, true, test.level, makeListRCallback(test.entries, test.err))
 		assert.Equal(t, test.err, err, fmt.Sprintf("%+v", test))
 		assert.Equal(t, test.want, r.String(), fmt.Sprintf("%+v", test))
 	}
 }
+
+func TestShouldUseListR(t *testing.T) {
+	oldUseListR, oldAutoListR, oldFilter := Config.UseListR, Config.AutoListR, Config.Filter
+	defer func() {
+		Config.UseListR, Config.AutoListR, Config.Filter = oldUseListR, oldAutoListR, oldFilter
+	}()
+	noFilter, err := NewFilter()
+	require.NoError(t, err)
+	dirFilter, err := NewFilter()
+	require.NoError(t, err)
+	require.NoError(t, dirFilter.AddRule("- /potato/**"))
+
+	listR := func(dir string, callback ListRCallback) error { return nil }
+	withListR := &aboutFs{features: &Features{ListR: listR, ListRByDirectory: true}}
+	ungroupedListR := &aboutFs{features: &Features{ListR: listR}}
+	withoutListR := &aboutFs{features: &Features{}}
+	for _, test := range []struct {
+		f          Fs
+		useListR   bool
+		autoListR  bool
+		filter     *Filter
+		includeAll bool
+		maxLevel   int
+		want       bool
+	}{
+		{withoutListR, true, false, noFilter, false, -1, false},
+		{withoutListR, false, true, noFilter, false, -1, false},
+		{withListR, true, false, noFilter, false, -1, true},
+		{withListR, true, false, noFilter, false, 1, false},
+		{withListR, true, false, dirFilter, false, 3, true},
+		{withListR, false, false, noFilter, false, -1, false},
+		{withListR, false, true, noFilter, false, -1, true},
+		{withListR, false, true, noFilter, false, 3, false},
+		{withListR, false, true, dirFilter, false, -1, false},
+		{withListR, false, true, dirFilter, true, -1, true},
+		{ungroupedListR, true, false, noFilter, false, -1, true},
+		{ungroupedListR, false, true, noFilter, false, -1, false},
+	} {
+		Config.UseListR, Config.AutoListR, Config.Filter = test.useListR, test.autoListR, test.filter
+		got := shouldUseListR(test.f, test.includeAll, test.maxLevel)
+		assert.Equal(t, test.want, got, fmt.Sprintf("%+v", test))
+	}
+}
+
+func TestFastListLimit(t *testing.T) {
+	oldUseListR, oldMaxEntries := Config.UseListR, Config.FastListMaxEntries
+	defer func() {
+		Config.UseListR, Config.FastListMaxEntries = oldUseListR, oldMaxEntries
+	}()
+	for _, test := range []struct {
+		useListR   bool
+		maxEntries int
+		want       int
+	}{
+		{false, 0, autoListRMaxEntries},
+		{false, 10, 10},
+		{true, 0, 0},
+		{true, 10, 10},
+	} {
+		Config.UseListR, Config.FastListMaxEntries = test.useListR, test.maxEntries
+		assert.Equal(t, test.want, fastListLimit(), fmt.Sprintf("%+v", test))
+		assert.Equal(t, test.want, newListRStream(&aboutFs{features: &Features{}}, "", false, -1, nil).maxEntries)
+	}
+}
+
+func TestWalkRDirTreeExcludeIfPresent(t *testing.T) {
+	oldFilter := Config.Filter
+	defer func() { Config.Filter = oldFilter }()
+	var err error
+	Config.Filter, err = NewFilter()
+	require.NoError(t, err)
+	Config.Filter.ExcludeFile = []string{".ignore"}
+
+	entries := DirEntries{
+		mockObject("a"),
+		mockObject("b/c"),
+		mockObject("b/.ignore"),
+		mockObject("b/d/e"),
+		mockObject("f/g"),
+	}
+	r, excluded, err := walkRDirTree(nil, "", false, -1, makeListRCallback(entries, nil))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]struct{}{"b": {}}, excluded)
+	assert.Equal(t, `/
+  a
+  b/
+  f/
+b/
+f/
+  g
+`, r.String())
+}
@@ -61,6 +61,7 @@ func Initialise() {
 	fs.Config.DumpBodies = *DumpBodies
 	fs.Config.LowLevelRetries = *LowLevelRetries
 	fs.Config.UseListR = *UseListR
+	fs.Config.AutoListR = false
 }
 
 // Item represents an item for checking
@@ -28,6 +28,8 @@ const (
 
 // Globals
 var (
+	// Root URL of the Hubic API
+	apiURL = "https://api.hubic.com/1.0"
 	// Description of how to auth for this app
 	oauthConfig = &oauth2.Config{
 		Scopes: []string{
@@ -73,6 +75,13 @@ type credentials struct {
 	Expires  string `json:"expires"`  // Expires date - eg "2015-11-09T14:24:56+01:00"
 }
 
+// usage is the JSON returned from the Hubic API to read the account
+// quota and usage
+type usage struct {
+	Quota int64 `json:"quota"` // Total quota in bytes
+	Used  int64 `json:"used"`  // Bytes used
+}
+
 // Fs represents a remote hubic
 type Fs struct {
 	fs.Fs                    // wrapped Fs
@@ -109,7 +118,7 @@ func (f *Fs) String() string {
 //
 // The credentials are read into the Fs
 func (f *Fs) getCredentials() (err error) {
-	req, err := http.NewRequest("GET", "https://api.hubic.com/1.0/account/credentials", nil)
+	req, err := http.NewRequest("GET", apiURL+"/account/credentials", nil)
 	if err != nil {
 		return err
 	}
@@ -141,6 +150,49 @@ func (f *Fs) getCredentials() (err error) {
 	return nil
 }
 
+// getUsage reads the account quota and usage using the Hubic API
+func (f *Fs) getUsage() (result *usage, err error) {
+	req, err := http.NewRequest("GET", apiURL+"/account/usage", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer fs.CheckClose(resp.Body, &err)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, errors.Errorf("failed to get usage: %s", resp.Status)
+	}
+	result = new(usage)
+	err = json.NewDecoder(resp.Body).Decode(result)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// About gets quota information
+//
+// The quota from the Hubic API is preferred, falling back to the
+// account information from the wrapped swift Fs if that fails.
+func (f *Fs) About() (*fs.Usage, error) {
+	result, err := f.getUsage()
+	if err == nil {
+		return &fs.Usage{
+			Total: fs.NewUsageValue(result.Quota),
+			Used:  fs.NewUsageValue(result.Used),
+			Free:  fs.NewUsageValue(result.Quota - result.Used),
+		}, nil
+	}
+	do := f.Fs.Features().About
+	if do == nil {
+		return nil, errors.Wrap(err, "failed to read usage")
+	}
+	fs.Debugf(f, "Failed to read usage from Hubic API - using swift account info: %v", err)
+	return do()
+}
+
 // NewFs constructs an Fs from the path, container:path
 func NewFs(name, root string) (fs.Fs, error) {
 	client, _, err := oauthutil.NewClient(name, oauthConfig)
@@ -188,4 +240,5 @@ func (f *Fs) UnWrap() fs.Fs {
 var (
 	_ fs.Fs        = (*Fs)(nil)
 	_ fs.UnWrapper = (*Fs)(nil)
+	_ fs.Abouter   = (*Fs)(nil)
 )
@@ -0,0 +1,83 @@
+package hubic
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/swift"
+	swiftLib "github.com/ncw/swift"
+	"github.com/ncw/swift/swifttest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestFs makes a hubic Fs wrapping a swift Fs connected to an in
+// memory swift server, with the Hubic API served by handler.
+func newTestFs(t *testing.T, handler http.HandlerFunc) (f *Fs, cleanup func()) {
+	fs.LoadConfig()
+	swiftSrv, err := swifttest.NewSwiftServer("localhost")
+	require.NoError(t, err)
+	apiSrv := httptest.NewServer(handler)
+	oldAPIURL := apiURL
+	apiURL = apiSrv.URL
+	cleanup = func() {
+		apiURL = oldAPIURL
+		apiSrv.Close()
+		swiftSrv.Close()
+	}
+
+	c := &swiftLib.Connection{
+		UserName: swifttest.TEST_ACCOUNT,
+		ApiKey:   swifttest.TEST_ACCOUNT,
+		AuthUrl:  swiftSrv.AuthURL,
+	}
+	require.NoError(t, c.Authenticate())
+	swiftFs, err := swift.NewFsWithConnection("TestHubic", "container", c, true)
+	require.NoError(t, err)
+
+	f = &Fs{
+		Fs:     swiftFs,
+		client: http.DefaultClient,
+	}
+	f.features = f.Fs.Features().Wrap(f)
+	return f, cleanup
+}
+
+func TestAboutHubicAPI(t *testing.T) {
+	f, cleanup := newTestFs(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/account/usage", r.URL.Path)
+		fmt.Fprint(w, `{"quota": 1000, "used": 300}`)
+	})
+	defer cleanup()
+
+	require.NotNil(t, f.Features().About)
+	usage, err := f.Features().About()
+	require.NoError(t, err)
+	require.NotNil(t, usage.Total)
+	require.NotNil(t, usage.Used)
+	require.NotNil(t, usage.Free)
+	assert.Equal(t, int64(1000), *usage.Total)
+	assert.Equal(t, int64(300), *usage.Used)
+	assert.Equal(t, int64(700), *usage.Free)
+}
+
+func TestAboutSwiftPassthrough(t *testing.T) {
+	f, cleanup := newTestFs(t, func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	})
+	defer cleanup()
+
+	// The wrapped swift Fs must advertise About too
+	require.NotNil(t, f.Fs.Features().About)
+	require.NotNil(t, f.Features().About)
+	usage, err := f.Features().About()
+	require.NoError(t, err)
+	require.NotNil(t, usage.Used)
+	require.NotNil(t, usage.Objects)
+	assert.Equal(t, int64(0), *usage.Used)
+	assert.Equal(t, int64(0), *usage.Objects)
+	assert.Nil(t, usage.Total)
+}
@@ -95,6 +95,8 @@ func NewFs(name, root string) (fs.Fs, error) {
 	f.features = (&fs.Features{
 		CaseInsensitive:         f.caseInsensitive(),
 		CanHaveEmptyDirectories: true,
+		SeekOpen:                true,
+		IsLocal:                 true,
 	}).Fill(f)
 	if *followSymlinks {
 		f.lstat = os.Stat
@@ -335,6 +337,29 @@ func (f *Fs) PutStream(in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption
 	return f.Put(in, src, options...)
 }
 
+// OpenWriterAt opens the file at remote for writing at any offset,
+// truncating it and preallocating size bytes
+func (f *Fs) OpenWriterAt(remote string, size int64) (fs.WriterAtCloser, error) {
+	// Temporary Object under construction
+	o := f.newObject(remote, "")
+	err := o.mkdirAll()
+	if err != nil {
+		return nil, err
+	}
+	out, err := os.OpenFile(o.path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return nil, err
+	}
+	if size > 0 {
+		err = out.Truncate(size)
+		if err != nil {
+			_ = out.Close()
+			return nil, errors.Wrap(err, "failed to preallocate")
+		}
+	}
+	return out, nil
+}
+
 // Mkdir creates the directory if it doesn't exist
 func (f *Fs) Mkdir(dir string) error {
 	// FIXME: https://github.com/syncthing/syncthing/blob/master/lib/osutil/mkdirall_windows.go
@@ -355,10 +380,37 @@ func (f *Fs) Mkdir(dir string) error {
 
 // Rmdir removes the directory
 //
-// If it isn't empty it will return an error
+// If it isn't empty it will return fs.ErrorDirectoryNotEmpty
 func (f *Fs) Rmdir(dir string) error {
 	root := f.cleanPath(filepath.Join(f.root, dir))
-	return os.Remove(root)
+	err := os.Remove(root)
+	if err != nil && !isEmptyDir(root) {
+		return fs.ErrorDirectoryNotEmpty
+	}
+	return err
+}
+
+// isEmptyDir returns false if path is a directory with something in
+// it, otherwise true
+func isEmptyDir(path string) bool {
+	fd, err := os.Open(path)
+	if err != nil {
+		return true
+	}
+	names, _ := fd.Readdirnames(1)
+	_ = fd.Close()
+	return len(names) == 0
+}
+
+// DirSetModTime sets the modification time of the directory
+func (f *Fs) DirSetModTime(dir string, modTime time.Time) error {
+	dir = f.dirNames.Load(dir)
+	fsDirPath := f.cleanPath(filepath.Join(f.root, dir))
+	err := os.Chtimes(fsDirPath, modTime, modTime)
+	if os.IsNotExist(err) {
+		return fs.ErrorDirNotFound
+	}
+	return err
 }
 
 // Precision of the file system
@@ -569,13 +621,18 @@ func (o *Object) Hash(r fs.HashType) (string, error) {
 		o.hashes = nil
 	}
 
-	if o.hashes == nil {
-		o.hashes = make(map[fs.HashType]string)
+	if _, found := o.hashes[r]; !found && fs.SupportedHashes.Contains(r) {
+		// Calculate the default hashes together, and any others
+		// only when asked for
+		hashes := fs.DefaultHashes
+		if o.hashes != nil || !hashes.Contains(r) {
+			hashes = fs.NewHashSet(r)
+		}
 		in, err := os.Open(o.path)
 		if err != nil {
 			return "", errors.Wrap(err, "hash: failed to open")
 		}
-		o.hashes, err = fs.HashStream(in)
+		sums, err := fs.HashStreamTypes(in, hashes)
 		closeErr := in.Close()
 		if err != nil {
 			return "", errors.Wrap(err, "hash: failed to read")
@@ -583,6 +640,12 @@ func (o *Object) Hash(r fs.HashType) (string, error) {
 		if closeErr != nil {
 			return "", errors.Wrap(closeErr, "hash: failed to close")
 		}
+		if o.hashes == nil {
+			o.hashes = make(map[fs.HashType]string)
+		}
+		for t, sum := range sums {
+			o.hashes[t] = sum
+		}
 	}
 	return o.hashes[r], nil
 }
@@ -669,7 +732,7 @@ func (file *localOpenFile) Close() (err error) {
 // Open an object for read
 func (o *Object) Open(options ...fs.OpenOption) (in io.ReadCloser, err error) {
 	var offset int64
-	hashes := fs.SupportedHashes
+	hashes := fs.DefaultHashes
 	for _, option := range options {
 		switch x := option.(type) {
 		case *fs.SeekOption:
@@ -714,7 +777,7 @@ func (o *Object) mkdirAll() error {
 
 // Update the object from in with modTime and size
 func (o *Object) Update(in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) error {
-	hashes := fs.SupportedHashes
+	hashes := fs.DefaultHashes
 	for _, option := range options {
 		switch x := option.(type) {
 		case *fs.HashesOption:
@@ -909,10 +972,12 @@ func cleanWindowsName(f *Fs, name string) string {
 
 // Check the interfaces are satisfied
 var (
-	_ fs.Fs          = &Fs{}
-	_ fs.Purger      = &Fs{}
-	_ fs.PutStreamer = &Fs{}
-	_ fs.Mover       = &Fs{}
-	_ fs.DirMover    = &Fs{}
-	_ fs.Object      = &Object{}
+	_ fs.Fs             = &Fs{}
+	_ fs.Purger         = &Fs{}
+	_ fs.PutStreamer    = &Fs{}
+	_ fs.Mover          = &Fs{}
+	_ fs.DirMover       = &Fs{}
+	_ fs.OpenWriterAter = &Fs{}
+	_ fs.DirSetModTimer = &Fs{}
+	_ fs.Object         = &Object{}
 )
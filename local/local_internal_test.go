@@ -1,9 +1,14 @@
 package local
 
 import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
 
+	"github.com/ncw/rclone/fs"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestMapper(t *testing.T) {
@@ -18,3 +23,47 @@ func TestMapper(t *testing.T) {
 	assert.Equal(t, "potato", m.Load("potato"))
 	assert.Equal(t, "-r?'a´o¨", m.Load("-r'áö"))
 }
+
+func TestHashOnlyWhenAsked(t *testing.T) {
+	fs.LoadConfig()
+	dir, err := ioutil.TempDir("", "rclone-local-test")
+	require.NoError(t, err)
+	defer func() { _ = os.RemoveAll(dir) }()
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "file"), []byte("hello"), 0600))
+	f, err := NewFs("local", dir)
+	require.NoError(t, err)
+	assert.True(t, f.Hashes().Contains(fs.HashSHA256))
+	obj, err := f.NewObject("file")
+	require.NoError(t, err)
+	o := obj.(*Object)
+
+	// The default hashes are calculated together
+	sum, err := o.Hash(fs.HashMD5)
+	require.NoError(t, err)
+	assert.Equal(t, "5d41402abc4b2a76b9719d911017c592", sum)
+	assert.Len(t, o.hashes, fs.DefaultHashes.Count())
+
+	// SHA-256 is only calculated when asked for
+	sum, err = o.Hash(fs.HashSHA256)
+	require.NoError(t, err)
+	assert.Equal(t, "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824", sum)
+	assert.Len(t, o.hashes, fs.DefaultHashes.Count()+1)
+}
+
+func TestRmdirNotEmpty(t *testing.T) {
+	fs.LoadConfig()
+	dir, err := ioutil.TempDir("", "rclone-local-test")
+	require.NoError(t, err)
+	defer func() { _ = os.RemoveAll(dir) }()
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "sub"), 0700))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "sub", "file"), []byte("hello"), 0600))
+	f, err := NewFs("local", dir)
+	require.NoError(t, err)
+
+	assert.Equal(t, fs.ErrorDirectoryNotEmpty, f.Rmdir("sub"))
+	err = f.Rmdir("missing")
+	require.Error(t, err)
+	assert.NotEqual(t, fs.ErrorDirectoryNotEmpty, err)
+	require.NoError(t, os.Remove(filepath.Join(dir, "sub", "file")))
+	assert.NoError(t, f.Rmdir("sub"))
+}
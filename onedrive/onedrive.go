@@ -371,6 +371,7 @@ func NewFs(name, root string) (fs.Fs, error) {
 		// so we disable it until resolved
 		// https://github.com/OneDrive/onedrive-api-docs/issues/643
 		ReadMimeType:            !f.isBusiness,
+		ListMimeType:            !f.isBusiness,
 		CanHaveEmptyDirectories: true,
 	}).Fill(f)
 	f.srv.SetErrorHandler(errorHandler)
@@ -911,6 +912,32 @@ func (f *Fs) DirCacheFlush() {
 	f.dirCache.ResetRoot()
 }
 
+// About gets quota information
+func (f *Fs) About() (*fs.Usage, error) {
+	var drive api.Drive
+	opts := rest.Opts{
+		Method: "GET",
+		Path:   "",
+	}
+	var resp *http.Response
+	var err error
+	err = f.pacer.Call(func() (bool, error) {
+		resp, err = f.srv.CallJSON(&opts, nil, &drive)
+		return shouldRetry(resp, err)
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "about failed")
+	}
+	q := drive.Quota
+	usage := &fs.Usage{
+		Total:   fs.NewUsageValue(int64(q.Total)),     // quota of bytes that can be used
+		Used:    fs.NewUsageValue(int64(q.Used)),      // bytes in use
+		Trashed: fs.NewUsageValue(int64(q.Deleted)),   // bytes in trash
+		Free:    fs.NewUsageValue(int64(q.Remaining)), // bytes which can be uploaded before reaching the quota
+	}
+	return usage, nil
+}
+
 // Hashes returns the supported hash sets.
 func (f *Fs) Hashes() fs.HashSet {
 	return fs.HashSet(fs.HashSHA1)
@@ -1236,6 +1263,7 @@ var (
 	_ fs.Mover  = (*Fs)(nil)
 	// _ fs.DirMover = (*Fs)(nil)
 	_ fs.DirCacheFlusher = (*Fs)(nil)
+	_ fs.Abouter         = (*Fs)(nil)
 	_ fs.Object          = (*Object)(nil)
 	_ fs.MimeTyper       = &Object{}
 )
@@ -247,6 +247,7 @@ func NewFs(name, root string) (fs.Fs, error) {
 		ReadMimeType:  true,
 		WriteMimeType: true,
 		BucketBased:   true,
+		SeekOpen:      true,
 	}).Fill(f)
 
 	if f.root != "" {
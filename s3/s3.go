@@ -396,23 +396,19 @@ func NewFs(name, root string) (fs.Fs, error) {
 		c:                  c,
 		bucket:             bucket,
 		ses:                ses,
-		acl:                fs.ConfigFileGet(name, "acl"),
 		root:               directory,
 		locationConstraint: fs.ConfigFileGet(name, "location_constraint"),
 		sse:                fs.ConfigFileGet(name, "server_side_encryption"),
-		storageClass:       fs.ConfigFileGet(name, "storage_class"),
 	}
 	f.features = (&fs.Features{
-		ReadMimeType:  true,
-		WriteMimeType: true,
-		BucketBased:   true,
+		ReadMimeType:     true,
+		WriteMimeType:    true,
+		BucketBased:      true,
+		SeekOpen:         true,
+		ListRByDirectory: true,
 	}).Fill(f)
-	if *s3ACL != "" {
-		f.acl = *s3ACL
-	}
-	if *s3StorageClass != "" {
-		f.storageClass = *s3StorageClass
-	}
+	f.acl, _ = fs.ConfigFileGetFlag(name, "acl", "s3-acl")
+	f.storageClass, _ = fs.ConfigFileGetFlag(name, "storage_class", "s3-storage-class")
 	if f.root != "" {
 		f.root += "/"
 		// Check to see if the object exists
@@ -745,6 +741,9 @@ func (f *Fs) Rmdir(dir string) error {
 
 // Precision of the remote
 func (f *Fs) Precision() time.Duration {
+	if fs.Config.UseServerModTime {
+		return time.Second
+	}
 	return time.Nanosecond
 }
 
@@ -873,7 +872,13 @@ func (o *Object) readMetaData() (err error) {
 //
 // It attempts to read the objects mtime and if that isn't present the
 // LastModified returned in the http headers
+//
+// If --use-server-modtime is set then it returns the LastModified
+// from the listing without reading the metadata.
 func (o *Object) ModTime() time.Time {
+	if fs.Config.UseServerModTime && !o.lastModified.IsZero() {
+		return o.lastModified
+	}
 	err := o.readMetaData()
 	if err != nil {
 		fs.Logf(o, "Failed to read metadata: %v", err)
@@ -894,7 +899,14 @@ func (o *Object) ModTime() time.Time {
 }
 
 // SetModTime sets the modification time of the local fs object
+//
+// If --use-server-modtime is set it does nothing as the time set
+// wouldn't be read back.
 func (o *Object) SetModTime(modTime time.Time) error {
+	if fs.Config.UseServerModTime {
+		fs.Debugf(o, "Not setting modification time as --use-server-modtime is set")
+		return nil
+	}
 	err := o.readMetaData()
 	if err != nil {
 		return err
@@ -292,6 +292,7 @@ func NewFs(name, root string) (fs.Fs, error) {
 	}
 	f.features = (&fs.Features{
 		CanHaveEmptyDirectories: true,
+		SeekOpen:                true,
 	}).Fill(f)
 	// Make a connection and pool it to return errors early
 	c, err := f.getSftpConnection()
@@ -510,6 +511,27 @@ func (f *Fs) Rmdir(dir string) error {
 	return err
 }
 
+// DirSetModTime sets the modification and access time of the directory
+func (f *Fs) DirSetModTime(dir string, modTime time.Time) error {
+	root := path.Join(f.root, dir)
+	if root == "" {
+		root = "."
+	}
+	c, err := f.getSftpConnection()
+	if err != nil {
+		return errors.Wrap(err, "DirSetModTime")
+	}
+	err = c.sftpClient.Chtimes(root, modTime, modTime)
+	f.putSftpConnection(&c, err)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fs.ErrorDirNotFound
+		}
+		return errors.Wrap(err, "DirSetModTime failed")
+	}
+	return nil
+}
+
 // Move renames a remote sftp file object
 func (f *Fs) Move(src fs.Object, remote string) (fs.Object, error) {
 	srcObj, ok := src.(*Object)
@@ -889,9 +911,10 @@ func (o *Object) Remove() error {
 
 // Check the interfaces are satisfied
 var (
-	_ fs.Fs          = &Fs{}
-	_ fs.PutStreamer = &Fs{}
-	_ fs.Mover       = &Fs{}
-	_ fs.DirMover    = &Fs{}
-	_ fs.Object      = &Object{}
+	_ fs.Fs             = &Fs{}
+	_ fs.PutStreamer    = &Fs{}
+	_ fs.Mover          = &Fs{}
+	_ fs.DirMover       = &Fs{}
+	_ fs.DirSetModTimer = &Fs{}
+	_ fs.Object         = &Object{}
 )
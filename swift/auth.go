@@ -1,10 +1,15 @@
 package swift
 
-import "github.com/ncw/swift"
+import (
+	"sync"
+
+	"github.com/ncw/swift"
+)
 
 // auth is an authenticator for swift
 type auth struct {
 	swift.Authenticator
+	mu         sync.Mutex
 	storageURL string
 }
 
@@ -17,14 +22,44 @@ func newAuth(Authenticator swift.Authenticator, storageURL string) *auth {
 	}
 }
 
+// setStorageURL sets the storage URL returned after the next
+// authentication
+func (a *auth) setStorageURL(storageURL string) {
+	a.mu.Lock()
+	a.storageURL = storageURL
+	a.mu.Unlock()
+}
+
+// getStorageURL returns the overridden storage URL or ""
+func (a *auth) getStorageURL() string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.storageURL
+}
+
 // The public storage URL - set Internal to true to read
 // internal/service net URL
 func (a *auth) StorageUrl(Internal bool) string {
-	if a.storageURL != "" {
-		return a.storageURL
+	if storageURL := a.getStorageURL(); storageURL != "" {
+		return storageURL
 	}
 	return a.Authenticator.StorageUrl(Internal)
 }
 
+// StorageUrlForEndpoint returns the storage URL for the endpoint type
+// if it isn't overridden
+func (a *auth) StorageUrlForEndpoint(endpointType swift.EndpointType) string {
+	if storageURL := a.getStorageURL(); storageURL != "" {
+		return storageURL
+	}
+	if customAuth, ok := a.Authenticator.(swift.CustomEndpointAuthenticator); ok {
+		return customAuth.StorageUrlForEndpoint(endpointType)
+	}
+	return a.Authenticator.StorageUrl(endpointType == swift.EndpointTypeInternal)
+}
+
 // Check the interfaces are satisfied
-var _ swift.Authenticator = (*auth)(nil)
+var (
+	_ swift.Authenticator               = (*auth)(nil)
+	_ swift.CustomEndpointAuthenticator = (*auth)(nil)
+)
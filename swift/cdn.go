@@ -0,0 +1,248 @@
+// Rackspace CDN and temp URLs for public links and downloads
+
+package swift
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/ncw/swift"
+	"github.com/pkg/errors"
+)
+
+const (
+	cdnEnabledHeader        = "X-Cdn-Enabled"
+	cdnURIHeader            = "X-Cdn-Uri"
+	cdnSSLURIHeader         = "X-Cdn-Ssl-Uri"
+	cdnTTLHeader            = "X-Ttl"
+	accountTempURLKeyHeader = "X-Account-Meta-Temp-Url-Key"
+	defaultTempURLExpiry    = time.Hour
+	tempURLDownloadExpiry   = 10 * time.Minute // downloads use the temp URL straight away
+)
+
+// cdnManagementURL returns the URL of the CDN management endpoint
+// or "" if there isn't one
+//
+// Rackspace returns this from the auth - other swift providers don't
+// have it.
+func (f *Fs) cdnManagementURL() string {
+	if f.cdnURL != "" {
+		return f.cdnURL
+	}
+	if f.c.Auth == nil {
+		return ""
+	}
+	return f.c.Auth.CdnUrl()
+}
+
+// cdnCall runs a request for the container on the CDN management
+// endpoint, returning the response headers
+func (f *Fs) cdnCall(operation string, headers swift.Headers) (swift.Headers, error) {
+	cdnURL := f.cdnManagementURL()
+	if cdnURL == "" {
+		return nil, errors.New("no CDN management URL - CDN is only available on Rackspace Cloud Files")
+	}
+	var respHeaders swift.Headers
+	err := f.pacer.Call(func() (bool, error) {
+		var err error
+		_, respHeaders, err = f.c.Call(cdnURL, swift.RequestOpts{
+			Container:  f.container,
+			Operation:  operation,
+			ErrorMap:   swift.ContainerErrorMap,
+			NoResponse: true,
+			Headers:    headers,
+			OnReAuth: func() (string, error) {
+				return f.cdnManagementURL(), nil
+			},
+		})
+		return shouldRetry(err)
+	})
+	return respHeaders, err
+}
+
+// containerCDN returns the CDN URIs of the container or "" if it
+// isn't CDN enabled
+func (f *Fs) containerCDN() (uri, sslURI string, err error) {
+	headers, err := f.cdnCall("HEAD", nil)
+	if errors.Cause(err) == swift.ContainerNotFound {
+		// Containers which have never been CDN enabled
+		return "", "", nil
+	}
+	if err != nil {
+		return "", "", errors.Wrapf(err, "failed to read CDN settings of container %q", f.container)
+	}
+	if !strings.EqualFold(headers[cdnEnabledHeader], "true") {
+		return "", "", nil
+	}
+	return headers[cdnURIHeader], headers[cdnSSLURIHeader], nil
+}
+
+// SetCDN enables or disables CDN access to the container
+//
+// If enabling, ttl is how long the CDN caches objects for, or 0 to
+// use the default of 72 hours.
+func (f *Fs) SetCDN(enabled bool, ttl time.Duration) error {
+	if f.container == "" {
+		return errors.New("container name needed in remote")
+	}
+	headers := swift.Headers{cdnEnabledHeader: strconv.FormatBool(enabled)}
+	if enabled && ttl > 0 {
+		headers[cdnTTLHeader] = strconv.FormatInt(int64(ttl/time.Second), 10)
+	}
+	_, err := f.cdnCall("PUT", headers)
+	if err != nil {
+		return errors.Wrapf(err, "failed to set CDN settings of container %q", f.container)
+	}
+	return nil
+}
+
+// readTempURLKey returns the key to sign temp URLs with - the
+// temp_url_key from the config or the account's key if not set
+//
+// It returns "" if there isn't one.
+func (f *Fs) readTempURLKey() string {
+	f.tempURLKeyOnce.Do(func() {
+		if f.tempURLKey != "" {
+			return
+		}
+		var headers swift.Headers
+		err := f.pacer.Call(func() (bool, error) {
+			var err error
+			_, headers, err = f.c.Account()
+			return f.shouldRetry(err)
+		})
+		if err != nil {
+			fs.Debugf(f, "Failed to read the temp URL key from the account: %v", err)
+			return
+		}
+		f.tempURLKey = headers[accountTempURLKeyHeader]
+	})
+	return f.tempURLKey
+}
+
+// tempURL returns a URL for method on the object name in container
+// which is valid until expires, signed with key
+func (f *Fs) tempURL(method, container, name, key string, expires time.Time) (string, error) {
+	storageURL, err := url.Parse(f.c.StorageUrl)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to parse storage URL")
+	}
+	mac := hmac.New(sha1.New, []byte(key))
+	_, _ = fmt.Fprintf(mac, "%s\n%d\n%s/%s/%s", method, expires.Unix(), storageURL.Path, container, name)
+	return fmt.Sprintf("%s/%s?temp_url_sig=%s&temp_url_expires=%d", f.c.StorageUrl, urlEncode(container+"/"+name), hex.EncodeToString(mac.Sum(nil)), expires.Unix()), nil
+}
+
+// PublicLink returns a link to the object at remote which can be
+// read without authenticating
+//
+// If the container is CDN enabled this is the CDN link, preferring
+// https, otherwise it is a temp URL valid for temp_url_expiry.
+func (f *Fs) PublicLink(remote string) (string, error) {
+	return f.PublicLinkExpire(remote, 0)
+}
+
+// PublicLinkExpire returns a link to the object at remote like
+// PublicLink, but if expire is non zero it is a temp URL valid for
+// expire, as CDN links can't be made to expire
+func (f *Fs) PublicLinkExpire(remote string, expire time.Duration) (string, error) {
+	o, err := f.NewObject(remote)
+	if err == fs.ErrorObjectNotFound && f.isDirectory(remote) {
+		return "", errors.Errorf("can't make a link to %q: links can only be made to objects, not directories", remote)
+	}
+	if err != nil {
+		return "", err
+	}
+	name := o.(*Object).name()
+	if expire == 0 && f.cdnManagementURL() != "" {
+		uri, sslURI, err := f.containerCDN()
+		if err != nil {
+			return "", err
+		}
+		if sslURI != "" {
+			uri = sslURI
+		}
+		if uri != "" {
+			return strings.TrimRight(uri, "/") + "/" + urlEncode(name), nil
+		}
+	}
+	key := f.readTempURLKey()
+	if key == "" {
+		if expire != 0 {
+			return "", errors.Errorf("can't make a link to %q which expires: there is no temp URL key - set temp_url_key in the config or %s on the account", remote, accountTempURLKeyHeader)
+		}
+		return "", errors.Errorf("can't make a link to %q: container %q isn't CDN enabled and there is no temp URL key - set temp_url_key in the config or %s on the account", remote, f.container, accountTempURLKeyHeader)
+	}
+	if expire == 0 {
+		expire = f.tempURLExpiry
+	}
+	return f.tempURL("GET", f.container, name, key, time.Now().Add(expire))
+}
+
+// isDirectory returns true if there are any objects under remote/
+func (f *Fs) isDirectory(remote string) bool {
+	if f.container == "" {
+		return false
+	}
+	found := false
+	errFound := errors.New("found")
+	err := f.listContainerRoot(f.container, f.root, remote, false, func(string, *swift.Object, bool) error {
+		found = true
+		return errFound
+	})
+	return found && (err == nil || errors.Cause(err) == errFound)
+}
+
+// openTempURL opens the object name in container with a GET of a
+// temp URL rather than an authenticated request, sending headers
+//
+// Errors are returned as the swift library returns them.  If
+// checkHash is set the MD5SUM and size of the data are checked
+// against the response's when it has all been read.
+func (f *Fs) openTempURL(container, name string, headers swift.Headers, checkHash bool) (io.ReadCloser, error) {
+	link, err := f.tempURL("GET", container, name, f.tempURLKey, time.Now().Add(tempURLDownloadExpiry))
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest("GET", link, nil)
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	transport := f.c.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	resp, err := (&http.Client{Transport: transport}).Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		_, _ = io.Copy(ioutil.Discard, resp.Body)
+		_ = resp.Body.Close()
+		if resp.StatusCode == http.StatusNotFound {
+			return nil, swift.ObjectNotFound
+		}
+		return nil, &swift.Error{StatusCode: resp.StatusCode, Text: resp.Status}
+	}
+	if checkHash {
+		// Large objects have no MD5SUM to check, as in ObjectOpen
+		etag := resp.Header.Get("Etag")
+		if resp.Header.Get("X-Object-Manifest") != "" || resp.Header.Get("X-Static-Large-Object") != "" {
+			etag = ""
+		}
+		return newHashCheckReader(resp.Body, etag, resp.ContentLength), nil
+	}
+	return resp.Body, nil
+}
@@ -0,0 +1,73 @@
+// Cache of containers known to exist
+
+package swift
+
+import (
+	"sync"
+	"time"
+)
+
+// containerCacheTTL is how long a container is remembered as existing
+var containerCacheTTL = 5 * time.Minute
+
+// containers remembers which containers exist for all the Fs in this
+// process so they don't all need to check
+var containers = newContainerCache()
+
+// containerEntry is the state of a single container
+type containerEntry struct {
+	mu      sync.Mutex // held while checking or creating the container
+	checked time.Time  // when the container was last known to exist
+}
+
+// containerCache remembers which containers exist, keyed by storage
+// URL and container name
+type containerCache struct {
+	mu      sync.Mutex
+	entries map[string]*containerEntry
+}
+
+// newContainerCache makes an empty containerCache
+func newContainerCache() *containerCache {
+	return &containerCache{
+		entries: make(map[string]*containerEntry),
+	}
+}
+
+// ensure calls create if the container at key isn't known to exist,
+// remembering that it exists if create returns nil.  Calls for the
+// same key are serialised so only one of them calls create.
+func (c *containerCache) ensure(key string, create func() error) error {
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	if !ok {
+		entry = &containerEntry{}
+		c.entries[key] = entry
+	}
+	c.mu.Unlock()
+
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+	if !entry.checked.IsZero() && time.Since(entry.checked) < containerCacheTTL {
+		return nil
+	}
+	err := create()
+	if err == nil {
+		entry.checked = time.Now()
+	}
+	return err
+}
+
+// forget removes the container at key from the cache, eg after it has
+// been deleted
+func (c *containerCache) forget(key string) {
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	c.mu.Unlock()
+	if !ok {
+		return
+	}
+	entry.mu.Lock()
+	entry.checked = time.Time{}
+	entry.mu.Unlock()
+}
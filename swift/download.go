@@ -0,0 +1,188 @@
+// Multi connection downloads of dynamic large objects
+
+package swift
+
+import (
+	"io"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/ncw/swift"
+	"github.com/pkg/errors"
+)
+
+const (
+	segmentBufferSize     = 1024 * 1024 // size of the buffers segments are read into
+	segmentBuffersMax     = 4           // number of buffers read ahead per segment
+	defaultDownloadCutoff = fs.SizeSuffix(1024 * 1024 * 1024)
+)
+
+// openSegments opens a dynamic large object by downloading its
+// segments download_concurrency at a time.
+//
+// It returns nil if the segments can't be used, eg if the segments
+// don't add up to the size of the object, in which case the object
+// should be downloaded normally.
+func (o *Object) openSegments() (io.ReadCloser, error) {
+	isDynamicLargeObject, err := o.isDynamicLargeObject()
+	if err != nil || !isDynamicLargeObject {
+		return nil, err
+	}
+	manifest, err := url.PathUnescape((*o.headers)["X-Object-Manifest"])
+	if err != nil {
+		fs.Debugf(o, "Can't download segments concurrently: bad manifest: %v", err)
+		return nil, nil
+	}
+	i := strings.Index(manifest, "/")
+	if i < 0 {
+		fs.Debugf(o, "Can't download segments concurrently: bad manifest %q", manifest)
+		return nil, nil
+	}
+	container, prefix := manifest[:i], manifest[i+1:]
+	var segments []swift.Object
+	var total int64
+	err = o.fs.listContainerRoot(container, prefix, "", true, func(remote string, object *swift.Object, isDirectory bool) error {
+		segments = append(segments, *object)
+		total += object.Bytes
+		return nil
+	})
+	if err != nil {
+		fs.Debugf(o, "Can't download segments concurrently: failed to list segments: %v", err)
+		return nil, nil
+	}
+	if total != o.Size() {
+		fs.Debugf(o, "Can't download segments concurrently: segments total %d bytes but object is %d bytes", total, o.Size())
+		return nil, nil
+	}
+	fs.Debugf(o, "Downloading %d segments %d at a time", len(segments), o.fs.downloadConcurrency)
+	return &segmentsReader{
+		o:         o,
+		container: container,
+		segments:  segments,
+		size:      total,
+		done:      make(chan struct{}),
+	}, nil
+}
+
+// segmentDownload is a segment being downloaded in the background
+type segmentDownload struct {
+	chunks chan []byte // chunks of data read in order, closed at the end
+	err    error       // the error, valid once chunks is closed
+}
+
+// segmentsReader reads the segments of a dynamic large object in
+// order, downloading several of them at once
+type segmentsReader struct {
+	o         *Object
+	container string             // container the segments are in
+	segments  []swift.Object     // the segments in order
+	size      int64              // expected total size
+	read      int64              // bytes read so far
+	next      int                // index of the next segment to start
+	queue     []*segmentDownload // downloads in progress in order
+	cur       []byte             // unread part of the current chunk
+	done      chan struct{}      // closed to stop the downloads
+	wg        sync.WaitGroup     // counts the downloads in progress
+	closeOnce sync.Once
+}
+
+// start downloads until download_concurrency are running
+func (r *segmentsReader) start() {
+	for len(r.queue) < r.o.fs.downloadConcurrency && r.next < len(r.segments) {
+		d := &segmentDownload{
+			chunks: make(chan []byte, segmentBuffersMax),
+		}
+		r.queue = append(r.queue, d)
+		r.wg.Add(1)
+		go r.download(d, r.segments[r.next].Name)
+		r.next++
+	}
+}
+
+// download the segment name into d
+func (r *segmentsReader) download(d *segmentDownload, name string) {
+	defer r.wg.Done()
+	defer close(d.chunks)
+	// Check the MD5SUM of each segment as we go
+	var in io.ReadCloser
+	err := r.o.fs.pacer.Call(func() (bool, error) {
+		var err error
+		headers := swift.Headers{"Accept-Encoding": "identity"}
+		if r.o.fs.downloadTempURL {
+			in, err = r.o.fs.openTempURL(r.container, name, headers, true)
+		} else {
+			var objectFile *swift.ObjectOpenFile
+			objectFile, _, err = r.o.fs.c.ObjectOpen(r.container, name, true, headers)
+			if err == nil {
+				in = objectFile
+			}
+		}
+		return r.o.fs.shouldRetry(err)
+	})
+	if err != nil {
+		d.err = errors.Wrapf(err, "failed to open segment %q", name)
+		return
+	}
+	for {
+		buf := make([]byte, segmentBufferSize)
+		n, err := io.ReadFull(in, buf)
+		if n > 0 {
+			select {
+			case d.chunks <- buf[:n]:
+			case <-r.done:
+				_ = in.Close()
+				return
+			}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			_ = in.Close()
+			d.err = errors.Wrapf(err, "failed to read segment %q", name)
+			return
+		}
+	}
+	err = in.Close()
+	if err != nil {
+		d.err = fs.RetryError(errors.Wrapf(err, "failed to check segment %q", name))
+	}
+}
+
+// Read the segments in order
+func (r *segmentsReader) Read(p []byte) (n int, err error) {
+	for len(r.cur) == 0 {
+		r.start()
+		if len(r.queue) == 0 {
+			if r.read != r.size {
+				return 0, fs.RetryErrorf("corrupted on transfer: sizes differ %d vs %d", r.size, r.read)
+			}
+			return 0, io.EOF
+		}
+		d := r.queue[0]
+		chunk, ok := <-d.chunks
+		if !ok {
+			if d.err != nil {
+				return 0, d.err
+			}
+			r.queue = r.queue[1:]
+			continue
+		}
+		r.cur = chunk
+	}
+	n = copy(p, r.cur)
+	r.cur = r.cur[n:]
+	r.read += int64(n)
+	return n, nil
+}
+
+// Close stops any downloads in progress
+func (r *segmentsReader) Close() error {
+	r.closeOnce.Do(func() {
+		close(r.done)
+		r.wg.Wait()
+	})
+	return nil
+}
@@ -0,0 +1,43 @@
+// Discover the capabilities of the swift cluster from /info
+
+package swift
+
+import (
+	"github.com/ncw/rclone/fs"
+	"github.com/ncw/swift"
+)
+
+// defaultMaxFileSize is the largest object swift accepts in a single
+// PUT unless /info says otherwise
+const defaultMaxFileSize = 5 * 1024 * 1024 * 1024
+
+// info returns the capabilities of the cluster, reading them once
+// for each Fs
+//
+// It returns nil if they couldn't be read - not all clusters support
+// /info.
+func (f *Fs) info() swift.SwiftInfo {
+	f.swiftInfoOnce.Do(func() {
+		err := f.pacer.Call(func() (bool, error) {
+			var err error
+			f.swiftInfo, err = f.c.QueryInfo()
+			return f.shouldRetry(err)
+		})
+		if err != nil {
+			fs.Debugf(f, "Failed to read /info - using defaults: %v", err)
+			f.swiftInfo = nil
+		}
+	})
+	return f.swiftInfo
+}
+
+// maxFileSize returns the largest object the cluster accepts in a
+// single PUT
+func (f *Fs) maxFileSize() int64 {
+	if swiftInfo, ok := f.info()["swift"].(map[string]interface{}); ok {
+		if maxFileSize, ok := swiftInfo["max_file_size"].(float64); ok && maxFileSize > 0 {
+			return int64(maxFileSize)
+		}
+	}
+	return defaultMaxFileSize
+}
@@ -0,0 +1,223 @@
+// Recognise the directory markers and placeholders other tools make
+
+package swift
+
+import (
+	"bytes"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/ncw/swift"
+	"github.com/pkg/errors"
+)
+
+// parseList parses a comma separated list into a set, dropping empty
+// items, lower casing them if lower is set
+func parseList(in string, lower bool) map[string]bool {
+	set := map[string]bool{}
+	for _, item := range strings.Split(in, ",") {
+		item = strings.TrimSpace(item)
+		if lower {
+			item = strings.ToLower(item)
+		}
+		if item != "" {
+			set[item] = true
+		}
+	}
+	return set
+}
+
+// isMarkerContentType returns true if contentType marks directories,
+// that is it is application/directory or in
+// directory_marker_content_types
+func (f *Fs) isMarkerContentType(contentType string) bool {
+	if contentType == directoryMarkerContentType {
+		return true
+	}
+	return f.markerContentTypes[strings.ToLower(contentType)]
+}
+
+// isDirectoryMarker returns true if object is a directory marker,
+// that is an object whose name ends in / which has a directory
+// content type, or is empty if empty_directory_markers is set.
+//
+// Other objects whose names end in / are not directory markers and
+// are listed as objects.
+func (f *Fs) isDirectoryMarker(object *swift.Object) bool {
+	return strings.HasSuffix(object.Name, "/") && (f.isMarkerContentType(object.ContentType) || (f.emptyDirMarkers && object.Bytes == 0))
+}
+
+// isPlaceholder returns true if object is an empty file named in
+// directory_marker_names, eg .keep, which is only there to make its
+// directory exist
+func (f *Fs) isPlaceholder(object *swift.Object) bool {
+	return object.Bytes == 0 && f.markerNames[path.Base(object.Name)]
+}
+
+// markerName returns the name of the directory marker object for dir
+// or "" if dir is the container
+func (f *Fs) markerName(dir string) string {
+	if dir == "" {
+		return f.root
+	}
+	return f.objectName(dir) + "/"
+}
+
+// markerDir is a directory whose modification time can be read from
+// the mtime metadata of its directory marker with ReadModTime.  This
+// needs a HEAD so ModTime doesn't do it and listings don't need any
+// extra transactions.
+type markerDir struct {
+	*fs.Dir
+	f       *Fs
+	once    sync.Once
+	modTime time.Time
+}
+
+// newDir makes a directory entry for remote with size bytes
+//
+// Unless use_server_modtime is set, its modification time is read
+// from its directory marker.
+func (f *Fs) newDir(remote string, size int64) fs.Directory {
+	d := fs.NewDir(remote, time.Time{}).SetSize(size)
+	if f.useServerModTime {
+		return d
+	}
+	return &markerDir{Dir: d, f: f}
+}
+
+// Check the interfaces are satisfied
+var _ fs.DirModTimeReader = &markerDir{}
+
+// ReadModTime returns the mtime of the directory marker, or the time
+// now if it doesn't have one
+func (d *markerDir) ReadModTime() time.Time {
+	d.once.Do(func() {
+		var h swift.Headers
+		err := d.f.callObject(func() (err error) {
+			_, h, err = d.f.c.Object(d.f.container, d.f.markerName(d.Remote()))
+			return err
+		})
+		if err == swift.ObjectNotFound {
+			return
+		}
+		meta := h.ObjectMetadata()
+		if err == nil && meta["mtime"] != "" {
+			d.modTime, err = meta.GetModTime()
+		}
+		if err != nil {
+			fs.Debugf(d, "Failed to read directory modification time: %v", err)
+		}
+	})
+	if d.modTime.IsZero() {
+		return d.Dir.ModTime()
+	}
+	return d.modTime
+}
+
+// objectNames returns the names of up to limit objects whose names
+// start with prefix
+func (f *Fs) objectNames(prefix string, limit int) (names []string, err error) {
+	err = f.pacer.Call(func() (bool, error) {
+		names, err = f.c.ObjectNames(f.container, &swift.ObjectsOpts{Prefix: prefix, Limit: limit})
+		return f.shouldRetry(err)
+	})
+	return names, err
+}
+
+// DirSetModTime sets the modification time of the directory by
+// storing it in the mtime metadata of its directory marker, making
+// the marker if the directory doesn't have one.
+//
+// The modification time of the container can't be set.
+func (f *Fs) DirSetModTime(dir string, modTime time.Time) error {
+	name := f.markerName(dir)
+	if f.container == "" || name == "" {
+		fs.Debugf(f, "Can't set the modification time of a container")
+		return nil
+	}
+	var info swift.Object
+	var h swift.Headers
+	err := f.callObject(func() (err error) {
+		info, h, err = f.c.Object(f.container, name)
+		return err
+	})
+	switch {
+	case err == nil && f.isDirectoryMarker(&info):
+		meta := h.ObjectMetadata()
+		meta.SetModTime(modTime)
+		err = f.callObject(func() error {
+			return f.c.ObjectUpdate(f.container, name, meta.ObjectHeaders())
+		})
+	case err == nil:
+		return errors.Errorf("can't set the modification time of directory %q as %q isn't a directory marker", dir, name)
+	case err == swift.ObjectNotFound:
+		var names []string
+		names, err = f.objectNames(name, 1)
+		if err == swift.ContainerNotFound || (err == nil && len(names) == 0) {
+			return fs.ErrorDirNotFound
+		}
+		if err != nil {
+			break
+		}
+		headers := swift.Headers{mtimeHeader: swift.TimeToFloatString(modTime)}
+		err = f.callObject(func() error {
+			_, err := f.c.ObjectPut(f.container, name, bytes.NewReader(nil), true, "", directoryMarkerContentType, headers)
+			return err
+		})
+	}
+	if err != nil {
+		return objectError(errors.Wrapf(err, "failed to set modification time of directory %q in container %q", dir, f.container))
+	}
+	return nil
+}
+
+// makeMarker makes a directory marker for dir unless there are
+// already objects in it
+func (f *Fs) makeMarker(dir string) error {
+	name := f.markerName(dir)
+	names, err := f.objectNames(name, 1)
+	if err != nil {
+		return errors.Wrapf(err, "failed to list directory %q", dir)
+	}
+	if len(names) != 0 {
+		return nil
+	}
+	err = f.callObject(func() error {
+		_, err := f.c.ObjectPut(f.container, name, bytes.NewReader(nil), true, "", directoryMarkerContentType, nil)
+		return err
+	})
+	if err != nil {
+		return objectError(errors.Wrapf(err, "failed to make directory %q in container %q", dir, f.container))
+	}
+	return nil
+}
+
+// removeMarker removes the directory marker of dir if it is the only
+// object left in the directory
+func (f *Fs) removeMarker(dir string) error {
+	if f.container == "" {
+		return nil
+	}
+	name := f.markerName(dir)
+	names, err := f.objectNames(name, 2)
+	if err == swift.ContainerNotFound {
+		return nil
+	}
+	if err != nil {
+		return errors.Wrapf(err, "failed to list directory %q", dir)
+	}
+	if len(names) != 1 || names[0] != name {
+		return nil
+	}
+	err = f.callObject(func() error {
+		return f.c.ObjectDelete(f.container, name)
+	})
+	if err == swift.ObjectNotFound {
+		return nil
+	}
+	return err
+}
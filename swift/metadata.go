@@ -0,0 +1,102 @@
+// Read and write the attributes of objects as generic metadata
+
+package swift
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/ncw/swift"
+	"github.com/pkg/errors"
+)
+
+// objectMetaPrefix is the prefix of the headers of user metadata
+const objectMetaPrefix = "X-Object-Meta-"
+
+// Metadata returns the attributes of the object - its Content-Type,
+// Content-Disposition, Content-Encoding, expiry and user metadata
+// apart from the mtime
+//
+// See fs.Metadataer for the keys.
+func (o *Object) Metadata() (map[string]string, error) {
+	err := o.readMetaData()
+	if err != nil {
+		return nil, err
+	}
+	metadata := make(map[string]string)
+	for k, v := range *o.headers {
+		switch k = http.CanonicalHeaderKey(k); {
+		case k == "Content-Type" || k == "Content-Disposition" || k == "Content-Encoding":
+			metadata[strings.ToLower(k)] = v
+		case strings.HasPrefix(k, objectMetaPrefix) && k != mtimeHeader:
+			metadata["meta-"+strings.ToLower(k[len(objectMetaPrefix):])] = v
+		}
+	}
+	if expires := o.expires(); !expires.IsZero() {
+		metadata["delete-at"] = expires.UTC().Format(time.RFC3339)
+	}
+	return metadata, nil
+}
+
+// SetMetadata replaces the attributes of the object with metadata,
+// keeping its modification time
+//
+// See fs.Metadataer for the keys.
+func (o *Object) SetMetadata(metadata map[string]string) error {
+	err := o.readMetaData()
+	if err != nil {
+		return err
+	}
+	headers := o.fs.metadataHeaders(metadata)
+	if contentType := metadata["content-type"]; contentType != "" {
+		headers["Content-Type"] = contentType
+	}
+	// Keep the mtime and the non metadata X-Object- headers, eg
+	// the manifest of dynamic large objects
+	for k, v := range *o.headers {
+		if k = http.CanonicalHeaderKey(k); k == mtimeHeader || (strings.HasPrefix(k, "X-Object-") && !strings.HasPrefix(k, objectMetaPrefix)) {
+			headers[k] = v
+		}
+	}
+	err = o.fs.callObject(func() error {
+		return o.fs.c.ObjectUpdate(o.fs.container, o.name(), headers)
+	})
+	if err != nil {
+		return objectError(errors.Wrapf(err, "failed to update metadata of %q in container %q", o.name(), o.fs.container))
+	}
+	// Read the metadata again when next needed
+	o.headers = nil
+	return nil
+}
+
+// metadataHeaders returns the headers to upload an object with the
+// metadata read from fs.Metadataer
+//
+// The Content-Type is sent separately so isn't included, nor is the
+// mtime which rclone sets itself.  Expiry times which have passed
+// are left out as swift refuses them.
+func (f *Fs) metadataHeaders(metadata map[string]string) swift.Headers {
+	headers := make(swift.Headers, len(metadata))
+	for k, v := range metadata {
+		switch k = strings.ToLower(k); {
+		case k == "content-disposition" || k == "content-encoding":
+			headers[http.CanonicalHeaderKey(k)] = v
+		case k == "delete-at":
+			deleteAt, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				fs.Debugf(f, "Ignoring metadata %s %q: %v", k, v, err)
+			} else if deleteAt.After(time.Now()) {
+				headers["X-Delete-At"] = strconv.FormatInt(deleteAt.Unix(), 10)
+			}
+		case strings.HasPrefix(k, "meta-"):
+			name := http.CanonicalHeaderKey(objectMetaPrefix + k[len("meta-"):])
+			if name != objectMetaPrefix && name != mtimeHeader {
+				headers[name] = v
+			}
+		}
+	}
+	return headers
+}
@@ -0,0 +1,94 @@
+// Check uploads against the account quota
+
+package swift
+
+import (
+	"strconv"
+	"sync"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/pkg/errors"
+)
+
+// accountQuota caches the quota and usage of the account so uploads
+// can be checked against it without reading the account each time.
+//
+// Uploads reserve their size from the free space as they start so
+// concurrent uploads can't use the same free space twice.
+type accountQuota struct {
+	mu    sync.Mutex
+	read  bool  // set once the account has been read
+	quota int64 // quota in bytes or -1 if there isn't one
+	used  int64 // bytes used plus the bytes reserved since
+}
+
+// readAccountQuota reads the quota and usage of the account into q
+//
+// If they can't be read the uploads aren't checked - some users
+// aren't allowed to read the account.
+//
+// Call with q.mu held
+func (f *Fs) readAccountQuota(q *accountQuota) {
+	q.read = true
+	q.quota = -1
+	err := f.pacer.Call(func() (bool, error) {
+		info, headers, err := f.c.Account()
+		if err == nil {
+			q.used = info.BytesUsed
+			if quotaString, ok := headers[accountQuotaBytesHeader]; ok {
+				quota, parseErr := strconv.ParseInt(quotaString, 10, 64)
+				if parseErr != nil {
+					fs.Debugf(f, "Failed to parse %s %q: %v", accountQuotaBytesHeader, quotaString, parseErr)
+				} else {
+					q.quota = quota
+				}
+			}
+		}
+		return f.shouldRetry(err)
+	})
+	if err != nil {
+		fs.Debugf(f, "Not checking uploads against the quota as reading the account failed: %v", err)
+	}
+}
+
+// reserveQuota checks there is enough of the account quota free to
+// upload size bytes and reserves it if so
+//
+// Call releaseQuota with the same size if the upload fails.
+func (f *Fs) reserveQuota(size int64) error {
+	q := &f.quota
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if !q.read {
+		f.readAccountQuota(q)
+	}
+	if q.quota < 0 {
+		return nil
+	}
+	free := q.quota - q.used
+	if free < 0 {
+		free = 0
+	}
+	if size > free {
+		return fs.NoRetryError(errors.Errorf("quota exceeded: need %s, have %s free", fs.SizeSuffix(size).Unit("Bytes"), fs.SizeSuffix(free).Unit("Bytes")))
+	}
+	q.used += size
+	return nil
+}
+
+// releaseQuota releases size bytes reserved with reserveQuota
+func (f *Fs) releaseQuota(size int64) {
+	q := &f.quota
+	q.mu.Lock()
+	q.used -= size
+	q.mu.Unlock()
+}
+
+// checkQuota returns whether an upload of size bytes should be
+// checked against the quota
+func (f *Fs) checkQuota(size int64) bool {
+	if f.noQuotaCheck || size < 0 {
+		return false
+	}
+	return size > int64(f.getChunkSize()) || (f.quotaCheckCutoff >= 0 && size > int64(f.quotaCheckCutoff))
+}
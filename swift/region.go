@@ -0,0 +1,206 @@
+// Fail over to other regions when the storage endpoint is down
+
+package swift
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/ncw/swift"
+	"github.com/pkg/errors"
+)
+
+// failoverAfter is the number of consecutive failures of the storage
+// endpoint before failing over to the next region
+const failoverAfter = 3
+
+// regionFailover tracks the failures of the storage endpoint and
+// which region is in use
+type regionFailover struct {
+	mu         sync.Mutex
+	auth       *auth    // to set the storage URL of the new region
+	regions    []string // the region from the config then fallback_regions
+	current    int      // index of the region in use
+	failures   int      // consecutive failures of the storage endpoint
+	generation int      // incremented each time the region changes
+}
+
+// newRegionFailover makes a regionFailover starting in region which
+// fails over to the comma separated list of fallbackRegions
+func newRegionFailover(a *auth, region, fallbackRegions string) *regionFailover {
+	r := &regionFailover{
+		auth:    a,
+		regions: []string{region},
+	}
+	for _, fallback := range strings.Split(fallbackRegions, ",") {
+		fallback = strings.TrimSpace(fallback)
+		if fallback != "" && fallback != region {
+			r.regions = append(r.regions, fallback)
+		}
+	}
+	return r
+}
+
+// isEndpointError returns true if err shows the storage endpoint is
+// unavailable rather than the request failing
+func isEndpointError(err error) bool {
+	if err == nil {
+		return false
+	}
+	cause := errors.Cause(err)
+	if swiftErr, ok := cause.(*swift.Error); ok {
+		return swiftErr.StatusCode == http.StatusServiceUnavailable
+	}
+	if _, ok := cause.(net.Error); ok {
+		return true
+	}
+	return fs.ShouldRetry(cause)
+}
+
+// shouldRetry is the same as shouldRetry but also counts the failures
+// of the storage endpoint, failing over to the next region if it
+// keeps failing.  Endpoint errors are retried when failing over.
+func (f *Fs) shouldRetry(err error) (bool, error) {
+	retry, err := shouldRetry(err)
+	if f.failover == nil {
+		return retry, err
+	}
+	r := f.failover
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !isEndpointError(err) {
+		r.failures = 0
+		return retry, err
+	}
+	r.failures++
+	if r.failures >= failoverAfter {
+		r.failures = 0
+		r.next(f)
+	}
+	return true, err
+}
+
+// next switches to the next region in the catalogue
+//
+// Call with r.mu held
+func (r *regionFailover) next(f *Fs) {
+	from := r.regions[r.current]
+	for i := 1; i < len(r.regions); i++ {
+		current := (r.current + i) % len(r.regions)
+		region := r.regions[current]
+		storageURL := catalogueURL(r.auth.Authenticator, region, f.c.EndpointType)
+		if storageURL == "" {
+			fs.Debugf(f, "No storage URL for region %q in the catalogue", region)
+			continue
+		}
+		fs.Logf(f, "Storage endpoint in region %q keeps failing - switching to region %q", from, region)
+		r.current = current
+		r.generation++
+		r.auth.setStorageURL(storageURL)
+		// Authenticate again to pick up the new storage URL
+		f.c.UnAuthenticate()
+		return
+	}
+	fs.Debugf(f, "Storage endpoint in region %q keeps failing but there are no other regions to switch to", from)
+}
+
+// regionGeneration returns a number which changes each time the
+// region changes
+func (f *Fs) regionGeneration() int {
+	if f.failover == nil {
+		return 0
+	}
+	f.failover.mu.Lock()
+	defer f.failover.mu.Unlock()
+	return f.failover.generation
+}
+
+// checkRegion returns an error if the region has changed since
+// generation was read with regionGeneration
+//
+// Uploads of large objects check this so their segments aren't
+// split between regions.
+func (f *Fs) checkRegion(generation int) error {
+	if f.regionGeneration() != generation {
+		return fs.RetryErrorf("storage region changed during upload - aborting it so it isn't split between regions")
+	}
+	return nil
+}
+
+// catalogueURL returns the URL of the object store for region with
+// endpointType from the catalogue the authenticator read, or "" if
+// there isn't one
+//
+// The swift library doesn't give access to the catalogue but its
+// keystone v2 and v3 authenticators export it so read it from their
+// JSON.
+func catalogueURL(authenticator swift.Authenticator, region string, endpointType swift.EndpointType) string {
+	data, err := json.Marshal(authenticator)
+	if err != nil {
+		return ""
+	}
+	var catalogue struct {
+		Auth struct {
+			Access struct { // v2
+				ServiceCatalog []struct {
+					Type      string
+					Endpoints []struct {
+						PublicUrl   string
+						InternalUrl string
+						AdminUrl    string
+						Region      string
+					}
+				}
+			}
+			Token struct { // v3
+				Catalog []struct {
+					Type      string
+					Endpoints []struct {
+						Url       string
+						Region    string
+						Interface swift.EndpointType
+					}
+				}
+			}
+		}
+	}
+	if err = json.Unmarshal(data, &catalogue); err != nil {
+		return ""
+	}
+	for _, service := range catalogue.Auth.Access.ServiceCatalog {
+		if service.Type != "object-store" {
+			continue
+		}
+		for _, endpoint := range service.Endpoints {
+			if region != "" && endpoint.Region != region {
+				continue
+			}
+			switch endpointType {
+			case swift.EndpointTypeInternal:
+				return endpoint.InternalUrl
+			case swift.EndpointTypeAdmin:
+				return endpoint.AdminUrl
+			default:
+				return endpoint.PublicUrl
+			}
+		}
+	}
+	if endpointType == "" {
+		endpointType = swift.EndpointTypePublic
+	}
+	for _, service := range catalogue.Auth.Token.Catalog {
+		if service.Type != "object-store" {
+			continue
+		}
+		for _, endpoint := range service.Endpoints {
+			if endpoint.Interface == endpointType && (region == "" || endpoint.Region == region) {
+				return endpoint.Url
+			}
+		}
+	}
+	return ""
+}
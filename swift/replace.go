@@ -0,0 +1,125 @@
+/*
+Translate file names for swift
+
+Swift object names must be valid UTF-8 and control characters in them
+either fail at the HTTP layer or don't survive a listing, so these are
+mapped to other characters on the way in and back on the way out.
+
+  control characters 0x00-0x1F -> SYMBOL FOR NULL etc U+2400-U+241F
+  DEL 0x7F                     -> SYMBOL FOR DELETE U+2421
+  invalid UTF-8 bytes 0x80-0xFF -> private use U+EE80-U+EEFF
+
+If the name already contains one of those replacement characters then
+it is quoted with SINGLE HIGH-REVERSED-9 QUOTATION MARK U+201B so it
+is restored as itself.  The quote is quoted too if it comes before a
+character which is replaced or quoted.
+*/
+
+package swift
+
+import (
+	"bytes"
+	"unicode/utf8"
+)
+
+const (
+	controlBase = '␀'      // replacement for 0x00, 0x01 -> U+2401 etc
+	delSymbol   = '␡'      // replacement for DEL
+	invalidBase = '\uEE00' // replacement for invalid byte 0x80 is U+EE80 etc
+	quoteRune   = '‛'      // quotes a replacement character in the input
+)
+
+// isReplacement returns true if r is a character which
+// replaceReservedChars produces
+func isReplacement(r rune) bool {
+	return (r >= controlBase && r < controlBase+0x20) || r == delSymbol || (r >= invalidBase+0x80 && r <= invalidBase+0xFF)
+}
+
+// needsQuote returns true if a quote rune before the start of in
+// would need quoting
+func needsQuote(in string) bool {
+	if in == "" {
+		return false
+	}
+	r, size := utf8.DecodeRuneInString(in)
+	if r == utf8.RuneError && size == 1 {
+		return true
+	}
+	return r < 0x20 || r == 0x7F || isReplacement(r) || r == quoteRune
+}
+
+// replaceReservedChars takes a path and substitutes any control
+// characters and invalid UTF-8 in it
+func replaceReservedChars(in string) string {
+	// Fast path for the common case
+	if !hasReserved(in) {
+		return in
+	}
+	var out bytes.Buffer
+	for i := 0; i < len(in); {
+		r, size := utf8.DecodeRuneInString(in[i:])
+		switch {
+		case r == utf8.RuneError && size == 1:
+			_, _ = out.WriteRune(invalidBase + rune(in[i]))
+		case r < 0x20:
+			_, _ = out.WriteRune(controlBase + r)
+		case r == 0x7F:
+			_, _ = out.WriteRune(delSymbol)
+		case isReplacement(r):
+			_, _ = out.WriteRune(quoteRune)
+			_, _ = out.WriteRune(r)
+		case r == quoteRune && needsQuote(in[i+size:]):
+			_, _ = out.WriteRune(quoteRune)
+			_, _ = out.WriteRune(r)
+		default:
+			_, _ = out.WriteString(in[i : i+size])
+		}
+		i += size
+	}
+	return out.String()
+}
+
+// hasReserved returns true if in contains anything
+// replaceReservedChars would change
+func hasReserved(in string) bool {
+	for i := 0; i < len(in); {
+		r, size := utf8.DecodeRuneInString(in[i:])
+		if (r == utf8.RuneError && size == 1) || r < 0x20 || r == 0x7F || isReplacement(r) || r == quoteRune {
+			return true
+		}
+		i += size
+	}
+	return false
+}
+
+// restoreReservedChars takes a path and undoes any substitutions
+// made by replaceReservedChars
+func restoreReservedChars(in string) string {
+	if !hasReserved(in) {
+		return in
+	}
+	var out bytes.Buffer
+	for i := 0; i < len(in); {
+		r, size := utf8.DecodeRuneInString(in[i:])
+		i += size
+		switch {
+		case r == quoteRune && i < len(in):
+			next, nextSize := utf8.DecodeRuneInString(in[i:])
+			if isReplacement(next) || next == quoteRune {
+				_, _ = out.WriteRune(next)
+				i += nextSize
+			} else {
+				_, _ = out.WriteRune(r)
+			}
+		case r >= controlBase && r < controlBase+0x20:
+			_ = out.WriteByte(byte(r - controlBase))
+		case r == delSymbol:
+			_ = out.WriteByte(0x7F)
+		case r >= invalidBase+0x80 && r <= invalidBase+0xFF:
+			_ = out.WriteByte(byte(r - invalidBase))
+		default:
+			_, _ = out.WriteString(in[i-size : i])
+		}
+	}
+	return out.String()
+}
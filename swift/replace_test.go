@@ -0,0 +1,34 @@
+package swift
+
+import "testing"
+
+func TestReplace(t *testing.T) {
+	for _, test := range []struct {
+		in  string
+		out string
+	}{
+		{"", ""},
+		{"abc 123", "abc 123"},
+		{"日本語/ファイル.txt", "日本語/ファイル.txt"},
+		{"new\nline", "new␊line"},
+		{"\x00\x1f\x7f", "␀␟␡"},
+		{"tab\there/dir\r", "tab␉here/dir␍"},
+		{"bad\xffutf8\x80", "bad\uEEFFutf8\uEE80"},
+		{"already␊encoded", "already‛␊encoded"},
+		{"private\uEE80use", "private‛\uEE80use"},
+		{"quote‛", "quote‛"},
+		{"quote‛a", "quote‛a"},
+		{"quote‛‛", "quote‛‛‛"},
+		{"quote‛\n", "quote‛‛␊"},
+		{"quote‛␊", "quote‛‛‛␊"},
+	} {
+		got := replaceReservedChars(test.in)
+		if got != test.out {
+			t.Errorf("replaceReservedChars(%q) want %q got %q", test.in, test.out, got)
+		}
+		got2 := restoreReservedChars(got)
+		if got2 != test.in {
+			t.Errorf("restoreReservedChars(%q) want %q got %q", got, test.in, got2)
+		}
+	}
+}
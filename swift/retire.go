@@ -0,0 +1,109 @@
+// Keep the segments of overwritten large objects for a while
+
+package swift
+
+import (
+	"bytes"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/ncw/swift"
+	"github.com/pkg/errors"
+)
+
+// retiredSegmentsPrefix is the prefix in the segments container of
+// the objects recording the segments which cleanup should remove.
+//
+// Each is named retiredSegmentsPrefix + object name + "/" + the
+// unique prefix of the segments, and its last modified time is when
+// they were retired.
+const retiredSegmentsPrefix = ".rclone-retired-segments/"
+
+// retireSegments records that the segments of the manifest o had
+// before it was overwritten should be removed by cleanup once
+// segment_retention has passed, rather than removing them now, so
+// downloads of the old version in progress can finish
+//
+// oldManifest is the X-Object-Manifest the object had.  It returns
+// false if the segments couldn't be retired so should be removed now.
+func (o *Object) retireSegments(oldManifest, newPrefix string) bool {
+	// Some servers return the manifest URL encoded as it was sent
+	if unescaped, err := url.PathUnescape(oldManifest); err == nil {
+		oldManifest = unescaped
+	}
+	segmentsRoot := o.fs.segmentsContainer + "/" + o.name() + "/"
+	if !strings.HasPrefix(oldManifest, segmentsRoot) {
+		// The segments are somewhere else, eg a copied manifest
+		return false
+	}
+	oldPrefix := strings.TrimSuffix(oldManifest[len(segmentsRoot):], "/")
+	if oldPrefix == "" || oldPrefix+"/" == newPrefix {
+		return false
+	}
+	ledgerName := retiredSegmentsPrefix + o.name() + "/" + oldPrefix
+	err := o.fs.pacer.Call(func() (bool, error) {
+		_, err := o.fs.c.ObjectPut(o.fs.segmentsContainer, ledgerName, bytes.NewReader(nil), true, "", "", swift.Headers{"Content-Length": "0"})
+		return o.fs.shouldRetry(err)
+	})
+	if err != nil {
+		fs.Logf(o, "Failed to record the old segments for cleanup - removing them now: %v", err)
+		return false
+	}
+	fs.Debugf(o, "Keeping the old segments under %q until cleanup after %v", oldPrefix, o.fs.segmentRetention)
+	return true
+}
+
+// CleanUp removes the segments of overwritten large objects under
+// the root which have been kept for longer than segment_retention
+func (f *Fs) CleanUp() error {
+	if f.container == "" {
+		return errors.New("container name needed in remote")
+	}
+	var retired []string
+	now := time.Now()
+	err := f.listContainerRoot(f.segmentsContainer, retiredSegmentsPrefix+f.root, "", true, func(remote string, object *swift.Object, isDirectory bool) error {
+		if now.Sub(object.LastModified) >= f.segmentRetention {
+			retired = append(retired, object.Name)
+		}
+		return nil
+	})
+	if errors.Cause(err) == swift.ContainerNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, ledgerName := range retired {
+		segmentsPath := strings.TrimPrefix(ledgerName, retiredSegmentsPrefix)
+		slash := strings.LastIndex(segmentsPath, "/")
+		if slash < 0 {
+			continue
+		}
+		// The unique prefix is made of two path elements
+		slash = strings.LastIndex(segmentsPath[:slash], "/")
+		if slash < 0 {
+			continue
+		}
+		name := segmentsPath[:slash]
+		o := &Object{
+			fs:     f,
+			remote: f.decodeName(strings.TrimPrefix(name, f.root)),
+			info:   swift.Object{Name: name},
+		}
+		fs.Infof(o, "Removing retired segments under %q", segmentsPath[slash+1:])
+		err = o.removeSegments(segmentsPath[slash+1:]+"/", "")
+		if err != nil {
+			return err
+		}
+		err = f.pacer.Call(func() (bool, error) {
+			err := f.c.ObjectDelete(f.segmentsContainer, ledgerName)
+			return f.shouldRetry(err)
+		})
+		if err != nil && err != swift.ObjectNotFound {
+			return errors.Wrapf(err, "failed to delete %q in container %q", ledgerName, f.segmentsContainer)
+		}
+	}
+	return nil
+}
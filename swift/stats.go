@@ -0,0 +1,93 @@
+// Per prefix statistics for a container
+
+package swift
+
+import (
+	"path"
+	"strings"
+
+	"github.com/ncw/swift"
+	"github.com/pkg/errors"
+)
+
+// PrefixStat is the number and total size of the objects in a
+// container or under a prefix in it
+type PrefixStat struct {
+	Name  string `json:"name"`
+	Bytes int64  `json:"bytes"`
+	Count int64  `json:"count"`
+}
+
+// PrefixStats returns the size of the container read from its
+// headers, then unless containerOnly is set the size of the objects
+// under the root of the remote and of each of its immediate
+// subdirectories, like du --max-depth=1
+//
+// The names are the container then container/path for the prefixes.
+// The root and its subdirectories are sized by walking the listing
+// so this costs a request per list_chunk objects.
+//
+// Large objects are counted at the size of their manifests as in the
+// container's headers - their segments are in the segments
+// container.
+func (f *Fs) PrefixStats(containerOnly bool) ([]PrefixStat, error) {
+	if f.container == "" {
+		return nil, errors.New("container name needed in remote")
+	}
+	var info swift.Container
+	err := f.pacer.Call(func() (bool, error) {
+		var err error
+		info, _, err = f.c.Container(f.container)
+		return f.shouldRetry(err)
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read container %q", f.container)
+	}
+	stats := []PrefixStat{{Name: f.container, Bytes: info.Bytes, Count: info.Count}}
+	if containerOnly {
+		return stats, nil
+	}
+
+	// List the root with the delimiter, sizing the objects in it
+	// and finding the subdirectories
+	root := PrefixStat{Name: strings.TrimRight(f.Root(), "/")}
+	var dirs []string
+	seen := make(map[string]struct{})
+	err = f.listContainerRoot(f.container, f.root, "", false, func(remote string, object *swift.Object, isDirectory bool) error {
+		if isDirectory {
+			dir := strings.TrimRight(remote, "/")
+			if _, ok := seen[dir]; !ok {
+				seen[dir] = struct{}{}
+				dirs = append(dirs, dir)
+			}
+			return nil
+		}
+		root.Bytes += object.Bytes
+		root.Count++
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Then walk each subdirectory
+	var subdirs []PrefixStat
+	for _, dir := range dirs {
+		subdir := PrefixStat{Name: path.Join(root.Name, dir)}
+		err = f.listContainerRoot(f.container, f.root, dir, true, func(remote string, object *swift.Object, isDirectory bool) error {
+			subdir.Bytes += object.Bytes
+			subdir.Count++
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		root.Bytes += subdir.Bytes
+		root.Count += subdir.Count
+		subdirs = append(subdirs, subdir)
+	}
+	if f.root != "" {
+		stats = append(stats, root)
+	}
+	return append(stats, subdirs...), nil
+}
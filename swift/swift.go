@@ -3,8 +3,15 @@ package swift
 
 import (
 	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"hash"
 	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
 	"path"
 	"regexp"
 	"strconv"
@@ -13,19 +20,30 @@ import (
 	"time"
 
 	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/pacer"
 	"github.com/ncw/swift"
 	"github.com/pkg/errors"
+	"golang.org/x/text/unicode/norm"
 )
 
 // Constants
 const (
 	directoryMarkerContentType = "application/directory" // content type of directory marker objects
-	listChunks                 = 1000                    // chunk size to read directory listings
+	listChunks                 = 1000                    // default chunk size to read directory listings
+	minListChunk               = 1                       // smallest list_chunk allowed
+	maxListChunk               = 10000                   // largest list_chunk allowed
+	accountQuotaBytesHeader    = "X-Account-Meta-Quota-Bytes"
+	accountQuotaCountHeader    = "X-Account-Meta-Quota-Count"
+	mtimeHeader                = "X-Object-Meta-Mtime" // header swift.Metadata.SetModTime sets on objects
+	minSleep                   = 10 * time.Millisecond // default minimum time between API calls
+	maxSleep                   = 2 * time.Second       // longest time to back off for
+	decayConstant              = 2                     // bigger for slower decay, exponential
 )
 
 // Globals
 var (
 	chunkSize = fs.SizeSuffix(5 * 1024 * 1024 * 1024)
+	pace      = fs.DurationP("swift-pace", "", minSleep, "Minimum time between swift API calls.")
 )
 
 // Register with Fs
@@ -105,6 +123,267 @@ func init() {
 				Help:  "Admin",
 				Value: "admin",
 			}},
+		}, {
+			Name: "ca_cert",
+			Help: "Path to a PEM encoded CA certificate bundle to verify the server with - optional",
+		}, {
+			Name: "client_cert",
+			Help: "Path to a PEM encoded client certificate for TLS client authentication - optional",
+		}, {
+			Name: "client_key",
+			Help: "Path to the PEM encoded private key for client_cert - optional",
+		}, {
+			Name: "insecure_skip_verify",
+			Help: "Don't verify the server's TLS certificate - optional, insecure",
+			Examples: []fs.OptionExample{
+				{
+					Value: "false",
+					Help:  "Verify the server certificate (default)",
+				}, {
+					Value: "true",
+					Help:  "Don't verify the server certificate",
+				},
+			},
+		}, {
+			Name: "no_large_objects",
+			Help: "Set if there are no large objects in the containers so 0 byte objects and hashes don't need checking, and refuse to make any - optional",
+			Examples: []fs.OptionExample{
+				{
+					Value: "false",
+					Help:  "Check every 0 byte object in case it is a dynamic large object (default)",
+				}, {
+					Value: "true",
+					Help:  "Trust the listing and hashes and refuse uploads which would make large objects",
+				},
+			},
+		}, {
+			Name: "use_server_modtime",
+			Help: "Use the server's last modified time instead of the mtime metadata, avoiding a HEAD per object - optional",
+			Examples: []fs.OptionExample{
+				{
+					Value: "false",
+					Help:  "Read the mtime metadata for accurate modification times (default)",
+				}, {
+					Value: "true",
+					Help:  "Use the last modified time from the listing, accurate to 1s",
+				},
+			},
+		}, {
+			Name: "list_chunk",
+			Help: "Number of entries to fetch in each listing request, 1 to 10000, default 1000 - optional",
+		}, {
+			Name: "fetch_until_empty_page",
+			Help: "Keep fetching listing pages until an empty one is returned, for servers which return short pages before the end - optional",
+			Examples: []fs.OptionExample{
+				{
+					Value: "false",
+					Help:  "Stop listing at the first page with fewer than list_chunk entries (default)",
+				}, {
+					Value: "true",
+					Help:  "Stop listing only at an empty page, using more transactions",
+				},
+			},
+		}, {
+			Name: "partial_page_fetch_threshold",
+			Help: "Keep fetching listing pages while they are at least this percentage of list_chunk full, 0 to 100, default 0 - optional",
+		}, {
+			Name: "container_timestamps",
+			Help: "Read the creation time of each container when listing the root, using a HEAD per container - optional",
+			Examples: []fs.OptionExample{
+				{
+					Value: "false",
+					Help:  "Show containers with no modification time (default)",
+				}, {
+					Value: "true",
+					Help:  "HEAD each container to read its X-Timestamp",
+				},
+			},
+		}, {
+			Name: "preserve_slashes",
+			Help: "Keep leading slashes in paths so objects with names starting with / can be used, eg container//name - optional",
+			Examples: []fs.OptionExample{
+				{
+					Value: "false",
+					Help:  "Remove all slashes between the container and the path (default)",
+				}, {
+					Value: "true",
+					Help:  "Only remove the slash after the container",
+				},
+			},
+		}, {
+			Name: "normalize_names",
+			Help: "Normalize listed names to Unicode NFC so names from macOS (NFD) match those from elsewhere - optional",
+			Examples: []fs.OptionExample{
+				{
+					Value: "false",
+					Help:  "Use names exactly as stored (default)",
+				}, {
+					Value: "true",
+					Help:  "Convert listed names to NFC",
+				},
+			},
+		}, {
+			Name: "encode_names",
+			Help: "Encode control characters and invalid UTF-8 in names so they can be stored - optional",
+			Examples: []fs.OptionExample{
+				{
+					Value: "false",
+					Help:  "Use names exactly as stored (default)",
+				}, {
+					Value: "true",
+					Help:  "Map control characters and invalid UTF-8 to other characters and back",
+				},
+			},
+		}, {
+			Name: "no_if_match",
+			Help: "Don't send If-Match with downloads, for servers which mishandle it - optional",
+			Examples: []fs.OptionExample{
+				{
+					Value: "false",
+					Help:  "Send the object's ETag so downloads fail if it changes (default)",
+				}, {
+					Value: "true",
+					Help:  "Don't send If-Match",
+				},
+			},
+		}, {
+			Name: "download_concurrency",
+			Help: "Number of segments of a large object to download at once, default 1 - optional",
+		}, {
+			Name: "download_cutoff",
+			Help: "Large objects above this size are downloaded download_concurrency segments at a time, default 1G - optional",
+		}, {
+			Name: "no_head_object",
+			Help: "Don't check whether the path points to an object when starting up, assume it is a directory - optional",
+			Examples: []fs.OptionExample{
+				{
+					Value: "false",
+					Help:  "HEAD the path to see if it is an object (default)",
+				}, {
+					Value: "true",
+					Help:  "Assume the path is a directory, saving a HEAD request",
+				},
+			},
+		}, {
+			Name: "upload_header",
+			Help: "Extra header to set on uploaded objects as Key: Value, eg \"Cache-Control: no-cache, no-store\".  Set more in upload_header_2, upload_header_3 etc - optional",
+		}, {
+			Name: "content_type",
+			Help: "Content-Type to set on all uploads instead of guessing it from the file extension, eg application/octet-stream - optional",
+		}, {
+			Name: "no_chunk",
+			Help: "Don't chunk large files into segments, upload them with a single PUT - optional",
+			Examples: []fs.OptionExample{
+				{
+					Value: "false",
+					Help:  "Upload files above the chunk size as large objects (default)",
+				}, {
+					Value: "true",
+					Help:  "Upload all files as single objects, up to the largest size the server accepts",
+				},
+			},
+		}, {
+			Name: "no_quota_check",
+			Help: "Don't check the account quota before large uploads, for servers whose quota headers are wrong - optional",
+			Examples: []fs.OptionExample{
+				{
+					Value: "false",
+					Help:  "Fail large uploads which would exceed the quota before starting them (default)",
+				}, {
+					Value: "true",
+					Help:  "Don't check the quota",
+				},
+			},
+		}, {
+			Name: "quota_check_cutoff",
+			Help: "Check the account quota before uploads above this size as well as before chunked uploads, default off - optional",
+		}, {
+			Name: "cdn_url",
+			Help: "Rackspace CDN management URL if not returned by the auth - optional",
+		}, {
+			Name: "temp_url_key",
+			Help: "Key to sign temp URLs with if not set on the account as X-Account-Meta-Temp-Url-Key - optional",
+		}, {
+			Name: "temp_url_expiry",
+			Help: "How long temp URLs made by rclone link are valid for, default 1h - optional",
+		}, {
+			Name: "download_temp_url",
+			Help: "Download objects with temp URLs instead of authenticated requests, needs a temp URL key - optional",
+			Examples: []fs.OptionExample{
+				{
+					Value: "false",
+					Help:  "Download with authenticated requests (default)",
+				}, {
+					Value: "true",
+					Help:  "Download with temp URLs signed with the temp URL key",
+				},
+			},
+		}, {
+			Name: "preserve_manifest_on_copy",
+			Help: "Server side copies of dynamic large objects make a new manifest referring to the same segments - optional",
+			Examples: []fs.OptionExample{
+				{
+					Value: "false",
+					Help:  "Copy the data of large objects (default)",
+				}, {
+					Value: "true",
+					Help:  "Copy the X-Object-Manifest so the copy shares the segments",
+				},
+			},
+		}, {
+			Name: "leave_parts_on_error",
+			Help: "Leave the segments already uploaded when a chunked upload fails - optional",
+			Examples: []fs.OptionExample{
+				{
+					Value: "false",
+					Help:  "Delete the segments of failed uploads (default)",
+				}, {
+					Value: "true",
+					Help:  "Leave them in the segments container, eg to debug the failure",
+				},
+			},
+		}, {
+			Name: "segment_retention",
+			Help: "Keep the segments of overwritten large objects for this long, eg 1h, for rclone cleanup to remove - optional",
+		}, {
+			Name: "directory_marker_content_types",
+			Help: "Comma separated list of content types which mark directories as well as application/directory - optional",
+		}, {
+			Name: "directory_marker_names",
+			Help: "Comma separated list of names of empty placeholder files to hide, eg .keep - optional",
+		}, {
+			Name: "empty_directory_markers",
+			Help: "Treat empty objects whose names end in / as directory markers whatever their content type - optional",
+			Examples: []fs.OptionExample{
+				{
+					Value: "false",
+					Help:  "Only objects with a directory content type are directory markers (default)",
+				}, {
+					Value: "true",
+					Help:  "Empty objects ending in / are directory markers too",
+				},
+			},
+		}, {
+			Name: "no_check_container",
+			Help: "Don't check the container or objects exist, for credentials which can write objects but not list or read them - optional",
+			Examples: []fs.OptionExample{
+				{
+					Value: "false",
+					Help:  "Check the container exists and read objects before overwriting them (default)",
+				}, {
+					Value: "true",
+					Help:  "Assume the container exists and treat objects which can't be read as missing",
+				},
+			},
+		}, {
+			Name: "fallback_regions",
+			Help: "Comma separated list of regions to switch to in order if the storage endpoint keeps failing - optional",
+		}, {
+			Name: "proxy_url",
+			Help: "URL of an http, https or socks5 proxy to use for this remote instead of the environment - optional",
+		}, {
+			Name: "user_agent",
+			Help: "User-Agent to send for this remote instead of --user-agent - optional",
 		},
 		},
 	})
@@ -113,15 +392,49 @@ func init() {
 
 // Fs represents a remote swift server
 type Fs struct {
-	name              string            // name of this remote
-	root              string            // the path we are working on if any
-	features          *fs.Features      // optional features
-	c                 *swift.Connection // the connection to the swift server
-	container         string            // the container we are working on
-	containerOKMu     sync.Mutex        // mutex to protect container OK
-	containerOK       bool              // true if we have created the container
-	segmentsContainer string            // container to store the segments (if any) in
-	noCheckContainer  bool              // don't check the container before creating it
+	name                   string            // name of this remote
+	root                   string            // the path we are working on if any
+	features               *fs.Features      // optional features
+	c                      *swift.Connection // the connection to the swift server
+	container              string            // the container we are working on
+	segmentsContainer      string            // container to store the segments (if any) in
+	noCheckContainer       bool              // don't check the container before creating it
+	noLargeObjects         bool              // set if there are no large objects and none should be made
+	useServerModTime       bool              // use the server's last modified time as the modtime
+	listChunk              int               // number of entries to read per listing request
+	fetchUntilEmpty        bool              // keep listing until an empty page is returned
+	partialPageFetch       int               // keep listing while pages are at least this percent full
+	containerTimes         bool              // read the container timestamps when listing the root
+	noIfMatch              bool              // don't send If-Match on downloads
+	downloadConcurrency    int               // number of segments to download at once
+	downloadCutoff         fs.SizeSuffix     // download segments concurrently above this size
+	chunkSize              fs.SizeSuffix     // chunk files above this size if set, otherwise use --swift-chunk-size
+	pacer                  *pacer.Pacer      // to pace and retry the API calls
+	normalizeNames         bool              // normalize listed names to NFC
+	encodeNames            bool              // encode reserved characters in names
+	dirNamesMu             sync.Mutex        // protects dirNames
+	dirNames               map[string]string // normalized directory prefixes to the ones stored
+	uploadHeaders          swift.Headers     // extra headers to set on uploads
+	contentType            string            // Content-Type to set on uploads if set
+	noChunk                bool              // don't chunk uploads into segments
+	noQuotaCheck           bool              // don't check uploads against the account quota
+	quotaCheckCutoff       fs.SizeSuffix     // check the quota for uploads above this size too
+	quota                  accountQuota      // cached quota and usage of the account
+	cdnURL                 string            // CDN management URL if set in the config
+	tempURLKey             string            // key to sign temp URLs with
+	tempURLKeyOnce         sync.Once         // reads tempURLKey from the account if not set
+	tempURLExpiry          time.Duration     // how long temp URLs are valid for
+	downloadTempURL        bool              // download with temp URLs
+	preserveManifestOnCopy bool              // copy the manifest of dynamic large objects not the data
+	failover               *regionFailover   // to fail over to other regions if set
+	leavePartsOnError      bool              // don't delete the segments of failed chunked uploads
+	segmentRetention       time.Duration     // keep old segments this long for cleanup if set
+	writeOnly              bool              // no_check_container is set so reads may be forbidden
+	markerContentTypes     map[string]bool   // lower case content types which mark directories
+	markerNames            map[string]bool   // names of empty placeholder files
+	emptyDirMarkers        bool              // empty objects ending in / are directory markers
+	swiftInfo              swift.SwiftInfo   // capabilities of the cluster, nil if they couldn't be read
+	swiftInfoOnce          sync.Once         // reads swiftInfo from /info when first needed
 }
 
 // Object describes a swift object
@@ -146,7 +459,7 @@ func (f *Fs) Root() string {
 	if f.root == "" {
 		return f.container
 	}
-	return f.container + "/" + f.root
+	return f.container + "/" + f.decodeName(f.root)
 }
 
 // String converts this Fs to a string
@@ -154,7 +467,30 @@ func (f *Fs) String() string {
 	if f.root == "" {
 		return fmt.Sprintf("Swift container %s", f.container)
 	}
-	return fmt.Sprintf("Swift container %s path %s", f.container, f.root)
+	return fmt.Sprintf("Swift container %s path %s", f.container, f.decodeName(f.root))
+}
+
+// objectName returns the name of the object for remote in the
+// container, encoding any reserved characters
+func (f *Fs) objectName(remote string) string {
+	return f.root + f.encodeName(remote)
+}
+
+// encodeName encodes the reserved characters in name if encode_names
+// is set
+func (f *Fs) encodeName(name string) string {
+	if !f.encodeNames {
+		return name
+	}
+	return replaceReservedChars(name)
+}
+
+// decodeName undoes encodeName
+func (f *Fs) decodeName(name string) string {
+	if !f.encodeNames {
+		return name
+	}
+	return restoreReservedChars(name)
 }
 
 // Features returns the optional features of this Fs
@@ -163,22 +499,84 @@ func (f *Fs) Features() *fs.Features {
 }
 
 // Pattern to match a swift path
-var matcher = regexp.MustCompile(`^([^/]*)(.*)$`)
+var matcher = regexp.MustCompile(`(?s)^([^/]*)(.*)$`)
 
 // parseParse parses a swift 'url'
-func parsePath(path string) (container, directory string, err error) {
+//
+// If preserveSlashes is set then only the / separating the container
+// from the directory is removed from the start of the directory so
+// object names starting with / can be used.
+func parsePath(path string, preserveSlashes bool) (container, directory string, err error) {
 	parts := matcher.FindStringSubmatch(path)
 	if parts == nil {
 		err = errors.Errorf("couldn't find container in swift path %q", path)
 	} else {
 		container, directory = parts[1], parts[2]
-		directory = strings.Trim(directory, "/")
+		if preserveSlashes {
+			directory = strings.TrimRight(strings.TrimPrefix(directory, "/"), "/")
+		} else {
+			directory = strings.Trim(directory, "/")
+		}
 	}
 	return
 }
 
+// uploadHeaderBlacklist are the headers which can't be set with
+// upload_header as they would corrupt uploads or are set by rclone
+var uploadHeaderBlacklist = map[string]bool{
+	"Content-Length":        true,
+	"Etag":                  true,
+	"Content-Type":          true,
+	"X-Object-Manifest":     true,
+	"X-Static-Large-Object": true,
+}
+
+// uploadHeaderKey returns the config key of the nth upload header,
+// counting from 1, eg "upload_header" then "upload_header_2"
+func uploadHeaderKey(n int) string {
+	if n == 1 {
+		return "upload_header"
+	}
+	return fmt.Sprintf("upload_header_%d", n)
+}
+
+// parseUploadHeaders parses the values of the upload_header options
+// which are each a single Key: Value pair.  The Value may contain
+// commas.
+func parseUploadHeaders(items []string) (swift.Headers, error) {
+	headers := swift.Headers{}
+	for _, item := range items {
+		item = strings.TrimSpace(item)
+		i := strings.IndexRune(item, ':')
+		if i <= 0 {
+			return nil, errors.Errorf("upload header %q must be of the form Key: Value", item)
+		}
+		key := http.CanonicalHeaderKey(strings.TrimSpace(item[:i]))
+		if uploadHeaderBlacklist[key] {
+			return nil, errors.Errorf("upload header %q can't be set", key)
+		}
+		headers[key] = strings.TrimSpace(item[i+1:])
+	}
+	return headers, nil
+}
+
+// parentDir returns the directory part of remote without cleaning
+// the path, so doubled slashes are preserved, or "" if remote has
+// no directory part
+func parentDir(remote string) string {
+	i := strings.LastIndex(remote, "/")
+	if i < 0 {
+		return ""
+	}
+	return remote[:i]
+}
+
 // swiftConnection makes a connection to swift
 func swiftConnection(name string) (*swift.Connection, error) {
+	transport, err := newTransport(name)
+	if err != nil {
+		return nil, err
+	}
 	c := &swift.Connection{
 		UserName:       fs.ConfigFileGet(name, "user"),
 		ApiKey:         fs.ConfigFileGet(name, "key"),
@@ -191,7 +589,7 @@ func swiftConnection(name string) (*swift.Connection, error) {
 		EndpointType:   swift.EndpointType(fs.ConfigFileGet(name, "endpoint_type", "public")),
 		ConnectTimeout: 10 * fs.Config.ConnectTimeout, // Use the timeouts in the transport
 		Timeout:        10 * fs.Config.Timeout,        // Use the timeouts in the transport
-		Transport:      fs.Config.Transport(),
+		Transport:      transport,
 	}
 	if fs.ConfigFileGetBool(name, "env_auth", false) {
 		err := c.ApplyEnvironment()
@@ -208,57 +606,240 @@ func swiftConnection(name string) (*swift.Connection, error) {
 	if c.AuthUrl == "" {
 		return nil, errors.New("auth not found")
 	}
-	err := c.Authenticate()
+	err = c.Authenticate()
 	if err != nil {
 		return nil, err
 	}
 	return c, nil
 }
 
+// errorClasses says how errors with these HTTP status codes from the
+// swift server are retried
+var errorClasses = fs.HTTPErrorClasses{
+	401: fs.ErrorClassFail,    // Authorization Failed - the library has already authenticated again
+	403: fs.ErrorClassNoRetry, // Forbidden
+	404: fs.ErrorClassFail,    // Not Found
+	408: fs.ErrorClassRetry,   // Request Timeout
+	413: fs.ErrorClassNoRetry, // Request Entity Too Large
+	429: fs.ErrorClassRetry,   // Rate exceeded.
+	498: fs.ErrorClassRetry,   // Rate limited by some swift servers
+	500: fs.ErrorClassRetry,   // Get occasional 500 Internal Server Error
+	503: fs.ErrorClassRetry,   // Service Unavailable
+	504: fs.ErrorClassRetry,   // Gateway Time-out
+}
+
+// classifyError returns how err from the swift library should be
+// retried
+func classifyError(err error) fs.ErrorClass {
+	statusCode := 0
+	if swiftError, ok := errors.Cause(err).(*swift.Error); ok {
+		statusCode = swiftError.StatusCode
+	}
+	return errorClasses.Classify(statusCode, err)
+}
+
+// shouldRetry returns a boolean as to whether this err deserves to be
+// retried.  It returns the err as a convenience
+func shouldRetry(err error) (bool, error) {
+	return classifyError(err) == fs.ErrorClassRetry, err
+}
+
+// callObject calls fn, an operation on an object, with the pacer
+// retrying it as classifyError says.  The swift library authenticates
+// again and retries once itself if the authorization has expired.
+//
+// The final error from fn is returned without the RetryError the
+// pacer wraps it in when it runs out of retries, so use objectError on
+// it before returning it from the Object methods.
+func (f *Fs) callObject(fn func() error) error {
+	var lastErr error
+	err := f.pacer.Call(func() (bool, error) {
+		lastErr = fn()
+		return f.shouldRetry(lastErr)
+	})
+	if err != nil {
+		return lastErr
+	}
+	return nil
+}
+
+// objectError marks err from an object operation so the sync doesn't
+// retry permanent errors.
+//
+// Transient errors have already been retried by the pacer so they
+// are returned unchanged rather than being retried yet again at the
+// low level.
+func objectError(err error) error {
+	switch class := classifyError(err); class {
+	case fs.ErrorClassNoRetry, fs.ErrorClassFatal:
+		return class.Wrap(err)
+	}
+	return err
+}
+
 // NewFsWithConnection contstructs an Fs from the path, container:path
 // and authenticated connection.
 //
 // if noCheckContainer is set then the Fs won't check the container
 // exists before creating it.
 func NewFsWithConnection(name, root string, c *swift.Connection, noCheckContainer bool) (fs.Fs, error) {
-	container, directory, err := parsePath(root)
+	container, directory, err := parsePath(root, fs.ConfigFileGetBool(name, "preserve_slashes", false))
 	if err != nil {
 		return nil, err
 	}
+	minPace := *pace
+	if paceFlag, found := fs.ConfigFileGetFlag(name, "pace", "swift-pace"); found {
+		minPace, err = time.ParseDuration(paceFlag)
+		if err != nil {
+			return nil, errors.Wrap(err, "bad pace")
+		}
+	}
 	f := &Fs{
-		name:              name,
-		c:                 c,
-		container:         container,
-		segmentsContainer: container + "_segments",
-		root:              directory,
-		noCheckContainer:  noCheckContainer,
+		name:                   name,
+		c:                      c,
+		container:              container,
+		segmentsContainer:      container + "_segments",
+		encodeNames:            fs.ConfigFileGetBool(name, "encode_names", false),
+		noCheckContainer:       noCheckContainer || fs.ConfigFileGetBool(name, "no_check_container", false),
+		writeOnly:              fs.ConfigFileGetBool(name, "no_check_container", false),
+		noLargeObjects:         fs.ConfigFileGetBool(name, "no_large_objects", false),
+		useServerModTime:       fs.ConfigFileGetBool(name, "use_server_modtime", fs.Config.UseServerModTime),
+		listChunk:              fs.ConfigFileGetInt(name, "list_chunk", listChunks),
+		fetchUntilEmpty:        fs.ConfigFileGetBool(name, "fetch_until_empty_page", false),
+		partialPageFetch:       fs.ConfigFileGetInt(name, "partial_page_fetch_threshold", 0),
+		containerTimes:         fs.ConfigFileGetBool(name, "container_timestamps", false),
+		noIfMatch:              fs.ConfigFileGetBool(name, "no_if_match", false),
+		downloadConcurrency:    fs.ConfigFileGetInt(name, "download_concurrency", 1),
+		downloadCutoff:         defaultDownloadCutoff,
+		normalizeNames:         fs.ConfigFileGetBool(name, "normalize_names", false),
+		contentType:            fs.ConfigFileGet(name, "content_type"),
+		noChunk:                fs.ConfigFileGetBool(name, "no_chunk", false),
+		leavePartsOnError:      fs.ConfigFileGetBool(name, "leave_parts_on_error", false),
+		markerContentTypes:     parseList(fs.ConfigFileGet(name, "directory_marker_content_types"), true),
+		markerNames:            parseList(fs.ConfigFileGet(name, "directory_marker_names"), false),
+		emptyDirMarkers:        fs.ConfigFileGetBool(name, "empty_directory_markers", false),
+		noQuotaCheck:           fs.ConfigFileGetBool(name, "no_quota_check", false),
+		quotaCheckCutoff:       -1,
+		cdnURL:                 fs.ConfigFileGet(name, "cdn_url"),
+		tempURLKey:             fs.ConfigFileGet(name, "temp_url_key"),
+		tempURLExpiry:          defaultTempURLExpiry,
+		downloadTempURL:        fs.ConfigFileGetBool(name, "download_temp_url", false),
+		preserveManifestOnCopy: fs.ConfigFileGetBool(name, "preserve_manifest_on_copy", false),
+		dirNames:               make(map[string]string),
+		pacer:                  pacer.New().SetMinSleep(minPace).SetMaxSleep(maxSleep).SetDecayConstant(decayConstant),
+	}
+	f.root = f.encodeName(directory)
+	if f.downloadConcurrency < 1 {
+		return nil, errors.Errorf("download_concurrency must be at least 1, got %d", f.downloadConcurrency)
+	}
+	if downloadCutoff := fs.ConfigFileGet(name, "download_cutoff"); downloadCutoff != "" {
+		err = f.downloadCutoff.Set(downloadCutoff)
+		if err != nil {
+			return nil, errors.Wrap(err, "bad download_cutoff")
+		}
+	}
+	if chunkSizeFlag, found := fs.ConfigFileGetFlag(name, "chunk_size", "swift-chunk-size"); found {
+		err = f.chunkSize.Set(chunkSizeFlag)
+		if err != nil {
+			return nil, errors.Wrap(err, "bad chunk_size")
+		}
+	}
+	if quotaCheckCutoff := fs.ConfigFileGet(name, "quota_check_cutoff"); quotaCheckCutoff != "" {
+		err = f.quotaCheckCutoff.Set(quotaCheckCutoff)
+		if err != nil {
+			return nil, errors.Wrap(err, "bad quota_check_cutoff")
+		}
+	}
+	if tempURLExpiry := fs.ConfigFileGet(name, "temp_url_expiry"); tempURLExpiry != "" {
+		f.tempURLExpiry, err = fs.ParseDuration(tempURLExpiry)
+		if err != nil {
+			return nil, errors.Wrap(err, "bad temp_url_expiry")
+		}
+	}
+	if segmentRetention := fs.ConfigFileGet(name, "segment_retention"); segmentRetention != "" {
+		f.segmentRetention, err = fs.ParseDuration(segmentRetention)
+		if err != nil {
+			return nil, errors.Wrap(err, "bad segment_retention")
+		}
+	}
+	var uploadHeaders []string
+	for n := 1; ; n++ {
+		item := fs.ConfigFileGet(name, uploadHeaderKey(n))
+		if item == "" {
+			break
+		}
+		uploadHeaders = append(uploadHeaders, item)
+	}
+	f.uploadHeaders, err = parseUploadHeaders(uploadHeaders)
+	if err != nil {
+		return nil, errors.Wrap(err, "bad upload_header")
+	}
+	if f.isMarkerContentType(f.contentType) {
+		return nil, errors.Errorf("content_type can't be %q as that marks directories", f.contentType)
+	}
+	if f.listChunk < minListChunk || f.listChunk > maxListChunk {
+		return nil, errors.Errorf("list_chunk must be between %d and %d, got %d", minListChunk, maxListChunk, f.listChunk)
+	}
+	if f.partialPageFetch < 0 || f.partialPageFetch > 100 {
+		return nil, errors.Errorf("partial_page_fetch_threshold must be between 0 and 100, got %d", f.partialPageFetch)
 	}
 	f.features = (&fs.Features{
 		ReadMimeType:  true,
+		ListMimeType:  true,
 		WriteMimeType: true,
 		BucketBased:   true,
+		SeekOpen:      true,
+		ReadMetadata:  true,
+		WriteMetadata: true,
+		// The listings are sorted by name so each
+		// directory's entries come together
+		ListRByDirectory: true,
 	}).Fill(f)
+	if f.useServerModTime {
+		// The directory modification times wouldn't be read back
+		f.features.DirSetModTime = nil
+	}
 	// StorageURL overloading
 	storageURL := fs.ConfigFileGet(name, "storage_url")
 	if storageURL != "" {
 		f.c.StorageUrl = storageURL
 		f.c.Auth = newAuth(f.c.Auth, storageURL)
 	}
-	if f.root != "" {
-		f.root += "/"
-		// Check to see if the object exists - ignoring directory markers
-		info, _, err := f.c.Object(container, directory)
-		if err == nil && info.ContentType != directoryMarkerContentType {
-			f.root = path.Dir(directory)
-			if f.root == "." {
-				f.root = ""
-			} else {
-				f.root += "/"
-			}
+	if fallbackRegions := fs.ConfigFileGet(name, "fallback_regions"); fallbackRegions != "" {
+		if storageURL != "" {
+			return nil, errors.New("can't use fallback_regions with storage_url")
+		}
+		a, ok := f.c.Auth.(*auth)
+		if !ok {
+			a = newAuth(f.c.Auth, "")
+			f.c.Auth = a
+		}
+		f.failover = newRegionFailover(a, f.c.Region, fallbackRegions)
+	}
+	if f.downloadTempURL && f.readTempURLKey() == "" {
+		return nil, errors.Errorf("download_temp_url needs a temp URL key - set temp_url_key in the config or %s on the account", accountTempURLKeyHeader)
+	}
+	if f.root != "" && !fs.ConfigFileGetBool(name, "no_head_object", false) && !f.writeOnly {
+		// Check to see if the object exists - ignoring directory
+		// markers.  Any error, eg a 403 from servers which return
+		// that for missing objects, means the root is a directory.
+		encodedDirectory := f.encodeName(directory)
+		var info swift.Object
+		err = f.pacer.Call(func() (bool, error) {
+			info, _, err = f.c.Object(container, encodedDirectory)
+			return f.shouldRetry(err)
+		})
+		if err == nil && !f.isMarkerContentType(info.ContentType) && !f.isPlaceholder(&info) {
+			// Don't use path.Dir here as it would clean
+			// doubled slashes out of the object name
+			f.root = encodedDirectory[:strings.LastIndex(encodedDirectory, "/")+1]
 			// return an error with an fs which points to the parent
 			return f, fs.ErrorIsFile
 		}
 	}
+	if f.root != "" {
+		f.root += "/"
+	}
 	return f, nil
 }
 
@@ -271,6 +852,18 @@ func NewFs(name, root string) (fs.Fs, error) {
 	return NewFsWithConnection(name, root, c, false)
 }
 
+// needsMetadata returns true if the listing info for an object can't
+// be trusted so the full metadata needs to be read.
+//
+// Note that due to a quirk of swift, dynamic large objects are
+// returned as 0 bytes in the listing.  Correct this by making sure we
+// read the full metadata for all 0 byte files unless the user has told
+// us there aren't any large objects.  We don't read the metadata for
+// directory marker objects.
+func (f *Fs) needsMetadata(info *swift.Object) bool {
+	return info.Bytes == 0 && !f.isMarkerContentType(info.ContentType) && !f.isPlaceholder(info) && !f.noLargeObjects
+}
+
 // Return an Object from a path
 //
 // If it can't be found it returns the error fs.ErrorObjectNotFound.
@@ -279,11 +872,9 @@ func (f *Fs) newObjectWithInfo(remote string, info *swift.Object) (fs.Object, er
 		fs:     f,
 		remote: remote,
 	}
-	// Note that due to a quirk of swift, dynamic large objects are
-	// returned as 0 bytes in the listing.  Correct this here by
-	// making sure we read the full metadata for all 0 byte files.
-	// We don't read the metadata for directory marker objects.
-	if info != nil && info.Bytes == 0 && info.ContentType != "application/directory" {
+	if info != nil && f.needsMetadata(info) {
+		// Keep the stored name to read the metadata with
+		o.info.Name = info.Name
 		info = nil
 	}
 	if info != nil {
@@ -300,11 +891,46 @@ func (f *Fs) newObjectWithInfo(remote string, info *swift.Object) (fs.Object, er
 
 // NewObject finds the Object at remote.  If it can't be found it
 // returns the error fs.ErrorObjectNotFound.
+//
+// If normalize_names is set and remote isn't stored with that name
+// then its directory is listed to find an object which normalizes
+// to the same name.
 func (f *Fs) NewObject(remote string) (fs.Object, error) {
-	return f.newObjectWithInfo(remote, nil)
+	o, err := f.newObjectWithInfo(remote, nil)
+	if err == fs.ErrorObjectNotFound && f.normalizeNames {
+		return f.findNormalized(remote)
+	}
+	return o, err
+}
+
+// findNormalized finds the object whose normalized name is the same
+// as remote's or returns fs.ErrorObjectNotFound
+func (f *Fs) findNormalized(remote string) (fs.Object, error) {
+	want := norm.NFC.String(remote)
+	dir := parentDir(remote)
+	f.findStoredDir(dir)
+	var found fs.Object
+	err := f.list(dir, false, func(entry fs.DirEntry) error {
+		if o, ok := entry.(fs.Object); ok && found == nil && o.Remote() == want {
+			found = o
+		}
+		return nil
+	})
+	if err == fs.ErrorDirNotFound {
+		return nil, fs.ErrorObjectNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if found == nil {
+		return nil, fs.ErrorObjectNotFound
+	}
+	return found, nil
 }
 
 // listFn is called from list and listContainerRoot to handle an object.
+//
+// object is reused for the next entry so must be copied if it is kept.
 type listFn func(remote string, object *swift.Object, isDirectory bool) error
 
 // listContainerRoot lists the objects into the function supplied from
@@ -314,68 +940,339 @@ type listFn func(remote string, object *swift.Object, isDirectory bool) error
 func (f *Fs) listContainerRoot(container, root string, dir string, recurse bool, fn listFn) error {
 	prefix := root
 	if dir != "" {
-		prefix += dir + "/"
+		prefix += f.encodeName(dir) + "/"
 	}
-	// Options for ObjectsWalk
-	opts := swift.ObjectsOpts{
-		Prefix: prefix,
-		Limit:  listChunks,
+	prefix = f.storedPrefix(prefix)
+	// Names are compared and cut after normalizing if required
+	normRoot, normPrefix := f.normalize(root), f.normalize(prefix)
+	var seen map[string]struct{} // normalized names seen, to warn about duplicates
+	if f.normalizeNames {
+		seen = make(map[string]struct{})
 	}
-	if !recurse {
-		opts.Delimiter = '/'
+	params := url.Values{}
+	params.Set("format", "json")
+	params.Set("limit", strconv.Itoa(f.listChunk))
+	if prefix != "" {
+		params.Set("prefix", prefix)
 	}
-	rootLength := len(root)
-	return f.c.ObjectsWalk(container, &opts, func(opts *swift.ObjectsOpts) (interface{}, error) {
-		objects, err := f.c.Objects(container, opts)
-		if err == nil {
-			for i := range objects {
-				object := &objects[i]
-				isDirectory := false
-				if !recurse {
-					isDirectory = strings.HasSuffix(object.Name, "/")
-				}
-				if !strings.HasPrefix(object.Name, prefix) {
-					fs.Logf(f, "Odd name received %q", object.Name)
-					continue
-				}
-				if object.Name == prefix {
-					// If we have zero length directory markers ending in / then swift
-					// will return them in the listing for the directory which causes
-					// duplicate directories.  Ignore them here.
-					continue
+	if !recurse {
+		params.Set("delimiter", "/")
+	}
+	rootLength := len(normRoot)
+	var (
+		object swift.Object // each entry is decoded into this in turn
+		fnErr  error        // error returned from fn
+	)
+	// This does the same as ObjectsWalk but can carry on past
+	// short pages for servers which return them early, and
+	// doesn't keep whole pages in memory
+	for {
+		n, last := 0, ""
+		err := f.listJSON(container, params, func(dec *json.Decoder) error {
+			object = swift.Object{}
+			err := dec.Decode(&object)
+			if err != nil {
+				return err
+			}
+			err = parseObject(&object)
+			if err != nil {
+				return err
+			}
+			n++
+			last = object.Name
+			isDirectory := false
+			if !recurse {
+				isDirectory = object.PseudoDirectory || f.isDirectoryMarker(&object)
+			}
+			name := f.normalize(object.Name)
+			if !strings.HasPrefix(name, normPrefix) {
+				fs.Logf(f, "Odd name received %q", object.Name)
+				return nil
+			}
+			if object.Name == prefix && f.isDirectoryMarker(&object) {
+				// If we have zero length directory markers ending in / then swift
+				// will return them in the listing for the directory which causes
+				// duplicate directories.  Ignore them here.
+				return nil
+			}
+			remote := f.decodeName(name[rootLength:])
+			if seen != nil {
+				if name != object.Name {
+					f.addStoredPrefixes(object.Name)
 				}
-				remote := object.Name[rootLength:]
-				err = fn(remote, object, isDirectory)
-				if err != nil {
-					break
+				if _, ok := seen[name]; ok {
+					fs.Logf(f, "Duplicate name %q after normalization - listing all the objects with it", remote)
 				}
+				seen[name] = struct{}{}
+			}
+			fnErr = fn(remote, &object, isDirectory)
+			return fnErr
+		})
+		if fnErr != nil {
+			return fnErr
+		}
+		if err != nil {
+			if errors.Cause(err) == swift.Forbidden {
+				return errors.Wrapf(err, "failed to list container %q prefix %q - the credentials may not have permission to list it", container, prefix)
 			}
+			return errors.Wrapf(err, "failed to list container %q prefix %q", container, prefix)
+		}
+		if !f.morePages(n, f.listChunk) {
+			return nil
+		}
+		params.Set("marker", last)
+	}
+}
+
+// parseObject fills in the fields of an object decoded from a listing
+// in the same way as swift.Connection.Objects does
+func parseObject(object *swift.Object) (err error) {
+	if object.SubDir != "" {
+		object.Name = object.SubDir
+		object.PseudoDirectory = true
+		object.ContentType = directoryMarkerContentType
+	}
+	if object.ServerLastModified != "" {
+		// Remove fractional seconds, eg 2012-11-11T14:49:47.887250,
+		// to be consistent with the time read from the object
+		datetime := object.ServerLastModified
+		if i := strings.IndexByte(datetime, '.'); i >= 0 {
+			datetime = datetime[:i]
+		}
+		object.LastModified, err = time.Parse(swift.TimeFormat, datetime)
+	}
+	return err
+}
+
+// listJSON GETs a JSON listing of the container, or of the account if
+// container is "", with the parameters passed.  It calls fn to decode
+// each entry of the listing in turn as it is read so the whole page
+// never needs to be held in memory.
+//
+// Errors from fn are returned as is.
+func (f *Fs) listJSON(container string, params url.Values, fn func(dec *json.Decoder) error) (err error) {
+	var resp *http.Response
+	err = f.pacer.Call(func() (bool, error) {
+		resp, _, err = f.c.Call(f.c.StorageUrl, swift.RequestOpts{
+			Container:  container,
+			Operation:  "GET",
+			Parameters: params,
+			ErrorMap:   swift.ContainerErrorMap,
+			OnReAuth: func() (string, error) {
+				return f.c.StorageUrl, nil
+			},
+		})
+		return f.shouldRetry(err)
+	})
+	if err != nil {
+		return err
+	}
+	defer func() {
+		// Read the rest of the body so the connection can be reused
+		_, _ = io.Copy(ioutil.Discard, resp.Body)
+		closeErr := resp.Body.Close()
+		if err == nil {
+			err = closeErr
 		}
-		return objects, err
+	}()
+	dec := json.NewDecoder(resp.Body)
+	token, err := dec.Token()
+	if err == io.EOF || (err == nil && token == nil) {
+		// An empty page may have no body or be null
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != '[' {
+		return errors.Errorf("expecting a JSON list but got %v", token)
+	}
+	for dec.More() {
+		err = fn(dec)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = dec.Token()
+	return err
+}
+
+// findStoredDir lists the directories above dir so the stored names
+// of any of them which normalize differently are known.  Errors are
+// ignored as listing dir will find them.
+func (f *Fs) findStoredDir(dir string) {
+	if dir == "" {
+		return
+	}
+	prefix := f.root + f.encodeName(dir) + "/"
+	if f.storedPrefix(prefix) != prefix {
+		return
+	}
+	parent := parentDir(dir)
+	f.findStoredDir(parent)
+	_ = f.listContainerRoot(f.container, f.root, parent, false, func(remote string, object *swift.Object, isDirectory bool) error {
+		return nil
 	})
 }
 
+// normalize returns name normalized to NFC if normalize_names is set
+func (f *Fs) normalize(name string) string {
+	if !f.normalizeNames {
+		return name
+	}
+	return norm.NFC.String(name)
+}
+
+// addStoredPrefixes remembers the directory prefixes of the stored
+// object name whose normalized forms are different, so listings of
+// those directories can use the stored prefix.
+func (f *Fs) addStoredPrefixes(name string) {
+	f.dirNamesMu.Lock()
+	defer f.dirNamesMu.Unlock()
+	for i := 0; i < len(name); i++ {
+		if name[i] != '/' {
+			continue
+		}
+		stored := name[:i+1]
+		if normalized := norm.NFC.String(stored); normalized != stored {
+			f.dirNames[normalized] = stored
+		}
+	}
+}
+
+// storedPrefix returns the stored form of a listing prefix made from
+// normalized names if one has been seen, otherwise prefix
+func (f *Fs) storedPrefix(prefix string) string {
+	if !f.normalizeNames {
+		return prefix
+	}
+	f.dirNamesMu.Lock()
+	defer f.dirNamesMu.Unlock()
+	if stored, ok := f.dirNames[prefix]; ok {
+		return stored
+	}
+	return prefix
+}
+
+// morePages returns true if another listing page should be fetched
+// after receiving a page of n entries from a request for limit
+func (f *Fs) morePages(n, limit int) bool {
+	switch {
+	case n == 0:
+		return false
+	case n >= limit, f.fetchUntilEmpty:
+		return true
+	case f.partialPageFetch > 0:
+		return n*100 >= limit*f.partialPageFetch
+	}
+	return false
+}
+
 type addEntryFn func(fs.DirEntry) error
 
 // list the objects into the function supplied
+//
+// Objects which need their metadata read before they can be returned
+// are read by up to fs.Config.Checkers goroutines while the listing
+// carries on, so entries may be returned in any order.  fn is never
+// called concurrently.
+//
+// It returns fs.ErrorDirNotFound if the container doesn't exist.
 func (f *Fs) list(dir string, recurse bool, fn addEntryFn) error {
-	return f.listContainerRoot(f.container, f.root, dir, recurse, func(remote string, object *swift.Object, isDirectory bool) (err error) {
+	var (
+		mu       sync.Mutex // protects fn and firstErr
+		firstErr error      // first error returned from fn or a metadata read
+		wg       sync.WaitGroup
+	)
+	checkers := fs.Config.Checkers
+	if checkers < 1 {
+		checkers = 1
+	}
+	tokens := make(chan struct{}, checkers)
+	// setErr records err if it is the first error
+	setErr := func(err error) {
+		mu.Lock()
+		if firstErr == nil {
+			firstErr = err
+		}
+		mu.Unlock()
+	}
+	// add calls fn with the entry unless an error has already occurred
+	add := func(entry fs.DirEntry) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if firstErr != nil {
+			return firstErr
+		}
+		err := fn(entry)
+		if err != nil {
+			firstErr = err
+		}
+		return err
+	}
+	// addObject adds the object if it is storable
+	addObject := func(remote string, info *swift.Object) error {
+		o, err := f.newObjectWithInfo(remote, info)
+		if err != nil {
+			setErr(err)
+			return err
+		}
+		if !o.Storable() {
+			return nil
+		}
+		return add(o)
+	}
+	err := f.listContainerRoot(f.container, f.root, dir, recurse, func(remote string, object *swift.Object, isDirectory bool) error {
+		// When recursing, directory markers ending in / are
+		// returned as directories as they would be with a
+		// delimiter listing.
+		if recurse && f.isDirectoryMarker(object) {
+			isDirectory = true
+		}
+		if !isDirectory && strings.HasSuffix(remote, "/") {
+			fs.Logf(f, "Object %q has a name ending in / - it is listed but can't be stored on most other remotes", remote)
+		}
 		if isDirectory {
-			remote = strings.TrimRight(remote, "/")
-			d := fs.NewDir(remote, time.Time{}).SetSize(object.Bytes)
-			err = fn(d)
-		} else {
-			o, err := f.newObjectWithInfo(remote, object)
-			if err != nil {
-				return err
-			}
-			// Storable does a full metadata read on 0 size objects which might be dynamic large objects
-			if o.Storable() {
-				err = fn(o)
+			// Only remove the last / so doubled slashes in
+			// names make directories ending in /
+			remote = strings.TrimSuffix(remote, "/")
+			if remote == "" {
+				fs.Logf(f, "Ignoring directory with empty name from objects with names starting with / - use --fast-list to see them")
+				return nil
 			}
+			return add(f.newDir(remote, object.Bytes))
 		}
-		return err
+		if !f.needsMetadata(object) {
+			return addObject(remote, object)
+		}
+		// Read the metadata in the background, stopping the
+		// listing if any of the reads have failed
+		mu.Lock()
+		err := firstErr
+		mu.Unlock()
+		if err != nil {
+			return err
+		}
+		tokens <- struct{}{}
+		wg.Add(1)
+		info := *object
+		go func() {
+			defer func() {
+				<-tokens
+				wg.Done()
+			}()
+			_ = addObject(remote, &info)
+		}()
+		return nil
 	})
+	wg.Wait()
+	if firstErr != nil {
+		return firstErr
+	}
+	if errors.Cause(err) == swift.ContainerNotFound {
+		err = fs.ErrorDirNotFound
+	}
+	return err
 }
 
 // listDir lists a single directory
@@ -389,30 +1286,99 @@ func (f *Fs) listDir(dir string) (entries fs.DirEntries, err error) {
 		return nil
 	})
 	if err != nil {
-		if err == swift.ContainerNotFound {
-			err = fs.ErrorDirNotFound
-		}
 		return nil, err
 	}
 	return entries, nil
 }
 
+// listContainersFn is called from listContainersRoot for each container
+//
+// The container is reused for the next entry so must be copied if it
+// is kept.
+type listContainersFn func(*swift.Container) error
+
+// listContainersRoot calls fn for each container in the account a
+// page at a time.  If fn returns an error then the listing stops and
+// that error is returned.
+func (f *Fs) listContainersRoot(fn listContainersFn) error {
+	params := url.Values{}
+	params.Set("format", "json")
+	params.Set("limit", strconv.Itoa(f.listChunk))
+	var (
+		container swift.Container // each entry is decoded into this in turn
+		fnErr     error           // error returned from fn
+	)
+	for {
+		n, last := 0, ""
+		err := f.listJSON("", params, func(dec *json.Decoder) error {
+			container = swift.Container{}
+			err := dec.Decode(&container)
+			if err != nil {
+				return err
+			}
+			n++
+			last = container.Name
+			fnErr = fn(&container)
+			return fnErr
+		})
+		if fnErr != nil {
+			return fnErr
+		}
+		if err != nil {
+			return errors.Wrap(err, "container listing failed")
+		}
+		if !f.morePages(n, f.listChunk) {
+			return nil
+		}
+		params.Set("marker", last)
+	}
+}
+
 // listContainers lists the containers
 func (f *Fs) listContainers(dir string) (entries fs.DirEntries, err error) {
 	if dir != "" {
 		return nil, fs.ErrorListBucketRequired
 	}
-	containers, err := f.c.ContainersAll(nil)
-	if err != nil {
-		return nil, errors.Wrap(err, "container listing failed")
-	}
-	for _, container := range containers {
-		d := fs.NewDir(container.Name, time.Time{}).SetSize(container.Bytes).SetItems(container.Count)
+	err = f.listContainersRoot(func(container *swift.Container) error {
+		d := fs.NewDir(container.Name, f.containerTime(container.Name)).SetSize(container.Bytes).SetItems(container.Count)
 		entries = append(entries, d)
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 	return entries, nil
 }
 
+// containerTime returns the time the container was created if
+// container_timestamps is set, or the zero time if not or if it
+// couldn't be read.
+func (f *Fs) containerTime(container string) time.Time {
+	if !f.containerTimes {
+		return time.Time{}
+	}
+	var headers swift.Headers
+	err := f.pacer.Call(func() (bool, error) {
+		var err error
+		_, headers, err = f.c.Container(container)
+		return f.shouldRetry(err)
+	})
+	if err != nil {
+		fs.Debugf(f, "Failed to read timestamp of container %q: %v", container, err)
+		return time.Time{}
+	}
+	timestamp := headers["X-Timestamp"]
+	if timestamp == "" {
+		return time.Time{}
+	}
+	t, err := swift.FloatStringToTime(timestamp)
+	if err != nil {
+		fs.Debugf(f, "Failed to parse timestamp %q of container %q: %v", timestamp, container, err)
+		return time.Time{}
+	}
+	return t
+}
+
 // List the objects and directories in dir into entries.  The
 // entries can be returned in any order but should be for a
 // complete directory.
@@ -450,72 +1416,169 @@ func (f *Fs) ListR(dir string, callback fs.ListRCallback) (err error) {
 		return errors.New("container needed for recursive list")
 	}
 	list := fs.NewListRHelper(callback)
+	// Directories don't necessarily have marker objects so make a
+	// directory entry for each level above every entry exactly once.
+	// They are added from the top down so the entries stay grouped
+	// by directory.
+	seen := make(map[string]struct{})
+	addDir := func(d fs.DirEntry) error {
+		if _, ok := seen[d.Remote()]; ok {
+			return nil
+		}
+		seen[d.Remote()] = struct{}{}
+		return list.Add(d)
+	}
 	err = f.list(dir, true, func(entry fs.DirEntry) error {
+		var parents []string
+		for parent := parentDir(entry.Remote()); parent != "" && parent != dir; parent = parentDir(parent) {
+			if _, ok := seen[parent]; ok {
+				break
+			}
+			parents = append(parents, parent)
+		}
+		for i := len(parents) - 1; i >= 0; i-- {
+			err := addDir(f.newDir(parents[i], -1))
+			if err != nil {
+				return err
+			}
+		}
+		if _, isDir := entry.(fs.Directory); isDir {
+			return addDir(entry)
+		}
 		return list.Add(entry)
 	})
 	if err != nil {
 		return err
 	}
-	return list.Flush()
+	return list.Flush()
+}
+
+// Put the object into the container
+//
+// Copy the reader in to the new object which is returned
+//
+// The new object may have been created if an error is returned
+func (f *Fs) Put(in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (fs.Object, error) {
+	// Temporary Object under construction
+	fs := &Object{
+		fs:     f,
+		remote: src.Remote(),
+	}
+	return fs, fs.Update(in, src, options...)
+}
+
+// containerKey returns the key for container in the containers cache
+func (f *Fs) containerKey(container string) (string, error) {
+	if !f.c.Authenticated() {
+		err := f.pacer.Call(func() (bool, error) {
+			err := f.c.Authenticate()
+			return shouldRetry(err)
+		})
+		if err != nil {
+			return "", err
+		}
+	}
+	return f.c.StorageUrl + "/" + container, nil
+}
+
+// makeContainer creates container if it isn't known to exist.
+//
+// If check is set then it checks whether the container exists before
+// creating it.
+func (f *Fs) makeContainer(container string, check bool) error {
+	key, err := f.containerKey(container)
+	if err != nil {
+		return err
+	}
+	return containers.ensure(key, func() error {
+		return f.createContainer(container, check)
+	})
 }
 
-// Put the object into the container
-//
-// Copy the reader in to the new object which is returned
-//
-// The new object may have been created if an error is returned
-func (f *Fs) Put(in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (fs.Object, error) {
-	// Temporary Object under construction
-	fs := &Object{
-		fs:     f,
-		remote: src.Remote(),
+// createContainer creates container, checking whether it exists
+// first if check is set
+func (f *Fs) createContainer(container string, check bool) error {
+	var err error = swift.ContainerNotFound
+	if check {
+		err = f.pacer.Call(func() (bool, error) {
+			_, _, err = f.c.Container(container)
+			return f.shouldRetry(err)
+		})
 	}
-	return fs, fs.Update(in, src, options...)
+	if err == swift.ContainerNotFound {
+		err = f.pacer.Call(func() (bool, error) {
+			err = f.c.ContainerCreate(container, nil)
+			return f.shouldRetry(err)
+		})
+		if err == swift.Forbidden && f.writeOnly {
+			fs.Debugf(f, "Assuming container %q exists as creating it is forbidden", container)
+			return nil
+		}
+		if err != nil {
+			return errors.Wrapf(err, "failed to create container %q", container)
+		}
+	}
+	if err != nil {
+		return errors.Wrapf(err, "failed to read container %q", container)
+	}
+	return nil
+}
+
+// deleteContainer deletes container and forgets it exists
+func (f *Fs) deleteContainer(container string) error {
+	key, err := f.containerKey(container)
+	if err != nil {
+		return err
+	}
+	err = f.pacer.Call(func() (bool, error) {
+		err = f.c.ContainerDelete(container)
+		return f.shouldRetry(err)
+	})
+	if err != nil {
+		return errors.Wrapf(err, "failed to delete container %q", container)
+	}
+	containers.forget(key)
+	return nil
 }
 
-// Mkdir creates the container if it doesn't exist
+// Mkdir creates the container if it doesn't exist, and a directory
+// marker for dir if it has no objects in it
 func (f *Fs) Mkdir(dir string) error {
-	f.containerOKMu.Lock()
-	defer f.containerOKMu.Unlock()
-	if f.containerOK {
-		return nil
+	err := f.makeRootContainer()
+	if err != nil || f.container == "" || (f.root == "" && dir == "") {
+		return err
 	}
+	// Make a directory marker so the empty directory exists, the
+	// root too if it is a directory in the container
+	return f.makeMarker(dir)
+}
+
+// makeRootContainer makes the container if it doesn't exist, without
+// making a directory marker for the root as Mkdir("") does
+func (f *Fs) makeRootContainer() error {
 	// if we are at the root, then it is OK
 	if f.container == "" {
 		return nil
 	}
-	// Check to see if container exists first
-	var err error = swift.ContainerNotFound
-	if !f.noCheckContainer {
-		_, _, err = f.c.Container(f.container)
-	}
-	if err == swift.ContainerNotFound {
-		err = f.c.ContainerCreate(f.container, nil)
-	}
-	if err == nil {
-		f.containerOK = true
-	}
-	return err
+	return f.makeContainer(f.container, !f.noCheckContainer)
 }
 
 // Rmdir deletes the container if the fs is at the root
 //
 // Returns an error if it isn't empty
 func (f *Fs) Rmdir(dir string) error {
-	f.containerOKMu.Lock()
-	defer f.containerOKMu.Unlock()
 	if f.root != "" || dir != "" {
-		return nil
+		// Remove any marker DirSetModTime made
+		return f.removeMarker(dir)
 	}
-	err := f.c.ContainerDelete(f.container)
-	if err == nil {
-		f.containerOK = false
-	}
-	return err
+	return f.deleteContainer(f.container)
 }
 
 // Precision of the remote
 func (f *Fs) Precision() time.Duration {
+	if f.useServerModTime {
+		return time.Second
+	}
 	return time.Nanosecond
 }
 
@@ -527,14 +1590,23 @@ func (f *Fs) Purge() error {
 	toBeDeleted := make(chan fs.Object, fs.Config.Transfers)
 	delErr := make(chan error, 1)
 	go func() {
-		delErr <- fs.DeleteFiles(toBeDeleted)
+		deleted, failed, err := fs.DeleteFilesCount(toBeDeleted)
+		fs.Debugf(f, "Purge deleted %d objects with %d failures", deleted, failed)
+		delErr <- err
 	}()
-	err := f.list("", true, func(entry fs.DirEntry) error {
-		if o, ok := entry.(*Object); ok {
-			toBeDeleted <- o
+	// List the raw objects so directory markers and objects with
+	// names ending in / are deleted too
+	err := f.listContainerRoot(f.container, f.root, "", true, func(remote string, object *swift.Object, isDirectory bool) error {
+		toBeDeleted <- &Object{
+			fs:     f,
+			remote: remote,
+			info:   *object,
 		}
 		return nil
 	})
+	if errors.Cause(err) == swift.ContainerNotFound {
+		err = fs.ErrorDirNotFound
+	}
 	close(toBeDeleted)
 	delError := <-delErr
 	if err == nil {
@@ -556,7 +1628,7 @@ func (f *Fs) Purge() error {
 //
 // If it isn't possible then return fs.ErrorCantCopy
 func (f *Fs) Copy(src fs.Object, remote string) (fs.Object, error) {
-	err := f.Mkdir("")
+	err := f.makeRootContainer()
 	if err != nil {
 		return nil, err
 	}
@@ -566,18 +1638,132 @@ func (f *Fs) Copy(src fs.Object, remote string) (fs.Object, error) {
 		return nil, fs.ErrorCantCopy
 	}
 	srcFs := srcObj.fs
-	_, err = f.c.ObjectCopy(srcFs.container, srcFs.root+srcObj.remote, f.container, f.root+remote, nil)
+	if f.preserveManifestOnCopy && srcFs.c.StorageUrl == f.c.StorageUrl {
+		isDynamicLargeObject, err := srcObj.isDynamicLargeObject()
+		if err != nil {
+			return nil, err
+		}
+		if isDynamicLargeObject {
+			return f.copyManifest(srcObj, remote)
+		}
+	}
+	// No Content-Type is sent so the copy keeps the source's
+	err = f.pacer.Call(func() (bool, error) {
+		_, err = f.c.ObjectCopy(srcFs.container, srcObj.name(), f.container, f.objectName(remote), nil)
+		return f.shouldRetry(err)
+	})
 	if err != nil {
-		return nil, err
+		return nil, errors.Wrapf(err, "failed to copy %q in container %q to %q in container %q", srcObj.name(), srcFs.container, f.objectName(remote), f.container)
+	}
+	return f.NewObject(remote)
+}
+
+// copyManifest copies the dynamic large object srcObj to remote by
+// making a manifest with the same X-Object-Manifest, so the copy
+// refers to the same segments rather than having its own copy of the
+// data
+//
+// Call with srcObj's metadata read
+func (f *Fs) copyManifest(srcObj *Object, remote string) (fs.Object, error) {
+	headers := swift.Headers{"Content-Length": "0"}
+	for k, v := range *srcObj.headers {
+		if k == "X-Object-Manifest" || k == "Content-Disposition" || k == "Content-Encoding" || strings.HasPrefix(k, "X-Object-Meta-") {
+			headers[k] = v
+		}
+	}
+	name := f.objectName(remote)
+	fs.Debugf(srcObj, "Copying manifest to %q in container %q", name, f.container)
+	err := f.pacer.Call(func() (bool, error) {
+		_, err := f.c.ObjectPut(f.container, name, bytes.NewReader(nil), true, "", srcObj.info.ContentType, headers)
+		return f.shouldRetry(err)
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to copy manifest of %q in container %q to %q in container %q", srcObj.name(), srcObj.fs.container, name, f.container)
 	}
 	return f.NewObject(remote)
 }
 
+// UserInfo returns info about the account the remote resolves to
+//
+// This includes the storage URL, the account name parsed from it,
+// the usage of the account and any quotas set on it.
+func (f *Fs) UserInfo() (map[string]string, error) {
+	var info swift.Account
+	var headers swift.Headers
+	err := f.pacer.Call(func() (bool, error) {
+		var err error
+		info, headers, err = f.c.Account()
+		return f.shouldRetry(err)
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read account info")
+	}
+	userInfo := map[string]string{
+		"StorageURL": f.c.StorageUrl,
+		"Account":    accountName(f.c.StorageUrl),
+		"BytesUsed":  strconv.FormatInt(info.BytesUsed, 10),
+		"Objects":    strconv.FormatInt(info.Objects, 10),
+		"Containers": strconv.FormatInt(info.Containers, 10),
+	}
+	for key, value := range map[string]string{
+		"User":       f.c.UserName,
+		"Tenant":     f.c.Tenant,
+		"TenantId":   f.c.TenantId,
+		"Domain":     f.c.Domain,
+		"Region":     f.c.Region,
+		"QuotaBytes": headers[accountQuotaBytesHeader],
+		"QuotaCount": headers[accountQuotaCountHeader],
+	} {
+		if value != "" {
+			userInfo[key] = value
+		}
+	}
+	return userInfo, nil
+}
+
+// accountName returns the account name from the storage URL passed
+// in - this is the last path element, eg AUTH_xxx
+func accountName(storageURL string) string {
+	u, err := url.Parse(storageURL)
+	if err != nil {
+		return ""
+	}
+	return path.Base(strings.TrimRight(u.Path, "/"))
+}
+
 // Hashes returns the supported hash sets.
 func (f *Fs) Hashes() fs.HashSet {
 	return fs.HashSet(fs.HashMD5)
 }
 
+// About gets quota information from the account headers
+func (f *Fs) About() (*fs.Usage, error) {
+	var info swift.Account
+	var headers swift.Headers
+	err := f.pacer.Call(func() (bool, error) {
+		var err error
+		info, headers, err = f.c.Account()
+		return f.shouldRetry(err)
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "about failed")
+	}
+	usage := &fs.Usage{
+		Used:    fs.NewUsageValue(info.BytesUsed),
+		Objects: fs.NewUsageValue(info.Objects),
+	}
+	if quotaString, ok := headers[accountQuotaBytesHeader]; ok {
+		quota, err := strconv.ParseInt(quotaString, 10, 64)
+		if err != nil {
+			fs.Debugf(f, "Failed to parse %s %q: %v", accountQuotaBytesHeader, quotaString, err)
+		} else {
+			usage.Total = fs.NewUsageValue(quota)
+			usage.Free = fs.NewUsageValue(quota - info.BytesUsed)
+		}
+	}
+	return usage, nil
+}
+
 // ------------------------------------------------------------
 
 // Fs returns the parent Fs
@@ -598,11 +1784,25 @@ func (o *Object) Remote() string {
 	return o.remote
 }
 
+// name returns the name of the object in the container.  This is the
+// name it was listed or read with if known as that may not be the
+// same as the one made from remote if normalize_names is set.
+func (o *Object) name() string {
+	if o.info.Name != "" {
+		return o.info.Name
+	}
+	return o.fs.objectName(o.remote)
+}
+
 // Hash returns the Md5sum of an object returning a lowercase hex string
 func (o *Object) Hash(t fs.HashType) (string, error) {
 	if t != fs.HashMD5 {
 		return "", fs.ErrHashUnsupported
 	}
+	if o.fs.noLargeObjects {
+		// Every Etag is the MD5SUM of the object
+		return strings.ToLower(o.info.Hash), nil
+	}
 	isDynamicLargeObject, err := o.isDynamicLargeObject()
 	if err != nil {
 		return "", err
@@ -656,24 +1856,66 @@ func (o *Object) readMetaData() (err error) {
 	if o.headers != nil {
 		return nil
 	}
-	info, h, err := o.fs.c.Object(o.fs.container, o.fs.root+o.remote)
+	var info swift.Object
+	var h swift.Headers
+	err = o.fs.callObject(func() (err error) {
+		info, h, err = o.fs.c.Object(o.fs.container, o.name())
+		return err
+	})
 	if err != nil {
 		if err == swift.ObjectNotFound {
 			return fs.ErrorObjectNotFound
 		}
-		return err
+		if err == swift.Forbidden && o.fs.writeOnly {
+			// Treat objects which can't be read as missing so
+			// they are uploaded
+			fs.Debugf(o, "Treating object as missing as reading it is forbidden")
+			return fs.ErrorObjectNotFound
+		}
+		return errors.Wrapf(err, "failed to read metadata of %q in container %q", o.name(), o.fs.container)
 	}
 	o.info = info
 	o.headers = &h
+	if expires := o.expires(); !expires.IsZero() {
+		fs.Debugf(o, "Object expires at %s", expires.Format(time.RFC3339))
+	}
 	return nil
 }
 
+// expires returns the time the object is due to be deleted from its
+// X-Delete-At header, or the zero time if it isn't or its metadata
+// hasn't been read.
+//
+// Only objects which have been HEADed have this so listings don't
+// need any extra transactions.
+func (o *Object) expires() time.Time {
+	if o.headers == nil {
+		return time.Time{}
+	}
+	deleteAt := (*o.headers)["X-Delete-At"]
+	if deleteAt == "" {
+		return time.Time{}
+	}
+	seconds, err := strconv.ParseInt(deleteAt, 10, 64)
+	if err != nil {
+		fs.Debugf(o, "Failed to parse X-Delete-At %q: %v", deleteAt, err)
+		return time.Time{}
+	}
+	return time.Unix(seconds, 0)
+}
+
 // ModTime returns the modification time of the object
 //
 //
 // It attempts to read the objects mtime and if that isn't present the
 // LastModified returned in the http headers
+//
+// If use_server_modtime is set then it returns the LastModified from
+// the listing without reading the metadata.
 func (o *Object) ModTime() time.Time {
+	if o.fs.useServerModTime {
+		return o.info.LastModified
+	}
 	err := o.readMetaData()
 	if err != nil {
 		fs.Debugf(o, "Failed to read metadata: %s", err)
@@ -688,11 +1930,21 @@ func (o *Object) ModTime() time.Time {
 }
 
 // SetModTime sets the modification time of the local fs object
+//
+// If use_server_modtime is set it does nothing as the time set
+// wouldn't be read back.
 func (o *Object) SetModTime(modTime time.Time) error {
+	if o.fs.useServerModTime {
+		fs.Debugf(o, "Not setting modification time as use_server_modtime is set")
+		return nil
+	}
 	err := o.readMetaData()
 	if err != nil {
 		return err
 	}
+	if expires := o.expires(); !expires.IsZero() {
+		fs.Logf(o, "Object is due to expire at %s - setting its modification time doesn't change that", expires.Format(time.RFC3339))
+	}
 	meta := o.headers.ObjectMetadata()
 	meta.SetModTime(modTime)
 	newHeaders := meta.ObjectHeaders()
@@ -705,23 +1957,249 @@ func (o *Object) SetModTime(modTime time.Time) error {
 			newHeaders[k] = v
 		}
 	}
-	return o.fs.c.ObjectUpdate(o.fs.container, o.fs.root+o.remote, newHeaders)
+	// The update replaces the metadata so set the upload headers
+	// again, unless the object has its own values for them
+	for k, v := range o.fs.uploadHeaders {
+		if _, ok := newHeaders[k]; !ok {
+			newHeaders[k] = v
+		}
+	}
+	err = o.fs.callObject(func() error {
+		return o.fs.c.ObjectUpdate(o.fs.container, o.name(), newHeaders)
+	})
+	if err != nil {
+		return objectError(errors.Wrapf(err, "failed to update metadata of %q in container %q", o.name(), o.fs.container))
+	}
+	return nil
+}
+
+// ContentEncoding returns the Content-Encoding the object was
+// uploaded with or "" if it doesn't have one
+func (o *Object) ContentEncoding() string {
+	err := o.readMetaData()
+	if err != nil {
+		fs.Logf(o, "Failed to read metadata: %v", err)
+		return ""
+	}
+	return (*o.headers)["Content-Encoding"]
 }
 
 // Storable returns if this object is storable
 //
-// It compares the Content-Type to directoryMarkerContentType - that
-// makes it a directory marker which is not storable.
+// It compares the Content-Type to directoryMarkerContentType and
+// directory_marker_content_types - that makes it a directory marker
+// which is not storable.  Placeholders named in
+// directory_marker_names aren't storable either.
 func (o *Object) Storable() bool {
-	return o.info.ContentType != directoryMarkerContentType
+	return !o.fs.isMarkerContentType(o.info.ContentType) && !o.fs.isPlaceholder(&o.info)
 }
 
 // Open an object for read
+//
+// The MD5SUM and size of the data are checked against the object's
+// when all of it has been read, unless only part of it is being read.
+// Large objects have no MD5SUM so only their size is checked, as it
+// is for all objects with --ignore-checksum.
+//
+// If-Match is sent with the ETag of objects which aren't large
+// objects so if the object changes during the download a retry error
+// is returned and the metadata is re-read.  The ETag from the listing
+// is used if the metadata hasn't been read rather than reading it.
+//
+// Ranges on empty objects or starting beyond the end of the object
+// return no data rather than an error, like reading a local file.
 func (o *Object) Open(options ...fs.OpenOption) (in io.ReadCloser, err error) {
-	headers := fs.OpenOptionHeaders(options)
-	_, isRanging := headers["Range"]
-	in, _, err = o.fs.c.ObjectOpen(o.fs.container, o.fs.root+o.remote, !isRanging, headers)
-	return
+	// Ask for the bytes as stored - otherwise the transport will
+	// decompress objects with a Content-Encoding of gzip and the
+	// size and MD5SUM won't match.
+	headers := swift.Headers{"Accept-Encoding": "identity"}
+	isRanging := false
+	var start int64 // offset the range starts at
+	for _, option := range options {
+		switch x := option.(type) {
+		case *fs.SeekOption:
+			if x.Offset > 0 {
+				headers["Range"] = fmt.Sprintf("bytes=%d-", x.Offset)
+				isRanging = true
+				start = x.Offset
+			}
+		case *fs.RangeOption:
+			if x.Start == 0 && (x.End < 0 || x.End >= o.Size()-1) {
+				// The range covers the whole object
+				continue
+			}
+			key, value := x.Header()
+			headers[key] = value
+			isRanging = true
+			if x.Start > 0 {
+				start = x.Start
+			}
+		default:
+			key, value := option.Header()
+			if key != "" && value != "" {
+				headers[key] = value
+			} else if option.Mandatory() {
+				fs.Logf(o, "Unsupported mandatory option: %v", option)
+			}
+		}
+	}
+	// Some servers return 416 Requested Range Not Satisfiable for
+	// ranges on empty objects or starting beyond the end so don't
+	// ask for them - there is nothing to read
+	if isRanging && o.Size() >= 0 && (o.Size() == 0 || start >= o.Size()) {
+		return ioutil.NopCloser(bytes.NewReader(nil)), nil
+	}
+	if !isRanging && o.fs.downloadConcurrency > 1 && o.Size() > int64(o.fs.downloadCutoff) {
+		in, err = o.openSegments()
+		if in != nil || err != nil {
+			return in, err
+		}
+	}
+	// Only ask for the MD5SUM if the metadata is already known as
+	// finding out whether this is a large object needs a HEAD -
+	// otherwise send the ETag from the listing and let the library
+	// check the MD5SUM.
+	md5sum := ""
+	etag := strings.ToLower(o.info.Hash)
+	knownType := o.headers != nil || o.fs.noLargeObjects
+	if knownType {
+		md5sum, err = o.Hash(fs.HashMD5)
+		if err != nil {
+			return nil, err
+		}
+		etag = md5sum
+	}
+	if etag != "" && !o.fs.noIfMatch {
+		headers["If-Match"] = etag
+	}
+	// Only check the size with --ignore-checksum
+	wantMD5 := md5sum
+	if fs.Config.IgnoreChecksum {
+		wantMD5 = ""
+	}
+	// Let the library check the hash if we aren't going to
+	checkHash := !isRanging && md5sum == "" && !fs.Config.IgnoreChecksum
+	var file io.ReadCloser
+	err = o.fs.callObject(func() (err error) {
+		if o.fs.downloadTempURL {
+			file, err = o.fs.openTempURL(o.fs.container, o.name(), headers, checkHash)
+		} else {
+			var objectFile *swift.ObjectOpenFile
+			objectFile, _, err = o.fs.c.ObjectOpen(o.fs.container, o.name(), checkHash, headers)
+			if err == nil {
+				file = objectFile
+			}
+		}
+		return err
+	})
+	if swiftErr, ok := err.(*swift.Error); ok && swiftErr.StatusCode == http.StatusPreconditionFailed {
+		o.headers = nil
+		readErr := o.readMetaData()
+		if readErr != nil {
+			return nil, readErr
+		}
+		if !knownType {
+			if md5sum, readErr = o.Hash(fs.HashMD5); readErr == nil && md5sum == "" {
+				// The ETag in the listing was a large
+				// object's so open it again without it
+				return o.Open(options...)
+			}
+		}
+		return nil, fs.RetryError(errors.Wrap(err, "object changed during download"))
+	}
+	if swiftErr, ok := err.(*swift.Error); ok && swiftErr.StatusCode == http.StatusRequestedRangeNotSatisfiable && isRanging {
+		// Only return no data if the object is now shorter
+		// than we thought so the range starts at or beyond
+		// the end - otherwise data would be silently missed
+		o.headers = nil
+		readErr := o.readMetaData()
+		if readErr != nil {
+			return nil, readErr
+		}
+		if o.Size() == 0 || start >= o.Size() {
+			fs.Debugf(o, "Range not satisfiable - returning no data: %v", err)
+			return ioutil.NopCloser(bytes.NewReader(nil)), nil
+		}
+	}
+	if err != nil {
+		return nil, objectError(errors.Wrapf(err, "failed to open %q in container %q", o.name(), o.fs.container))
+	}
+	if isRanging {
+		return file, nil
+	}
+	// Large objects have no MD5SUM but check their size as swift
+	// stops early without an error if segments are missing
+	return newHashCheckReader(file, wantMD5, o.Size()), nil
+}
+
+// hashCheckReader wraps a download and checks the MD5SUM and size of
+// the data match the object's once it has all been read.  Any
+// mismatch is returned from Read and Close as a retry error.
+type hashCheckReader struct {
+	in   io.ReadCloser
+	hash hash.Hash // nil if only the size is being checked
+	want string    // the expected MD5SUM or "" to only check the size
+	size int64     // the expected size or -1 if not known
+	read int64     // the bytes read so far
+	done bool      // set when the check has been done
+	err  error     // the result of the check
+}
+
+// newHashCheckReader makes a hashCheckReader reading from in
+//
+// If want is empty then only the size is checked, and if size is -1
+// then only the MD5SUM.
+func newHashCheckReader(in io.ReadCloser, want string, size int64) *hashCheckReader {
+	r := &hashCheckReader{
+		in:   in,
+		want: strings.ToLower(want),
+		size: size,
+	}
+	if r.want != "" {
+		r.hash = md5.New()
+	}
+	return r
+}
+
+// Read bytes checking the hash at the end
+func (r *hashCheckReader) Read(p []byte) (n int, err error) {
+	n, err = r.in.Read(p)
+	if r.hash != nil {
+		_, _ = r.hash.Write(p[:n])
+	}
+	r.read += int64(n)
+	if !r.done && (err == io.EOF || (r.size >= 0 && r.read >= r.size)) {
+		r.done = true
+		r.err = r.check()
+	}
+	if r.err != nil {
+		return n, r.err
+	}
+	return n, err
+}
+
+// check the size and hash of the data read
+func (r *hashCheckReader) check() error {
+	if r.size >= 0 && r.read != r.size {
+		return fs.RetryErrorf("corrupted on transfer: sizes differ %d vs %d", r.size, r.read)
+	}
+	if r.hash == nil {
+		return nil
+	}
+	got := hex.EncodeToString(r.hash.Sum(nil))
+	if got != r.want {
+		return fs.RetryErrorf("corrupted on transfer: md5 hashes differ %q vs %q", r.want, got)
+	}
+	return nil
+}
+
+// Close the download returning any error from the check
+func (r *hashCheckReader) Close() error {
+	err := r.in.Close()
+	if r.err != nil {
+		return r.err
+	}
+	return err
 }
 
 // min returns the smallest of x, y
@@ -734,9 +2212,42 @@ func min(x, y int64) int64 {
 
 // removeSegments removes any old segments from o
 //
-// if except is passed in then segments with that prefix won't be deleted
-func (o *Object) removeSegments(except string) error {
-	segmentsRoot := o.fs.root + o.remote + "/"
+// Only segments under prefix are deleted, and if except is passed in
+// then segments with that prefix won't be deleted
+func (o *Object) removeSegments(prefix, except string) error {
+	segmentsRoot := o.name() + "/" + prefix
+	// Delete the segments with --transfers workers as the listing
+	// finds them
+	var (
+		mu        sync.Mutex // protects deleteErr
+		deleteErr error      // first error deleting a segment
+		wg        sync.WaitGroup
+	)
+	transfers := fs.Config.Transfers
+	if transfers < 1 {
+		transfers = 1
+	}
+	toBeDeleted := make(chan string, transfers)
+	for i := 0; i < transfers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for segmentPath := range toBeDeleted {
+				fs.Debugf(o, "Removing segment file %q in container %q", segmentPath, o.fs.segmentsContainer)
+				err := o.fs.pacer.Call(func() (bool, error) {
+					err := o.fs.c.ObjectDelete(o.fs.segmentsContainer, segmentPath)
+					return o.fs.shouldRetry(err)
+				})
+				if err != nil {
+					mu.Lock()
+					if deleteErr == nil {
+						deleteErr = errors.Wrapf(err, "failed to delete segment %q in container %q", segmentPath, o.fs.segmentsContainer)
+					}
+					mu.Unlock()
+				}
+			}
+		}()
+	}
 	err := o.fs.listContainerRoot(o.fs.segmentsContainer, segmentsRoot, "", true, func(remote string, object *swift.Object, isDirectory bool) error {
 		if isDirectory {
 			return nil
@@ -745,15 +2256,31 @@ func (o *Object) removeSegments(except string) error {
 			// fs.Debugf(o, "Ignoring current segment file %q in container %q", segmentsRoot+remote, o.fs.segmentsContainer)
 			return nil
 		}
-		segmentPath := segmentsRoot + remote
-		fs.Debugf(o, "Removing segment file %q in container %q", segmentPath, o.fs.segmentsContainer)
-		return o.fs.c.ObjectDelete(o.fs.segmentsContainer, segmentPath)
+		// Stop listing if a delete has failed
+		mu.Lock()
+		err := deleteErr
+		mu.Unlock()
+		if err != nil {
+			return err
+		}
+		toBeDeleted <- object.Name
+		return nil
 	})
+	// Wait for the deletes to finish before checking the container
+	close(toBeDeleted)
+	wg.Wait()
+	if deleteErr != nil {
+		return deleteErr
+	}
+	if errors.Cause(err) == swift.ContainerNotFound {
+		// The segments are somewhere else, eg a copied manifest
+		return nil
+	}
 	if err != nil {
 		return err
 	}
 	// remove the segments container if empty, ignore errors
-	err = o.fs.c.ContainerDelete(o.fs.segmentsContainer)
+	err = o.fs.deleteContainer(o.fs.segmentsContainer)
 	if err == nil {
 		fs.Debugf(o, "Removed empty container %q", o.fs.segmentsContainer)
 	}
@@ -763,53 +2290,235 @@ func (o *Object) removeSegments(except string) error {
 // urlEncode encodes a string so that it is a valid URL
 //
 // We don't use any of Go's standard methods as we need `/` not
-// encoded but we need '&' encoded.
+// encoded but we need '&' encoded.  Everything apart from `/` and the
+// unreserved characters in RFC 3986 is percent encoded byte by byte,
+// including `%` itself.
 func urlEncode(str string) string {
-	var buf bytes.Buffer
+	const hexDigits = "0123456789ABCDEF"
+	encode := 0
+	for i := 0; i < len(str); i++ {
+		if !isUnreserved(str[i]) {
+			encode++
+		}
+	}
+	if encode == 0 {
+		return str
+	}
+	buf := make([]byte, 0, len(str)+2*encode)
 	for i := 0; i < len(str); i++ {
 		c := str[i]
-		if (c >= '0' && c <= '9') || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c == '/' || c == '.' {
-			_ = buf.WriteByte(c)
+		if isUnreserved(c) {
+			buf = append(buf, c)
 		} else {
-			_, _ = buf.WriteString(fmt.Sprintf("%%%02X", c))
+			buf = append(buf, '%', hexDigits[c>>4], hexDigits[c&0x0F])
+		}
+	}
+	return string(buf)
+}
+
+// isUnreserved returns true if c doesn't need encoding by urlEncode
+func isUnreserved(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c == '/' || c == '.' || c == '-' || c == '_' || c == '~'
+}
+
+// appendSegmentName appends the name of segment i of the segments in
+// segmentsPath to buf, the same as fmt.Sprintf("%s/%08d",
+// segmentsPath, i)
+func appendSegmentName(buf []byte, segmentsPath string, i int) []byte {
+	const width = 8
+	buf = append(buf, segmentsPath...)
+	buf = append(buf, '/')
+	digits := 1
+	for n := i; n >= 10; n /= 10 {
+		digits++
+	}
+	for ; digits < width; digits++ {
+		buf = append(buf, '0')
+	}
+	return strconv.AppendInt(buf, int64(i), 10)
+}
+
+// appendFloatTime appends t to buf as seconds with up to 9 decimal
+// places, the same as swift.TimeToFloatString but without making
+// intermediate strings
+func appendFloatTime(buf []byte, t time.Time) []byte {
+	ns := t.UnixNano()
+	if ns < 0 {
+		buf = append(buf, '-')
+		ns = -ns
+	}
+	buf = strconv.AppendInt(buf, ns/1e9, 10)
+	var decimals [9]byte
+	frac := ns % 1e9
+	for i := len(decimals) - 1; i >= 0; i-- {
+		decimals[i] = byte('0' + frac%10)
+		frac /= 10
+	}
+	n := len(decimals)
+	for n > 0 && decimals[n-1] == '0' {
+		n--
+	}
+	if n == 0 {
+		return buf
+	}
+	buf = append(buf, '.')
+	return append(buf, decimals[:n]...)
+}
+
+// uploadHeadersPool holds header maps for uploads to reuse, which is
+// safe as the swift library copies them into each request
+var uploadHeadersPool = sync.Pool{
+	New: func() interface{} {
+		return make(swift.Headers, 8)
+	},
+}
+
+// newUploadHeaders returns the headers to upload an object with
+// metadata and modTime.  The user's upload_header ones are set first
+// so the source's and rclone's own override them.
+//
+// Give them back with putUploadHeaders when done.
+func (f *Fs) newUploadHeaders(metadata map[string]string, modTime time.Time) swift.Headers {
+	headers := uploadHeadersPool.Get().(swift.Headers)
+	for k, v := range f.uploadHeaders {
+		headers[k] = v
+	}
+	if len(metadata) > 0 {
+		for k, v := range f.metadataHeaders(metadata) {
+			headers[k] = v
 		}
 	}
-	return buf.String()
+	// Set the mtime as swift.Metadata.SetModTime would
+	var buf [32]byte
+	headers[mtimeHeader] = string(appendFloatTime(buf[:0], modTime))
+	return headers
+}
+
+// putUploadHeaders clears headers from newUploadHeaders and puts
+// them back in the pool.  They mustn't be used afterwards.
+func putUploadHeaders(headers swift.Headers) {
+	for k := range headers {
+		delete(headers, k)
+	}
+	uploadHeadersPool.Put(headers)
 }
 
 // updateChunks updates the existing object using chunks to a separate
 // container.  It returns a string which prefixes current segments.
 func (o *Object) updateChunks(in io.Reader, headers swift.Headers, size int64, contentType string) (string, error) {
-	// Create the segmentsContainer if it doesn't exist
-	err := o.fs.c.ContainerCreate(o.fs.segmentsContainer, nil)
+	// All the segments and the manifest must go to the same region
+	generation := o.fs.regionGeneration()
+	// Create the segmentsContainer if it doesn't exist.  This isn't
+	// cached as the segments container is removed when it is
+	// empty, possibly by another process, and the segments can't be
+	// uploaded again if it is found missing part way through.
+	err := o.fs.createContainer(o.fs.segmentsContainer, false)
 	if err != nil {
 		return "", err
 	}
 	// Upload the chunks
 	left := size
 	i := 0
-	uniquePrefix := fmt.Sprintf("%s/%d", swift.TimeToFloatString(time.Now()), size)
-	segmentsPath := fmt.Sprintf("%s%s/%s", o.fs.root, o.remote, uniquePrefix)
+	uniquePrefix := swift.TimeToFloatString(time.Now()) + "/" + strconv.FormatInt(size, 10)
+	segmentsPath := o.name() + "/" + uniquePrefix
+	// Reuse the reader and name buffer for each segment
+	segmentReader := &io.LimitedReader{R: in}
+	nameBuf := make([]byte, 0, len(segmentsPath)+16)
 	for left > 0 {
-		n := min(left, int64(chunkSize))
+		n := min(left, int64(o.fs.getChunkSize()))
 		headers["Content-Length"] = strconv.FormatInt(n, 10) // set Content-Length as we know it
-		segmentReader := io.LimitReader(in, n)
-		segmentPath := fmt.Sprintf("%s/%08d", segmentsPath, i)
+		segmentReader.N = n
+		nameBuf = appendSegmentName(nameBuf[:0], segmentsPath, i)
+		segmentPath := string(nameBuf)
 		fs.Debugf(o, "Uploading segment file %q into %q", segmentPath, o.fs.segmentsContainer)
-		_, err := o.fs.c.ObjectPut(o.fs.segmentsContainer, segmentPath, segmentReader, true, "", "", headers)
+		err := o.fs.checkRegion(generation)
 		if err != nil {
+			o.removeFailedSegments(uniquePrefix)
 			return "", err
 		}
+		err = o.fs.pacer.CallNoRetry(func() (bool, error) {
+			_, err := o.fs.c.ObjectPut(o.fs.segmentsContainer, segmentPath, segmentReader, !fs.Config.IgnoreChecksum, "", "", headers)
+			return o.fs.shouldRetry(err)
+		})
+		if err != nil {
+			o.removeFailedSegments(uniquePrefix)
+			return "", objectError(errors.Wrapf(err, "failed to upload segment %q to container %q", segmentPath, o.fs.segmentsContainer))
+		}
 		left -= n
 		i++
 	}
 	// Upload the manifest
-	headers["X-Object-Manifest"] = urlEncode(fmt.Sprintf("%s/%s", o.fs.segmentsContainer, segmentsPath))
+	headers["X-Object-Manifest"] = urlEncode(o.fs.segmentsContainer + "/" + segmentsPath)
 	headers["Content-Length"] = "0" // set Content-Length as we know it
-	emptyReader := bytes.NewReader(nil)
-	manifestName := o.fs.root + o.remote
-	_, err = o.fs.c.ObjectPut(o.fs.container, manifestName, emptyReader, true, "", contentType, headers)
-	return uniquePrefix + "/", err
+	manifestName := o.name()
+	err = o.fs.pacer.Call(func() (bool, error) {
+		if err := o.fs.checkRegion(generation); err != nil {
+			return false, err
+		}
+		emptyReader := bytes.NewReader(nil)
+		_, err = o.fs.c.ObjectPut(o.fs.container, manifestName, emptyReader, true, "", contentType, headers)
+		return o.fs.shouldRetry(err)
+	})
+	if err != nil {
+		o.removeFailedSegments(uniquePrefix)
+		return "", objectError(errors.Wrapf(err, "failed to upload manifest %q to container %q", manifestName, o.fs.container))
+	}
+	return uniquePrefix + "/", nil
+}
+
+// removeFailedSegments removes the segments uploaded under
+// uniquePrefix by an updateChunks which failed, unless
+// leave_parts_on_error is set
+//
+// The segments of the object's previous version are under a
+// different prefix so are left alone.  Errors are logged as the
+// upload's error is the one to return.
+func (o *Object) removeFailedSegments(uniquePrefix string) {
+	if o.fs.leavePartsOnError {
+		fs.Debugf(o, "Leaving the segments of the failed upload under %q in container %q", o.name()+"/"+uniquePrefix, o.fs.segmentsContainer)
+		return
+	}
+	err := o.removeSegments(uniquePrefix+"/", "")
+	if err != nil {
+		fs.Logf(o, "Failed to remove the segments of the failed upload: %v", err)
+	}
+}
+
+// getChunkSize returns the size above which files are uploaded in
+// chunks - the chunk_size for the remote if set or --swift-chunk-size
+func (f *Fs) getChunkSize() fs.SizeSuffix {
+	if f.chunkSize > 0 {
+		return f.chunkSize
+	}
+	return chunkSize
+}
+
+// checkPutSize checks that the PUTs to upload name with size bytes
+// aren't bigger than the server accepts, so uploads which will fail
+// are refused before they start rather than after sending all the
+// data
+func (f *Fs) checkPutSize(name string, size int64, chunked bool) error {
+	putSize := size
+	if chunked {
+		putSize = int64(f.getChunkSize())
+	}
+	if putSize <= 0 {
+		return nil
+	}
+	maxFileSize := f.maxFileSize()
+	if putSize <= maxFileSize {
+		return nil
+	}
+	var fix string
+	switch {
+	case chunked:
+		fix = "set --swift-chunk-size smaller"
+	case f.noChunk:
+		fix = "don't set no_chunk so it is uploaded in segments"
+	default:
+		fix = "set --swift-chunk-size smaller so it is uploaded in segments"
+	}
+	return fs.NoRetryError(errors.Errorf("can't upload %q to container %q: PUT of %s is bigger than the largest the server accepts (%s) - %s", name, f.container, fs.SizeSuffix(putSize).Unit("Bytes"), fs.SizeSuffix(maxFileSize).Unit("Bytes"), fix))
 }
 
 // Update the object with the contents of the io.Reader, modTime and size
@@ -819,7 +2528,7 @@ func (o *Object) Update(in io.Reader, src fs.ObjectInfo, options ...fs.OpenOptio
 	if o.fs.container == "" {
 		return fs.FatalError(errors.New("container name needed in remote"))
 	}
-	err := o.fs.Mkdir("")
+	err := o.fs.makeRootContainer()
 	if err != nil {
 		return err
 	}
@@ -831,37 +2540,106 @@ func (o *Object) Update(in io.Reader, src fs.ObjectInfo, options ...fs.OpenOptio
 	if err != nil {
 		return err
 	}
+	oldManifest := ""
+	if isDynamicLargeObject {
+		oldManifest = (*o.headers)["X-Object-Manifest"]
+	}
+	expires := o.expires()
 
-	// Set the mtime
-	m := swift.Metadata{}
-	m.SetModTime(modTime)
+	// Keep the attributes of sources which have them, eg objects
+	// copied from another swift with --metadata
+	var metadata map[string]string
+	if do, ok := src.(fs.Metadataer); ok {
+		metadata, err = do.Metadata()
+		if err != nil {
+			return errors.Wrap(err, "failed to read metadata of source")
+		}
+	}
 	contentType := fs.MimeType(src)
-	headers := m.ObjectHeaders()
-	uniquePrefix := ""
-	if size > int64(chunkSize) {
-		uniquePrefix, err = o.updateChunks(in, headers, size, contentType)
+	if metadata["content-type"] != "" {
+		contentType = metadata["content-type"]
+	}
+	if o.fs.contentType != "" && contentType != directoryMarkerContentType {
+		contentType = o.fs.contentType
+	}
+	headers := o.fs.newUploadHeaders(metadata, modTime)
+	defer putUploadHeaders(headers)
+	chunked := size > int64(o.fs.getChunkSize()) && !o.fs.noChunk
+	if o.fs.noLargeObjects && !o.fs.noChunk {
+		if size < 0 {
+			return fs.FatalError(errors.Errorf("can't upload %q to container %q: its size is unknown so it might need to be a large object and no_large_objects is set", o.name(), o.fs.container))
+		}
+		if chunked {
+			return fs.FatalError(errors.Errorf("can't upload %q to container %q: %s is bigger than --swift-chunk-size %s so it would be a large object and no_large_objects is set", o.name(), o.fs.container, fs.SizeSuffix(size).Unit("Bytes"), o.fs.getChunkSize().Unit("Bytes")))
+		}
+	}
+	err = o.fs.checkPutSize(o.name(), size, chunked)
+	if err != nil {
+		return err
+	}
+	// Check the quota before starting uploads which would waste a
+	// lot of time and leave segments behind if they exceeded it
+	if o.fs.checkQuota(size) {
+		err = o.fs.reserveQuota(size)
 		if err != nil {
-			return err
+			return errors.Wrapf(err, "can't upload %q to container %q", o.name(), o.fs.container)
 		}
+	}
+	uniquePrefix, hash := "", ""
+	if chunked {
+		uniquePrefix, err = o.updateChunks(in, headers, size, contentType)
 	} else {
 		headers["Content-Length"] = strconv.FormatInt(size, 10) // set Content-Length as we know it
-		_, err := o.fs.c.ObjectPut(o.fs.container, o.fs.root+o.remote, in, true, "", contentType, headers)
+		err = o.fs.pacer.CallNoRetry(func() (bool, error) {
+			respHeaders, err := o.fs.c.ObjectPut(o.fs.container, o.name(), in, !fs.Config.IgnoreChecksum, "", contentType, headers)
+			hash = respHeaders["Etag"]
+			return o.fs.shouldRetry(err)
+		})
 		if err != nil {
-			return err
+			err = objectError(errors.Wrapf(err, "failed to upload %q to container %q", o.name(), o.fs.container))
+		}
+	}
+	if err != nil {
+		if o.fs.checkQuota(size) {
+			o.fs.releaseQuota(size)
 		}
+		return err
 	}
 
 	// If file was a dynamic large object then remove old/all segments
-	if isDynamicLargeObject {
-		err = o.removeSegments(uniquePrefix)
+	// unless they are being kept for downloads of the old version
+	if isDynamicLargeObject && !(o.fs.segmentRetention > 0 && o.retireSegments(oldManifest, uniquePrefix)) {
+		err = o.removeSegments("", uniquePrefix)
 		if err != nil {
 			fs.Logf(o, "Failed to remove old segments - carrying on with upload: %v", err)
 		}
 	}
 
+	if _, ok := headers["X-Delete-At"]; !ok && !expires.IsZero() {
+		fs.Logf(o, "Replaced object which was due to expire at %s - the new object won't expire", expires.Format(time.RFC3339))
+	}
+
 	// Read the metadata from the newly created object
 	o.headers = nil // wipe old metadata
-	return o.readMetaData()
+	err = o.readMetaData()
+	if err == fs.ErrorObjectNotFound && o.fs.writeOnly {
+		// Use what was uploaded if it can't be read
+		o.info = swift.Object{
+			Name:         o.name(),
+			ContentType:  contentType,
+			Bytes:        size,
+			LastModified: modTime,
+			Hash:         hash,
+		}
+		// Copy the headers as they go back in the pool
+		uploaded := make(swift.Headers, len(headers))
+		for k, v := range headers {
+			uploaded[k] = v
+		}
+		o.headers = &uploaded
+		return nil
+	}
+	return err
 }
 
 // Remove an object
@@ -871,13 +2649,18 @@ func (o *Object) Remove() error {
 		return err
 	}
 	// Remove file/manifest first
-	err = o.fs.c.ObjectDelete(o.fs.container, o.fs.root+o.remote)
+	err = o.fs.callObject(func() error {
+		return o.fs.c.ObjectDelete(o.fs.container, o.name())
+	})
+	if err == swift.ObjectNotFound {
+		err = fs.ErrorObjectNotFound
+	}
 	if err != nil {
-		return err
+		return objectError(errors.Wrapf(err, "failed to delete %q in container %q", o.name(), o.fs.container))
 	}
 	// ...then segments if required
 	if isDynamicLargeObject {
-		err = o.removeSegments("")
+		err = o.removeSegments("", "")
 		if err != nil {
 			return err
 		}
@@ -892,10 +2675,17 @@ func (o *Object) MimeType() string {
 
 // Check the interfaces are satisfied
 var (
-	_ fs.Fs        = &Fs{}
-	_ fs.Purger    = &Fs{}
-	_ fs.Copier    = &Fs{}
-	_ fs.ListRer   = &Fs{}
-	_ fs.Object    = &Object{}
-	_ fs.MimeTyper = &Object{}
+	_ fs.Fs             = &Fs{}
+	_ fs.Purger         = &Fs{}
+	_ fs.Copier         = &Fs{}
+	_ fs.ListRer        = &Fs{}
+	_ fs.Abouter        = &Fs{}
+	_ fs.UserInfoer     = &Fs{}
+	_ fs.PublicLinker   = &Fs{}
+	_ fs.CleanUpper     = &Fs{}
+	_ fs.DirSetModTimer = &Fs{}
+	_ fs.Object         = &Object{}
+	_ fs.MimeTyper      = &Object{}
+	_ fs.Metadataer     = &Object{}
+	_ fs.MetadataSetter = &Object{}
 )
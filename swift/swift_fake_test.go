@@ -0,0 +1,43 @@
+// Run the generic Fs tests against an in memory swift server unless
+// a real one is configured
+
+package swift_test
+
+import (
+	"flag"
+	"log"
+	"os"
+	"testing"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/ncw/swift/swifttest"
+)
+
+// TestMain runs the tests against an in memory swift server if the
+// TestSwift remote isn't configured, so they can be run without
+// network access or credentials
+func TestMain(m *testing.M) {
+	flag.Parse()
+	fs.LoadConfig()
+	if fs.ConfigFileGet("TestSwift", "type") != "" {
+		os.Exit(m.Run())
+	}
+	srv, err := swifttest.NewSwiftServer("localhost")
+	if err != nil {
+		log.Fatalf("Failed to start swift test server: %v", err)
+	}
+	for key, value := range map[string]string{
+		"TYPE": "swift",
+		"USER": swifttest.TEST_ACCOUNT,
+		"KEY":  swifttest.TEST_ACCOUNT,
+		"AUTH": srv.AuthURL,
+	} {
+		err = os.Setenv("RCLONE_CONFIG_TESTSWIFT_"+key, value)
+		if err != nil {
+			log.Fatalf("Failed to set config: %v", err)
+		}
+	}
+	rc := m.Run()
+	srv.Close()
+	os.Exit(rc)
+}
@@ -1,6 +1,120 @@
 package swift
 
-import "testing"
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/ncw/swift"
+	"github.com/ncw/swift/swifttest"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testRemote is the name of the remote used for the internal tests
+const testRemote = "TestSwiftInternal"
+
+// setTestConfig sets config key on testRemote via the environment
+// returning a function to unset it.
+func setTestConfig(t *testing.T, key, value string) func() {
+	envKey := "RCLONE_CONFIG_" + strings.ToUpper(testRemote+"_"+key)
+	require.NoError(t, os.Setenv(envKey, value))
+	return func() {
+		_ = os.Unsetenv(envKey)
+	}
+}
+
+// recordingTransport is an http.RoundTripper which records the
+// method and path of each request
+type recordingTransport struct {
+	mu       sync.Mutex
+	requests []string
+}
+
+// RoundTrip records the request then passes it on
+//
+// It decodes the X-Object-Manifest header as real swift servers do
+// but swifttest doesn't.
+func (r *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	r.mu.Lock()
+	r.requests = append(r.requests, req.Method+" "+req.URL.RequestURI())
+	r.mu.Unlock()
+	if manifest := req.Header.Get("X-Object-Manifest"); manifest != "" {
+		unescaped, err := url.PathUnescape(manifest)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("X-Object-Manifest", unescaped)
+	}
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+// count returns the number of requests with the method passed in and
+// resets the recorded requests
+func (r *recordingTransport) count(method string) (n int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, request := range r.requests {
+		if strings.HasPrefix(request, method+" ") {
+			n++
+		}
+	}
+	r.requests = nil
+	return n
+}
+
+// all returns the recorded requests and resets them
+func (r *recordingTransport) all() (requests []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	requests, r.requests = r.requests, nil
+	return requests
+}
+
+// recorder returns the recordingTransport used by f
+func recorder(f *Fs) *recordingTransport {
+	return f.c.Transport.(*recordingTransport)
+}
+
+// newTestFs makes an Fs pointing at root on an in memory swift
+// server.  Call the returned cleanup function when done.
+func newTestFs(t testing.TB, root string) (f *Fs, srv *swifttest.SwiftServer, cleanup func()) {
+	fs.LoadConfig()
+	// The servers may reuse the ports of earlier ones so forget
+	// which containers they had
+	containers = newContainerCache()
+	srv, err := swifttest.NewSwiftServer("localhost")
+	require.NoError(t, err)
+	c := &swift.Connection{
+		UserName:  swifttest.TEST_ACCOUNT,
+		ApiKey:    swifttest.TEST_ACCOUNT,
+		AuthUrl:   srv.AuthURL,
+		Transport: &recordingTransport{},
+	}
+	require.NoError(t, c.Authenticate())
+	newF, err := NewFsWithConnection(testRemote, root, c, false)
+	require.NoError(t, err)
+	return newF.(*Fs), srv, srv.Close
+}
 
 func TestInternalUrlEncode(t *testing.T) {
 	for _, test := range []struct {
@@ -16,10 +130,3101 @@ func TestInternalUrlEncode(t *testing.T) {
 		{"&", "%26"},
 		{"ß£", "%C3%9F%C2%A3"},
 		{"Vidéo Potato Sausage?&£.mkv", "Vid%C3%A9o%20Potato%20Sausage%3F%26%C2%A3.mkv"},
+		{"50%off.mp4", "50%25off.mp4"},
+		{"a#b?c", "a%23b%3Fc"},
+		{"un-reserved_chars.~", "un-reserved_chars.~"},
 	} {
 		got := urlEncode(test.in)
 		if got != test.want {
-			t.Logf("%q: want %q got %q", test.in, test.want, got)
+			t.Errorf("%q: want %q got %q", test.in, test.want, got)
+		}
+	}
+}
+
+func TestInternalLargeObjectNames(t *testing.T) {
+	f, _, cleanup := newTestFs(t, "container")
+	defer cleanup()
+	oldChunkSize := chunkSize
+	chunkSize = 4
+	defer func() { chunkSize = oldChunkSize }()
+	require.NoError(t, f.Mkdir(""))
+
+	contents := "0123456789"
+	for _, remote := range []string{"50%off.mp4", "a&b#c?d", "with spaces/file", "Vidéo £.mkv", "日本語"} {
+		src := fs.NewStaticObjectInfo(remote, time.Now(), int64(len(contents)), true, nil, nil)
+		_, err := f.Put(strings.NewReader(contents), src)
+		require.NoError(t, err, remote)
+
+		o, err := f.NewObject(remote)
+		require.NoError(t, err, remote)
+		assert.Equal(t, int64(len(contents)), o.Size(), remote)
+		in, err := o.Open()
+		require.NoError(t, err, remote)
+		got, err := ioutil.ReadAll(in)
+		require.NoError(t, err, remote)
+		require.NoError(t, in.Close())
+		assert.Equal(t, contents, string(got), remote)
+	}
+}
+
+func TestInternalAccountName(t *testing.T) {
+	for _, test := range []struct {
+		in   string
+		want string
+	}{
+		{"https://storage.example.com/v1/AUTH_abc", "AUTH_abc"},
+		{"https://storage.example.com/v1/AUTH_abc/", "AUTH_abc"},
+		{"http://127.0.0.1:8080/v1/AUTH_test", "AUTH_test"},
+	} {
+		assert.Equal(t, test.want, accountName(test.in), test.in)
+	}
+}
+
+func TestInternalUserInfo(t *testing.T) {
+	f, srv, cleanup := newTestFs(t, "container")
+	defer cleanup()
+	require.NoError(t, f.Mkdir(""))
+
+	info, err := f.UserInfo()
+	require.NoError(t, err)
+	assert.Equal(t, srv.URL+"/AUTH_"+swifttest.TEST_ACCOUNT, info["StorageURL"])
+	assert.Equal(t, "AUTH_"+swifttest.TEST_ACCOUNT, info["Account"])
+	assert.Equal(t, swifttest.TEST_ACCOUNT, info["User"])
+	assert.Equal(t, "0", info["BytesUsed"])
+	assert.Equal(t, "0", info["Objects"])
+	assert.Contains(t, info, "Containers")
+	assert.NotContains(t, info, "QuotaBytes")
+
+	// Check a quota set on the account is reported
+	require.NoError(t, f.c.AccountUpdate(swift.Headers{accountQuotaBytesHeader: "12345"}))
+	info, err = f.UserInfo()
+	require.NoError(t, err)
+	assert.Equal(t, "12345", info["QuotaBytes"])
+}
+
+// putEmptyObjects makes n 0 byte objects in the container
+func putEmptyObjects(t *testing.T, f *Fs, n int) {
+	require.NoError(t, f.Mkdir(""))
+	for i := 0; i < n; i++ {
+		require.NoError(t, f.c.ObjectPutString(f.container, fmt.Sprintf("dir/empty%d.lock", i), "", "application/octet-stream"))
+	}
+}
+
+func TestInternalListZeroByteObjects(t *testing.T) {
+	f, _, cleanup := newTestFs(t, "container")
+	defer cleanup()
+	putEmptyObjects(t, f, 5)
+
+	// By default every 0 byte object is checked in case it is a DLO
+	recorder(f).count("")
+	entries, err := f.List("dir")
+	require.NoError(t, err)
+	assert.Len(t, entries, 5)
+	assert.Equal(t, 5, recorder(f).count("HEAD"))
+}
+
+func TestInternalListZeroByteObjectsNoLargeObjects(t *testing.T) {
+	defer setTestConfig(t, "no_large_objects", "true")()
+	f, _, cleanup := newTestFs(t, "container")
+	defer cleanup()
+	putEmptyObjects(t, f, 5)
+
+	recorder(f).count("")
+	entries, err := f.List("dir")
+	require.NoError(t, err)
+	require.Len(t, entries, 5)
+	assert.Equal(t, 0, recorder(f).count("HEAD"))
+	for _, entry := range entries {
+		o, ok := entry.(*Object)
+		require.True(t, ok)
+		assert.Equal(t, int64(0), o.Size())
+		assert.Equal(t, "application/octet-stream", o.MimeType())
+	}
+}
+
+func TestInternalListCallbackError(t *testing.T) {
+	f, _, cleanup := newTestFs(t, "container")
+	defer cleanup()
+	putEmptyObjects(t, f, 20)
+
+	stop := errors.New("stop listing")
+	calls := 0
+	err := f.list("dir", false, func(entry fs.DirEntry) error {
+		calls++
+		return stop
+	})
+	assert.Equal(t, stop, err)
+	assert.Equal(t, 1, calls)
+}
+
+func TestInternalListMetadataError(t *testing.T) {
+	f, srv, cleanup := newTestFs(t, "container")
+	defer cleanup()
+	putEmptyObjects(t, f, 20)
+
+	srv.SetOverride("/v1/AUTH_"+swifttest.TEST_ACCOUNT+"/container/dir/empty7.lock", func(w http.ResponseWriter, r *http.Request, recorder *httptest.ResponseRecorder) {
+		w.WriteHeader(http.StatusForbidden)
+	})
+	_, err := f.List("dir")
+	require.Error(t, err)
+	assert.Equal(t, swift.Forbidden, errors.Cause(err))
+	assert.Contains(t, err.Error(), "dir/empty7.lock")
+}
+
+// putObjectWithModTime makes an object with the mtime metadata set
+func putObjectWithModTime(t *testing.T, f *Fs, remote string, modTime time.Time) {
+	require.NoError(t, f.Mkdir(""))
+	m := swift.Metadata{}
+	m.SetModTime(modTime)
+	_, err := f.c.ObjectPut(f.container, f.root+remote, strings.NewReader("hello"), true, "", "text/plain", m.ObjectHeaders())
+	require.NoError(t, err)
+}
+
+func TestInternalModTime(t *testing.T) {
+	f, _, cleanup := newTestFs(t, "container")
+	defer cleanup()
+	modTime := time.Date(2001, 2, 3, 4, 5, 6, 123456789, time.UTC)
+	putObjectWithModTime(t, f, "file.txt", modTime)
+
+	assert.Equal(t, time.Nanosecond, f.Precision())
+	entries, err := f.List("")
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	recorder(f).count("")
+	assert.True(t, modTime.Equal(entries[0].ModTime()))
+	assert.Equal(t, 1, recorder(f).count("HEAD"))
+}
+
+func TestInternalModTimeUseServerModTime(t *testing.T) {
+	defer setTestConfig(t, "use_server_modtime", "true")()
+	f, _, cleanup := newTestFs(t, "container")
+	defer cleanup()
+	modTime := time.Date(2001, 2, 3, 4, 5, 6, 123456789, time.UTC)
+	putObjectWithModTime(t, f, "file.txt", modTime)
+
+	assert.Equal(t, time.Second, f.Precision())
+	entries, err := f.List("")
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	recorder(f).count("")
+	got := entries[0].ModTime()
+	assert.Equal(t, 0, recorder(f).count("HEAD"))
+	assert.False(t, modTime.Equal(got))
+	assert.WithinDuration(t, time.Now(), got, time.Minute)
+
+	// Setting the modification time does nothing as it wouldn't
+	// be read back
+	o := entries[0].(*Object)
+	require.NoError(t, o.SetModTime(modTime.Add(time.Hour)))
+	assert.Empty(t, recorder(f).all())
+	assert.Equal(t, got, o.ModTime())
+}
+
+// listAll walks dir with List returning the remotes found, marking
+// directories with a trailing /
+func listAll(t *testing.T, f *Fs, dir string) (remotes []string) {
+	entries, err := f.List(dir)
+	require.NoError(t, err)
+	for _, entry := range entries {
+		if _, isDir := entry.(fs.Directory); isDir {
+			remotes = append(remotes, entry.Remote()+"/")
+			remotes = append(remotes, listAll(t, f, entry.Remote())...)
+		} else {
+			remotes = append(remotes, entry.Remote())
+		}
+	}
+	return remotes
+}
+
+func TestInternalListRDirectories(t *testing.T) {
+	f, _, cleanup := newTestFs(t, "container")
+	defer cleanup()
+	require.NoError(t, f.Mkdir(""))
+	for _, name := range []string{"a/b/c/one.txt", "a/b/two.txt", "a/three.txt", "four.txt", "d/e/five.txt"} {
+		require.NoError(t, f.c.ObjectPutString(f.container, name, "hello", "text/plain"))
+	}
+	// directory markers for both a populated and an empty directory
+	require.NoError(t, f.c.ObjectPutString(f.container, "d/", "", directoryMarkerContentType))
+	require.NoError(t, f.c.ObjectPutString(f.container, "empty/", "", directoryMarkerContentType))
+
+	for _, dir := range []string{"", "a", "a/b", "d"} {
+		var got []string
+		err := f.ListR(dir, func(entries fs.DirEntries) error {
+			for _, entry := range entries {
+				if _, isDir := entry.(fs.Directory); isDir {
+					got = append(got, entry.Remote()+"/")
+				} else {
+					got = append(got, entry.Remote())
+				}
+			}
+			return nil
+		})
+		require.NoError(t, err)
+		want := listAll(t, f, dir)
+		sort.Strings(want)
+		sort.Strings(got)
+		assert.Equal(t, want, got, "dir=%q", dir)
+	}
+}
+
+func TestInternalWalkAutoListR(t *testing.T) {
+	f, _, cleanup := newTestFs(t, "container")
+	defer cleanup()
+	require.NoError(t, f.Mkdir(""))
+	for _, name := range []string{"a/b/c/one.txt", "a/b-two.txt", "a/b0.txt", "a/three.txt", "four.txt", "d/e/five.txt"} {
+		require.NoError(t, f.c.ObjectPutString(f.container, name, "hello", "text/plain"))
+	}
+	assert.True(t, f.Features().ListRByDirectory)
+	oldUseListR, oldAutoListR := fs.Config.UseListR, fs.Config.AutoListR
+	defer func() { fs.Config.UseListR, fs.Config.AutoListR = oldUseListR, oldAutoListR }()
+	fs.Config.UseListR = false
+
+	walk := func() (got []string, listings []string) {
+		recorder(f).count("")
+		err := fs.Walk(f, "", true, -1, func(dirPath string, entries fs.DirEntries, err error) error {
+			require.NoError(t, err)
+			for _, entry := range entries {
+				got = append(got, entry.Remote())
+			}
+			return nil
+		})
+		require.NoError(t, err)
+		for _, request := range recorder(f).all() {
+			if strings.HasPrefix(request, "GET "+accountPath+"/container?") {
+				listings = append(listings, request)
+			}
+		}
+		sort.Strings(got)
+		return got, listings
+	}
+
+	// Without --fast-list set the recursive listing is used
+	fs.Config.AutoListR = true
+	got, listings := walk()
+	require.Len(t, listings, 1)
+	assert.NotContains(t, listings[0], "delimiter")
+
+	// and finds the same as listing each directory
+	fs.Config.AutoListR = false
+	want, listings := walk()
+	assert.True(t, len(listings) > 1)
+	assert.Equal(t, want, got)
+}
+
+func TestInternalListChunk(t *testing.T) {
+	defer setTestConfig(t, "list_chunk", "5")()
+	f, _, cleanup := newTestFs(t, "container")
+	defer cleanup()
+	assert.Equal(t, 5, f.listChunk)
+	putEmptyObjects(t, f, 12)
+	f.noLargeObjects = true
+
+	recorder(f).count("")
+	entries, err := f.List("dir")
+	require.NoError(t, err)
+	assert.Len(t, entries, 12)
+	requests := recorder(f).all()
+	require.NotEmpty(t, requests)
+	for _, request := range requests {
+		assert.Contains(t, request, "limit=5")
+	}
+}
+
+func TestInternalListChunkInvalid(t *testing.T) {
+	for _, value := range []string{"0", "-1", "10001"} {
+		defer setTestConfig(t, "list_chunk", value)()
+		_, err := NewFsWithConnection(testRemote, "container", &swift.Connection{}, false)
+		require.Error(t, err, value)
+		assert.Contains(t, err.Error(), "list_chunk must be between", value)
+	}
+}
+
+// accountPath is the path of the test account on the swifttest server
+const accountPath = "/v1/AUTH_" + swifttest.TEST_ACCOUNT
+
+// shortPages makes the listing at urlPath return at most n entries
+// per page as some broken servers do
+func shortPages(t *testing.T, srv *swifttest.SwiftServer, urlPath string, n int) {
+	srv.SetOverride(urlPath, func(w http.ResponseWriter, r *http.Request, recorder *httptest.ResponseRecorder) {
+		for k, v := range recorder.HeaderMap {
+			w.Header()[k] = v
+		}
+		if r.Method != "GET" || recorder.Code != http.StatusOK || recorder.Body.Len() == 0 {
+			w.WriteHeader(recorder.Code)
+			_, _ = w.Write(recorder.Body.Bytes())
+			return
+		}
+		var items []json.RawMessage
+		require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &items))
+		if len(items) > n {
+			items = items[:n]
+		}
+		w.Header().Del("Content-Length")
+		w.WriteHeader(recorder.Code)
+		require.NoError(t, json.NewEncoder(w).Encode(items))
+	})
+}
+
+func TestInternalListShortPages(t *testing.T) {
+	for _, test := range []struct {
+		key   string
+		value string
+		want  int
+	}{
+		{"fetch_until_empty_page", "false", 3},
+		{"fetch_until_empty_page", "true", 12},
+		{"partial_page_fetch_threshold", "50", 12},
+		{"partial_page_fetch_threshold", "80", 3},
+	} {
+		func() {
+			defer setTestConfig(t, "list_chunk", "5")()
+			defer setTestConfig(t, test.key, test.value)()
+			f, srv, cleanup := newTestFs(t, "container")
+			defer cleanup()
+			putEmptyObjects(t, f, 12)
+			f.noLargeObjects = true
+			shortPages(t, srv, accountPath+"/container", 3)
+
+			entries, err := f.List("dir")
+			require.NoError(t, err)
+			assert.Len(t, entries, test.want, "%s=%s", test.key, test.value)
+		}()
+	}
+}
+
+func TestInternalPartialPageFetchInvalid(t *testing.T) {
+	for _, value := range []string{"-1", "101"} {
+		defer setTestConfig(t, "partial_page_fetch_threshold", value)()
+		_, err := NewFsWithConnection(testRemote, "container", &swift.Connection{}, false)
+		require.Error(t, err, value)
+		assert.Contains(t, err.Error(), "partial_page_fetch_threshold must be between", value)
+	}
+}
+
+func TestInternalListContainers(t *testing.T) {
+	defer setTestConfig(t, "list_chunk", "5")()
+	f, srv, cleanup := newTestFs(t, "")
+	defer cleanup()
+	for i := 0; i < 12; i++ {
+		require.NoError(t, f.c.ContainerCreate(fmt.Sprintf("container%02d", i), nil))
+	}
+	// the swifttest server ignores the limit so make it obey it
+	shortPages(t, srv, accountPath, 5)
+
+	recorder(f).count("")
+	entries, err := f.List("")
+	require.NoError(t, err)
+	require.Len(t, entries, 12)
+	for i, entry := range entries {
+		assert.Equal(t, fmt.Sprintf("container%02d", i), entry.Remote())
+	}
+	assert.Equal(t, 3, recorder(f).count("GET"))
+
+	// check the listing stops early if asked
+	stop := errors.New("stop listing")
+	calls := 0
+	err = f.listContainersRoot(func(container *swift.Container) error {
+		calls++
+		return stop
+	})
+	assert.Equal(t, stop, err)
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, 1, recorder(f).count("GET"))
+}
+
+func TestInternalListContainersTimestamps(t *testing.T) {
+	for _, containerTimes := range []bool{false, true} {
+		func() {
+			defer setTestConfig(t, "container_timestamps", fmt.Sprint(containerTimes))()
+			f, srv, cleanup := newTestFs(t, "")
+			defer cleanup()
+			require.NoError(t, f.c.ContainerCreate("dated", nil))
+			require.NoError(t, f.c.ContainerCreate("undated", nil))
+			srv.SetOverride(accountPath+"/dated", func(w http.ResponseWriter, r *http.Request, recorder *httptest.ResponseRecorder) {
+				for k, v := range recorder.HeaderMap {
+					w.Header()[k] = v
+				}
+				w.Header().Set("X-Timestamp", "1404916537.12345")
+				w.WriteHeader(recorder.Code)
+				_, _ = w.Write(recorder.Body.Bytes())
+			})
+
+			recorder(f).count("")
+			entries, err := f.List("")
+			require.NoError(t, err)
+			require.Len(t, entries, 2)
+			if containerTimes {
+				assert.Equal(t, time.Date(2014, 7, 9, 14, 35, 37, 123450000, time.UTC), entries[0].ModTime().UTC())
+				assert.Equal(t, 2, recorder(f).count("HEAD"))
+			} else {
+				assert.WithinDuration(t, time.Now(), entries[0].ModTime(), time.Minute)
+				assert.Equal(t, 0, recorder(f).count("HEAD"))
+			}
+			assert.WithinDuration(t, time.Now(), entries[1].ModTime(), time.Minute)
+		}()
+	}
+}
+
+func TestInternalListMissingContainer(t *testing.T) {
+	f, _, cleanup := newTestFs(t, "missing")
+	defer cleanup()
+
+	_, err := f.List("")
+	assert.Equal(t, fs.ErrorDirNotFound, err)
+	_, err = f.List("dir")
+	assert.Equal(t, fs.ErrorDirNotFound, err)
+
+	for _, dir := range []string{"", "dir"} {
+		err = f.ListR(dir, func(entries fs.DirEntries) error {
+			return nil
+		})
+		assert.Equal(t, fs.ErrorDirNotFound, err)
+	}
+}
+
+func TestInternalListObjectsEndingInSlash(t *testing.T) {
+	f, _, cleanup := newTestFs(t, "container")
+	defer cleanup()
+	require.NoError(t, f.Mkdir(""))
+	require.NoError(t, f.c.ObjectPutString(f.container, "reports/2016/", "data", "text/plain"))
+	require.NoError(t, f.c.ObjectPutString(f.container, "reports/2016/a.txt", "hello", "text/plain"))
+	require.NoError(t, f.c.ObjectPutString(f.container, "reports/2017/", "data", "text/plain"))
+	require.NoError(t, f.c.ObjectPutString(f.container, "reports/empty/", "", "application/octet-stream"))
+
+	want := []string{
+		"reports/",
+		"reports/2016/",
+		"reports/2016/",
+		"reports/2016/a.txt",
+		"reports/2017/",
+		"reports/2017/",
+		"reports/empty/",
+		"reports/empty/",
+	}
+	got := listAll(t, f, "")
+	sort.Strings(got)
+	assert.Equal(t, want, got)
+
+	// Empty objects are directory markers with empty_directory_markers
+	defer setTestConfig(t, "empty_directory_markers", "true")()
+	newF, err := NewFsWithConnection(testRemote, "container", f.c, false)
+	require.NoError(t, err)
+	got = listAll(t, newF.(*Fs), "")
+	sort.Strings(got)
+	assert.Equal(t, want[:len(want)-1], got)
+
+	entries, err := f.List("reports/2017")
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	o, ok := entries[0].(*Object)
+	require.True(t, ok)
+	assert.Equal(t, "reports/2017/", o.Remote())
+	assert.Equal(t, int64(4), o.Size())
+
+	require.NoError(t, f.Purge())
+	_, _, err = f.c.Container(f.container)
+	assert.Equal(t, swift.ContainerNotFound, err)
+}
+
+func TestInternalParsePath(t *testing.T) {
+	for _, test := range []struct {
+		in              string
+		preserveSlashes bool
+		container       string
+		directory       string
+	}{
+		{"", false, "", ""},
+		{"container", false, "container", ""},
+		{"container/", false, "container", ""},
+		{"container/dir/", false, "container", "dir"},
+		{"container//weird", false, "container", "weird"},
+		{"container//weird", true, "container", "/weird"},
+		{"container/a//b", false, "container", "a//b"},
+		{"container/a//b/", true, "container", "a//b"},
+	} {
+		container, directory, err := parsePath(test.in, test.preserveSlashes)
+		require.NoError(t, err)
+		assert.Equal(t, test.container, container, test.in)
+		assert.Equal(t, test.directory, directory, test.in)
+	}
+}
+
+func TestInternalDoubledSlashes(t *testing.T) {
+	f, _, cleanup := newTestFs(t, "container")
+	defer cleanup()
+	require.NoError(t, f.Mkdir(""))
+	require.NoError(t, f.c.ObjectPutString(f.container, "a//b", "hello", "text/plain"))
+	require.NoError(t, f.c.ObjectPutString(f.container, "a/c", "hello", "text/plain"))
+	require.NoError(t, f.c.ObjectPutString(f.container, "/weird", "hello", "text/plain"))
+
+	got := listAll(t, f, "")
+	sort.Strings(got)
+	assert.Equal(t, []string{"a/", "a//", "a//b", "a/c"}, got)
+
+	var gotR []string
+	require.NoError(t, f.ListR("", func(entries fs.DirEntries) error {
+		for _, entry := range entries {
+			gotR = append(gotR, entry.Remote())
+		}
+		return nil
+	}))
+	sort.Strings(gotR)
+	assert.Equal(t, []string{"/weird", "a", "a/", "a//b", "a/c"}, gotR)
+
+	for _, remote := range []string{"a//b", "/weird"} {
+		o, err := f.NewObject(remote)
+		require.NoError(t, err, remote)
+		assert.Equal(t, int64(5), o.Size())
+	}
+}
+
+func TestInternalPreserveSlashes(t *testing.T) {
+	defer setTestConfig(t, "preserve_slashes", "true")()
+	f, _, cleanup := newTestFs(t, "container")
+	defer cleanup()
+	require.NoError(t, f.Mkdir(""))
+	require.NoError(t, f.c.ObjectPutString(f.container, "/weird", "hello", "text/plain"))
+	require.NoError(t, f.c.ObjectPutString(f.container, "a//b", "hello", "text/plain"))
+
+	for _, test := range []struct {
+		root   string
+		remote string
+	}{
+		{"container//weird", "weird"},
+		{"container/a//b", "b"},
+	} {
+		newF, err := NewFsWithConnection(testRemote, test.root, f.c, false)
+		assert.Equal(t, fs.ErrorIsFile, err, test.root)
+		o, err := newF.NewObject(test.remote)
+		require.NoError(t, err, test.root)
+		assert.Equal(t, int64(5), o.Size())
+	}
+}
+
+func TestInternalReservedCharsRoundTrip(t *testing.T) {
+	defer setTestConfig(t, "encode_names", "true")()
+	f, _, cleanup := newTestFs(t, "container")
+	defer cleanup()
+	require.NoError(t, f.Mkdir(""))
+	remotes := []string{"dir\n/new\nline.txt", "bad\xffutf8", "already␊encoded", "del\x7f"}
+	for _, remote := range remotes {
+		src := fs.NewStaticObjectInfo(remote, time.Now(), 5, true, nil, nil)
+		_, err := f.Put(strings.NewReader("hello"), src)
+		require.NoError(t, err, remote)
+	}
+	// check what is stored on the server
+	names, err := f.c.ObjectNamesAll(f.container, nil)
+	require.NoError(t, err)
+	sort.Strings(names)
+	assert.Equal(t, []string{"already‛␊encoded", "bad\uEEFFutf8", "del␡", "dir␊/new␊line.txt"}, names)
+
+	got := listAll(t, f, "")
+	sort.Strings(got)
+	assert.Equal(t, []string{"already␊encoded", "bad\xffutf8", "del\x7f", "dir\n/", "dir\n/new\nline.txt"}, got)
+	for _, remote := range remotes {
+		o, err := f.NewObject(remote)
+		require.NoError(t, err, remote)
+		assert.Equal(t, remote, o.Remote())
+		assert.Equal(t, int64(5), o.Size())
+	}
+
+	// check an Fs rooted in an encoded directory
+	newF, err := NewFsWithConnection(testRemote, "container/dir\n", f.c, false)
+	require.NoError(t, err)
+	entries, err := newF.List("")
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "new\nline.txt", entries[0].Remote())
+	assert.Equal(t, "container/dir\n/", newF.Root())
+}
+
+func TestInternalNamesNotEncoded(t *testing.T) {
+	f, _, cleanup := newTestFs(t, "container")
+	defer cleanup()
+	require.NoError(t, f.Mkdir(""))
+	// Names stored by other tools which look encoded are left alone
+	require.NoError(t, f.c.ObjectPutString(f.container, "already␊encoded", "hello", "text/plain"))
+	require.NoError(t, f.c.ObjectPutString(f.container, "quoted‛␊", "hello", "text/plain"))
+	got := listAll(t, f, "")
+	sort.Strings(got)
+	assert.Equal(t, []string{"already␊encoded", "quoted‛␊"}, got)
+	o, err := f.NewObject("already␊encoded")
+	require.NoError(t, err)
+	assert.Equal(t, "already␊encoded", o.Remote())
+}
+
+// corruptReads makes GETs of urlPath return the data with the first
+// byte changed and records the Range headers received
+func corruptReads(srv *swifttest.SwiftServer, urlPath string, ranges *[]string) {
+	srv.SetOverride(urlPath, func(w http.ResponseWriter, r *http.Request, recorder *httptest.ResponseRecorder) {
+		for k, v := range recorder.HeaderMap {
+			w.Header()[k] = v
+		}
+		w.WriteHeader(recorder.Code)
+		body := recorder.Body.Bytes()
+		if r.Method == "GET" {
+			*ranges = append(*ranges, r.Header.Get("Range"))
+			if len(body) > 0 {
+				body[0] ^= 0xFF
+			}
+		}
+		_, _ = w.Write(body)
+	})
+}
+
+func TestInternalOpenOptions(t *testing.T) {
+	f, srv, cleanup := newTestFs(t, "container")
+	defer cleanup()
+	require.NoError(t, f.Mkdir(""))
+	require.NoError(t, f.c.ObjectPutString(f.container, "file.txt", "0123456789", "text/plain"))
+	o, err := f.NewObject("file.txt")
+	require.NoError(t, err)
+
+	// check reads are correct with a working server
+	for _, test := range []struct {
+		option fs.OpenOption
+		want   string
+	}{
+		{nil, "0123456789"},
+		{&fs.SeekOption{Offset: 0}, "0123456789"},
+		{&fs.SeekOption{Offset: 4}, "456789"},
+		{&fs.RangeOption{Start: 0, End: 9}, "0123456789"},
+		{&fs.RangeOption{Start: 2, End: 4}, "234"},
+		{&fs.RangeOption{Start: 7, End: -1}, "789"},
+	} {
+		var options []fs.OpenOption
+		if test.option != nil {
+			options = append(options, test.option)
+		}
+		in, err := o.Open(options...)
+		require.NoError(t, err, test.option)
+		got, err := ioutil.ReadAll(in)
+		require.NoError(t, err, test.option)
+		require.NoError(t, in.Close())
+		assert.Equal(t, test.want, string(got), "%v", test.option)
+	}
+
+	// check full reads are verified and partial reads aren't
+	var ranges []string
+	corruptReads(srv, accountPath+"/container/file.txt", &ranges)
+	for _, test := range []struct {
+		option  fs.OpenOption
+		rangeH  string
+		corrupt bool
+	}{
+		{&fs.SeekOption{Offset: 0}, "", true},
+		{&fs.RangeOption{Start: 0, End: -1}, "", true},
+		{&fs.RangeOption{Start: 0, End: 20}, "", true},
+		{&fs.SeekOption{Offset: 4}, "bytes=4-", false},
+		{&fs.RangeOption{Start: 2, End: 4}, "bytes=2-4", false},
+		{&fs.RangeOption{Start: -1, End: 3}, "bytes=-3", false},
+	} {
+		ranges = nil
+		in, err := o.Open(test.option)
+		require.NoError(t, err, test.option)
+		_, err = ioutil.ReadAll(in)
+		closeErr := in.Close()
+		if err == nil {
+			err = closeErr
+		}
+		if test.corrupt {
+			require.Error(t, err, "%v", test.option)
+			assert.True(t, fs.IsRetryError(err), "%v", test.option)
+			assert.Contains(t, err.Error(), "corrupted on transfer", "%v", test.option)
+		} else {
+			assert.NoError(t, err, "%v", test.option)
+		}
+		assert.Equal(t, []string{test.rangeH}, ranges, "%v", test.option)
+	}
+}
+
+func TestInternalOpenEmptyRanges(t *testing.T) {
+	f, srv, cleanup := newTestFs(t, "container")
+	defer cleanup()
+	require.NoError(t, f.Mkdir(""))
+	require.NoError(t, f.c.ObjectPutString(f.container, "empty.txt", "", "text/plain"))
+	require.NoError(t, f.c.ObjectPutString(f.container, "file.txt", "0123456789", "text/plain"))
+
+	// make the server refuse all ranges and count the GETs
+	gets := 0
+	refuseRanges := func(w http.ResponseWriter, r *http.Request, recorder *httptest.ResponseRecorder) {
+		if r.Method == "GET" {
+			gets++
+			if r.Header.Get("Range") != "" {
+				w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+				return
+			}
+		}
+		for k, v := range recorder.HeaderMap {
+			w.Header()[k] = v
+		}
+		w.WriteHeader(recorder.Code)
+		_, _ = w.Write(recorder.Body.Bytes())
+	}
+	srv.SetOverride(accountPath+"/container/empty.txt", refuseRanges)
+	srv.SetOverride(accountPath+"/container/file.txt", refuseRanges)
+
+	for _, test := range []struct {
+		remote string
+		option fs.OpenOption
+		gets   int
+	}{
+		{"empty.txt", &fs.SeekOption{Offset: 5}, 0},
+		{"empty.txt", &fs.RangeOption{Start: 0, End: 3}, 1},
+		{"empty.txt", &fs.RangeOption{Start: -1, End: 3}, 0},
+		{"file.txt", &fs.SeekOption{Offset: 10}, 0},
+		{"file.txt", &fs.RangeOption{Start: 12, End: 20}, 0},
+	} {
+		o, err := f.NewObject(test.remote)
+		require.NoError(t, err)
+		gets = 0
+		in, err := o.Open(test.option)
+		require.NoError(t, err, "%s %v", test.remote, test.option)
+		got, err := ioutil.ReadAll(in)
+		require.NoError(t, err, "%s %v", test.remote, test.option)
+		require.NoError(t, in.Close())
+		assert.Equal(t, "", string(got), "%s %v", test.remote, test.option)
+		assert.Equal(t, test.gets, gets, "%s %v", test.remote, test.option)
+	}
+
+	// A refused range inside the object is an error so a resumed
+	// download can't end early
+	o, err := f.NewObject("file.txt")
+	require.NoError(t, err)
+	gets = 0
+	_, err = o.Open(&fs.SeekOption{Offset: 4})
+	require.Error(t, err)
+	assert.Equal(t, 1, gets)
+
+	// Unless the object is shorter than we thought
+	o.(*Object).info.Bytes = 20
+	gets = 0
+	in, err := o.Open(&fs.SeekOption{Offset: 10})
+	require.NoError(t, err)
+	got, err := ioutil.ReadAll(in)
+	require.NoError(t, err)
+	require.NoError(t, in.Close())
+	assert.Equal(t, "", string(got))
+	assert.Equal(t, 1, gets)
+	assert.Equal(t, int64(10), o.Size())
+}
+
+// checkIfMatch makes the server at urlPath obey If-Match and records
+// the If-Match headers received
+func checkIfMatch(srv *swifttest.SwiftServer, urlPath string, ifMatches *[]string) {
+	srv.SetOverride(urlPath, func(w http.ResponseWriter, r *http.Request, recorder *httptest.ResponseRecorder) {
+		if r.Method == "GET" {
+			ifMatch := r.Header.Get("If-Match")
+			*ifMatches = append(*ifMatches, ifMatch)
+			if ifMatch != "" && ifMatch != recorder.HeaderMap.Get("Etag") {
+				w.WriteHeader(http.StatusPreconditionFailed)
+				return
+			}
+		}
+		for k, v := range recorder.HeaderMap {
+			w.Header()[k] = v
+		}
+		w.WriteHeader(recorder.Code)
+		_, _ = w.Write(recorder.Body.Bytes())
+	})
+}
+
+func TestInternalOpenIfMatch(t *testing.T) {
+	for _, noIfMatch := range []bool{false, true} {
+		func() {
+			defer setTestConfig(t, "no_if_match", fmt.Sprint(noIfMatch))()
+			f, srv, cleanup := newTestFs(t, "container")
+			defer cleanup()
+			require.NoError(t, f.Mkdir(""))
+			require.NoError(t, f.c.ObjectPutString(f.container, "file.txt", "hello", "text/plain"))
+			var ifMatches []string
+			checkIfMatch(srv, accountPath+"/container/file.txt", &ifMatches)
+			o, err := f.NewObject("file.txt")
+			require.NoError(t, err)
+
+			in, err := o.Open()
+			require.NoError(t, err)
+			require.NoError(t, in.Close())
+			want := "5d41402abc4b2a76b9719d911017c592"
+			if noIfMatch {
+				want = ""
+			}
+			assert.Equal(t, []string{want}, ifMatches)
+
+			// overwrite the object under the download
+			require.NoError(t, f.c.ObjectPutString(f.container, "file.txt", "changed", "text/plain"))
+			_, err = o.Open()
+			if noIfMatch {
+				require.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.True(t, fs.IsRetryError(err))
+			assert.Equal(t, int64(7), o.Size())
+
+			// the retry should then succeed
+			in, err = o.Open()
+			require.NoError(t, err)
+			got, err := ioutil.ReadAll(in)
+			require.NoError(t, err)
+			require.NoError(t, in.Close())
+			assert.Equal(t, "changed", string(got))
+		}()
+	}
+}
+
+func TestInternalOpenIfMatchLargeObject(t *testing.T) {
+	f, srv, cleanup := newTestFs(t, "container")
+	defer cleanup()
+	oldChunkSize := chunkSize
+	chunkSize = 4
+	defer func() { chunkSize = oldChunkSize }()
+	require.NoError(t, f.Mkdir(""))
+	src := fs.NewStaticObjectInfo("large", time.Now(), 10, true, nil, nil)
+	o, err := f.Put(strings.NewReader("0123456789"), src)
+	require.NoError(t, err)
+	var ifMatches []string
+	checkIfMatch(srv, accountPath+"/container/large", &ifMatches)
+
+	in, err := o.Open()
+	require.NoError(t, err)
+	require.NoError(t, in.Close())
+	assert.Equal(t, []string{""}, ifMatches)
+}
+
+func TestInternalOpenIfMatchFromListing(t *testing.T) {
+	f, srv, cleanup := newTestFs(t, "container")
+	defer cleanup()
+	oldChunkSize := chunkSize
+	chunkSize = 4
+	defer func() { chunkSize = oldChunkSize }()
+	require.NoError(t, f.Mkdir(""))
+	require.NoError(t, f.c.ObjectPutString(f.container, "file.txt", "hello", "text/plain"))
+	src := fs.NewStaticObjectInfo("large", time.Now(), 10, true, nil, nil)
+	_, err := f.Put(strings.NewReader("0123456789"), src)
+	require.NoError(t, err)
+	var ifMatches []string
+	checkIfMatch(srv, accountPath+"/container/file.txt", &ifMatches)
+	checkIfMatch(srv, accountPath+"/container/large", &ifMatches)
+
+	entries, err := f.List("")
+	require.NoError(t, err)
+	objects := map[string]fs.Object{}
+	for _, entry := range entries {
+		if o, ok := entry.(fs.Object); ok {
+			objects[o.Remote()] = o
+		}
+	}
+	require.Len(t, objects, 2)
+
+	// The ETag from the listing is sent without a HEAD
+	recorder(f).count("")
+	got, err := readObject(t, objects["file.txt"])
+	require.NoError(t, err)
+	assert.Equal(t, "hello", got)
+	assert.Equal(t, []string{"5d41402abc4b2a76b9719d911017c592"}, ifMatches)
+	assert.Equal(t, 0, recorder(f).count("HEAD"))
+
+	// A large object's ETag in the listing isn't its content's so
+	// if its metadata isn't known it is read again without If-Match
+	large := objects["large"].(*Object)
+	require.NotNil(t, large.headers, "zero byte objects are checked when listing")
+	large.headers = nil
+	large.info.Hash = "d41d8cd98f00b204e9800998ecf8427e" // the manifest's
+	ifMatches = nil
+	got, err = readObject(t, large)
+	require.NoError(t, err)
+	assert.Equal(t, "0123456789", got)
+	require.Len(t, ifMatches, 2)
+	assert.NotEqual(t, "", ifMatches[0])
+	assert.Equal(t, "", ifMatches[1])
+}
+
+func TestInternalOpenHashCheck(t *testing.T) {
+	f, srv, cleanup := newTestFs(t, "container")
+	defer cleanup()
+	require.NoError(t, f.Mkdir(""))
+	require.NoError(t, f.c.ObjectPutString(f.container, "file.txt", "0123456789", "text/plain"))
+	o, err := f.NewObject("file.txt")
+	require.NoError(t, err)
+	var ranges []string
+	corruptReads(srv, accountPath+"/container/file.txt", &ranges)
+
+	// Reading exactly the size of the object without seeing EOF
+	// should still be checked
+	in, err := o.Open()
+	require.NoError(t, err)
+	buf := make([]byte, 10)
+	for n := 0; n < len(buf) && err == nil; {
+		var nn int
+		nn, err = in.Read(buf[n:])
+		n += nn
+	}
+	require.Error(t, err)
+	assert.True(t, fs.IsRetryError(err))
+	err = in.Close()
+	require.Error(t, err)
+	assert.True(t, fs.IsRetryError(err))
+
+	// An incomplete read isn't checked
+	in, err = o.Open()
+	require.NoError(t, err)
+	_, err = io.ReadFull(in, buf[:5])
+	require.NoError(t, err)
+	require.NoError(t, in.Close())
+
+	// Large objects only have their size checked by rclone
+	oldChunkSize := chunkSize
+	chunkSize = 4
+	defer func() { chunkSize = oldChunkSize }()
+	src := fs.NewStaticObjectInfo("large", time.Now(), 10, true, nil, nil)
+	large, err := f.Put(strings.NewReader("0123456789"), src)
+	require.NoError(t, err)
+	in, err = large.Open()
+	require.NoError(t, err)
+	check, isHashCheck := in.(*hashCheckReader)
+	require.True(t, isHashCheck)
+	assert.Nil(t, check.hash)
+	got, err := ioutil.ReadAll(in)
+	require.NoError(t, err)
+	require.NoError(t, in.Close())
+	assert.Equal(t, "0123456789", string(got))
+}
+
+func TestInternalHashCheckReaderUnknownSize(t *testing.T) {
+	sum := md5.Sum([]byte("hello"))
+	want := hex.EncodeToString(sum[:])
+
+	// Without a size the hash is only checked at the end
+	in := newHashCheckReader(ioutil.NopCloser(iotest.OneByteReader(strings.NewReader("hello"))), want, -1)
+	got, err := ioutil.ReadAll(in)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(got))
+
+	in = newHashCheckReader(ioutil.NopCloser(iotest.OneByteReader(strings.NewReader("HELLO"))), want, -1)
+	_, err = ioutil.ReadAll(in)
+	require.Error(t, err)
+	assert.True(t, fs.IsRetryError(err))
+}
+
+// putLargeObject uploads contents as a dynamic large object in
+// segments of segmentSize
+func putLargeObject(t *testing.T, f *Fs, remote, contents string, segmentSize int) fs.Object {
+	oldChunkSize := chunkSize
+	chunkSize = fs.SizeSuffix(segmentSize)
+	defer func() { chunkSize = oldChunkSize }()
+	require.NoError(t, f.Mkdir(""))
+	src := fs.NewStaticObjectInfo(remote, time.Now(), int64(len(contents)), true, nil, nil)
+	o, err := f.Put(strings.NewReader(contents), src)
+	require.NoError(t, err)
+	return o
+}
+
+// readObject reads all of o
+func readObject(t *testing.T, o fs.Object) (string, error) {
+	in, err := o.Open()
+	if err != nil {
+		return "", err
+	}
+	got, err := ioutil.ReadAll(in)
+	closeErr := in.Close()
+	if err == nil {
+		err = closeErr
+	}
+	return string(got), err
+}
+
+func TestInternalDownloadSegments(t *testing.T) {
+	defer setTestConfig(t, "download_concurrency", "3")()
+	defer setTestConfig(t, "download_cutoff", "10b")()
+	f, srv, cleanup := newTestFs(t, "container")
+	defer cleanup()
+	contents := "abcdefghijklmnopqrstuvwxyz"
+	o := putLargeObject(t, f, "large", contents, 4)
+	small := putLargeObject(t, f, "small", "0123456789", 4)
+
+	// check the segments are downloaded and not the manifest
+	recorder(f).count("")
+	got, err := readObject(t, o)
+	require.NoError(t, err)
+	assert.Equal(t, contents, got)
+	requests := recorder(f).all()
+	segmentGets := 0
+	for _, request := range requests {
+		assert.False(t, strings.HasPrefix(request, "GET "+accountPath+"/container/large"), request)
+		if strings.HasPrefix(request, "GET "+accountPath+"/container_segments/large/") {
+			segmentGets++
 		}
 	}
+	assert.Equal(t, 7, segmentGets)
+
+	// objects below the cutoff are downloaded normally
+	got, err = readObject(t, small)
+	require.NoError(t, err)
+	assert.Equal(t, "0123456789", got)
+	assert.Equal(t, 0, strings.Count(strings.Join(recorder(f).all(), "\n"), "container_segments/small/"))
+
+	// a corrupted segment gives a retry error
+	names, err := f.c.ObjectNamesAll(f.segmentsContainer, &swift.ObjectsOpts{Prefix: "large/"})
+	require.NoError(t, err)
+	require.Len(t, names, 7)
+	var ranges []string
+	corruptReads(srv, accountPath+"/container_segments/"+names[3], &ranges)
+	_, err = readObject(t, o)
+	require.Error(t, err)
+	assert.True(t, fs.IsRetryError(err))
+	srv.UnsetOverride(accountPath + "/container_segments/" + names[3])
+
+	// missing segments fall back to a normal download which
+	// notices the object is short
+	require.NoError(t, f.c.ObjectDelete(f.segmentsContainer, names[6]))
+	recorder(f).count("")
+	_, err = readObject(t, o)
+	require.Error(t, err)
+	assert.True(t, fs.IsRetryError(err))
+	assert.Contains(t, err.Error(), "sizes differ 26 vs 24")
+	assert.Contains(t, recorder(f).all(), "GET "+accountPath+"/container/large")
+}
+
+func TestInternalDownloadConcurrencyInvalid(t *testing.T) {
+	for _, test := range []struct {
+		key, value, want string
+	}{
+		{"download_concurrency", "0", "download_concurrency must be at least 1"},
+		{"download_cutoff", "potato", "bad download_cutoff"},
+	} {
+		func() {
+			defer setTestConfig(t, test.key, test.value)()
+			_, err := NewFsWithConnection(testRemote, "container", &swift.Connection{}, false)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), test.want)
+		}()
+	}
+}
+
+func TestInternalNoHeadObject(t *testing.T) {
+	f, srv, cleanup := newTestFs(t, "container")
+	defer cleanup()
+	require.NoError(t, f.Mkdir(""))
+	require.NoError(t, f.c.ObjectPutString(f.container, "dir/file.txt", "hello", "text/plain"))
+
+	// The object is found with a HEAD
+	recorder(f).count("")
+	newF, err := NewFsWithConnection(testRemote, "container/dir/file.txt", f.c, false)
+	assert.Equal(t, fs.ErrorIsFile, err)
+	assert.Equal(t, "container/dir/", newF.Root())
+	assert.Equal(t, 1, recorder(f).count("HEAD"))
+
+	// A 403 on the HEAD means it is a directory
+	srv.SetOverride(accountPath+"/container/dir/file.txt", func(w http.ResponseWriter, r *http.Request, recorder *httptest.ResponseRecorder) {
+		w.WriteHeader(http.StatusForbidden)
+	})
+	newF, err = NewFsWithConnection(testRemote, "container/dir/file.txt", f.c, false)
+	require.NoError(t, err)
+	assert.Equal(t, "container/dir/file.txt/", newF.Root())
+	srv.UnsetOverride(accountPath + "/container/dir/file.txt")
+
+	// With no_head_object the root is assumed to be a directory
+	defer setTestConfig(t, "no_head_object", "true")()
+	recorder(f).count("")
+	newF, err = NewFsWithConnection(testRemote, "container/dir/file.txt", f.c, false)
+	require.NoError(t, err)
+	assert.Equal(t, "container/dir/file.txt/", newF.Root())
+	assert.Equal(t, 0, recorder(f).count("HEAD"))
+
+	// The object can still be found with NewObject
+	newF, err = NewFsWithConnection(testRemote, "container/dir", f.c, false)
+	require.NoError(t, err)
+	o, err := newF.NewObject("file.txt")
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), o.Size())
+}
+
+func TestInternalContainerCache(t *testing.T) {
+	f, _, cleanup := newTestFs(t, "container")
+	defer cleanup()
+	f2, err := NewFsWithConnection(testRemote, "container/dir", f.c, false)
+	require.NoError(t, err)
+
+	// Only the first Mkdir should check and create the container.
+	// Uploads to f2 make the container the same way without
+	// making a marker for its root.
+	recorder(f).count("")
+	require.NoError(t, f.Mkdir(""))
+	assert.Equal(t, 1, recorder(f).count("HEAD"))
+	require.NoError(t, f.Mkdir(""))
+	require.NoError(t, f2.(*Fs).makeRootContainer())
+	assert.Equal(t, 0, recorder(f).count(""))
+
+	// Deleting the container should forget it
+	require.NoError(t, f.Rmdir(""))
+	recorder(f).count("")
+	require.NoError(t, f2.(*Fs).makeRootContainer())
+	assert.Equal(t, 1, recorder(f).count("PUT"))
+
+	// Entries should expire
+	oldTTL := containerCacheTTL
+	containerCacheTTL = 0
+	defer func() { containerCacheTTL = oldTTL }()
+	recorder(f).count("")
+	require.NoError(t, f.Mkdir(""))
+	assert.Equal(t, 1, recorder(f).count("HEAD"))
+}
+
+func TestInternalSegmentsContainerDeleted(t *testing.T) {
+	f, _, cleanup := newTestFs(t, "container")
+	defer cleanup()
+	require.NoError(t, f.Mkdir(""))
+
+	// Pretend the segments container was known to exist but has
+	// since been deleted
+	key, err := f.containerKey(f.segmentsContainer)
+	require.NoError(t, err)
+	require.NoError(t, containers.ensure(key, func() error { return nil }))
+
+	o := putLargeObject(t, f, "large", "0123456789", 4)
+	got, err := readObject(t, o)
+	require.NoError(t, err)
+	assert.Equal(t, "0123456789", got)
+}
+
+func TestInternalErrorContext(t *testing.T) {
+	f, _, cleanup := newTestFs(t, "container")
+	defer cleanup()
+	putEmptyObjects(t, f, 1)
+
+	o, err := f.NewObject("dir/empty0.lock")
+	require.NoError(t, err)
+
+	// Delete the object behind rclone's back then remove it
+	require.NoError(t, f.c.ObjectDelete(f.container, f.root+"dir/empty0.lock"))
+	err = o.Remove()
+	require.Error(t, err)
+	assert.Equal(t, fs.ErrorObjectNotFound, errors.Cause(err))
+	assert.Contains(t, err.Error(), "dir/empty0.lock")
+	assert.Contains(t, err.Error(), "container")
+
+	// Deleting a missing container names it
+	err = f.deleteContainer("missing")
+	require.Error(t, err)
+	assert.Equal(t, swift.ContainerNotFound, errors.Cause(err))
+	assert.Contains(t, err.Error(), `"missing"`)
+}
+
+func TestInternalNormalizeNames(t *testing.T) {
+	f, _, cleanup := newTestFs(t, "container")
+	defer cleanup()
+	const (
+		nfd = "cafe\u0301" // as uploaded from macOS
+		nfc = "caf\u00e9"
+	)
+	require.NoError(t, f.Mkdir(""))
+	require.NoError(t, f.c.ObjectPutString(f.container, "dir/"+nfd+"/file.txt", "hello", "text/plain"))
+	require.NoError(t, f.c.ObjectPutString(f.container, "dir/"+nfd+".txt", "one", "text/plain"))
+	require.NoError(t, f.c.ObjectPutString(f.container, "dir/"+nfc+".txt", "two", "text/plain"))
+
+	// Names are listed as stored by default
+	remotes := listAll(t, f, "")
+	sort.Strings(remotes)
+	assert.Equal(t, []string{"dir/", "dir/" + nfd + ".txt", "dir/" + nfd + "/", "dir/" + nfd + "/file.txt", "dir/" + nfc + ".txt"}, remotes)
+	_, err := f.NewObject("dir/" + nfc + "/file.txt")
+	assert.Equal(t, fs.ErrorObjectNotFound, err)
+
+	defer setTestConfig(t, "normalize_names", "true")()
+	newF, err := NewFsWithConnection(testRemote, "container", f.c, false)
+	require.NoError(t, err)
+	f = newF.(*Fs)
+
+	// Both objects with the same normalized name are listed and
+	// the directory can be listed with its normalized name
+	remotes = listAll(t, f, "")
+	sort.Strings(remotes)
+	assert.Equal(t, []string{"dir/", "dir/" + nfc + ".txt", "dir/" + nfc + ".txt", "dir/" + nfc + "/", "dir/" + nfc + "/file.txt"}, remotes)
+
+	// Recursive listings are normalized too
+	remotes = nil
+	err = f.list("", true, func(entry fs.DirEntry) error {
+		remotes = append(remotes, entry.Remote())
+		return nil
+	})
+	require.NoError(t, err)
+	sort.Strings(remotes)
+	assert.Equal(t, []string{"dir/" + nfc + ".txt", "dir/" + nfc + ".txt", "dir/" + nfc + "/file.txt"}, remotes)
+
+	// Objects can be found and read by their normalized names
+	newF, err = NewFsWithConnection(testRemote, "container", f.c, false)
+	require.NoError(t, err)
+	o, err := newF.NewObject("dir/" + nfc + "/file.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "dir/"+nfc+"/file.txt", o.Remote())
+	got, err := readObject(t, o)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", got)
+	_, err = newF.NewObject("dir/" + nfc + "/missing.txt")
+	assert.Equal(t, fs.ErrorObjectNotFound, err)
+}
+
+func TestInternalLargeObjectSize(t *testing.T) {
+	f, _, cleanup := newTestFs(t, "container")
+	defer cleanup()
+	require.NoError(t, f.Mkdir(""))
+	o := putLargeObject(t, f, "large", "0123456789", 4)
+
+	got, err := readObject(t, o)
+	require.NoError(t, err)
+	assert.Equal(t, "0123456789", got)
+
+	// Delete the last segment - swift returns the rest without an error
+	names, err := f.c.ObjectNamesAll(f.segmentsContainer, &swift.ObjectsOpts{Prefix: "large/"})
+	require.NoError(t, err)
+	require.Len(t, names, 3)
+	require.NoError(t, f.c.ObjectDelete(f.segmentsContainer, names[2]))
+
+	got, err = readObject(t, o)
+	require.Error(t, err)
+	assert.True(t, fs.IsRetryError(err))
+	assert.Contains(t, err.Error(), "sizes differ 10 vs 8")
+	assert.Equal(t, "01234567", got)
+
+	// Ranged reads aren't checked
+	in, err := o.Open(&fs.RangeOption{Start: 2, End: 5})
+	require.NoError(t, err)
+	got2, err := ioutil.ReadAll(in)
+	require.NoError(t, err)
+	require.NoError(t, in.Close())
+	assert.Equal(t, "2345", string(got2))
+}
+
+func TestInternalExpires(t *testing.T) {
+	f, srv, cleanup := newTestFs(t, "container")
+	defer cleanup()
+	require.NoError(t, f.Mkdir(""))
+	require.NoError(t, f.c.ObjectPutString(f.container, "file.txt", "hello", "text/plain"))
+	expires := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+	deleteAt := strconv.FormatInt(expires.Unix(), 10)
+	srv.SetOverride(accountPath+"/container/file.txt", func(w http.ResponseWriter, r *http.Request, recorder *httptest.ResponseRecorder) {
+		for k, v := range recorder.HeaderMap {
+			w.Header()[k] = v
+		}
+		if r.Method == "HEAD" || r.Method == "GET" {
+			w.Header().Set("X-Delete-At", deleteAt)
+		}
+		w.WriteHeader(recorder.Code)
+		_, _ = w.Write(recorder.Body.Bytes())
+	})
+
+	// Listings don't HEAD the object so don't know the expiry
+	entries, err := f.List("")
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.True(t, entries[0].(*Object).expires().IsZero())
+
+	// Reading the metadata finds it
+	o, err := f.NewObject("file.txt")
+	require.NoError(t, err)
+	assert.True(t, expires.Equal(o.(*Object).expires()), "got %v", o.(*Object).expires())
+
+	// Setting the modtime and updating still work
+	require.NoError(t, o.SetModTime(expires))
+	src := fs.NewStaticObjectInfo("file.txt", time.Now(), 3, true, nil, nil)
+	require.NoError(t, o.Update(strings.NewReader("new"), src))
+	assert.Equal(t, int64(3), o.Size())
+
+	// A bad header is ignored
+	deleteAt = "soon"
+	o, err = f.NewObject("file.txt")
+	require.NoError(t, err)
+	assert.True(t, o.(*Object).expires().IsZero())
+}
+
+func TestInternalPacerRetries(t *testing.T) {
+	f, srv, cleanup := newTestFs(t, "container")
+	defer cleanup()
+	require.NoError(t, f.Mkdir(""))
+	require.NoError(t, f.c.ObjectPutString(f.container, "file.txt", "hello", "text/plain"))
+
+	// fail the first few HEADs with status then pass them through
+	var heads, failures, status int
+	srv.SetOverride(accountPath+"/container/file.txt", func(w http.ResponseWriter, r *http.Request, recorder *httptest.ResponseRecorder) {
+		if r.Method == "HEAD" {
+			heads++
+			if heads <= failures {
+				w.WriteHeader(status)
+				return
+			}
+		}
+		for k, v := range recorder.HeaderMap {
+			w.Header()[k] = v
+		}
+		w.WriteHeader(recorder.Code)
+		_, _ = w.Write(recorder.Body.Bytes())
+	})
+
+	for _, status = range []int{429, 498, http.StatusServiceUnavailable} {
+		heads, failures = 0, 2
+		o, err := f.NewObject("file.txt")
+		require.NoError(t, err, "status %d", status)
+		assert.Equal(t, int64(5), o.Size())
+		assert.Equal(t, 3, heads, "status %d", status)
+	}
+
+	// Other errors aren't retried
+	heads, failures, status = 0, 2, http.StatusForbidden
+	_, err := f.NewObject("file.txt")
+	require.Error(t, err)
+	assert.Equal(t, 1, heads)
+}
+
+func TestInternalObjectErrorClasses(t *testing.T) {
+	f, srv, cleanup := newTestFs(t, "container")
+	defer cleanup()
+	require.NoError(t, f.Mkdir(""))
+	require.NoError(t, f.c.ObjectPutString(f.container, "file.txt", "hello", "text/plain"))
+	o, err := f.NewObject("file.txt")
+	require.NoError(t, err)
+
+	// fail the first few DELETEs with status then pass them through
+	//
+	// The server has already deleted the object when it fails the
+	// DELETE so only errors which aren't retried can be checked.
+	var deletes, failures, status int
+	srv.SetOverride(accountPath+"/container/file.txt", func(w http.ResponseWriter, r *http.Request, recorder *httptest.ResponseRecorder) {
+		if r.Method == "DELETE" {
+			deletes++
+			if deletes <= failures {
+				w.WriteHeader(status)
+				return
+			}
+		}
+		for k, v := range recorder.HeaderMap {
+			w.Header()[k] = v
+		}
+		w.WriteHeader(recorder.Code)
+		_, _ = w.Write(recorder.Body.Bytes())
+	})
+
+	// Permanent errors fail straight away and aren't retried by
+	// the sync
+	for _, status = range []int{http.StatusForbidden, http.StatusRequestEntityTooLarge} {
+		deletes, failures = 0, 1
+		err = o.Remove()
+		require.Error(t, err, "status %d", status)
+		assert.True(t, fs.IsNoRetryError(err), "status %d", status)
+		assert.Equal(t, 1, deletes, "status %d", status)
+	}
+
+	// An expired token is only authenticated again by the library
+	// so no more DELETEs are made than the library makes
+	deletes, failures, status = 0, 100, http.StatusUnauthorized
+	require.Error(t, f.c.ObjectDelete(f.container, "file.txt"))
+	libraryDeletes := deletes
+	deletes = 0
+	err = o.Remove()
+	require.Error(t, err)
+	assert.False(t, fs.IsNoRetryError(err))
+	assert.False(t, fs.IsRetryError(err))
+	assert.Equal(t, libraryDeletes, deletes)
+
+	// Transient errors are retried by the pacer then returned as
+	// they are so they aren't retried again at the low level
+	deletes, failures, status = 0, 100, http.StatusServiceUnavailable
+	err = o.Remove()
+	require.Error(t, err)
+	assert.True(t, deletes > 1, "deletes %d", deletes)
+	assert.False(t, fs.IsRetryError(err))
+	assert.False(t, fs.IsNoRetryError(err))
+}
+
+// benchmarkList lists a container of n objects in 10 directories
+// with list each time round, checking it returns want entries
+func benchmarkList(b *testing.B, n, want int, list func(f *Fs) (int, error)) {
+	f, _, cleanup := newTestFs(b, "container")
+	defer cleanup()
+	f.pacer.SetMinSleep(0)
+	require.NoError(b, f.Mkdir(""))
+	for i := 0; i < n; i++ {
+		require.NoError(b, f.c.ObjectPutString(f.container, fmt.Sprintf("dir%d/file%d.txt", i%10, i), "hello", "text/plain"))
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		got, err := list(f)
+		require.NoError(b, err)
+		require.Equal(b, want, got)
+	}
+}
+
+func BenchmarkListContainerRoot(b *testing.B) {
+	benchmarkList(b, 5000, 5000, func(f *Fs) (n int, err error) {
+		err = f.listContainerRoot(f.container, f.root, "", true, func(remote string, object *swift.Object, isDirectory bool) error {
+			n++
+			return nil
+		})
+		return n, err
+	})
+}
+
+func BenchmarkListR(b *testing.B) {
+	benchmarkList(b, 5000, 5010, func(f *Fs) (n int, err error) {
+		err = f.ListR("", func(entries fs.DirEntries) error {
+			n += len(entries)
+			return nil
+		})
+		return n, err
+	})
+}
+
+func TestInternalChunkedUpload(t *testing.T) {
+	f, _, cleanup := newTestFs(t, "container/path")
+	defer cleanup()
+	o := putLargeObject(t, f, "dir/large", "0123456789", 4)
+	assert.Equal(t, int64(10), o.Size())
+	isDynamicLargeObject, err := o.(*Object).isDynamicLargeObject()
+	require.NoError(t, err)
+	assert.True(t, isDynamicLargeObject)
+
+	// The segments are in the segments container under the object name
+	names, err := f.c.ObjectNamesAll(f.segmentsContainer, nil)
+	require.NoError(t, err)
+	require.Len(t, names, 3)
+	for _, name := range names {
+		assert.True(t, strings.HasPrefix(name, "path/dir/large/"), name)
+	}
+	got, err := readObject(t, o)
+	require.NoError(t, err)
+	assert.Equal(t, "0123456789", got)
+
+	// Updating it replaces the segments
+	oldChunkSize := chunkSize
+	chunkSize = 4
+	defer func() { chunkSize = oldChunkSize }()
+	src := fs.NewStaticObjectInfo("dir/large", time.Now(), 6, true, nil, nil)
+	require.NoError(t, o.Update(strings.NewReader("abcdef"), src))
+	newNames, err := f.c.ObjectNamesAll(f.segmentsContainer, nil)
+	require.NoError(t, err)
+	require.Len(t, newNames, 2)
+	for _, name := range newNames {
+		assert.NotContains(t, names, name)
+	}
+	got, err = readObject(t, o)
+	require.NoError(t, err)
+	assert.Equal(t, "abcdef", got)
+
+	// Removing it removes the segments
+	require.NoError(t, o.Remove())
+	_, err = f.c.ObjectNamesAll(f.segmentsContainer, nil)
+	assert.Equal(t, swift.ContainerNotFound, err)
+}
+
+func TestInternalPurgeLargeObjects(t *testing.T) {
+	f, _, cleanup := newTestFs(t, "container")
+	defer cleanup()
+	putLargeObject(t, f, "dir/large", "0123456789", 4)
+	require.NoError(t, f.c.ObjectPutString(f.container, "dir/small", "hello", "text/plain"))
+	require.NoError(t, f.c.ObjectPutString(f.container, "dir/", "", directoryMarkerContentType))
+
+	require.NoError(t, f.Purge())
+	_, err := f.c.ObjectNamesAll(f.container, nil)
+	assert.Equal(t, swift.ContainerNotFound, err)
+	_, err = f.c.ObjectNamesAll(f.segmentsContainer, nil)
+	assert.Equal(t, swift.ContainerNotFound, err)
+}
+
+func TestInternalCopyLargeObject(t *testing.T) {
+	f, _, cleanup := newTestFs(t, "container")
+	defer cleanup()
+	o := putLargeObject(t, f, "large", "0123456789", 4)
+
+	dst, err := f.Copy(o, "copy")
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), dst.Size())
+	got, err := readObject(t, dst)
+	require.NoError(t, err)
+	assert.Equal(t, "0123456789", got)
+
+	// The original is still intact
+	got, err = readObject(t, o)
+	require.NoError(t, err)
+	assert.Equal(t, "0123456789", got)
+}
+
+func TestInternalPreserveManifestOnCopy(t *testing.T) {
+	defer setTestConfig(t, "preserve_manifest_on_copy", "true")()
+	f, _, cleanup := newTestFs(t, "container")
+	defer cleanup()
+	require.NoError(t, f.Mkdir(""))
+
+	// A manifest pointing at segments in a shared pool
+	require.NoError(t, f.c.ContainerCreate("pool", nil))
+	for i, segment := range []string{"01234", "56789"} {
+		require.NoError(t, f.c.ObjectPutString("pool", fmt.Sprintf("shared/%08d", i), segment, ""))
+	}
+	modTime := time.Date(2017, 1, 2, 3, 4, 5, 0, time.UTC)
+	_, err := f.c.ObjectPut(f.container, "large", bytes.NewReader(nil), true, "", "text/plain", swift.Headers{
+		"X-Object-Manifest":    "pool/shared/",
+		"X-Object-Meta-Origin": "portal",
+		mtimeHeader:            swift.TimeToFloatString(modTime),
+		"Content-Disposition":  "attachment",
+	})
+	require.NoError(t, err)
+	o, err := f.NewObject("large")
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), o.Size())
+
+	newF, err := NewFsWithConnection(testRemote, "other", f.c, false)
+	require.NoError(t, err)
+	otherF := newF.(*Fs)
+	for _, dstF := range []*Fs{f, otherF} {
+		recorder(f).all()
+		dst, err := dstF.Copy(o, "copy")
+		require.NoError(t, err)
+		assert.Equal(t, 0, recorder(f).count("COPY"), "shouldn't copy the data")
+
+		_, headers, err := f.c.Object(dstF.container, "copy")
+		require.NoError(t, err)
+		assert.Equal(t, "pool/shared/", headers["X-Object-Manifest"])
+		assert.Equal(t, "portal", headers["X-Object-Meta-Origin"])
+		assert.Equal(t, "attachment", headers["Content-Disposition"])
+		assert.Equal(t, "text/plain", headers["Content-Type"])
+		assert.Equal(t, int64(10), dst.Size())
+		assert.True(t, modTime.Equal(dst.ModTime()), dst.ModTime())
+		got, err := readObject(t, dst)
+		require.NoError(t, err)
+		assert.Equal(t, "0123456789", got)
+
+		// Listings show the resolved size
+		entries, err := dstF.List("")
+		require.NoError(t, err)
+		for _, entry := range entries {
+			if entry.Remote() == "copy" {
+				assert.Equal(t, int64(10), entry.Size())
+			}
+		}
+
+		// Removing the copy leaves the segments alone
+		require.NoError(t, dst.Remove())
+		names, err := f.c.ObjectNamesAll("pool", nil)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"shared/00000000", "shared/00000001"}, names)
+	}
+
+	// Objects which aren't large objects are copied as usual
+	require.NoError(t, f.c.ObjectPutString(f.container, "small", "hello", "text/plain"))
+	small, err := f.NewObject("small")
+	require.NoError(t, err)
+	recorder(f).all()
+	_, err = f.Copy(small, "small-copy")
+	require.NoError(t, err)
+	assert.Equal(t, 1, recorder(f).count("COPY"))
+}
+
+func TestInternalAppendSegmentName(t *testing.T) {
+	buf := []byte("junk")
+	for _, i := range []int{0, 1, 9, 10, 42, 12345678, 123456789} {
+		buf = appendSegmentName(buf[:0], "path/1500000000.5/10", i)
+		assert.Equal(t, fmt.Sprintf("%s/%08d", "path/1500000000.5/10", i), string(buf))
+	}
+}
+
+func TestInternalAppendFloatTime(t *testing.T) {
+	for _, modTime := range []time.Time{
+		time.Unix(0, 0),
+		time.Unix(0, 5),
+		time.Unix(1, 0),
+		time.Unix(1500000000, 0),
+		time.Unix(1500000000, 100000000),
+		time.Unix(1500000000, 123456789),
+		time.Unix(1500000000, 120),
+		time.Unix(-1, 0),
+		time.Unix(-1500000000, 500000000),
+	} {
+		assert.Equal(t, swift.TimeToFloatString(modTime), string(appendFloatTime(nil, modTime)), modTime.String())
+	}
+}
+
+func TestInternalNewUploadHeaders(t *testing.T) {
+	f := &Fs{uploadHeaders: swift.Headers{
+		"Content-Disposition": "inline",
+		"Cache-Control":       "no-cache",
+		mtimeHeader:           "1",
+	}}
+	modTime := time.Unix(1500000000, 5)
+	headers := f.newUploadHeaders(map[string]string{"content-disposition": "attachment"}, modTime)
+	assert.Equal(t, swift.Headers{
+		"Content-Disposition": "attachment",
+		"Cache-Control":       "no-cache",
+		mtimeHeader:           swift.TimeToFloatString(modTime),
+	}, headers)
+	putUploadHeaders(headers)
+	assert.Empty(t, headers)
+}
+
+func BenchmarkUploadHeaders(b *testing.B) {
+	f := &Fs{uploadHeaders: swift.Headers{"Content-Disposition": "attachment"}}
+	modTime := time.Unix(1500000000, 123456789)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		putUploadHeaders(f.newUploadHeaders(nil, modTime))
+	}
+}
+
+func BenchmarkAppendSegmentName(b *testing.B) {
+	var buf []byte
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		for j := 0; j < 10; j++ {
+			buf = appendSegmentName(buf[:0], "dir/file.txt/1500000000.123456789/40", j)
+			_ = string(buf)
+		}
+	}
+}
+
+func BenchmarkUrlEncode(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_ = urlEncode("container_segments/path/to/a file.txt/1500000000.123456789/1234567")
+		_ = urlEncode("container_segments/path/to/file.txt/1500000000.123456789/1234567")
+	}
+}
+
+// benchmarkUpdate uploads contents over the same object each time
+// round with segments of segmentSize
+func benchmarkUpdate(b *testing.B, contents string, segmentSize int) {
+	f, _, cleanup := newTestFs(b, "container")
+	defer cleanup()
+	f.pacer.SetMinSleep(0)
+	oldChunkSize := chunkSize
+	chunkSize = fs.SizeSuffix(segmentSize)
+	defer func() { chunkSize = oldChunkSize }()
+	src := fs.NewStaticObjectInfo("dir/file.txt", time.Now(), int64(len(contents)), true, nil, nil)
+	o, err := f.Put(strings.NewReader(contents), src)
+	require.NoError(b, err)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		require.NoError(b, o.Update(strings.NewReader(contents), src))
+	}
+}
+
+func BenchmarkUpdateSmall(b *testing.B) {
+	benchmarkUpdate(b, "hello", 1024)
+}
+
+func BenchmarkUpdateChunks(b *testing.B) {
+	benchmarkUpdate(b, "0123456789012345678901234567890123456789", 4)
+}
+
+func TestInternalContentEncoding(t *testing.T) {
+	f, _, cleanup := newTestFs(t, "container")
+	defer cleanup()
+	require.NoError(t, f.Mkdir(""))
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	_, err := zw.Write([]byte(strings.Repeat("hello world\n", 100)))
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+	contents := gz.String()
+	sum := md5.Sum(gz.Bytes())
+	_, err = f.c.ObjectPut(f.container, "file.txt.gz", strings.NewReader(contents), true, "", "text/plain", swift.Headers{"Content-Encoding": "gzip"})
+	require.NoError(t, err)
+
+	// check o is the compressed object with its encoding
+	check := func(o fs.Object) {
+		assert.Equal(t, int64(len(contents)), o.Size())
+		hash, err := o.Hash(fs.HashMD5)
+		require.NoError(t, err)
+		assert.Equal(t, hex.EncodeToString(sum[:]), hash)
+		assert.Equal(t, "gzip", o.(*Object).ContentEncoding())
+		got, err := readObject(t, o)
+		require.NoError(t, err)
+		assert.Equal(t, contents, got, "should be read without decompressing")
+	}
+
+	o, err := f.NewObject("file.txt.gz")
+	require.NoError(t, err)
+	check(o)
+
+	// Server side copies keep the encoding
+	copied, err := f.Copy(o, "copy.txt.gz")
+	require.NoError(t, err)
+	check(copied)
+
+	// Uploads from swift objects keep the encoding
+	newF, err := NewFsWithConnection(testRemote, "container2", f.c, false)
+	require.NoError(t, err)
+	require.NoError(t, newF.Mkdir(""))
+	in, err := o.Open()
+	require.NoError(t, err)
+	uploaded, err := newF.Put(in, o)
+	require.NoError(t, err)
+	require.NoError(t, in.Close())
+	check(uploaded)
+}
+
+func TestInternalUploadHeaderKey(t *testing.T) {
+	assert.Equal(t, "upload_header", uploadHeaderKey(1))
+	assert.Equal(t, "upload_header_2", uploadHeaderKey(2))
+	assert.Equal(t, "upload_header_10", uploadHeaderKey(10))
+}
+
+func TestInternalParseUploadHeaders(t *testing.T) {
+	for _, test := range []struct {
+		in      []string
+		want    swift.Headers
+		wantErr string
+	}{
+		{nil, swift.Headers{}, ""},
+		{[]string{"content-disposition: attachment"}, swift.Headers{"Content-Disposition": "attachment"}, ""},
+		{[]string{" X-Object-Meta-Origin:portal ", "Content-Disposition: attachment; filename=a.txt"}, swift.Headers{
+			"X-Object-Meta-Origin": "portal",
+			"Content-Disposition":  "attachment; filename=a.txt",
+		}, ""},
+		{[]string{"Cache-Control: no-cache, no-store"}, swift.Headers{"Cache-Control": "no-cache, no-store"}, ""},
+		{[]string{"X-Object-Meta-Empty:"}, swift.Headers{"X-Object-Meta-Empty": ""}, ""},
+		{[]string{"nocolon"}, nil, `upload header "nocolon" must be of the form Key: Value`},
+		{[]string{": value"}, nil, `upload header ": value" must be of the form Key: Value`},
+		{[]string{"content-length: 10"}, nil, `upload header "Content-Length" can't be set`},
+		{[]string{"ETag: abc"}, nil, `upload header "Etag" can't be set`},
+		{[]string{"X-Object-Manifest: c/p"}, nil, `upload header "X-Object-Manifest" can't be set`},
+	} {
+		got, err := parseUploadHeaders(test.in)
+		if test.wantErr != "" {
+			assert.EqualError(t, err, test.wantErr, "%q", test.in)
+			continue
+		}
+		require.NoError(t, err, "%q", test.in)
+		assert.Equal(t, test.want, got, "%q", test.in)
+	}
+}
+
+func TestInternalUploadHeaders(t *testing.T) {
+	defer setTestConfig(t, "upload_header", "Content-Disposition: attachment")()
+	defer setTestConfig(t, "upload_header_2", "X-Object-Meta-Origin: portal")()
+	defer setTestConfig(t, "upload_header_3", "X-Object-Meta-Mtime: 1")()
+	defer setTestConfig(t, "upload_header_4", "X-Object-Meta-Tags: red, green")()
+	f, srv, cleanup := newTestFs(t, "container")
+	defer cleanup()
+	modTime := time.Date(2017, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	// check the object has the upload headers but rclone's mtime
+	check := func(container, name string) {
+		_, headers, err := f.c.Object(container, name)
+		require.NoError(t, err)
+		assert.Equal(t, "attachment", headers["Content-Disposition"], name)
+		assert.Equal(t, "portal", headers["X-Object-Meta-Origin"], name)
+		assert.Equal(t, "red, green", headers["X-Object-Meta-Tags"], name)
+		assert.Equal(t, swift.TimeToFloatString(modTime), headers[mtimeHeader], name)
+	}
+
+	require.NoError(t, f.Mkdir(""))
+	src := fs.NewStaticObjectInfo("small", modTime, 5, true, nil, nil)
+	o, err := f.Put(strings.NewReader("hello"), src)
+	require.NoError(t, err)
+	check(f.container, "small")
+
+	// Large objects have them on the manifest and the segments
+	oldChunkSize := chunkSize
+	chunkSize = 4
+	defer func() { chunkSize = oldChunkSize }()
+	src = fs.NewStaticObjectInfo("large", modTime, 10, true, nil, nil)
+	_, err = f.Put(strings.NewReader("0123456789"), src)
+	require.NoError(t, err)
+	check(f.container, "large")
+	segments, err := f.c.ObjectNamesAll(f.segmentsContainer, nil)
+	require.NoError(t, err)
+	require.Len(t, segments, 3)
+	for _, segment := range segments {
+		check(f.segmentsContainer, segment)
+	}
+
+	// Setting the modification time sends them again as the
+	// update replaces the metadata on real swift servers
+	var posted http.Header
+	srv.SetOverride("/v1/AUTH_"+swifttest.TEST_ACCOUNT+"/container/small", func(w http.ResponseWriter, r *http.Request, recorder *httptest.ResponseRecorder) {
+		if r.Method == "POST" {
+			posted = r.Header
+		}
+		for k, v := range recorder.HeaderMap {
+			w.Header()[k] = v
+		}
+		w.WriteHeader(recorder.Code)
+		_, _ = w.Write(recorder.Body.Bytes())
+	})
+	modTime = modTime.Add(time.Hour)
+	require.NoError(t, o.SetModTime(modTime))
+	require.NotNil(t, posted)
+	assert.Equal(t, "attachment", posted.Get("Content-Disposition"))
+	assert.Equal(t, "portal", posted.Get("X-Object-Meta-Origin"))
+	assert.Equal(t, swift.TimeToFloatString(modTime), posted.Get(mtimeHeader))
+	check(f.container, "small")
+
+	// Bad headers are rejected
+	defer setTestConfig(t, "upload_header_2", "Content-Length: 1")()
+	_, err = NewFsWithConnection(testRemote, "container", f.c, false)
+	assert.EqualError(t, err, `bad upload_header: upload header "Content-Length" can't be set`)
+}
+
+// mimeTypedInfo is an fs.ObjectInfo with a MimeType
+type mimeTypedInfo struct {
+	fs.ObjectInfo
+	mimeType string
+}
+
+// MimeType returns the mime type of the object
+func (o mimeTypedInfo) MimeType() string {
+	return o.mimeType
+}
+
+func TestInternalContentType(t *testing.T) {
+	defer setTestConfig(t, "content_type", "text/plain; charset=utf-8")()
+	f, _, cleanup := newTestFs(t, "container")
+	defer cleanup()
+	require.NoError(t, f.Mkdir(""))
+	contentType := func(name string) string {
+		info, _, err := f.c.Object(f.container, name)
+		require.NoError(t, err)
+		return info.ContentType
+	}
+
+	// Uploads get the configured type whatever their name
+	for _, name := range []string{"blob", "image.png"} {
+		src := fs.NewStaticObjectInfo(name, time.Now(), 5, true, nil, nil)
+		_, err := f.Put(strings.NewReader("hello"), src)
+		require.NoError(t, err)
+		assert.Equal(t, "text/plain; charset=utf-8", contentType(name), name)
+	}
+	src := mimeTypedInfo{fs.NewStaticObjectInfo("typed", time.Now(), 5, true, nil, nil), "image/jpeg"}
+	_, err := f.Put(strings.NewReader("hello"), src)
+	require.NoError(t, err)
+	assert.Equal(t, "text/plain; charset=utf-8", contentType("typed"))
+	putLargeObject(t, f, "large", "0123456789", 4)
+	assert.Equal(t, "text/plain; charset=utf-8", contentType("large"))
+
+	// ...except directory markers
+	src = mimeTypedInfo{fs.NewStaticObjectInfo("dir/", time.Now(), 0, true, nil, nil), directoryMarkerContentType}
+	_, err = f.Put(strings.NewReader(""), src)
+	require.NoError(t, err)
+	assert.Equal(t, directoryMarkerContentType, contentType("dir/"))
+
+	// Server side copies keep the source's type
+	require.NoError(t, f.c.ObjectPutString(f.container, "photo", "hello", "image/png"))
+	o, err := f.NewObject("photo")
+	require.NoError(t, err)
+	copied, err := f.Copy(o, "photo-copy")
+	require.NoError(t, err)
+	assert.Equal(t, "image/png", contentType("photo-copy"))
+	assert.Equal(t, "image/png", copied.(*Object).MimeType())
+
+	// Directory markers can't be made by mistake
+	defer setTestConfig(t, "content_type", directoryMarkerContentType)()
+	_, err = NewFsWithConnection(testRemote, "container", f.c, false)
+	assert.EqualError(t, err, `content_type can't be "application/directory" as that marks directories`)
+}
+
+func TestInternalQuota(t *testing.T) {
+	oldChunkSize := chunkSize
+	chunkSize = 4
+	defer func() { chunkSize = oldChunkSize }()
+	f, _, cleanup := newTestFs(t, "container")
+	defer cleanup()
+	require.NoError(t, f.Mkdir(""))
+	require.NoError(t, f.c.AccountUpdate(swift.Headers{accountQuotaBytesHeader: "20"}))
+	accountPath := "/v1/AUTH_" + swifttest.TEST_ACCOUNT
+	accountReads := func() (n int) {
+		for _, request := range recorder(f).all() {
+			if strings.HasPrefix(request, "HEAD "+accountPath) && !strings.HasPrefix(request, "HEAD "+accountPath+"/") {
+				n++
+			}
+		}
+		return n
+	}
+	accountReads()
+	put := func(f *Fs, remote, contents string) error {
+		src := fs.NewStaticObjectInfo(remote, time.Now(), int64(len(contents)), true, nil, nil)
+		_, err := f.Put(strings.NewReader(contents), src)
+		return err
+	}
+
+	// Chunked uploads within the quota reserve their size
+	require.NoError(t, put(f, "large1", "0123456789"))
+	assert.Equal(t, 1, accountReads())
+
+	// ...so the next one fails before uploading anything
+	err := put(f, "large2", "abcdefghijk")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "quota exceeded: need 11 Bytes, have 10 Bytes free")
+	assert.True(t, fs.IsNoRetryError(err))
+	assert.Equal(t, 0, accountReads(), "account should be cached")
+	_, err = f.NewObject("large2")
+	assert.Equal(t, fs.ErrorObjectNotFound, err)
+	segments, err := f.c.ObjectNamesAll(f.segmentsContainer, nil)
+	require.NoError(t, err)
+	assert.Len(t, segments, 3, "no segments uploaded for large2")
+
+	// Small uploads aren't checked
+	require.NoError(t, put(f, "small", "abcd"))
+	assert.Equal(t, 0, accountReads())
+
+	// ...unless above quota_check_cutoff
+	func() {
+		chunkSize = 100
+		defer func() { chunkSize = 4 }()
+		defer setTestConfig(t, "quota_check_cutoff", "2b")()
+		newF, err := NewFsWithConnection(testRemote, "container", f.c, false)
+		require.NoError(t, err)
+		err = put(newF.(*Fs), "small2", "abcdefg")
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "quota exceeded: need 7 Bytes, have 6 Bytes free")
+	}()
+
+	// The check can be turned off
+	defer setTestConfig(t, "no_quota_check", "true")()
+	newF, err := NewFsWithConnection(testRemote, "container", f.c, false)
+	require.NoError(t, err)
+	recorder(f).all()
+	require.NoError(t, put(newF.(*Fs), "large2", "abcdefghijk"))
+	assert.Equal(t, 0, accountReads())
+}
+
+func TestInternalInfoPerFs(t *testing.T) {
+	f, srv, cleanup := newTestFs(t, "container")
+	defer cleanup()
+	setMaxFileSize := func(size string) {
+		srv.SetOverride("/info", func(w http.ResponseWriter, r *http.Request, recorder *httptest.ResponseRecorder) {
+			_, _ = w.Write([]byte(`{"swift": {"max_file_size": ` + size + `}}`))
+		})
+	}
+	setMaxFileSize("8")
+	assert.Equal(t, int64(8), f.maxFileSize())
+
+	// /info is kept with the Fs not the connection so a new Fs
+	// reads it again and nothing is kept once the Fs has gone
+	setMaxFileSize("16")
+	newF, err := NewFsWithConnection(testRemote, "container", f.c, false)
+	require.NoError(t, err)
+	assert.Equal(t, int64(16), newF.(*Fs).maxFileSize())
+	assert.Equal(t, int64(8), f.maxFileSize())
+}
+
+func TestInternalMaxFileSize(t *testing.T) {
+	oldChunkSize := chunkSize
+	defer func() { chunkSize = oldChunkSize }()
+	f, srv, cleanup := newTestFs(t, "container")
+	defer cleanup()
+	require.NoError(t, f.Mkdir(""))
+	srv.SetOverride("/info", func(w http.ResponseWriter, r *http.Request, recorder *httptest.ResponseRecorder) {
+		_, _ = w.Write([]byte(`{"swift": {"version": "1.2", "max_file_size": 8}}`))
+	})
+	put := func(f *Fs, remote, contents string) error {
+		src := fs.NewStaticObjectInfo(remote, time.Now(), int64(len(contents)), true, nil, nil)
+		_, err := f.Put(strings.NewReader(contents), src)
+		return err
+	}
+	recorder(f).all()
+
+	// Single PUTs above the limit are refused
+	chunkSize = 100
+	err := put(f, "big", "0123456789")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "PUT of 10 Bytes is bigger than the largest the server accepts (8 Bytes) - set --swift-chunk-size smaller")
+	assert.True(t, fs.IsNoRetryError(err))
+	require.NoError(t, put(f, "small", "01234567"))
+
+	// ...as are segments above the limit
+	chunkSize = 9
+	err = put(f, "big", "0123456789")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "PUT of 9 Bytes is bigger than the largest the server accepts (8 Bytes)")
+
+	chunkSize = 4
+	require.NoError(t, put(f, "big", "0123456789"))
+	infoReads := 0
+	for _, request := range recorder(f).all() {
+		if request == "GET /info" {
+			infoReads++
+		}
+	}
+	assert.Equal(t, 1, infoReads, "/info should be read once")
+
+	// With no_chunk everything is uploaded as a single object
+	defer setTestConfig(t, "no_chunk", "true")()
+	newF, err := NewFsWithConnection(testRemote, "container", f.c, false)
+	require.NoError(t, err)
+	err = put(newF.(*Fs), "big2", "0123456789")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "don't set no_chunk")
+	require.NoError(t, put(newF.(*Fs), "medium", "012345"))
+	o, err := newF.NewObject("medium")
+	require.NoError(t, err)
+	isDynamicLargeObject, err := o.(*Object).isDynamicLargeObject()
+	require.NoError(t, err)
+	assert.False(t, isDynamicLargeObject)
+}
+
+// fakeCDN is a Rackspace CDN management endpoint
+type fakeCDN struct {
+	mu      sync.Mutex
+	enabled map[string]string // container to X-Cdn-Enabled
+	ttl     map[string]string // container to X-Ttl
+}
+
+// ServeHTTP handles the requests to the CDN management endpoint
+func (cdn *fakeCDN) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	cdn.mu.Lock()
+	defer cdn.mu.Unlock()
+	if r.Header.Get("X-Auth-Token") == "" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	container := strings.TrimPrefix(r.URL.Path, "/")
+	switch r.Method {
+	case "PUT":
+		cdn.enabled[container] = r.Header.Get(cdnEnabledHeader)
+		cdn.ttl[container] = r.Header.Get(cdnTTLHeader)
+		w.WriteHeader(http.StatusAccepted)
+	case "HEAD":
+		enabled, ok := cdn.enabled[container]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set(cdnEnabledHeader, enabled)
+		w.Header().Set(cdnURIHeader, "http://cdn.example.com/"+container)
+		w.Header().Set(cdnSSLURIHeader, "https://ssl.cdn.example.com/"+container+"/")
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func TestInternalPublicLink(t *testing.T) {
+	cdn := &fakeCDN{enabled: map[string]string{}, ttl: map[string]string{}}
+	cdnServer := httptest.NewServer(cdn)
+	defer cdnServer.Close()
+	defer setTestConfig(t, "cdn_url", cdnServer.URL)()
+	f, _, cleanup := newTestFs(t, "container")
+	defer cleanup()
+	require.NoError(t, f.Mkdir(""))
+	require.NoError(t, f.c.ObjectPutString(f.container, "dir/file name.txt", "hello", "text/plain"))
+
+	_, err := f.PublicLink("missing")
+	assert.Equal(t, fs.ErrorObjectNotFound, err)
+
+	// Without CDN or a temp URL key there is no link
+	_, err = f.PublicLink("dir/file name.txt")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `container "container" isn't CDN enabled and there is no temp URL key`)
+
+	// CDN enabled containers give CDN links
+	require.NoError(t, f.SetCDN(true, 24*time.Hour))
+	assert.Equal(t, "true", cdn.enabled["container"])
+	assert.Equal(t, "86400", cdn.ttl["container"])
+	link, err := f.PublicLink("dir/file name.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "https://ssl.cdn.example.com/container/dir/file%20name.txt", link)
+
+	// ...until disabled when temp URLs are used
+	require.NoError(t, f.SetCDN(false, 0))
+	assert.Equal(t, "false", cdn.enabled["container"])
+	require.NoError(t, f.c.AccountUpdate(swift.Headers{accountTempURLKeyHeader: "secret"}))
+	newF, err := NewFsWithConnection(testRemote, "container", f.c, false)
+	require.NoError(t, err)
+	link, err = newF.(*Fs).PublicLink("dir/file name.txt")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(link, f.c.StorageUrl+"/container/dir/file%20name.txt?temp_url_sig="), link)
+	resp, err := http.Get(link)
+	require.NoError(t, err)
+	body, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "hello", string(body))
+
+	// The temp URL expiry can be set
+	defer setTestConfig(t, "temp_url_expiry", "2d")()
+	newF, err = NewFsWithConnection(testRemote, "container", f.c, false)
+	require.NoError(t, err)
+	link, err = newF.(*Fs).PublicLink("dir/file name.txt")
+	require.NoError(t, err)
+	u, err := url.Parse(link)
+	require.NoError(t, err)
+	expires, err := strconv.ParseInt(u.Query().Get("temp_url_expires"), 10, 64)
+	require.NoError(t, err)
+	assert.InDelta(t, time.Now().Add(48*time.Hour).Unix(), expires, 10)
+
+	// ...or given for the link
+	link, err = newF.(*Fs).PublicLinkExpire("dir/file name.txt", 3*time.Hour)
+	require.NoError(t, err)
+	u, err = url.Parse(link)
+	require.NoError(t, err)
+	expires, err = strconv.ParseInt(u.Query().Get("temp_url_expires"), 10, 64)
+	require.NoError(t, err)
+	assert.InDelta(t, time.Now().Add(3*time.Hour).Unix(), expires, 10)
+
+	// Links can't be made to directories
+	_, err = newF.(*Fs).PublicLink("dir")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "links can only be made to objects")
+}
+
+func TestInternalDownloadTempURL(t *testing.T) {
+	defer setTestConfig(t, "download_temp_url", "true")()
+	defer setTestConfig(t, "download_concurrency", "2")()
+	defer setTestConfig(t, "download_cutoff", "5b")()
+	oldChunkSize := chunkSize
+	defer func() { chunkSize = oldChunkSize }()
+	fs.LoadConfig()
+	// The servers may reuse the ports of earlier ones so forget
+	// which containers they had
+	containers = newContainerCache()
+	srv, err := swifttest.NewSwiftServer("localhost")
+	require.NoError(t, err)
+	defer srv.Close()
+	c := &swift.Connection{
+		UserName:  swifttest.TEST_ACCOUNT,
+		ApiKey:    swifttest.TEST_ACCOUNT,
+		AuthUrl:   srv.AuthURL,
+		Transport: &recordingTransport{},
+	}
+	require.NoError(t, c.Authenticate())
+
+	// Refuses to start without a temp URL key
+	_, err = NewFsWithConnection(testRemote, "container", c, false)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "download_temp_url needs a temp URL key")
+
+	require.NoError(t, c.AccountUpdate(swift.Headers{accountTempURLKeyHeader: "secret"}))
+	newF, err := NewFsWithConnection(testRemote, "container", c, false)
+	require.NoError(t, err)
+	f := newF.(*Fs)
+	require.NoError(t, f.Mkdir(""))
+	require.NoError(t, f.c.ObjectPutString(f.container, "file name.txt", "hello world", "text/plain"))
+	o, err := f.NewObject("file name.txt")
+	require.NoError(t, err)
+
+	// checkTempURLs checks the object GETs used temp URLs
+	checkTempURLs := func() {
+		gets := 0
+		for _, request := range recorder(f).all() {
+			if strings.HasPrefix(request, "GET /v1/") && !strings.Contains(request, "format=json") {
+				gets++
+				assert.Contains(t, request, "temp_url_sig=", request)
+			}
+		}
+		assert.True(t, gets > 0, "no GETs")
+	}
+
+	recorder(f).all()
+	got, err := readObject(t, o)
+	require.NoError(t, err)
+	assert.Equal(t, "hello world", got)
+	checkTempURLs()
+
+	// Ranges are passed through
+	in, err := o.Open(&fs.SeekOption{Offset: 6})
+	require.NoError(t, err)
+	data, err := ioutil.ReadAll(in)
+	require.NoError(t, err)
+	require.NoError(t, in.Close())
+	assert.Equal(t, "world", string(data))
+	checkTempURLs()
+
+	// The MD5SUM is checked
+	objectPath := "/v1/AUTH_" + swifttest.TEST_ACCOUNT + "/container/file name.txt"
+	srv.SetOverride(objectPath, func(w http.ResponseWriter, r *http.Request, recorder *httptest.ResponseRecorder) {
+		for k, v := range recorder.HeaderMap {
+			w.Header()[k] = v
+		}
+		w.WriteHeader(recorder.Code)
+		_, _ = w.Write(bytes.ToUpper(recorder.Body.Bytes()))
+	})
+	_, err = readObject(t, o)
+	require.Error(t, err)
+	assert.True(t, fs.IsRetryError(err))
+	assert.Contains(t, err.Error(), "md5 hashes differ")
+	srv.UnsetOverride(objectPath)
+
+	// Segments of large objects are downloaded with temp URLs too
+	large := putLargeObject(t, f, "large", "0123456789", 4)
+	recorder(f).all()
+	got, err = readObject(t, large)
+	require.NoError(t, err)
+	assert.Equal(t, "0123456789", got)
+	checkTempURLs()
+}
+
+// catalogueAuth is a swift.Authenticator which doesn't need a request
+// and has a keystone v2 catalogue of object stores in regions
+type catalogueAuth struct {
+	Auth struct {
+		Access struct {
+			ServiceCatalog []catalogueService
+		}
+	}
+	token string
+}
+
+type catalogueService struct {
+	Type      string
+	Endpoints []catalogueEndpoint
+}
+
+type catalogueEndpoint struct {
+	PublicUrl string
+	Region    string
+}
+
+// newCatalogueAuth makes a catalogueAuth with token listing the
+// storage URLs of regions in pairs of region, URL
+func newCatalogueAuth(token string, regions ...string) *catalogueAuth {
+	a := &catalogueAuth{token: token}
+	service := catalogueService{Type: "object-store"}
+	for i := 0; i < len(regions); i += 2 {
+		service.Endpoints = append(service.Endpoints, catalogueEndpoint{Region: regions[i], PublicUrl: regions[i+1]})
+	}
+	a.Auth.Access.ServiceCatalog = []catalogueService{{Type: "compute"}, service}
+	return a
+}
+
+func (a *catalogueAuth) Request(*swift.Connection) (*http.Request, error) { return nil, nil }
+func (a *catalogueAuth) Response(resp *http.Response) error               { return nil }
+func (a *catalogueAuth) Token() string                                    { return a.token }
+func (a *catalogueAuth) CdnUrl() string                                   { return "" }
+func (a *catalogueAuth) StorageUrl(Internal bool) string {
+	return a.Auth.Access.ServiceCatalog[1].Endpoints[0].PublicUrl
+}
+
+func TestInternalCatalogueURL(t *testing.T) {
+	a := newCatalogueAuth("token", "one", "https://one/v1", "two", "https://two/v1")
+	assert.Equal(t, "https://one/v1", catalogueURL(a, "", ""))
+	assert.Equal(t, "https://one/v1", catalogueURL(a, "one", swift.EndpointTypePublic))
+	assert.Equal(t, "https://two/v1", catalogueURL(a, "two", ""))
+	assert.Equal(t, "", catalogueURL(a, "three", ""))
+	assert.Equal(t, "", catalogueURL(a, "two", swift.EndpointTypeInternal))
+	assert.Equal(t, "", catalogueURL(newAuth(a, ""), "two", ""), "reads the authenticator not the wrapper")
+}
+
+// newRegionTestFs makes an Fs on srv authenticating with a catalogue
+// of regions in pairs of region, URL with fallback_regions set
+func newRegionTestFs(t *testing.T, srv *swifttest.SwiftServer, fallbackRegions string, regions ...string) *Fs {
+	v1 := &swift.Connection{
+		UserName: swifttest.TEST_ACCOUNT,
+		ApiKey:   swifttest.TEST_ACCOUNT,
+		AuthUrl:  srv.AuthURL,
+	}
+	require.NoError(t, v1.Authenticate())
+	c := &swift.Connection{
+		Auth:      newCatalogueAuth(v1.AuthToken, regions...),
+		Region:    regions[0],
+		Transport: &recordingTransport{},
+	}
+	defer setTestConfig(t, "fallback_regions", fallbackRegions)()
+	f, err := NewFsWithConnection(testRemote, "container", c, false)
+	require.NoError(t, err)
+	return f.(*Fs)
+}
+
+func TestInternalRegionFailover(t *testing.T) {
+	f, srv, cleanup := newTestFs(t, "container")
+	defer cleanup()
+	require.NoError(t, f.Mkdir(""))
+	require.NoError(t, f.c.ObjectPutString(f.container, "file.txt", "hello", "text/plain"))
+	storageURL := f.c.StorageUrl
+
+	// A storage endpoint which refuses connections
+	dead := httptest.NewServer(http.NotFoundHandler())
+	dead.Close()
+
+	f = newRegionTestFs(t, srv, "nowhere, alive", "dead", dead.URL+"/v1/AUTH_"+swifttest.TEST_ACCOUNT, "alive", storageURL)
+	assert.Equal(t, []string{"dead", "nowhere", "alive"}, f.failover.regions)
+	o, err := f.NewObject("file.txt")
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), o.Size())
+	assert.Equal(t, storageURL, f.c.StorageUrl)
+	assert.Equal(t, 2, f.failover.current)
+	assert.Equal(t, 1, f.regionGeneration())
+
+	// Errors from a working endpoint don't fail over
+	for i := 0; i < failoverAfter; i++ {
+		_, err = f.NewObject("missing.txt")
+		assert.Equal(t, fs.ErrorObjectNotFound, err)
+	}
+	assert.Equal(t, 1, f.regionGeneration())
+
+	// storage_url can't be used with fallback_regions
+	defer setTestConfig(t, "storage_url", storageURL)()
+	defer setTestConfig(t, "fallback_regions", "alive")()
+	_, err = NewFsWithConnection(testRemote, "container", &swift.Connection{}, false)
+	assert.EqualError(t, err, "can't use fallback_regions with storage_url")
+}
+
+// failoverReader calls fail on the first Read
+type failoverReader struct {
+	io.Reader
+	fail func()
+}
+
+func (r *failoverReader) Read(p []byte) (int, error) {
+	if r.fail != nil {
+		r.fail()
+		r.fail = nil
+	}
+	return r.Reader.Read(p)
+}
+
+func TestInternalRegionFailoverDuringChunkedUpload(t *testing.T) {
+	f, srv, cleanup := newTestFs(t, "container")
+	defer cleanup()
+	require.NoError(t, f.Mkdir(""))
+	storageURL := f.c.StorageUrl
+
+	f = newRegionTestFs(t, srv, "two", "one", storageURL, "two", storageURL)
+	oldChunkSize := chunkSize
+	chunkSize = 4
+	defer func() { chunkSize = oldChunkSize }()
+	in := &failoverReader{
+		Reader: strings.NewReader("0123456789"),
+		fail: func() {
+			f.failover.mu.Lock()
+			f.failover.next(f)
+			f.failover.mu.Unlock()
+		},
+	}
+	src := fs.NewStaticObjectInfo("large", time.Now(), 10, true, nil, nil)
+	_, err := f.Put(in, src)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "storage region changed during upload")
+	_, err = f.NewObject("large")
+	assert.Equal(t, fs.ErrorObjectNotFound, err)
+}
+
+func TestInternalPrefixStats(t *testing.T) {
+	f, _, cleanup := newTestFs(t, "container")
+	defer cleanup()
+	require.NoError(t, f.Mkdir(""))
+	for name, contents := range map[string]string{
+		"top.txt":         "0123456789",
+		"path/file.txt":   "hello",
+		"path/a/one.txt":  "1",
+		"path/a/b/two":    "22",
+		"path/c/three":    "333",
+		"path/c/four.txt": "4444",
+	} {
+		require.NoError(t, f.c.ObjectPutString(f.container, name, contents, "text/plain"))
+	}
+
+	stats, err := f.PrefixStats(true)
+	require.NoError(t, err)
+	assert.Equal(t, []PrefixStat{{Name: "container", Bytes: 25, Count: 6}}, stats)
+
+	stats, err = f.PrefixStats(false)
+	require.NoError(t, err)
+	assert.Equal(t, []PrefixStat{
+		{Name: "container", Bytes: 25, Count: 6},
+		{Name: "container/path", Bytes: 15, Count: 5},
+	}, stats)
+
+	// The listing is paged with list_chunk
+	defer setTestConfig(t, "list_chunk", "2")()
+	newF, err := NewFsWithConnection(testRemote, "container/path", f.c, false)
+	require.NoError(t, err)
+	f = newF.(*Fs)
+	recorder(f).all()
+	stats, err = f.PrefixStats(false)
+	require.NoError(t, err)
+	assert.Equal(t, []PrefixStat{
+		{Name: "container", Bytes: 25, Count: 6},
+		{Name: "container/path", Bytes: 15, Count: 5},
+		{Name: "container/path/a", Bytes: 3, Count: 2},
+		{Name: "container/path/c", Bytes: 7, Count: 2},
+	}, stats)
+	for _, request := range recorder(f).all() {
+		if strings.HasPrefix(request, "GET ") {
+			assert.Contains(t, request, "limit=2")
+		}
+	}
+
+	// A missing container is an error
+	newF, err = NewFsWithConnection(testRemote, "missing", f.c, false)
+	require.NoError(t, err)
+	_, err = newF.(*Fs).PrefixStats(false)
+	assert.Error(t, err)
+}
+
+// inFlightTransport records the most DELETE requests in flight at
+// once, slowing them down so they overlap
+type inFlightTransport struct {
+	recordingTransport
+	mu       sync.Mutex
+	inFlight int
+	max      int
+}
+
+func (r *inFlightTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != "DELETE" {
+		return r.recordingTransport.RoundTrip(req)
+	}
+	r.mu.Lock()
+	r.inFlight++
+	if r.inFlight > r.max {
+		r.max = r.inFlight
+	}
+	r.mu.Unlock()
+	time.Sleep(10 * time.Millisecond)
+	resp, err := r.recordingTransport.RoundTrip(req)
+	r.mu.Lock()
+	r.inFlight--
+	r.mu.Unlock()
+	return resp, err
+}
+
+func TestInternalRemoveSegmentsConcurrently(t *testing.T) {
+	_, srv, cleanup := newTestFs(t, "container")
+	defer cleanup()
+	transport := &inFlightTransport{}
+	c := &swift.Connection{
+		UserName:  swifttest.TEST_ACCOUNT,
+		ApiKey:    swifttest.TEST_ACCOUNT,
+		AuthUrl:   srv.AuthURL,
+		Transport: transport,
+	}
+	newF, err := NewFsWithConnection(testRemote, "container", c, false)
+	require.NoError(t, err)
+	f := newF.(*Fs)
+	oldTransfers := fs.Config.Transfers
+	fs.Config.Transfers = 4
+	defer func() { fs.Config.Transfers = oldTransfers }()
+
+	o := putLargeObject(t, f, "large", "0123456789abcdef", 2)
+	names, err := f.c.ObjectNamesAll(f.segmentsContainer, nil)
+	require.NoError(t, err)
+	require.Len(t, names, 8)
+	require.NoError(t, o.Remove())
+	assert.True(t, transport.max > 1, "max deletes in flight %d", transport.max)
+	assert.True(t, transport.max <= 4, "max deletes in flight %d", transport.max)
+	// The segments container is removed once they are all gone
+	_, _, err = f.c.Container(f.segmentsContainer)
+	assert.Equal(t, swift.ContainerNotFound, err)
+
+	// Failed deletes are reported and the segments container kept
+	o = putLargeObject(t, f, "large", "0123456789abcdef", 2)
+	names, err = f.c.ObjectNamesAll(f.segmentsContainer, nil)
+	require.NoError(t, err)
+	require.Len(t, names, 8)
+	srv.SetOverride(accountPath+"/"+f.segmentsContainer+"/"+names[3], func(w http.ResponseWriter, r *http.Request, recorder *httptest.ResponseRecorder) {
+		w.WriteHeader(http.StatusForbidden)
+	})
+	err = o.Remove()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to delete segment")
+	assert.Contains(t, err.Error(), names[3])
+	_, _, err = f.c.Container(f.segmentsContainer)
+	assert.NoError(t, err)
+}
+
+func TestInternalNoLargeObjectsStrict(t *testing.T) {
+	defer setTestConfig(t, "no_large_objects", "true")()
+	f, _, cleanup := newTestFs(t, "container")
+	defer cleanup()
+	oldChunkSize := chunkSize
+	chunkSize = 4
+	defer func() { chunkSize = oldChunkSize }()
+
+	// Uploads which would be large objects are refused
+	src := fs.NewStaticObjectInfo("large", time.Now(), 10, true, nil, nil)
+	_, err := f.Put(strings.NewReader("0123456789"), src)
+	require.Error(t, err)
+	assert.True(t, fs.IsFatalError(err))
+	assert.Contains(t, err.Error(), "10 Bytes is bigger than --swift-chunk-size 4 Bytes")
+	assert.Contains(t, err.Error(), "no_large_objects")
+	src = fs.NewStaticObjectInfo("unknown", time.Now(), -1, true, nil, nil)
+	_, err = f.Put(strings.NewReader("0123456789"), src)
+	require.Error(t, err)
+	assert.True(t, fs.IsFatalError(err))
+	assert.Contains(t, err.Error(), "its size is unknown")
+	_, _, err = f.c.Container(f.segmentsContainer)
+	assert.Equal(t, swift.ContainerNotFound, err)
+
+	// Small ones aren't
+	src = fs.NewStaticObjectInfo("small", time.Now(), 3, true, nil, nil)
+	_, err = f.Put(strings.NewReader("abc"), src)
+	require.NoError(t, err)
+
+	// The hashes in the listing are trusted
+	recorder(f).count("")
+	entries, err := f.List("")
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	hash, err := entries[0].(fs.Object).Hash(fs.HashMD5)
+	require.NoError(t, err)
+	assert.Equal(t, "900150983cd24fb0d6963f7d28e17f72", hash)
+	assert.Equal(t, 0, recorder(f).count("HEAD"))
+
+	// no_chunk uploads them in one PUT instead
+	defer setTestConfig(t, "no_chunk", "true")()
+	newF, err := NewFsWithConnection(testRemote, "container", f.c, false)
+	require.NoError(t, err)
+	src = fs.NewStaticObjectInfo("large", time.Now(), 10, true, nil, nil)
+	_, err = newF.Put(strings.NewReader("0123456789"), src)
+	require.NoError(t, err)
+}
+
+// failingReader reads from the Reader then returns an error
+type failingReader struct {
+	io.Reader
+}
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	if err == io.EOF {
+		return n, errors.New("read failed")
+	}
+	return n, err
+}
+
+func TestInternalFailedChunkedUploadCleanup(t *testing.T) {
+	f, _, cleanup := newTestFs(t, "container")
+	defer cleanup()
+	oldChunkSize := chunkSize
+	chunkSize = 4
+	defer func() { chunkSize = oldChunkSize }()
+	failedUpload := func(f *Fs, remote string) {
+		src := fs.NewStaticObjectInfo(remote, time.Now(), 10, true, nil, nil)
+		_, err := f.Put(&failingReader{strings.NewReader("abcdef")}, src)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "read failed")
+	}
+
+	// A new object leaves nothing behind
+	failedUpload(f, "new")
+	_, _, err := f.c.Container(f.segmentsContainer)
+	assert.Equal(t, swift.ContainerNotFound, err)
+
+	// The segments of the previous version are kept
+	o := putLargeObject(t, f, "large", "0123456789", 4)
+	names, err := f.c.ObjectNamesAll(f.segmentsContainer, nil)
+	require.NoError(t, err)
+	require.Len(t, names, 3)
+	failedUpload(f, "large")
+	newNames, err := f.c.ObjectNamesAll(f.segmentsContainer, nil)
+	require.NoError(t, err)
+	assert.Equal(t, names, newNames)
+	got, err := readObject(t, o)
+	require.NoError(t, err)
+	assert.Equal(t, "0123456789", got)
+
+	// leave_parts_on_error leaves the uploaded segments
+	defer setTestConfig(t, "leave_parts_on_error", "true")()
+	newF, err := NewFsWithConnection(testRemote, "container", f.c, false)
+	require.NoError(t, err)
+	failedUpload(newF.(*Fs), "large")
+	newNames, err = f.c.ObjectNamesAll(f.segmentsContainer, nil)
+	require.NoError(t, err)
+	assert.Len(t, newNames, 3+1)
+}
+
+func TestInternalSegmentRetention(t *testing.T) {
+	defer setTestConfig(t, "segment_retention", "1h")()
+	f, _, cleanup := newTestFs(t, "container")
+	defer cleanup()
+	o := putLargeObject(t, f, "dir/large", "0123456789", 4)
+	oldNames, err := f.c.ObjectNamesAll(f.segmentsContainer, nil)
+	require.NoError(t, err)
+	require.Len(t, oldNames, 3)
+
+	// Overwriting it keeps the old segments and records them
+	oldChunkSize := chunkSize
+	chunkSize = 4
+	src := fs.NewStaticObjectInfo("dir/large", time.Now(), 6, true, nil, nil)
+	require.NoError(t, o.Update(strings.NewReader("abcdef"), src))
+	chunkSize = oldChunkSize
+	names, err := f.c.ObjectNamesAll(f.segmentsContainer, nil)
+	require.NoError(t, err)
+	require.Len(t, names, 3+2+1)
+	for _, name := range oldNames {
+		assert.Contains(t, names, name)
+	}
+	oldPrefix := path.Dir(oldNames[0])
+	assert.Contains(t, names, retiredSegmentsPrefix+oldPrefix)
+	got, err := readObject(t, o)
+	require.NoError(t, err)
+	assert.Equal(t, "abcdef", got)
+
+	// Cleanup leaves them until the retention has passed
+	require.NoError(t, f.CleanUp())
+	names, err = f.c.ObjectNamesAll(f.segmentsContainer, nil)
+	require.NoError(t, err)
+	require.Len(t, names, 6)
+
+	defer setTestConfig(t, "segment_retention", "1ms")()
+	newF, err := NewFsWithConnection(testRemote, "container", f.c, false)
+	require.NoError(t, err)
+	time.Sleep(10 * time.Millisecond)
+	require.NoError(t, newF.(*Fs).CleanUp())
+	names, err = f.c.ObjectNamesAll(f.segmentsContainer, nil)
+	require.NoError(t, err)
+	require.Len(t, names, 2)
+	for _, name := range names {
+		assert.NotContains(t, oldNames, name)
+	}
+	got, err = readObject(t, o)
+	require.NoError(t, err)
+	assert.Equal(t, "abcdef", got)
+
+	// A bad retention is an error
+	defer setTestConfig(t, "segment_retention", "potato")()
+	_, err = NewFsWithConnection(testRemote, "container", f.c, false)
+	assert.Error(t, err)
+}
+
+func TestInternalMetadata(t *testing.T) {
+	f, srv, cleanup := newTestFs(t, "container")
+	defer cleanup()
+	require.NoError(t, f.Mkdir(""))
+	deleteAt := time.Now().Add(time.Hour).Truncate(time.Second)
+	_, err := f.c.ObjectPut(f.container, "file.txt", strings.NewReader("hello"), true, "", "text/x-special", swift.Headers{
+		"Content-Disposition": "attachment; filename=hello.txt",
+		"Content-Encoding":    "identity",
+		"X-Object-Meta-Color": "blue",
+		mtimeHeader:           swift.TimeToFloatString(time.Now()),
+	})
+	require.NoError(t, err)
+	// swifttest doesn't store X-Delete-At so add it to the source
+	// and record it on the upload
+	var uploadedDeleteAt string
+	passThrough := func(w http.ResponseWriter, r *http.Request, recorder *httptest.ResponseRecorder) {
+		for k, v := range recorder.HeaderMap {
+			w.Header()[k] = v
+		}
+		if r.Method == "HEAD" || r.Method == "GET" {
+			w.Header().Set("X-Delete-At", strconv.FormatInt(deleteAt.Unix(), 10))
+		}
+		if r.Method == "PUT" {
+			uploadedDeleteAt = r.Header.Get("X-Delete-At")
+		}
+		w.WriteHeader(recorder.Code)
+		_, _ = w.Write(recorder.Body.Bytes())
+	}
+	srv.SetOverride(accountPath+"/container/file.txt", passThrough)
+	srv.SetOverride(accountPath+"/container2/file.txt", passThrough)
+	o, err := f.NewObject("file.txt")
+	require.NoError(t, err)
+	metadata, err := o.(*Object).Metadata()
+	require.NoError(t, err)
+	want := map[string]string{
+		"content-type":        "text/x-special",
+		"content-disposition": "attachment; filename=hello.txt",
+		"content-encoding":    "identity",
+		"delete-at":           deleteAt.UTC().Format(time.RFC3339),
+		"meta-color":          "blue",
+	}
+	for k, v := range want {
+		assert.Equal(t, v, metadata[k], k)
+	}
+	assert.NotContains(t, metadata, "meta-mtime")
+
+	// Uploads from swift objects keep the metadata
+	newF, err := NewFsWithConnection(testRemote, "container2", f.c, false)
+	require.NoError(t, err)
+	require.NoError(t, newF.Mkdir(""))
+	in, err := o.Open()
+	require.NoError(t, err)
+	uploaded, err := newF.Put(in, o)
+	require.NoError(t, err)
+	require.NoError(t, in.Close())
+	assert.Equal(t, strconv.FormatInt(deleteAt.Unix(), 10), uploadedDeleteAt)
+	metadata, err = uploaded.(*Object).Metadata()
+	require.NoError(t, err)
+	for k, v := range want {
+		assert.Equal(t, v, metadata[k], k)
+	}
+	assert.True(t, o.ModTime().Equal(uploaded.ModTime()))
+
+	// Keys rclone sets itself and expiry times in the past are ignored
+	headers := f.metadataHeaders(map[string]string{
+		"Meta-Mtime":   "1",
+		"meta-":        "empty",
+		"delete-at":    "2001-02-03T04:05:06Z",
+		"content-type": "text/plain",
+		"meta-size":    "large",
+		"other":        "value",
+	})
+	assert.Equal(t, swift.Headers{"X-Object-Meta-Size": "large"}, headers)
+}
+
+func TestInternalCopyMetadata(t *testing.T) {
+	f, _, cleanup := newTestFs(t, "container")
+	defer cleanup()
+	require.NoError(t, f.Mkdir(""))
+	modTime := time.Unix(1500000000, 0)
+	_, err := f.c.ObjectPut(f.container, "file.txt", strings.NewReader("hello"), true, "", "text/x-special", swift.Headers{
+		"Content-Disposition": "attachment; filename=hello.txt",
+		"X-Object-Meta-Color": "blue",
+		mtimeHeader:           swift.TimeToFloatString(modTime),
+	})
+	require.NoError(t, err)
+	o, err := f.NewObject("file.txt")
+	require.NoError(t, err)
+	assert.True(t, f.Features().ReadMetadata)
+	assert.True(t, f.Features().WriteMetadata)
+
+	newF, err := NewFsWithConnection(testRemote, "container2", f.c, false)
+	require.NoError(t, err)
+	require.NoError(t, newF.Mkdir(""))
+	// Upload rather than copying on the server which always
+	// keeps the metadata
+	newF.Features().Copy = nil
+	oldMetadata := fs.Config.Metadata
+	defer func() { fs.Config.Metadata = oldMetadata }()
+
+	// copy copies o to newF returning the metadata of the copy
+	copy := func() map[string]string {
+		require.NoError(t, fs.Copy(newF, nil, "file.txt", o))
+		copied, err := newF.NewObject("file.txt")
+		require.NoError(t, err)
+		assert.True(t, modTime.Equal(copied.ModTime()))
+		metadata, err := copied.(*Object).Metadata()
+		require.NoError(t, err)
+		return metadata
+	}
+
+	// The metadata is only copied with --metadata
+	fs.Config.Metadata = false
+	metadata := copy()
+	assert.NotContains(t, metadata, "meta-color")
+	assert.NotContains(t, metadata, "content-disposition")
+	fs.Config.Metadata = true
+	metadata = copy()
+	assert.Equal(t, "blue", metadata["meta-color"])
+	assert.Equal(t, "attachment; filename=hello.txt", metadata["content-disposition"])
+	assert.Equal(t, "text/x-special", metadata["content-type"])
+
+	// SetMetadata sets the metadata but keeps the mtime
+	copied, err := newF.NewObject("file.txt")
+	require.NoError(t, err)
+	require.NoError(t, copied.(*Object).SetMetadata(map[string]string{
+		"content-type": "text/plain",
+		"meta-size":    "large",
+		"meta-mtime":   "1",
+	}))
+	metadata, err = copied.(*Object).Metadata()
+	require.NoError(t, err)
+	assert.Equal(t, "large", metadata["meta-size"])
+	assert.Equal(t, "text/plain", metadata["content-type"])
+	assert.True(t, modTime.Equal(copied.ModTime()))
+}
+
+func TestInternalDirectoryMarkerConventions(t *testing.T) {
+	f, _, cleanup := newTestFs(t, "container")
+	defer cleanup()
+	require.NoError(t, f.Mkdir(""))
+	for _, object := range []struct {
+		name, contents, contentType string
+	}{
+		{"a/", "", "application/octet-stream"},
+		{"b", "", "httpd/unix-directory"},
+		{"c/.keep", "", "application/octet-stream"},
+		{"c/file", "hello", "text/plain"},
+		{"d/.keep", "data", "text/plain"},
+	} {
+		require.NoError(t, f.c.ObjectPutString(f.container, object.name, object.contents, object.contentType))
+	}
+	// listRecursive lists f with ListR
+	listRecursive := func(f *Fs) (remotes []string) {
+		err := f.ListR("", func(entries fs.DirEntries) error {
+			for _, entry := range entries {
+				if _, isDir := entry.(fs.Directory); isDir {
+					remotes = append(remotes, entry.Remote()+"/")
+				} else {
+					remotes = append(remotes, entry.Remote())
+				}
+			}
+			return nil
+		})
+		require.NoError(t, err)
+		sort.Strings(remotes)
+		return remotes
+	}
+
+	// listSorted lists f with List into sorted order
+	listSorted := func(f *Fs) []string {
+		remotes := listAll(t, f, "")
+		sort.Strings(remotes)
+		return remotes
+	}
+
+	// Empty objects ending in / aren't markers by default
+	assert.Equal(t, []string{"a/", "a/", "b", "c/", "c/.keep", "c/file", "d/", "d/.keep"}, listSorted(f))
+	assert.Equal(t, []string{"a/", "a/", "b", "c/", "c/.keep", "c/file", "d/", "d/.keep"}, listRecursive(f))
+
+	defer setTestConfig(t, "empty_directory_markers", "true")()
+	defer setTestConfig(t, "directory_marker_content_types", "text/x-directory, HTTPD/Unix-Directory")()
+	defer setTestConfig(t, "directory_marker_names", ".keep")()
+	newF, err := NewFsWithConnection(testRemote, "container", f.c, false)
+	require.NoError(t, err)
+	f = newF.(*Fs)
+	assert.Equal(t, []string{"a/", "c/", "c/file", "d/", "d/.keep"}, listSorted(f))
+	assert.Equal(t, []string{"a/", "c/", "c/file", "d/", "d/.keep"}, listRecursive(f))
+	_, err = NewFsWithConnection(testRemote, "container/c/.keep", f.c, false)
+	assert.NoError(t, err, "placeholders aren't files")
+	_, err = NewFsWithConnection(testRemote, "container/d/.keep", f.c, false)
+	assert.Equal(t, fs.ErrorIsFile, err)
+
+	// Uploads can't use them
+	defer setTestConfig(t, "content_type", "text/x-directory")()
+	_, err = NewFsWithConnection(testRemote, "container", f.c, false)
+	assert.EqualError(t, err, `content_type can't be "text/x-directory" as that marks directories`)
+}
+
+func TestInternalDirSetModTime(t *testing.T) {
+	f, _, cleanup := newTestFs(t, "container")
+	defer cleanup()
+	require.NoError(t, f.Mkdir(""))
+	require.NoError(t, f.c.ObjectPutString(f.container, "dir/file", "hello", "text/plain"))
+	modTime := time.Unix(1500000000, 0)
+
+	// dirModTime reads the modification time of dir from a listing
+	dirModTime := func(dir string) time.Time {
+		entries, err := f.List("")
+		require.NoError(t, err)
+		for _, entry := range entries {
+			if entry.Remote() == dir {
+				// Only reading it needs a HEAD
+				recorder(f).count("")
+				entry.ModTime()
+				assert.Equal(t, 0, recorder(f).count("HEAD"))
+				modTime := fs.DirModTime(entry)
+				assert.Equal(t, 1, recorder(f).count("HEAD"))
+				return modTime
+			}
+		}
+		t.Fatalf("directory %q not found", dir)
+		return time.Time{}
+	}
+
+	// Directories without markers have no modification time
+	assert.WithinDuration(t, time.Now(), dirModTime("dir"), time.Minute)
+	assert.Equal(t, fs.ErrorDirNotFound, f.DirSetModTime("missing", modTime))
+
+	// Setting it makes a marker which is read back
+	require.NoError(t, f.DirSetModTime("dir", modTime))
+	info, _, err := f.c.Object(f.container, "dir/")
+	require.NoError(t, err)
+	assert.Equal(t, directoryMarkerContentType, info.ContentType)
+	assert.True(t, modTime.Equal(dirModTime("dir")))
+	assert.Equal(t, []string{"dir/", "dir/file"}, listAll(t, f, ""))
+
+	// Setting it again updates the marker
+	modTime = modTime.Add(time.Hour)
+	require.NoError(t, f.DirSetModTime("dir", modTime))
+	assert.True(t, modTime.Equal(dirModTime("dir")))
+
+	// Rmdir removes the marker once the directory is empty
+	require.NoError(t, f.Rmdir("dir"))
+	_, _, err = f.c.Object(f.container, "dir/")
+	require.NoError(t, err)
+	require.NoError(t, f.c.ObjectDelete(f.container, "dir/file"))
+	require.NoError(t, f.Rmdir("dir"))
+	_, _, err = f.c.Object(f.container, "dir/")
+	assert.Equal(t, swift.ObjectNotFound, err)
+}
+
+func TestInternalMkdirMarker(t *testing.T) {
+	f, _, cleanup := newTestFs(t, "container")
+	defer cleanup()
+
+	// Mkdir of an empty directory makes a marker
+	require.NoError(t, f.Mkdir("empty"))
+	info, _, err := f.c.Object(f.container, "empty/")
+	require.NoError(t, err)
+	assert.Equal(t, directoryMarkerContentType, info.ContentType)
+	entries, err := f.List("")
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "empty", entries[0].Remote())
+
+	// But not if the directory has objects in
+	require.NoError(t, f.c.ObjectPutString(f.container, "dir/file", "hello", "text/plain"))
+	require.NoError(t, f.Mkdir("dir"))
+	_, _, err = f.c.Object(f.container, "dir/")
+	assert.Equal(t, swift.ObjectNotFound, err)
+	assert.Equal(t, []string{"dir/", "dir/file", "empty/"}, listAll(t, f, ""))
+
+	// Rmdir removes the marker again
+	require.NoError(t, f.Rmdir("empty"))
+	assert.Equal(t, []string{"dir/", "dir/file"}, listAll(t, f, ""))
+
+	// Mkdir of the root of a Fs in a directory makes its marker
+	subF, err := NewFsWithConnection(testRemote, "container/sub", f.c, false)
+	require.NoError(t, err)
+	require.NoError(t, subF.Mkdir(""))
+	info, _, err = f.c.Object(f.container, "sub/")
+	require.NoError(t, err)
+	assert.Equal(t, directoryMarkerContentType, info.ContentType)
+	require.NoError(t, subF.Rmdir(""))
+	assert.Equal(t, []string{"dir/", "dir/file"}, listAll(t, f, ""))
+
+	// ...but uploads into it don't
+	src := fs.NewStaticObjectInfo("file", time.Now(), 5, true, nil, nil)
+	_, err = subF.Put(strings.NewReader("hello"), src)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"dir/", "dir/file", "sub/", "sub/file"}, listAll(t, f, ""))
+	_, _, err = f.c.Object(f.container, "sub/")
+	assert.Equal(t, swift.ObjectNotFound, err)
+}
+
+// forbidReads makes the swifttest server forbid everything but PUTs
+// of objects at urlPath, and PUTs of the container too if container
+// is set
+func forbidReads(srv *swifttest.SwiftServer, urlPath string, container bool) {
+	srv.SetOverride(urlPath, func(w http.ResponseWriter, r *http.Request, recorder *httptest.ResponseRecorder) {
+		if r.Method != "PUT" || container {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		for k, v := range recorder.HeaderMap {
+			w.Header()[k] = v
+		}
+		w.WriteHeader(recorder.Code)
+		_, _ = w.Write(recorder.Body.Bytes())
+	})
+}
+
+func TestInternalWriteOnlyContainer(t *testing.T) {
+	f, srv, cleanup := newTestFs(t, "container")
+	defer cleanup()
+	require.NoError(t, f.Mkdir(""))
+	forbidReads(srv, accountPath+"/container", true)
+	forbidReads(srv, accountPath+"/container/dir", false)
+	forbidReads(srv, accountPath+"/container/dir/file.txt", false)
+	src := fs.NewStaticObjectInfo("file.txt", time.Unix(1500000000, 0), 5, true, nil, nil)
+
+	// Without no_check_container nothing works
+	newF, err := NewFsWithConnection(testRemote, "container/dir", f.c, false)
+	require.NoError(t, err)
+	_, err = newF.Put(strings.NewReader("hello"), src)
+	require.Error(t, err)
+
+	defer setTestConfig(t, "no_check_container", "true")()
+	// Forget the container exists so it is created again
+	containers.forget(f.c.StorageUrl + "/container")
+	recorder(f).all()
+	newF, err = NewFsWithConnection(testRemote, "container/dir", f.c, false)
+	require.NoError(t, err)
+	assert.Equal(t, 0, recorder(f).count("HEAD"), "doesn't check the root is an object")
+
+	// Objects which can't be read are missing so are uploaded
+	_, err = newF.NewObject("file.txt")
+	assert.Equal(t, fs.ErrorObjectNotFound, err)
+	o, err := newF.Put(strings.NewReader("hello"), src)
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), o.Size())
+	assert.True(t, o.ModTime().Equal(src.ModTime()))
+	hash, err := o.Hash(fs.HashMD5)
+	require.NoError(t, err)
+	assert.Equal(t, "5d41402abc4b2a76b9719d911017c592", hash)
+	assert.Contains(t, recorder(f).all(), "PUT "+accountPath+"/container")
+	srv.UnsetOverride(accountPath + "/container/dir/file.txt")
+	o, err = f.NewObject("dir/file.txt")
+	require.NoError(t, err)
+	got, err := readObject(t, o)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", got)
+
+	// Listing says why it failed
+	_, err = newF.List("")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "the credentials may not have permission to list it")
+}
+
+func TestInternalIgnoreChecksum(t *testing.T) {
+	oldIgnoreChecksum := fs.Config.IgnoreChecksum
+	defer func() { fs.Config.IgnoreChecksum = oldIgnoreChecksum }()
+	f, srv, cleanup := newTestFs(t, "container")
+	defer cleanup()
+	require.NoError(t, f.Mkdir(""))
+
+	// Rewrite the data like a compressing middleware would so the
+	// ETag doesn't match what was sent
+	objectPath := "/v1/AUTH_" + swifttest.TEST_ACCOUNT + "/container/file.txt"
+	srv.SetOverride(objectPath, func(w http.ResponseWriter, r *http.Request, recorder *httptest.ResponseRecorder) {
+		for k, v := range recorder.HeaderMap {
+			w.Header()[k] = v
+		}
+		if r.Method == "PUT" {
+			w.Header().Set("Etag", "00000000000000000000000000000000")
+		}
+		w.WriteHeader(recorder.Code)
+		_, _ = w.Write(bytes.ToUpper(recorder.Body.Bytes()))
+	})
+	defer srv.UnsetOverride(objectPath)
+	put := func() (fs.Object, error) {
+		src := fs.NewStaticObjectInfo("file.txt", time.Now(), 5, true, nil, nil)
+		return f.Put(strings.NewReader("hello"), src)
+	}
+
+	// Uploads and downloads are checked normally
+	fs.Config.IgnoreChecksum = false
+	_, err := put()
+	require.Error(t, err)
+	o, err := f.NewObject("file.txt")
+	require.NoError(t, err)
+	_, err = readObject(t, o)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "md5 hashes differ")
+
+	// But only their sizes with --ignore-checksum
+	fs.Config.IgnoreChecksum = true
+	_, err = put()
+	require.NoError(t, err)
+	got, err := readObject(t, o)
+	require.NoError(t, err)
+	assert.Equal(t, "HELLO", got)
+}
+
+func TestInternalChunkSizeOverride(t *testing.T) {
+	oldChunkSize := chunkSize
+	chunkSize = 4
+	defer func() { chunkSize = oldChunkSize }()
+	f, _, cleanup := newTestFs(t, "container")
+	defer cleanup()
+	require.NoError(t, f.Mkdir(""))
+	assert.Equal(t, fs.SizeSuffix(4), f.getChunkSize())
+
+	// chunk_size for the remote overrides --swift-chunk-size
+	defer setTestConfig(t, "chunk_size", "8b")()
+	newF, err := NewFsWithConnection(testRemote, "container", f.c, false)
+	require.NoError(t, err)
+	f8 := newF.(*Fs)
+	assert.Equal(t, fs.SizeSuffix(8), f8.getChunkSize())
+	src := fs.NewStaticObjectInfo("large", time.Now(), 10, true, nil, nil)
+	_, err = f8.Put(strings.NewReader("0123456789"), src)
+	require.NoError(t, err)
+	segments, err := f.c.ObjectNamesAll(f.segmentsContainer, nil)
+	require.NoError(t, err)
+	assert.Len(t, segments, 2)
+
+	defer setTestConfig(t, "chunk_size", "potato")()
+	_, err = NewFsWithConnection(testRemote, "container", f.c, false)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "bad chunk_size")
+}
+
+func TestInternalPaceOverride(t *testing.T) {
+	f, _, cleanup := newTestFs(t, "container")
+	defer cleanup()
+	newF, err := NewFsWithConnection(testRemote, "container", f.c, false)
+	require.NoError(t, err)
+	assert.Equal(t, *pace, newF.(*Fs).pacer.GetSleep())
+
+	// pace for the remote overrides --swift-pace
+	defer setTestConfig(t, "pace", "25ms")()
+	newF, err = NewFsWithConnection(testRemote, "container", f.c, false)
+	require.NoError(t, err)
+	assert.Equal(t, 25*time.Millisecond, newF.(*Fs).pacer.GetSleep())
+
+	defer setTestConfig(t, "pace", "potato")()
+	_, err = NewFsWithConnection(testRemote, "container", f.c, false)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "bad pace")
 }
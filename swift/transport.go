@@ -0,0 +1,137 @@
+package swift
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/pkg/errors"
+)
+
+// transportOptions are the per remote HTTP transport settings read
+// from the config
+type transportOptions struct {
+	caCert             string // path to the CA certificate bundle
+	clientCert         string // path to the client certificate
+	clientKey          string // path to the client key
+	insecureSkipVerify bool   // don't verify the server certificate
+	proxyURL           string // proxy to use instead of the environment
+	userAgent          string // User-Agent to send instead of --user-agent
+}
+
+// readTransportOptions reads the transport options for the remote
+// name from the config
+func readTransportOptions(name string) transportOptions {
+	return transportOptions{
+		caCert:             fs.ConfigFileGet(name, "ca_cert"),
+		clientCert:         fs.ConfigFileGet(name, "client_cert"),
+		clientKey:          fs.ConfigFileGet(name, "client_key"),
+		insecureSkipVerify: fs.ConfigFileGetBool(name, "insecure_skip_verify", false),
+		proxyURL:           fs.ConfigFileGet(name, "proxy_url"),
+		userAgent:          fs.ConfigFileGet(name, "user_agent"),
+	}
+}
+
+// tlsIsSet returns true if any of the TLS options differ from the
+// defaults
+func (opt *transportOptions) tlsIsSet() bool {
+	return opt.caCert != "" || opt.clientCert != "" || opt.clientKey != "" || opt.insecureSkipVerify
+}
+
+// isSet returns true if any of the options differ from the defaults
+func (opt *transportOptions) isSet() bool {
+	return opt.tlsIsSet() || opt.proxyURL != "" || opt.userAgent != ""
+}
+
+// tlsConfig makes a tls.Config from the options, reading and checking
+// the certificate files so that mistakes are reported up front.
+//
+// It starts from the global TLS config so any options which aren't
+// set for the remote come from the command line flags.
+func (opt *transportOptions) tlsConfig() (*tls.Config, error) {
+	config := fs.Config.TLSClientConfig()
+	if opt.insecureSkipVerify {
+		config.InsecureSkipVerify = true
+	}
+	if opt.caCert != "" {
+		pem, err := ioutil.ReadFile(opt.caCert)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read ca_cert %q", opt.caCert)
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, errors.Errorf("no PEM encoded certificates found in ca_cert %q", opt.caCert)
+		}
+	}
+	if (opt.clientCert == "") != (opt.clientKey == "") {
+		return nil, errors.New("client_cert and client_key must be set together")
+	}
+	if opt.clientCert != "" {
+		cert, err := tls.LoadX509KeyPair(opt.clientCert, opt.clientKey)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to load client_cert %q and client_key %q", opt.clientCert, opt.clientKey)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+// proxy parses and checks the proxy_url option
+func (opt *transportOptions) proxy() (*url.URL, error) {
+	u, err := url.Parse(opt.proxyURL)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to parse proxy_url %q", opt.proxyURL)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5":
+	default:
+		return nil, errors.Errorf("proxy_url %q must use the http, https or socks5 scheme", opt.proxyURL)
+	}
+	if u.Host == "" {
+		return nil, errors.Errorf("proxy_url %q has no host", opt.proxyURL)
+	}
+	return u, nil
+}
+
+// newTransport returns the http.RoundTripper to use for the remote
+// name.
+//
+// This is the shared transport unless the remote has options which
+// need a dedicated one.
+func newTransport(name string) (http.RoundTripper, error) {
+	opt := readTransportOptions(name)
+	if !opt.isSet() {
+		return fs.Config.Transport(), nil
+	}
+	var config *tls.Config
+	if opt.tlsIsSet() {
+		var err error
+		config, err = opt.tlsConfig()
+		if err != nil {
+			return nil, err
+		}
+	}
+	var proxyURL *url.URL
+	if opt.proxyURL != "" {
+		var err error
+		proxyURL, err = opt.proxy()
+		if err != nil {
+			return nil, err
+		}
+	}
+	transport := fs.Config.NewTransportCustom(func(t *http.Transport) {
+		if config != nil {
+			t.TLSClientConfig = config
+		}
+		if proxyURL != nil {
+			t.Proxy = http.ProxyURL(proxyURL)
+		}
+	})
+	if opt.userAgent != "" {
+		transport.SetUserAgent(opt.userAgent)
+	}
+	return transport, nil
+}
@@ -0,0 +1,210 @@
+package swift
+
+import (
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setConfig sets the config key for the remote name via the environment
+func setConfig(t *testing.T, name, key, value string) {
+	envKey := "RCLONE_CONFIG_" + name + "_" + key
+	require.NoError(t, os.Setenv(envKey, value))
+}
+
+// unsetConfig removes the config keys set with setConfig
+func unsetConfig(name string, keys ...string) {
+	for _, key := range keys {
+		_ = os.Unsetenv("RCLONE_CONFIG_" + name + "_" + key)
+	}
+}
+
+func TestNewTransportDefault(t *testing.T) {
+	fs.LoadConfig()
+	transport, err := newTransport("TESTTLSDEFAULT")
+	require.NoError(t, err)
+	assert.Equal(t, fs.Config.Transport(), transport)
+}
+
+func TestNewTransportErrors(t *testing.T) {
+	fs.LoadConfig()
+	const name = "TESTTLSERRORS"
+	defer unsetConfig(name, "CA_CERT", "CLIENT_CERT", "CLIENT_KEY")
+	dir, err := ioutil.TempDir("", "rclone-swift-tls")
+	require.NoError(t, err)
+	defer func() { _ = os.RemoveAll(dir) }()
+	notPEM := filepath.Join(dir, "not.pem")
+	require.NoError(t, ioutil.WriteFile(notPEM, []byte("potato"), 0600))
+	missing := filepath.Join(dir, "missing.pem")
+
+	for _, test := range []struct {
+		caCert, clientCert, clientKey string
+		want                          string
+	}{
+		{caCert: missing, want: "failed to read ca_cert"},
+		{caCert: notPEM, want: "no PEM encoded certificates found in ca_cert"},
+		{clientCert: notPEM, want: "client_cert and client_key must be set together"},
+		{clientKey: notPEM, want: "client_cert and client_key must be set together"},
+		{clientCert: missing, clientKey: missing, want: "failed to load client_cert"},
+	} {
+		setConfig(t, name, "CA_CERT", test.caCert)
+		setConfig(t, name, "CLIENT_CERT", test.clientCert)
+		setConfig(t, name, "CLIENT_KEY", test.clientKey)
+		_, err := newTransport(name)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), test.want)
+	}
+}
+
+func TestNewTransportCACert(t *testing.T) {
+	fs.LoadConfig()
+	const name = "TESTTLSCACERT"
+	defer unsetConfig(name, "CA_CERT")
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	// Without the CA the server certificate should be rejected
+	_, err := fs.Config.Client().Get(srv.URL)
+	require.Error(t, err)
+
+	dir, err := ioutil.TempDir("", "rclone-swift-tls")
+	require.NoError(t, err)
+	defer func() { _ = os.RemoveAll(dir) }()
+	caCert := filepath.Join(dir, "ca.pem")
+	pemBytes := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	require.NoError(t, ioutil.WriteFile(caCert, pemBytes, 0600))
+	setConfig(t, name, "CA_CERT", caCert)
+
+	transport, err := newTransport(name)
+	require.NoError(t, err)
+	assert.NotEqual(t, fs.Config.Transport(), transport)
+	resp, err := (&http.Client{Transport: transport}).Get(srv.URL)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+}
+
+func TestNewTransportProxyErrors(t *testing.T) {
+	fs.LoadConfig()
+	const name = "TESTPROXYERRORS"
+	defer unsetConfig(name, "PROXY_URL")
+	for _, test := range []struct {
+		proxyURL string
+		want     string
+	}{
+		{"ftp://proxy.example.com", "must use the http, https or socks5 scheme"},
+		{"http://", "has no host"},
+		{"http://[::1", "failed to parse proxy_url"},
+	} {
+		setConfig(t, name, "PROXY_URL", test.proxyURL)
+		_, err := newTransport(name)
+		require.Error(t, err, test.proxyURL)
+		assert.Contains(t, err.Error(), test.want, test.proxyURL)
+	}
+}
+
+func TestNewTransportProxy(t *testing.T) {
+	fs.LoadConfig()
+	const name = "TESTPROXY"
+	defer unsetConfig(name, "PROXY_URL", "INSECURE_SKIP_VERIFY")
+
+	// A tiny proxy stub which answers every request itself,
+	// recording the URL it was asked for.
+	var proxied []string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = append(proxied, r.URL.String())
+		w.Header().Set("X-Proxied", "yes")
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer proxy.Close()
+	setConfig(t, name, "PROXY_URL", proxy.URL)
+	// Make sure the proxy composes with the TLS options
+	setConfig(t, name, "INSECURE_SKIP_VERIFY", "true")
+
+	transport, err := newTransport(name)
+	require.NoError(t, err)
+	resp, err := (&http.Client{Transport: transport}).Get("http://swift.example.invalid/v1/AUTH_test")
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, "yes", resp.Header.Get("X-Proxied"))
+	assert.Equal(t, []string{"http://swift.example.invalid/v1/AUTH_test"}, proxied)
+
+	// Check the TLS options were applied too
+	httpTransport := transport.(*fs.Transport).Transport
+	require.NotNil(t, httpTransport.TLSClientConfig)
+	assert.True(t, httpTransport.TLSClientConfig.InsecureSkipVerify)
+}
+
+func TestNewTransportUserAgent(t *testing.T) {
+	fs.LoadConfig()
+	const name = "TESTUSERAGENT"
+	defer unsetConfig(name, "USER_AGENT", "AUTH", "USER", "KEY")
+	var userAgents []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userAgents = append(userAgents, r.Header.Get("User-Agent"))
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer srv.Close()
+	setConfig(t, name, "USER_AGENT", "team-potato/1.0")
+	setConfig(t, name, "AUTH", srv.URL+"/v1.0")
+	setConfig(t, name, "USER", "user")
+	setConfig(t, name, "KEY", "key")
+
+	// The auth requests use the User-Agent too
+	_, err := swiftConnection(name)
+	require.Error(t, err)
+	require.NotEmpty(t, userAgents)
+	for _, userAgent := range userAgents {
+		assert.Equal(t, "team-potato/1.0", userAgent)
+	}
+
+	// Other remotes are unaffected
+	transport, err := newTransport("TESTTLSDEFAULT")
+	require.NoError(t, err)
+	assert.Equal(t, fs.Config.Transport(), transport)
+}
+
+func TestNewTransportGlobalTLS(t *testing.T) {
+	fs.LoadConfig()
+	const name = "TESTTLSGLOBAL"
+	defer unsetConfig(name, "INSECURE_SKIP_VERIFY")
+	oldCaCert := fs.Config.CaCert
+	defer func() {
+		fs.Config.CaCert = oldCaCert
+		require.NoError(t, fs.Config.LoadTLSConfig())
+	}()
+	setConfig(t, name, "INSECURE_SKIP_VERIFY", "true")
+
+	// The remote's TLS config starts from the loaded flags
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	srv.Close()
+	dir, err := ioutil.TempDir("", "rclone-swift-tls")
+	require.NoError(t, err)
+	defer func() { _ = os.RemoveAll(dir) }()
+	fs.Config.CaCert = filepath.Join(dir, "ca.pem")
+	pemBytes := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	require.NoError(t, ioutil.WriteFile(fs.Config.CaCert, pemBytes, 0600))
+	require.NoError(t, fs.Config.LoadTLSConfig())
+
+	// The file isn't read again
+	require.NoError(t, os.Remove(fs.Config.CaCert))
+	transport, err := newTransport(name)
+	require.NoError(t, err)
+	httpTransport := transport.(*fs.Transport).Transport
+	require.NotNil(t, httpTransport.TLSClientConfig)
+	assert.NotNil(t, httpTransport.TLSClientConfig.RootCAs)
+	assert.True(t, httpTransport.TLSClientConfig.InsecureSkipVerify)
+
+	// The global config isn't changed by the remote's
+	assert.False(t, fs.Config.TLSClientConfig().InsecureSkipVerify)
+}